@@ -0,0 +1,20 @@
+#!/usr/bin/env bash
+
+# Copies the current schema and bundle of each package into its versions folder, then writes the list of published
+# versions to versions.json. Should be run after generate_bundles.sh so the bundle matches the schema
+INPUT_DIR="packages";
+cd $INPUT_DIR || exit;
+
+for packageDir in ./*; do
+  if [ -f "$packageDir/schema.json" ]; then
+    version=$(jq -r '.version' "$packageDir/schema.json");
+    echo "Publishing $packageDir $version";
+    mkdir -p "$packageDir/versions/$version";
+    cp "$packageDir/schema.json" "$packageDir/versions/$version/schema.json";
+    if [ -f "$packageDir/package.tar.gz" ]; then
+      cp "$packageDir/package.tar.gz" "$packageDir/versions/$version/package.tar.gz";
+    fi
+
+    ls -1 "$packageDir/versions" | jq -R . | jq -s . > "$packageDir/versions.json";
+  fi
+done
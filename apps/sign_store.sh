@@ -0,0 +1,22 @@
+#!/usr/bin/env bash
+
+# Signs the package list and every package file with the given ed25519 private key in PEM format, writing the base64
+# encoded signature of each file alongside it with a .sig extension. Should be run after all other generation scripts.
+# The public key for the STORE_PUBLIC_KEY environment variable is printed at the end
+KEY_FILE="$1";
+if [ -z "$KEY_FILE" ]; then
+  echo "Usage: $0 <private key file>";
+  exit 1;
+fi
+
+sign() {
+  openssl pkeyutl -sign -inkey "$KEY_FILE" -rawin -in "$1" | base64 -w 0 > "$1.sig";
+}
+
+sign list.json;
+find packages -type f \( -name schema.json -o -name versions.json -o -name package.tar.gz -o -name icon.png \) | while read -r file; do
+  echo "Signing $file";
+  sign "$file";
+done
+
+echo "Public key: $(openssl pkey -in "$KEY_FILE" -pubout -outform DER | tail -c 32 | base64 -w 0)";
@@ -1,7 +1,20 @@
 package main
 
-import "github.com/An-Owlbear/homecloud/backend/internal/server"
+import (
+	"fmt"
+	"os"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/server"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "drift" {
+		if err := server.DriftCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	server.CreateServer()
 }
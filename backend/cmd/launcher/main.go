@@ -55,7 +55,10 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	storeClient := apps.NewStoreClient(config.Store{StoreUrl: os.Getenv("SYSTEM_STORE_URL")})
+	storeClient := apps.NewStoreClient(config.Store{
+		StoreUrl:  os.Getenv("SYSTEM_STORE_URL"),
+		PublicKey: os.Getenv("SYSTEM_STORE_PUBLIC_KEY"),
+	})
 
 	// Starts containers and sets up networks
 	oryConfig, err := config.OryFromEnv()
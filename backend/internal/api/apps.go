@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 
@@ -13,14 +14,19 @@ import (
 
 	"github.com/An-Owlbear/homecloud/backend/internal/apps"
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
-	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
 	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
 	"github.com/An-Owlbear/homecloud/backend/internal/storage"
 )
 
 type InstalledApp struct {
 	apps.PackageListItem
-	Status string `json:"status"`
+	Status       string `json:"status"`
+	State        string `json:"state"`
+	StateMessage string `json:"state_message"`
+	UpdatePolicy string `json:"update_policy"`
+	Pinned       bool   `json:"pinned"`
+	Sideloaded   bool   `json:"sideloaded"`
 }
 
 func ListApps(queries *persistence.Queries) echo.HandlerFunc {
@@ -31,12 +37,32 @@ func ListApps(queries *persistence.Queries) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
 
+		// Retrieves the actual state of the apps' containers, recorded by the reconciler
+		states, err := queries.GetAppStates(c.Request().Context())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		appStates := make(map[string]persistence.AppState)
+		for _, state := range states {
+			appStates[state.AppID] = state
+		}
+
 		// returns them in a more compact format fit for lists
 		resList := make([]InstalledApp, 0)
 		for _, app := range appList {
+			state, ok := appStates[app.ID]
+			if !ok {
+				state.State = string(apps.StateFromStatus(app.Status))
+			}
+
 			resList = append(resList, InstalledApp{
 				PackageListItem: apps.NewPackageListItem(app),
 				Status:          app.Status,
+				State:           state.State,
+				StateMessage:    state.Message,
+				UpdatePolicy:    app.UpdatePolicy,
+				Pinned:          app.Pinned,
+				Sideloaded:      app.Sideloaded,
 			})
 		}
 
@@ -49,6 +75,7 @@ func StartApp(
 	queries *persistence.Queries,
 	hosts *apps.Hosts,
 	appDataHandler *storage.AppDataHandler,
+	reconciler *apps.Reconciler,
 	hostConfig config.Host,
 	oryConfig config.Ory,
 ) echo.HandlerFunc {
@@ -60,11 +87,14 @@ func StartApp(
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to start app")
 		}
 
+		// Starting the app manually gives it a fresh set of automatic restarts
+		reconciler.Reset(appId)
+
 		return c.String(200, "App started!")
 	}
 }
 
-func StopApp(dockerClient *client.Client, queries *persistence.Queries) echo.HandlerFunc {
+func StopApp(dockerClient *client.Client, queries *persistence.Queries, reconciler *apps.Reconciler) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		appId := c.Param("appId")
 		if appId == "" {
@@ -75,50 +105,113 @@ func StopApp(dockerClient *client.Client, queries *persistence.Queries) echo.Han
 		if err != nil {
 			return c.String(500, "Failed to stop app")
 		}
+		reconciler.Reset(appId)
 
 		return c.String(200, "App stopped!")
 	}
 }
 
 func UninstallApp(
-	queries *persistence.Queries,
 	dockerClient *client.Client,
+	queries *persistence.Queries,
 	hydraAdmin *hydra.APIClient,
+	hosts *apps.Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
 ) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		appId := c.Param("appId")
 
-		// Delete the oauth client for the app if there is one
-		app, err := queries.GetAppWithCreds(context.Background(), appId)
+		err := apps.UninstallApp(
+			c.Request().Context(),
+			dockerClient,
+			queries,
+			hydraAdmin,
+			hosts,
+			appDataHandler,
+			oryConfig,
+			hostConfig,
+			storageConfig,
+			dockerConfig,
+			appId,
+		)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return echo.NewHTTPError(http.StatusNotFound, "App not found")
 			}
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
-		if app.ClientID.Valid {
-			_, err = hydraAdmin.OAuth2API.DeleteOAuth2Client(c.Request().Context(), app.ClientID.String).Execute()
-			if err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-			}
+
+		return c.String(200, "App uninstalled!")
+	}
+}
+
+// SideloadApp installs an app from a package bundle uploaded in the bundle form field, for apps that aren't available
+// from any store
+func SideloadApp(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *apps.Hosts,
+	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		fileHeader, err := c.FormFile("bundle")
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Package bundle must be uploaded")
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		defer file.Close()
+		bundle, err := io.ReadAll(file)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
 
-		// Removes the app entry from the database
-		_, err = queries.RemoveApp(context.Background(), appId)
+		app, err := apps.ReadBundle(bundle)
 		if err != nil {
-			return c.String(500, err.Error())
+			return packageValidationError(err)
 		}
 
-		// Uninstalls the app deleting the docker resources
-		if err := docker.UninstallApp(dockerClient, appId); err != nil {
-			return c.String(500, err.Error())
+		// Checks if app is already installed before starting the install
+		_, err = queries.GetApp(c.Request().Context(), app.Id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		} else if err == nil {
+			return echo.NewHTTPError(http.StatusConflict, "App already exists")
 		}
 
-		// Removes volumes for app
-		if err := docker.RemoveAppVolumes(c.Request().Context(), dockerClient, appId); err != nil {
-			return c.String(500, err.Error())
+		job, err := jobManager.Start(jobs.Install, app.Id, func(ctx context.Context, progress jobs.Progress) error {
+			return apps.SideloadApp(
+				ctx,
+				progress,
+				dockerClient,
+				queries,
+				hydraAdmin,
+				hosts,
+				appDataHandler,
+				oryConfig,
+				hostConfig,
+				storageConfig,
+				dockerConfig,
+				app,
+				bundle,
+			)
+		})
+		if err != nil {
+			return jobStartError(err)
 		}
 
-		return c.String(200, "App uninstalled!")
+		return c.JSONPretty(http.StatusAccepted, job, "  ")
 	}
 }
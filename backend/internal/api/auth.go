@@ -226,7 +226,7 @@ func ListUsers(kratosAdminClient kratos.IdentityAPI) echo.HandlerFunc {
 	}
 }
 
-func DeleteUser(kratosIdentity kratos.IdentityAPI) echo.HandlerFunc {
+func DeleteUser(kratosIdentity kratos.IdentityAPI, queries *persistence.Queries) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		userId := c.Param("id")
 		err := auth.DeleteUser(c.Request().Context(), kratosIdentity, userId)
@@ -234,6 +234,14 @@ func DeleteUser(kratosIdentity kratos.IdentityAPI) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete user")
 		}
 
+		// Removes the user's notifications, which are of no use once they're deleted
+		if err := queries.DeleteUserNotifications(c.Request().Context(), userId); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete user notifications")
+		}
+		if err := queries.DeleteNotificationSubscriptions(c.Request().Context(), userId); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete user notifications")
+		}
+
 		return c.NoContent(http.StatusNoContent)
 	}
 }
@@ -363,6 +371,8 @@ func GetUserOptions(queries *persistence.Queries) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get user metadata")
 		}
 
+		// The webhook token is only returned with the notification settings, decrypted
+		options.WebhookToken = ""
 		return c.JSON(http.StatusOK, userOptionsResponse{
 			UserOption: options,
 			UserRoles:  userMetadata.Roles,
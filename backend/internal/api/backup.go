@@ -1,11 +1,14 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
 	"github.com/An-Owlbear/homecloud/backend/internal/apps"
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
 	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
 	"github.com/An-Owlbear/homecloud/backend/internal/storage"
 	"github.com/docker/docker/client"
@@ -23,34 +26,109 @@ func ListExternalStorage() echo.HandlerFunc {
 	}
 }
 
+// resolveTarget retrieves the request's backup target, converting errors to HTTP errors
+func resolveTarget(c echo.Context, targets *backup.TargetStore, name string, device string) (backup.TargetConfig, error) {
+	target, err := targets.Resolve(c.Request().Context(), name, device)
+	if errors.Is(err, backup.TargetNotFoundError) {
+		return backup.TargetConfig{}, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if errors.Is(err, backup.InvalidTargetError) {
+		return backup.TargetConfig{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return backup.TargetConfig{}, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return target, nil
+}
+
+// backupRequest specifies the target to back up to, either a configured target by name or a removable drive. The
+// passphrase replaces the target's passphrase, and is required for removable drives that aren't configured targets
 type backupRequest struct {
+	Target       string `json:"target"`
 	TargetDevice string `json:"target_device"`
+	Passphrase   string `json:"passphrase"`
 }
 
-func BackupApp(dockerClient *client.Client, storageConfig config.Storage) echo.HandlerFunc {
+func BackupApp(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
+	targets *backup.TargetStore,
+	storageConfig config.Storage,
+) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Retrieves request information
-		appId := c.Param("appId")
-		var request backupRequest
-		if err := c.Bind(&request); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-		}
+		return startBackup(c, dockerClient, queries, appDataHandler, jobManager, targets, storageConfig, c.Param("appId"))
+	}
+}
 
-		// Performs backup and returns response
-		err := apps.BackupApp(c.Request().Context(), dockerClient, storageConfig, appId, request.TargetDevice)
-		if err != nil {
+// BackupSystem backs up the database, identities and every app as a single backup, which can be restored by the
+// launcher when setting up a replacement device
+func BackupSystem(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
+	targets *backup.TargetStore,
+	storageConfig config.Storage,
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return startBackup(c, dockerClient, queries, appDataHandler, jobManager, targets, storageConfig, apps.SystemBackupId)
+	}
+}
+
+// startBackup starts a backup job for the request, backing up the app or the whole system
+func startBackup(
+	c echo.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
+	targets *backup.TargetStore,
+	storageConfig config.Storage,
+	appId string,
+) error {
+	// Retrieves request information
+	var request backupRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	target, err := resolveTarget(c, targets, request.Target, request.TargetDevice)
+	if err != nil {
+		return err
+	}
+	if request.Passphrase != "" {
+		target.Passphrase = request.Passphrase
+	}
+	if target.Passphrase == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, backup.NoPassphraseError.Error())
+	}
+
+	// Checks the drive is valid before starting the backup
+	if target.Type == backup.DriveTarget {
+		if _, err := storage.GetExternalPartition(target.Drive.Device); err != nil {
 			if errors.Is(err, storage.DriveInvalidError) {
 				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 			}
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
+	}
 
-		return c.NoContent(http.StatusNoContent)
+	// Performs backup in the background and returns the job
+	job, err := jobManager.Start(jobs.Backup, appId, func(ctx context.Context, progress jobs.Progress) error {
+		return apps.BackupApp(ctx, progress, dockerClient, queries, appDataHandler, storageConfig, appId, target)
+	})
+	if err != nil {
+		return jobStartError(err)
 	}
+
+	return c.JSONPretty(http.StatusAccepted, job, "  ")
 }
 
 type restoreRequest struct {
+	Target       string `json:"target"`
 	TargetDevice string `json:"target_device"`
+	Passphrase   string `json:"passphrase"`
 	Backup       string `json:"backup"`
 }
 
@@ -63,6 +141,8 @@ func RestoreApp(
 	storageConfig config.Storage,
 	oryConfig config.Ory,
 	dockerConfig config.Docker,
+	jobManager *jobs.Manager,
+	targets *backup.TargetStore,
 ) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		appId := c.Param("appId")
@@ -70,33 +150,137 @@ func RestoreApp(
 		if err := c.Bind(&request); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
+		target, err := resolveTarget(c, targets, request.Target, request.TargetDevice)
+		if err != nil {
+			return err
+		}
+		if request.Passphrase != "" {
+			target.Passphrase = request.Passphrase
+		}
 
-		err := apps.RestoreApp(c.Request().Context(), dockerClient, queries, hosts, appDataHandler, hostConfig, storageConfig, oryConfig, dockerConfig, appId, request.TargetDevice, request.Backup)
+		job, err := jobManager.Start(jobs.Restore, appId, func(ctx context.Context, progress jobs.Progress) error {
+			return apps.RestoreApp(ctx, progress, dockerClient, queries, hosts, appDataHandler, hostConfig, storageConfig, oryConfig, dockerConfig, appId, target, request.Backup)
+		})
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return jobStartError(err)
 		}
 
-		return c.NoContent(http.StatusNoContent)
+		return c.JSONPretty(http.StatusAccepted, job, "  ")
+	}
+}
+
+// VerifyBackup starts a job reading every archive of the backup, checking it against the manifest recorded when the
+// backup was made
+func VerifyBackup(queries *persistence.Queries, jobManager *jobs.Manager, targets *backup.TargetStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return startVerify(c, jobManager, targets, c.Param("appId"), func(ctx context.Context, progress jobs.Progress, target backup.TargetConfig, snapshot string) error {
+			return apps.VerifyBackup(ctx, progress, queries, c.Param("appId"), target, snapshot)
+		})
 	}
 }
 
+// VerifySystemBackup verifies a system backup the same as VerifyBackup
+func VerifySystemBackup(queries *persistence.Queries, jobManager *jobs.Manager, targets *backup.TargetStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return startVerify(c, jobManager, targets, apps.SystemBackupId, func(ctx context.Context, progress jobs.Progress, target backup.TargetConfig, snapshot string) error {
+			return apps.VerifyBackup(ctx, progress, queries, apps.SystemBackupId, target, snapshot)
+		})
+	}
+}
+
+// TestRestoreBackup starts a job restoring the backup alongside the installed app, checking the restored app's
+// containers become healthy before removing it
+func TestRestoreBackup(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	oryConfig config.Ory,
+	dockerConfig config.Docker,
+	jobManager *jobs.Manager,
+	targets *backup.TargetStore,
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		appId := c.Param("appId")
+		return startVerify(c, jobManager, targets, appId, func(ctx context.Context, progress jobs.Progress, target backup.TargetConfig, snapshot string) error {
+			return apps.TestRestoreBackup(ctx, progress, dockerClient, queries, appDataHandler, hostConfig, storageConfig, oryConfig, dockerConfig, appId, target, snapshot)
+		})
+	}
+}
+
+// startVerify starts a verify job checking the backup named in the request path, stored on the request's target
+func startVerify(
+	c echo.Context,
+	jobManager *jobs.Manager,
+	targets *backup.TargetStore,
+	appId string,
+	verify func(ctx context.Context, progress jobs.Progress, target backup.TargetConfig, snapshot string) error,
+) error {
+	var request backupRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	target, err := resolveTarget(c, targets, request.Target, request.TargetDevice)
+	if err != nil {
+		return err
+	}
+	if request.Passphrase != "" {
+		target.Passphrase = request.Passphrase
+	}
+	if target.Passphrase == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, backup.NoPassphraseError.Error())
+	}
+
+	snapshot := c.Param("backup")
+	job, err := jobManager.Start(jobs.Verify, appId, func(ctx context.Context, progress jobs.Progress) error {
+		return verify(ctx, progress, target, snapshot)
+	})
+	if err != nil {
+		return jobStartError(err)
+	}
+
+	return c.JSONPretty(http.StatusAccepted, job, "  ")
+}
+
 type listBackupsRequest struct {
+	Target       string `query:"target"`
 	TargetDevice string `query:"target_device"`
 }
 
-func ListBackups() echo.HandlerFunc {
+func ListBackups(targets *backup.TargetStore) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		var request listBackupsRequest
-		if err := c.Bind(&request); err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-		}
-		appId := c.Param("appId")
+		return listBackups(c, targets, c.Param("appId"))
+	}
+}
 
-		backups, err := storage.ListBackups(request.TargetDevice, appId)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+// ListSystemBackups lists the system backups stored on the target
+func ListSystemBackups(targets *backup.TargetStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return listBackups(c, targets, apps.SystemBackupId)
+	}
+}
 
-		return c.JSONPretty(http.StatusOK, backups, "  ")
+func listBackups(c echo.Context, targets *backup.TargetStore, appId string) error {
+	var request listBackupsRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	targetConfig, err := resolveTarget(c, targets, request.Target, request.TargetDevice)
+	if err != nil {
+		return err
 	}
+
+	target, err := backup.Open(c.Request().Context(), targetConfig)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	defer target.Close()
+
+	backups, err := backup.ListSnapshots(c.Request().Context(), target, appId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSONPretty(http.StatusOK, backups, "  ")
 }
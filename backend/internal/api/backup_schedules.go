@@ -0,0 +1,229 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/apps"
+	"github.com/An-Owlbear/homecloud/backend/internal/cron"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// backupScheduleRequest is a new or replacement schedule. An empty app ID backs up every installed app. TestRestore
+// test restores each backup after it's made
+type backupScheduleRequest struct {
+	AppID       string `json:"app_id"`
+	Cron        string `json:"cron"`
+	Target      string `json:"target"`
+	KeepDaily   int64  `json:"keep_daily"`
+	KeepWeekly  int64  `json:"keep_weekly"`
+	KeepMonthly int64  `json:"keep_monthly"`
+	Enabled     bool   `json:"enabled"`
+	TestRestore bool   `json:"test_restore"`
+}
+
+func newBackupScheduleRequest() backupScheduleRequest {
+	return backupScheduleRequest{KeepDaily: 7, KeepWeekly: 4, KeepMonthly: 6, Enabled: true}
+}
+
+// validateBackupSchedule checks the schedule's fields, and that the app and backup target exist. Schedules can also back
+// up the whole system using the system backup ID. The target isn't connected to, so schedules for drives that are
+// currently unplugged can still be edited
+func validateBackupSchedule(c echo.Context, queries *persistence.Queries, request backupScheduleRequest) error {
+	if _, err := cron.Parse(request.Cron); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if request.KeepDaily < 0 || request.KeepWeekly < 0 || request.KeepMonthly < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Retention counts can't be negative")
+	}
+
+	if request.AppID != "" && request.AppID != apps.SystemBackupId {
+		if _, err := queries.GetApp(c.Request().Context(), request.AppID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusBadRequest, "App not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	if _, err := queries.GetBackupTarget(c.Request().Context(), request.Target); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Backup target not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return nil
+}
+
+func parseScheduleId(c echo.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid schedule ID")
+	}
+	return id, nil
+}
+
+func ListBackupSchedules(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		schedules, err := queries.GetBackupSchedules(c.Request().Context())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if schedules == nil {
+			schedules = []persistence.BackupSchedule{}
+		}
+
+		return c.JSONPretty(http.StatusOK, schedules, "  ")
+	}
+}
+
+func CreateBackupSchedule(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := newBackupScheduleRequest()
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err := validateBackupSchedule(c, queries, request); err != nil {
+			return err
+		}
+
+		schedule, err := queries.CreateBackupSchedule(c.Request().Context(), persistence.CreateBackupScheduleParams{
+			AppID:       request.AppID,
+			Cron:        request.Cron,
+			Target:      request.Target,
+			KeepDaily:   request.KeepDaily,
+			KeepWeekly:  request.KeepWeekly,
+			KeepMonthly: request.KeepMonthly,
+			Enabled:     request.Enabled,
+			TestRestore: request.TestRestore,
+			CreatedAt:   time.Now().Unix(),
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusCreated, schedule, "  ")
+	}
+}
+
+func UpdateBackupSchedule(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := parseScheduleId(c)
+		if err != nil {
+			return err
+		}
+		if _, err := queries.GetBackupSchedule(c.Request().Context(), id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "Schedule not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		request := newBackupScheduleRequest()
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err := validateBackupSchedule(c, queries, request); err != nil {
+			return err
+		}
+
+		_, err = queries.UpdateBackupSchedule(c.Request().Context(), persistence.UpdateBackupScheduleParams{
+			AppID:       request.AppID,
+			Cron:        request.Cron,
+			Target:      request.Target,
+			KeepDaily:   request.KeepDaily,
+			KeepWeekly:  request.KeepWeekly,
+			KeepMonthly: request.KeepMonthly,
+			Enabled:     request.Enabled,
+			TestRestore: request.TestRestore,
+			ID:          id,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		schedule, err := queries.GetBackupSchedule(c.Request().Context(), id)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSONPretty(http.StatusOK, schedule, "  ")
+	}
+}
+
+func DeleteBackupSchedule(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := parseScheduleId(c)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := queries.DeleteBackupSchedule(c.Request().Context(), id)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if deleted == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "Schedule not found")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// RunBackupSchedule runs the schedule immediately, regardless of whether it's enabled. The backups run in the
+// background and can be followed through their jobs and the backup history
+func RunBackupSchedule(queries *persistence.Queries, scheduler *apps.BackupScheduler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := parseScheduleId(c)
+		if err != nil {
+			return err
+		}
+		schedule, err := queries.GetBackupSchedule(c.Request().Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "Schedule not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		if !scheduler.RunNow(schedule) {
+			return echo.NewHTTPError(http.StatusConflict, "Schedule is already running")
+		}
+
+		return c.NoContent(http.StatusAccepted)
+	}
+}
+
+type backupHistoryRequest struct {
+	AppID      string `query:"app_id"`
+	ScheduleID int64  `query:"schedule_id"`
+	Limit      int64  `query:"limit"`
+}
+
+// GetBackupHistory lists past backups, newest first, optionally filtered to an app or schedule
+func GetBackupHistory(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := backupHistoryRequest{Limit: 50}
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		history, err := queries.GetBackupHistory(c.Request().Context(), persistence.GetBackupHistoryParams{
+			AppID:      request.AppID,
+			ScheduleID: request.ScheduleID,
+			Limit:      request.Limit,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if history == nil {
+			history = []persistence.BackupHistory{}
+		}
+
+		return c.JSONPretty(http.StatusOK, history, "  ")
+	}
+}
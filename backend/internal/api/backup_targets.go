@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+)
+
+// targetError converts errors from the target store to HTTP errors
+func targetError(err error) error {
+	switch {
+	case errors.Is(err, backup.TargetNotFoundError):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, backup.TargetExistsError), errors.Is(err, backup.TargetInUseError):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, backup.InvalidTargetError):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
+
+// ListBackupTargets lists the configured targets. Credentials are never returned
+func ListBackupTargets(targets *backup.TargetStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		configs, err := targets.List(c.Request().Context())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusOK, configs, "  ")
+	}
+}
+
+func CreateBackupTarget(targets *backup.TargetStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request backup.TargetConfig
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := targets.Create(c.Request().Context(), request); err != nil {
+			return targetError(err)
+		}
+
+		return c.JSONPretty(http.StatusCreated, request.Redacted(), "  ")
+	}
+}
+
+// UpdateBackupTarget replaces the target's config. Credentials left empty keep their existing values
+func UpdateBackupTarget(targets *backup.TargetStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request backup.TargetConfig
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		request.Name = c.Param("name")
+
+		if err := targets.Update(c.Request().Context(), request); err != nil {
+			return targetError(err)
+		}
+
+		return c.JSONPretty(http.StatusOK, request.Redacted(), "  ")
+	}
+}
+
+// DeleteBackupTarget removes the target's config. Backups already stored on the target aren't removed
+func DeleteBackupTarget(targets *backup.TargetStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := targets.Delete(c.Request().Context(), c.Param("name")); err != nil {
+			return targetError(err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// TestBackupTarget checks the target can be connected to and its backups listed
+func TestBackupTarget(targets *backup.TargetStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		config, err := targets.Get(c.Request().Context(), c.Param("name"))
+		if err != nil {
+			return targetError(err)
+		}
+
+		target, err := backup.Open(c.Request().Context(), config)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+		}
+		defer target.Close()
+
+		if _, err := target.List(c.Request().Context(), "backup/"); err != nil {
+			return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+type checkBackupTargetRequest struct {
+	ReadData bool `json:"read_data"`
+}
+
+// CheckBackupTarget verifies the backups in the target's repository in the background. Reading all data detects
+// corrupted backups, but downloads the whole repository. Checks are run as jobs for the target rather than an app, so
+// only one can run for each target at a time
+func CheckBackupTarget(targets *backup.TargetStore, jobManager *jobs.Manager) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request checkBackupTargetRequest
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		config, err := targets.Get(c.Request().Context(), c.Param("name"))
+		if err != nil {
+			return targetError(err)
+		}
+
+		job, err := jobManager.Start(jobs.Check, "target:"+config.Name, func(ctx context.Context, progress jobs.Progress) error {
+			return checkBackupTarget(ctx, progress, config, request.ReadData)
+		})
+		if err != nil {
+			return jobStartError(err)
+		}
+
+		return c.JSONPretty(http.StatusAccepted, job, "  ")
+	}
+}
+
+func checkBackupTarget(ctx context.Context, progress jobs.Progress, config backup.TargetConfig, readData bool) error {
+	progress.Step("Connecting to backup target")
+	target, err := backup.Open(ctx, config)
+	if err != nil {
+		return fmt.Errorf("error opening backup target %s: %w", config.Name, err)
+	}
+	defer target.Close()
+
+	repository, err := backup.OpenRepository(ctx, target, config, false)
+	if err != nil {
+		return fmt.Errorf("error opening backup repository on %s: %w", config.Name, err)
+	}
+
+	progress.Step("Checking backups")
+	result, err := repository.Check(ctx, readData)
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("found %d problems in %d snapshots: %s", len(result.Errors), result.Snapshots, strings.Join(result.Errors, "; "))
+	}
+	return nil
+}
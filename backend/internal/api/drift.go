@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/docker/docker/client"
+	"github.com/labstack/echo/v4"
+	hydra "github.com/ory/hydra-client-go/v2"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/apps"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+func GetDrift(dockerClient *client.Client, queries *persistence.Queries, hydraAdmin *hydra.APIClient) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		drift, err := apps.DetectDrift(c.Request().Context(), dockerClient, queries, hydraAdmin)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusOK, drift, "  ")
+	}
+}
+
+type repairDriftRequest struct {
+	Kind     apps.DriftKind    `json:"kind"`
+	AppID    string            `json:"app_id"`
+	Resource string            `json:"resource"`
+	Action   apps.RepairAction `json:"action"`
+}
+
+func RepairDrift(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *apps.Hosts,
+	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request repairDriftRequest
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		// Checks the drift still exists before starting the repair
+		target := apps.Drift{Kind: request.Kind, AppID: request.AppID, Resource: request.Resource}
+		drift, err := apps.FindDrift(c.Request().Context(), dockerClient, queries, hydraAdmin, target, request.Action)
+		if err != nil {
+			if errors.Is(err, apps.DriftNotFoundError) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			if errors.Is(err, apps.InvalidRepairError) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		job, err := jobManager.Start(jobs.Repair, drift.JobKey(), func(ctx context.Context, progress jobs.Progress) error {
+			return apps.RepairDrift(ctx, progress, dockerClient, queries, hydraAdmin, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, target, request.Action)
+		})
+		if err != nil {
+			return jobStartError(err)
+		}
+
+		return c.JSONPretty(http.StatusAccepted, job, "  ")
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	kratos "github.com/ory/kratos-client-go"
 
 	"github.com/An-Owlbear/homecloud/backend/internal/auth"
+	"github.com/An-Owlbear/homecloud/backend/internal/notifications"
 	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
 )
 
@@ -87,7 +89,7 @@ func CheckInvitationCode(queries *persistence.Queries) echo.HandlerFunc {
 }
 
 // CompleteInvite removes used invite code
-func CompleteInvite(queries *persistence.Queries, kratosAdmin kratos.IdentityAPI) echo.HandlerFunc {
+func CompleteInvite(queries *persistence.Queries, kratosAdmin kratos.IdentityAPI, notifier *notifications.Notifier) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		reqBody, err := io.ReadAll(c.Request().Body)
 		if err != nil {
@@ -137,6 +139,19 @@ func CompleteInvite(queries *persistence.Queries, kratosAdmin kratos.IdentityAPI
 			return c.JSON(http.StatusInternalServerError, makeWebhookError(105, "Error creating user settings in DB"))
 		}
 
+		// Lets admins know about the new user, identifying them by their account details where possible
+		userName := codeRequest.UserId
+		identity, _, err := kratosAdmin.GetIdentity(c.Request().Context(), codeRequest.UserId).Execute()
+		var traits auth.Traits
+		if err == nil && auth.ParseSessionData(identity.Traits, &traits) == nil {
+			userName = fmt.Sprintf("%s (%s)", traits.Name, traits.Email)
+		}
+		notifier.Notify(notifications.Notification{
+			Event:   notifications.UserRegistered,
+			Title:   "New user registered",
+			Message: fmt.Sprintf("%s has registered with an invite code", userName),
+		})
+
 		return c.JSON(http.StatusOK, webhookError{Messages: []webhookErrorMessage{}})
 	}
 }
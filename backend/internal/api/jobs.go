@@ -0,0 +1,118 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// jobStartError converts an error from starting a job to the appropriate HTTP error
+func jobStartError(err error) error {
+	if errors.Is(err, jobs.AppBusyError) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+type listJobsRequest struct {
+	AppId string `query:"app_id"`
+	Limit int64  `query:"limit"`
+}
+
+func ListJobs(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := listJobsRequest{Limit: 50}
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		jobList, err := queries.GetJobs(c.Request().Context(), request.AppId, request.Limit)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusOK, jobList, "  ")
+	}
+}
+
+func GetJob(jobManager *jobs.Manager) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		job, err := jobManager.Get(c.Request().Context(), c.Param("id"))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "Job not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusOK, job, "  ")
+	}
+}
+
+// JobEvents streams updates to the given job using server-sent events until the job finishes
+func JobEvents(jobManager *jobs.Manager) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+
+		// Subscribes before retrieving the current state so no updates are missed in between
+		updates, unsubscribe := jobManager.Subscribe(id)
+		defer unsubscribe()
+
+		job, err := jobManager.Get(c.Request().Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "Job not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		response := c.Response()
+		response.Header().Set(echo.HeaderContentType, "text/event-stream")
+		response.Header().Set(echo.HeaderCacheControl, "no-cache")
+		response.Header().Set(echo.HeaderConnection, "keep-alive")
+		response.WriteHeader(http.StatusOK)
+
+		if err := writeJobEvent(response, job); err != nil || jobs.IsFinished(job.Status) {
+			return err
+		}
+
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case update, ok := <-updates:
+				// When the channel is closed the job has finished, so the final state is sent from the database
+				if !ok {
+					finalJob, err := jobManager.Get(c.Request().Context(), id)
+					if err != nil {
+						return err
+					}
+					return writeJobEvent(response, finalJob)
+				}
+				if err := writeJobEvent(response, update); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func writeJobEvent(response *echo.Response, job persistence.JobDetails) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(response, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	response.Flush()
+	return nil
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/docker/docker/client"
+	"github.com/labstack/echo/v4"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/apps"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
+)
+
+type containerLimits struct {
+	Container string                     `json:"container"`
+	Package   *persistence.PackageLimits `json:"package"`
+	Override  *persistence.PackageLimits `json:"override"`
+}
+
+// GetLimits lists the resource limits of each of an app's containers, both those set by the package and by an admin
+func GetLimits(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		appId := c.Param("appId")
+		app, err := queries.GetApp(c.Request().Context(), appId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "App not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		overrides, err := queries.GetResourceLimits(c.Request().Context(), appId)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		overridesMap := make(map[string]persistence.ResourceLimit)
+		for _, override := range overrides {
+			overridesMap[override.Container] = override
+		}
+
+		limits := make([]containerLimits, len(app.Schema.Containers))
+		for i, appContainer := range app.Schema.Containers {
+			limits[i] = containerLimits{Container: appContainer.Name, Package: appContainer.Limits}
+			if override, ok := overridesMap[appContainer.Name]; ok {
+				limits[i].Override = &persistence.PackageLimits{
+					Memory: override.Memory,
+					Cpus:   override.Cpus,
+					Pids:   override.Pids,
+				}
+			}
+		}
+
+		return c.JSONPretty(http.StatusOK, limits, "  ")
+	}
+}
+
+type setLimitsRequest struct {
+	Container string  `json:"container"`
+	Memory    string  `json:"memory"`
+	Cpus      float64 `json:"cpus"`
+	Pids      int64   `json:"pids"`
+}
+
+// SetLimits replaces the resource limits set by an admin for an app's containers, overriding those set by the package.
+// Overrides are kept when the app is updated
+func SetLimits(dockerClient *client.Client, db *sql.DB, queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		appId := c.Param("appId")
+		var request []setLimitsRequest
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		overrides := make([]persistence.ResourceLimit, len(request))
+		for i, limits := range request {
+			overrides[i] = persistence.ResourceLimit{
+				AppID:     appId,
+				Container: limits.Container,
+				Memory:    limits.Memory,
+				Cpus:      limits.Cpus,
+				Pids:      limits.Pids,
+			}
+		}
+
+		err := apps.SetLimitOverrides(c.Request().Context(), dockerClient, db, queries, appId, overrides)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "App not found")
+			}
+			if errors.Is(err, apps.UnknownContainerError) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			var validationErr schema.ValidationError
+			if errors.As(err, &validationErr) {
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, validationErr)
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
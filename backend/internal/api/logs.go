@@ -0,0 +1,173 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/labstack/echo/v4"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// defaultLogTail is the number of lines returned from each container when viewing logs without a tail or since
+const defaultLogTail = "100"
+
+type logsRequest struct {
+	Containers []string `query:"container"`
+	Since      string   `query:"since"`
+	Until      string   `query:"until"`
+	Tail       string   `query:"tail"`
+}
+
+// logOptions parses the log filters in the request, checking the app and requested containers exist. When neither a
+// tail nor since are given the tail defaults to defaultTail
+func logOptions(c echo.Context, queries *persistence.Queries, defaultTail string) (docker.LogOptions, error) {
+	var request logsRequest
+	if err := c.Bind(&request); err != nil {
+		return docker.LogOptions{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	app, err := queries.GetApp(c.Request().Context(), c.Param("appId"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return docker.LogOptions{}, echo.NewHTTPError(http.StatusNotFound, "App not found")
+		}
+		return docker.LogOptions{}, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	for _, containerName := range request.Containers {
+		if !slices.ContainsFunc(app.Schema.Containers, func(c persistence.PackageContainer) bool {
+			return c.Name == containerName
+		}) {
+			return docker.LogOptions{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unknown container %s", containerName))
+		}
+	}
+
+	if request.Tail == "" && request.Since == "" {
+		request.Tail = defaultTail
+	}
+	if request.Tail != "" && request.Tail != "all" {
+		if tail, err := strconv.Atoi(request.Tail); err != nil || tail < 0 {
+			return docker.LogOptions{}, echo.NewHTTPError(http.StatusBadRequest, "tail must be a number of lines or all")
+		}
+	}
+
+	return docker.LogOptions{
+		Containers: request.Containers,
+		Since:      request.Since,
+		Until:      request.Until,
+		Tail:       request.Tail,
+	}, nil
+}
+
+// logsError converts errors from docker, such as invalid since and until values, to HTTP errors
+func logsError(err error) error {
+	if errdefs.IsInvalidParameter(err) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+// GetLogs retrieves the most recent logs of an app's containers, sorted by time
+func GetLogs(dockerClient *client.Client, queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		options, err := logOptions(c, queries, defaultLogTail)
+		if err != nil {
+			return err
+		}
+
+		lines := []docker.LogLine{}
+		err = docker.AppLogs(c.Request().Context(), dockerClient, c.Param("appId"), options, func(line docker.LogLine) error {
+			lines = append(lines, line)
+			return nil
+		})
+		if err != nil {
+			return logsError(err)
+		}
+
+		return c.JSONPretty(http.StatusOK, lines, "  ")
+	}
+}
+
+// LogEvents follows the logs of an app's containers, sending each line as a server sent event as it's written. The
+// most recent lines are sent first, the same as GetLogs
+func LogEvents(dockerClient *client.Client, queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		options, err := logOptions(c, queries, defaultLogTail)
+		if err != nil {
+			return err
+		}
+		options.Follow = true
+
+		response := c.Response()
+		response.Header().Set(echo.HeaderContentType, "text/event-stream")
+		response.Header().Set(echo.HeaderCacheControl, "no-cache")
+		response.Header().Set(echo.HeaderConnection, "keep-alive")
+		response.WriteHeader(http.StatusOK)
+
+		// Errors can't be returned as a status once the stream has started, so are sent as an error event instead
+		err = docker.AppLogs(c.Request().Context(), dockerClient, c.Param("appId"), options, func(line docker.LogLine) error {
+			return writeLogEvent(response, line)
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(response, "event: error\ndata: %s\n\n", err.Error())
+			response.Flush()
+		}
+		return nil
+	}
+}
+
+func writeLogEvent(response *echo.Response, line docker.LogLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(response, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	response.Flush()
+	return nil
+}
+
+// DownloadLogs downloads the logs of an app's containers as a text file, including every line unless filtered
+func DownloadLogs(dockerClient *client.Client, queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		options, err := logOptions(c, queries, "all")
+		if err != nil {
+			return err
+		}
+
+		appId := c.Param("appId")
+		response := c.Response()
+		headerWritten := false
+		err = docker.AppLogs(c.Request().Context(), dockerClient, appId, options, func(line docker.LogLine) error {
+			// Headers are only written once the logs have been read, so errors reading them can still be returned
+			if !headerWritten {
+				response.Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+				response.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.log"`, appId))
+				response.WriteHeader(http.StatusOK)
+				headerWritten = true
+			}
+			_, err := fmt.Fprintf(response, "%s %s %s: %s\n", line.Time.Format(time.RFC3339Nano), line.Container, line.Stream, line.Text)
+			return err
+		})
+		if err != nil && !headerWritten {
+			return logsError(err)
+		}
+		if !headerWritten {
+			response.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.log"`, appId))
+			return c.Blob(http.StatusOK, echo.MIMETextPlainCharsetUTF8, nil)
+		}
+		return err
+	}
+}
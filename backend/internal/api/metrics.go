@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/labstack/echo/v4"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/metrics"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// metricsRanges are the periods of history that can be requested for an app
+var metricsRanges = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+}
+
+type appMetricsRequest struct {
+	Range string `query:"range"`
+}
+
+type appMetricsResponse struct {
+	Current *metrics.Sample  `json:"current"`
+	History []metrics.Sample `json:"history"`
+}
+
+// GetAppMetrics retrieves the current resource usage of an app and its history over the requested range
+func GetAppMetrics(queries *persistence.Queries, collector *metrics.Collector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := appMetricsRequest{Range: "day"}
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		period, ok := metricsRanges[request.Range]
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unknown range %s", request.Range))
+		}
+
+		appId := c.Param("appId")
+		if _, err := queries.GetApp(c.Request().Context(), appId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "App not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		history, err := metrics.History(c.Request().Context(), queries, appId, period, time.Now())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		response := appMetricsResponse{History: history}
+		if current, ok := collector.Latest()[appId]; ok {
+			response.Current = &current
+		}
+
+		return c.JSONPretty(http.StatusOK, response, "  ")
+	}
+}
+
+// GetSystemMetrics retrieves the current resource usage of all apps and the disk space used by apps and docker
+func GetSystemMetrics(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	collector *metrics.Collector,
+	storageConfig config.Storage,
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		summary, err := metrics.Summary(c.Request().Context(), dockerClient, queries, collector, storageConfig)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusOK, summary, "  ")
+	}
+}
+
+// PrometheusMetrics serves metrics in the Prometheus text format, requiring the configured token as a bearer token
+// if one is set
+func PrometheusMetrics(exporter *metrics.Exporter, metricsConfig config.Metrics) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if metricsConfig.Token != "" {
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(metricsConfig.Token)) != 1 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid metrics token")
+			}
+		}
+
+		var buffer bytes.Buffer
+		if err := exporter.Write(c.Request().Context(), &buffer); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.Blob(http.StatusOK, metrics.ContentType, buffer.Bytes())
+	}
+}
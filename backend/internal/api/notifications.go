@@ -0,0 +1,239 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/auth"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/notifications"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+type listNotificationsRequest struct {
+	Unread bool  `query:"unread"`
+	Limit  int64 `query:"limit"`
+}
+
+type listNotificationsResponse struct {
+	Notifications []persistence.Notification `json:"notifications"`
+	Unread        int64                      `json:"unread"`
+}
+
+func ListNotifications(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cc := c.(*config.Context)
+		request := listNotificationsRequest{Limit: 50}
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		userId := cc.Session.Identity.Id
+		items, err := queries.ListNotifications(c.Request().Context(), persistence.ListNotificationsParams{
+			UserID:     userId,
+			UnreadOnly: request.Unread,
+			Limit:      request.Limit,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if items == nil {
+			items = []persistence.Notification{}
+		}
+
+		unread, err := queries.CountUnreadNotifications(c.Request().Context(), userId)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusOK, listNotificationsResponse{Notifications: items, Unread: unread}, "  ")
+	}
+}
+
+func ReadNotification(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cc := c.(*config.Context)
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid notification ID")
+		}
+
+		updated, err := queries.MarkNotificationRead(c.Request().Context(), persistence.MarkNotificationReadParams{
+			ID:     id,
+			UserID: cc.Session.Identity.Id,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if updated == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "Notification not found")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func ReadAllNotifications(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cc := c.(*config.Context)
+		if err := queries.MarkAllNotificationsRead(c.Request().Context(), cc.Session.Identity.Id); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func DeleteNotification(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cc := c.(*config.Context)
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid notification ID")
+		}
+
+		deleted, err := queries.DeleteNotification(c.Request().Context(), persistence.DeleteNotificationParams{
+			ID:     id,
+			UserID: cc.Session.Identity.Id,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if deleted == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "Notification not found")
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+type notificationChannel struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+}
+
+type notificationWebhook struct {
+	Url    string                      `json:"url"`
+	Format notifications.WebhookFormat `json:"format"`
+	Token  string                      `json:"token"`
+}
+
+type notificationSettingsResponse struct {
+	Events        []notifications.Event        `json:"events"`
+	Channels      []notificationChannel        `json:"channels"`
+	Subscriptions []notifications.Subscription `json:"subscriptions"`
+	Webhook       notificationWebhook          `json:"webhook"`
+}
+
+// GetNotificationSettings retrieves the user's subscriptions and webhook, along with which channels can currently be
+// used to send to them. Notifications are only sent to admins, so only admins have settings
+func GetNotificationSettings(queries *persistence.Queries, notifier *notifications.Notifier) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cc := c.(*config.Context)
+		userId := cc.Session.Identity.Id
+		options, err := queries.GetUserOptions(c.Request().Context(), userId)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get user options")
+		}
+		options, err = notifier.DecryptWebhook(options)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to decrypt webhook token")
+		}
+
+		subscriptions, err := notifier.Subscriptions(c.Request().Context(), userId)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		var traits auth.Traits
+		if err := auth.ParseSessionData(cc.Session.Identity.Traits, &traits); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get user details")
+		}
+		recipient := notifications.Recipient{UserID: userId, Email: traits.Email, Options: options}
+		var channels []notificationChannel
+		for _, channel := range notifier.Channels() {
+			channels = append(channels, notificationChannel{Name: channel.Name(), Available: channel.Available(recipient)})
+		}
+
+		return c.JSONPretty(http.StatusOK, notificationSettingsResponse{
+			Events:        notifications.Events,
+			Channels:      channels,
+			Subscriptions: subscriptions,
+			Webhook: notificationWebhook{
+				Url:    options.WebhookUrl,
+				Format: notifications.WebhookFormat(options.WebhookFormat),
+				Token:  options.WebhookToken,
+			},
+		}, "  ")
+	}
+}
+
+type updateNotificationSettingsRequest struct {
+	Subscriptions []notifications.Subscription `json:"subscriptions"`
+	Webhook       *notificationWebhook         `json:"webhook,omitempty"`
+}
+
+// UpdateNotificationSettings changes the given subscriptions, leaving the others unchanged, and replaces the webhook
+// if one is given
+func UpdateNotificationSettings(queries *persistence.Queries, notifier *notifications.Notifier) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cc := c.(*config.Context)
+		userId := cc.Session.Identity.Id
+		var request updateNotificationSettingsRequest
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid update request")
+		}
+
+		// Validates the whole request before saving any of it
+		channelNames := make(map[string]bool)
+		for _, channel := range notifier.Channels() {
+			channelNames[channel.Name()] = true
+		}
+		for _, subscription := range request.Subscriptions {
+			if !notifications.ValidEvent(subscription.Event) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Unknown event "+string(subscription.Event))
+			}
+			if !channelNames[subscription.Channel] {
+				return echo.NewHTTPError(http.StatusBadRequest, "Unknown channel "+subscription.Channel)
+			}
+		}
+		var webhookFormat notifications.WebhookFormat
+		if request.Webhook != nil {
+			var err error
+			webhookFormat, err = notifications.ParseWebhookFormat(string(request.Webhook.Format))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			if request.Webhook.Url != "" {
+				webhookUrl, err := url.Parse(request.Webhook.Url)
+				if err != nil || (webhookUrl.Scheme != "http" && webhookUrl.Scheme != "https") || webhookUrl.Host == "" {
+					return echo.NewHTTPError(http.StatusBadRequest, "Webhook URL must be an http or https URL")
+				}
+			}
+		}
+
+		for _, subscription := range request.Subscriptions {
+			err := queries.SetNotificationSubscription(c.Request().Context(), persistence.SetNotificationSubscriptionParams{
+				UserID:  userId,
+				Event:   string(subscription.Event),
+				Channel: subscription.Channel,
+				Enabled: subscription.Enabled,
+			})
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+		}
+
+		if request.Webhook != nil {
+			err := notifier.SetWebhook(c.Request().Context(), userId, request.Webhook.Url, webhookFormat, request.Webhook.Token)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
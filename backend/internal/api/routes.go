@@ -1,6 +1,7 @@
 package api
 
 import (
+	"database/sql"
 	"fmt"
 	"path/filepath"
 	"regexp"
@@ -14,7 +15,11 @@ import (
 
 	"github.com/An-Owlbear/homecloud/backend/internal/apps"
 	"github.com/An-Owlbear/homecloud/backend/internal/auth"
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/metrics"
+	"github.com/An-Owlbear/homecloud/backend/internal/notifications"
 	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
 	"github.com/An-Owlbear/homecloud/backend/internal/storage"
 )
@@ -28,6 +33,7 @@ type containerInfo struct {
 func AddRoutes(
 	e *echo.Echo,
 	docker *client.Client,
+	db *sql.DB,
 	queries *persistence.Queries,
 	storeClient *apps.StoreClient,
 	hosts *apps.Hosts,
@@ -35,6 +41,12 @@ func AddRoutes(
 	kratosClient *kratos.APIClient,
 	kratosIdentityAPI kratos.IdentityAPI,
 	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
+	metricsCollector *metrics.Collector,
+	reconciler *apps.Reconciler,
+	notifier *notifications.Notifier,
+	backupTargets *backup.TargetStore,
+	backupScheduler *apps.BackupScheduler,
 	serverConfig config.Config,
 	launcherProxy echo.MiddlewareFunc,
 ) {
@@ -47,33 +59,85 @@ func AddRoutes(
 
 	api.GET("/v1/packages", ListPackages(queries))
 	api.GET("/v1/packages/:id", GetPackage(queries))
+	api.GET("/v1/packages/:id/versions", ListPackageVersions(storeClient))
+	api.GET("/v1/packages/:id/icon", GetPackageIcon(storeClient))
 	api.GET("/v1/packages/search", SearchPackages(queries))
-	apiAdmin.POST("/v1/packages/:appId/install", AddPackage(storeClient, queries, docker, hydraAdmin, hosts, serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker, appDataHandler))
+	apiAdmin.POST("/v1/packages/:appId/install", AddPackage(storeClient, queries, docker, hydraAdmin, hosts, jobManager, serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker, appDataHandler))
 	apiAdmin.POST("/v1/packages/update", CheckUpdates(storeClient, queries))
 	api.GET("/v1/packages/categories", ListCategories(queries))
+	apiAdmin.GET("/v1/stores", ListStores(storeClient, queries))
+	apiAdmin.POST("/v1/stores", AddStore(storeClient, queries))
+	apiAdmin.DELETE("/v1/stores/:name", DeleteStore(storeClient, queries))
 	api.GET("/v1/store", GetStoreHome(queries))
 
 	api.GET("/v1/apps", ListApps(queries))
-	apiAdmin.POST("/v1/apps/:appId/start", StartApp(docker, queries, hosts, appDataHandler, serverConfig.Host, serverConfig.Ory))
-	apiAdmin.POST("/v1/apps/:appId/stop", StopApp(docker, queries))
-	apiAdmin.POST("/v1/apps/:appId/uninstall", UninstallApp(queries, docker, hydraAdmin))
+	apiAdmin.POST("/v1/apps/:appId/start", StartApp(docker, queries, hosts, appDataHandler, reconciler, serverConfig.Host, serverConfig.Ory))
+	apiAdmin.POST("/v1/apps/:appId/stop", StopApp(docker, queries, reconciler))
+	apiAdmin.POST("/v1/apps/:appId/uninstall", UninstallApp(docker, queries, hydraAdmin, hosts, appDataHandler, serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker))
 	api.GET("/v1/apps/update", CheckUpdateApps(queries))
-	apiAdmin.POST("/v1/apps/update", UpdateApps(docker, storeClient, queries, hosts, appDataHandler, serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker))
-	apiAdmin.POST("/v1/apps/:appId/backup", BackupApp(docker, serverConfig.Storage))
-	apiAdmin.GET("/v1/apps/:appId/backups", ListBackups())
-	apiAdmin.POST("/v1/apps/:appId/restore", RestoreApp(docker, queries, hosts, appDataHandler, serverConfig.Host, serverConfig.Storage, serverConfig.Ory, serverConfig.Docker))
+	apiAdmin.POST("/v1/apps/sideload", SideloadApp(docker, queries, hydraAdmin, hosts, appDataHandler, jobManager, serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker))
+	apiAdmin.POST("/v1/apps/update", UpdateApps(docker, storeClient, queries, hosts, appDataHandler, jobManager, serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker))
+	apiAdmin.PUT("/v1/apps/:appId/update_policy", SetUpdatePolicy(queries))
+	apiAdmin.GET("/v1/apps/:appId/updates", GetUpdateHistory(queries))
+	apiAdmin.PUT("/v1/apps/:appId/pin", SetPinned(queries))
+	apiAdmin.GET("/v1/apps/:appId/limits", GetLimits(queries))
+	apiAdmin.PUT("/v1/apps/:appId/limits", SetLimits(docker, db, queries))
+	apiAdmin.GET("/v1/apps/:appId/logs", GetLogs(docker, queries))
+	apiAdmin.GET("/v1/apps/:appId/logs/events", LogEvents(docker, queries))
+	apiAdmin.GET("/v1/apps/:appId/logs/download", DownloadLogs(docker, queries))
+	apiAdmin.GET("/v1/apps/:appId/metrics", GetAppMetrics(queries, metricsCollector))
+	apiAdmin.GET("/v1/apps/:appId/settings", GetSettings(queries, appDataHandler))
+	apiAdmin.PUT("/v1/apps/:appId/settings", SetSettings(docker, queries, hosts, appDataHandler, jobManager, serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker))
+	apiAdmin.POST("/v1/apps/:appId/version", ChangeAppVersion(docker, storeClient, queries, hosts, appDataHandler, jobManager, serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker))
+	apiAdmin.GET("/v1/updates/settings", GetUpdateSettings(queries))
+	apiAdmin.PUT("/v1/updates/settings", SetUpdateSettings(queries))
+	apiAdmin.POST("/v1/apps/:appId/backup", BackupApp(docker, queries, appDataHandler, jobManager, backupTargets, serverConfig.Storage))
+	apiAdmin.GET("/v1/apps/:appId/backups", ListBackups(backupTargets))
+	apiAdmin.POST("/v1/apps/:appId/backups/:backup/verify", VerifyBackup(queries, jobManager, backupTargets))
+	apiAdmin.POST("/v1/apps/:appId/backups/:backup/test-restore", TestRestoreBackup(docker, queries, appDataHandler, serverConfig.Host, serverConfig.Storage, serverConfig.Ory, serverConfig.Docker, jobManager, backupTargets))
+	apiAdmin.POST("/v1/apps/:appId/restore", RestoreApp(docker, queries, hosts, appDataHandler, serverConfig.Host, serverConfig.Storage, serverConfig.Ory, serverConfig.Docker, jobManager, backupTargets))
+
+	apiAdmin.GET("/v1/jobs", ListJobs(queries))
+	apiAdmin.GET("/v1/jobs/:id", GetJob(jobManager))
+	apiAdmin.GET("/v1/jobs/:id/events", JobEvents(jobManager))
 
 	apiNoAuth.POST("/v1/invites/check", CheckInvitationCode(queries))
 	apiAdmin.POST("/v1/invites", CreateInviteCode(queries))
-	apiNoAuth.POST("/v1/invites/complete", CompleteInvite(queries, kratosIdentityAPI))
+	apiNoAuth.POST("/v1/invites/complete", CompleteInvite(queries, kratosIdentityAPI, notifier))
 
 	apiAdmin.GET("/v1/users", ListUsers(kratosIdentityAPI))
-	apiAdmin.DELETE("/v1/users/:id", DeleteUser(kratosIdentityAPI))
+	apiAdmin.DELETE("/v1/users/:id", DeleteUser(kratosIdentityAPI, queries))
 	apiAdmin.POST("/v1/users/:id/reset_password", ResetPassword(kratosIdentityAPI))
 	api.GET("/v1/account/options", GetUserOptions(queries))
 	api.PUT("/v1/account/options", UpdateUserOptions(queries))
+	apiAdmin.GET("/v1/account/notifications", GetNotificationSettings(queries, notifier))
+	apiAdmin.PUT("/v1/account/notifications", UpdateNotificationSettings(queries, notifier))
+
+	api.GET("/v1/notifications", ListNotifications(queries))
+	api.POST("/v1/notifications/read", ReadAllNotifications(queries))
+	api.POST("/v1/notifications/:id/read", ReadNotification(queries))
+	api.DELETE("/v1/notifications/:id", DeleteNotification(queries))
 
 	apiAdmin.GET("/v1/backup/devices", ListExternalStorage())
+	apiAdmin.POST("/v1/backup/system", BackupSystem(docker, queries, appDataHandler, jobManager, backupTargets, serverConfig.Storage))
+	apiAdmin.GET("/v1/backup/system", ListSystemBackups(backupTargets))
+	apiAdmin.POST("/v1/backup/system/:backup/verify", VerifySystemBackup(queries, jobManager, backupTargets))
+	apiAdmin.GET("/v1/backup/targets", ListBackupTargets(backupTargets))
+	apiAdmin.POST("/v1/backup/targets", CreateBackupTarget(backupTargets))
+	apiAdmin.PUT("/v1/backup/targets/:name", UpdateBackupTarget(backupTargets))
+	apiAdmin.DELETE("/v1/backup/targets/:name", DeleteBackupTarget(backupTargets))
+	apiAdmin.POST("/v1/backup/targets/:name/test", TestBackupTarget(backupTargets))
+	apiAdmin.POST("/v1/backup/targets/:name/check", CheckBackupTarget(backupTargets, jobManager))
+	apiAdmin.GET("/v1/backup/schedules", ListBackupSchedules(queries))
+	apiAdmin.POST("/v1/backup/schedules", CreateBackupSchedule(queries))
+	apiAdmin.PUT("/v1/backup/schedules/:id", UpdateBackupSchedule(queries))
+	apiAdmin.DELETE("/v1/backup/schedules/:id", DeleteBackupSchedule(queries))
+	apiAdmin.POST("/v1/backup/schedules/:id/run", RunBackupSchedule(queries, backupScheduler))
+	apiAdmin.GET("/v1/backup/history", GetBackupHistory(queries))
+
+	apiAdmin.GET("/v1/system/metrics", GetSystemMetrics(docker, queries, metricsCollector, serverConfig.Storage))
+	apiAdmin.GET("/v1/system/drift", GetDrift(docker, queries, hydraAdmin))
+	apiAdmin.POST("/v1/system/drift/repair", RepairDrift(docker, queries, hydraAdmin, hosts, appDataHandler, jobManager, serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker))
 
 	e.GET("/auth/login", Login(kratosClient, kratosIdentityAPI, serverConfig.Ory))
 	e.GET("/auth/registration", Registration(kratosClient, serverConfig.Ory))
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/docker/docker/client"
+	"github.com/labstack/echo/v4"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/apps"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// GetSettings lists the settings declared by an app along with their current values. Secret values aren't returned
+func GetSettings(queries *persistence.Queries, appDataHandler *storage.AppDataHandler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		settings, err := apps.GetAppSettings(c.Request().Context(), queries, appDataHandler, c.Param("appId"))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "App not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusOK, settings, "  ")
+	}
+}
+
+// SetSettings changes the given settings of an app, with null values resetting settings to their defaults. Settings
+// not included are left unchanged. The containers affected by the change are recreated in a job
+func SetSettings(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hosts *apps.Hosts,
+	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		appId := c.Param("appId")
+		var request map[string]*string
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		// Settings are validated before starting the job so invalid values are reported in the response
+		app, err := queries.GetApp(c.Request().Context(), appId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "App not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if err := apps.ValidateSettings(app.Schema, request); err != nil {
+			var validationErr schema.ValidationError
+			if errors.As(err, &validationErr) {
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, validationErr)
+			}
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		job, err := jobManager.Start(jobs.Configure, appId, func(ctx context.Context, progress jobs.Progress) error {
+			return apps.SetAppSettings(ctx, progress, dockerClient, queries, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, appId, request)
+		})
+		if err != nil {
+			return jobStartError(err)
+		}
+
+		return c.JSONPretty(http.StatusAccepted, job, "  ")
+	}
+}
@@ -1,23 +1,23 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
-	"encoding/json"
+	"encoding/base64"
 	"errors"
 	"net/http"
-	"strings"
+	"net/url"
+	"path/filepath"
 
 	"github.com/docker/docker/client"
 	"github.com/labstack/echo/v4"
 	hydra "github.com/ory/hydra-client-go/v2"
 
 	"github.com/An-Owlbear/homecloud/backend/internal/apps"
-	"github.com/An-Owlbear/homecloud/backend/internal/auth"
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
-	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
 	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
 	"github.com/An-Owlbear/homecloud/backend/internal/storage"
 )
 
@@ -81,12 +81,17 @@ func ListCategories(queries *persistence.Queries) echo.HandlerFunc {
 	}
 }
 
+type installRequest struct {
+	Version string `json:"version"`
+}
+
 func AddPackage(
 	storeClient *apps.StoreClient,
 	queries *persistence.Queries,
 	dockerClient *client.Client,
 	hydraAdmin *hydra.APIClient,
 	hosts *apps.Hosts,
+	jobManager *jobs.Manager,
 	oryConfig config.Ory,
 	hostConfig config.Host,
 	storageConfig config.Storage,
@@ -98,114 +103,89 @@ func AddPackage(
 		if id == "" {
 			return c.String(400, "Must provide id query parameter")
 		}
+		var request installRequest
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 
-		// Retrieves app from store
-		app, err := storeClient.GetPackage(id)
+		// Retrieves app from store, using the latest version if one isn't specified
+		app, err := storeClient.GetPackageVersion(id, request.Version)
 		if err != nil {
+			if errors.Is(err, apps.PackageVersionNotFoundError) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
 			return c.String(500, err.Error())
 		}
 
-		// Converts to json string for storing in DB
-		schemaString, err := json.Marshal(app)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		if err := schema.Validate(app); err != nil {
+			return packageValidationError(err)
 		}
 
-		// Checks if app is already installed before creating oauth2 client
-		_, err = queries.GetApp(context.Background(), app.Id)
+		// Checks if app is already installed before starting the install
+		_, err = queries.GetApp(c.Request().Context(), app.Id)
 		if err != nil && !errors.Is(err, sql.ErrNoRows) {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		} else if err == nil {
 			return echo.NewHTTPError(http.StatusConflict, "App already exists")
 		}
 
-		// Creates oauth2 client for the app if required
-		tokenAuthMethod := "client_secret_basic"
-		if app.OidcEndpointAuthMethod != nil {
-			tokenAuthMethod = *app.OidcEndpointAuthMethod
-		}
-
-		var clientId string
-		var clientSecret string
-		if app.OidcEnabled {
-			var redirectUris []string
-			for _, appContainer := range app.Containers {
-				// If the redirect uri starts with a slash append the actual host
-				for _, redirectUri := range appContainer.OidcRedirectUris {
-					if strings.HasPrefix(redirectUri, "/") {
-						redirectUri = hostConfig.PublicSubdomain(app.Id) + redirectUri
-					}
-					redirectUris = append(redirectUris, redirectUri)
-				}
-			}
-
-			oidcClient, err := auth.SetupAppAuth(
+		// Installs the app in the background, as downloading images can take a long time
+		job, err := jobManager.Start(jobs.Install, app.Id, func(ctx context.Context, progress jobs.Progress) error {
+			return apps.InstallApp(
+				ctx,
+				progress,
+				dockerClient,
+				queries,
 				hydraAdmin,
-				app.Name,
-				strings.Join(app.OidcScopes[:], " "),
-				redirectUris,
-				tokenAuthMethod,
+				hosts,
+				appDataHandler,
+				oryConfig,
+				hostConfig,
+				storageConfig,
+				dockerConfig,
+				app,
 			)
-			if err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-			}
-
-			clientId = oidcClient.GetClientId()
-			clientSecret = oidcClient.GetClientSecret()
-		}
-
-		// Applies the variables to the template
-		var templatedApp bytes.Buffer
-		err = storage.ApplyAppTemplate(
-			string(schemaString),
-			&templatedApp,
-			app,
-			clientId,
-			clientSecret,
-			oryConfig,
-			hostConfig,
-			storageConfig,
-		)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
-		var parsedTemplatedApp persistence.AppPackage
-		err = json.Unmarshal(templatedApp.Bytes(), &parsedTemplatedApp)
+		})
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return jobStartError(err)
 		}
 
-		// Creates app in DB
-		err = queries.CreateApp(
-			context.Background(), persistence.CreateAppParams{
-				ID:           app.Id,
-				Schema:       schemaString,
-				ClientID:     sql.NullString{String: clientId, Valid: clientId != ""},
-				ClientSecret: sql.NullString{String: clientSecret, Valid: clientSecret != ""},
-			},
-		)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+		return c.JSONPretty(http.StatusAccepted, job, "  ")
+	}
+}
+
+// packageValidationError converts an error from validating a package to the appropriate HTTP error, returning the
+// list of problems found with the package if available
+func packageValidationError(err error) error {
+	var validationErr schema.ValidationError
+	if errors.As(err, &validationErr) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, validationErr)
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+}
 
-		// Downloads the app package and stores required files
-		err = appDataHandler.SavePackage(app.Id)
+func ListPackageVersions(storeClient *apps.StoreClient) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		versions, err := storeClient.GetPackageVersions(c.Param("id"))
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
 
-		// Install and sets up app containers
-		err = docker.InstallApp(dockerClient, parsedTemplatedApp, hostConfig, storageConfig, dockerConfig)
-		if err != nil {
-			return c.String(500, err.Error())
-		}
+		return c.JSONPretty(http.StatusOK, versions, "  ")
+	}
+}
 
-		// Starts application
-		if err := apps.StartApp(dockerClient, queries, hosts, appDataHandler, hostConfig, oryConfig, app.Id); err != nil {
-			return c.String(500, err.Error())
+// GetPackageIcon serves the icon of a package from its store, used for stores in a local directory
+func GetPackageIcon(storeClient *apps.StoreClient) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		icon, err := storeClient.GetPackageIcon(c.Param("id"))
+		if errors.Is(err, apps.InvalidPackageIdError) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		} else if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
 		}
 
-		return c.JSONPretty(200, app, "  ")
+		return c.Blob(http.StatusOK, "image/png", icon)
 	}
 }
 
@@ -231,23 +211,73 @@ func CheckUpdateApps(queries *persistence.Queries) echo.HandlerFunc {
 	}
 }
 
+// UpdateAppError is an app which couldn't be updated, such as when it's busy with another job
+type UpdateAppError struct {
+	AppId string `json:"app_id"`
+	Error string `json:"error"`
+}
+
+// UpdateAppsResponse contains the jobs started to update apps, and the apps whose updates couldn't be started
+type UpdateAppsResponse struct {
+	Jobs   []persistence.JobDetails `json:"jobs"`
+	Errors []UpdateAppError         `json:"errors"`
+}
+
 func UpdateApps(
 	dockerClient *client.Client,
 	storeClient *apps.StoreClient,
 	queries *persistence.Queries,
 	hosts *apps.Hosts,
 	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
 	oryConfig config.Ory,
 	hostConfig config.Host,
 	storageConfig config.Storage,
 	dockerConfig config.Docker,
 ) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		err := apps.UpdateApps(dockerClient, storeClient, queries, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig)
+		if err := storeClient.UpdatePackageList(c.Request().Context(), queries); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		appsToUpdate, err := apps.CheckUpdateApps(c.Request().Context(), queries)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
-		return c.String(http.StatusOK, "Apps updated")
+
+		// Starts a separate job for each app, so a failure updating one app doesn't affect the others. Apps whose
+		// updates can't be started are recorded instead, so the jobs already started are still returned
+		response := UpdateAppsResponse{Jobs: make([]persistence.JobDetails, 0), Errors: make([]UpdateAppError, 0)}
+		for _, appToUpdate := range appsToUpdate {
+			appPackage, err := storeClient.GetPackage(appToUpdate.ID)
+			if err != nil {
+				response.Errors = append(response.Errors, UpdateAppError{AppId: appToUpdate.ID, Error: err.Error()})
+				continue
+			}
+
+			job, err := apps.StartUpdate(
+				c.Request().Context(),
+				jobManager,
+				dockerClient,
+				queries,
+				hosts,
+				appDataHandler,
+				oryConfig,
+				hostConfig,
+				storageConfig,
+				dockerConfig,
+				appPackage,
+				false,
+				false,
+			)
+			if err != nil {
+				response.Errors = append(response.Errors, UpdateAppError{AppId: appToUpdate.ID, Error: err.Error()})
+				continue
+			}
+			response.Jobs = append(response.Jobs, job)
+		}
+
+		return c.JSONPretty(http.StatusAccepted, response, "  ")
 	}
 }
 
@@ -273,3 +303,131 @@ func GetStoreHome(queries *persistence.Queries) echo.HandlerFunc {
 		}, "  ")
 	}
 }
+
+type storeResponse struct {
+	Name      string `json:"name"`
+	Url       string `json:"url"`
+	Priority  int64  `json:"priority"`
+	PublicKey string `json:"public_key"`
+}
+
+func ListStores(storeClient *apps.StoreClient, queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sources, err := storeClient.Sources(c.Request().Context(), queries)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		stores := make([]storeResponse, len(sources))
+		for i, source := range sources {
+			stores[i] = storeResponse{
+				Name:     source.Name,
+				Url:      source.Url,
+				Priority: source.Priority,
+			}
+			if source.PublicKey != nil {
+				stores[i].PublicKey = base64.StdEncoding.EncodeToString(source.PublicKey)
+			}
+		}
+
+		return c.JSONPretty(http.StatusOK, stores, "  ")
+	}
+}
+
+// AddStore adds a store packages can be installed from, either served over HTTP or from a local directory. Added stores
+// must have a public key, so packages from third party stores are always verified
+func AddStore(storeClient *apps.StoreClient, queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request storeResponse
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if request.Name == "" || request.Name == apps.DefaultStoreName {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid store name")
+		}
+		if !validStoreUrl(request.Url) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid store URL")
+		}
+		if request.PublicKey == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Public key must be set")
+		}
+		if _, err := apps.ParsePublicKey(request.PublicKey); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		stores, err := queries.GetStores(c.Request().Context())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		for _, store := range stores {
+			if store.Name == request.Name {
+				return echo.NewHTTPError(http.StatusConflict, "A store with that name already exists")
+			}
+		}
+
+		err = queries.CreateStore(c.Request().Context(), persistence.CreateStoreParams{
+			Name:      request.Name,
+			Url:       request.Url,
+			Priority:  request.Priority,
+			PublicKey: request.PublicKey,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		if err := storeClient.UpdatePackageList(c.Request().Context(), queries); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusCreated, request, "  ")
+	}
+}
+
+// DeleteStore removes a store along with the packages listed from it. Packages also provided by another store are
+// listed from that store again once the package list is updated
+func DeleteStore(storeClient *apps.StoreClient, queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		if name == apps.DefaultStoreName {
+			return echo.NewHTTPError(http.StatusBadRequest, "The default store can't be removed")
+		}
+
+		result, err := queries.DeleteStore(c.Request().Context(), name)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		} else if rows == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "Store not found")
+		}
+
+		if err := queries.RemoveStorePackages(c.Request().Context(), name); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if err := storeClient.UpdatePackageList(c.Request().Context(), queries); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// validStoreUrl checks the store is served over HTTP, or is a local directory given as a file:// URL or absolute path
+func validStoreUrl(storeUrl string) bool {
+	if filepath.IsAbs(storeUrl) {
+		return true
+	}
+	parsed, err := url.Parse(storeUrl)
+	if err != nil {
+		return false
+	}
+	switch parsed.Scheme {
+	case "http", "https":
+		return parsed.Host != ""
+	case "file":
+		return parsed.Host == "" && filepath.IsAbs(filepath.FromSlash(parsed.Path))
+	}
+	return false
+}
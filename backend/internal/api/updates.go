@@ -0,0 +1,224 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/docker/docker/client"
+	"github.com/labstack/echo/v4"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/apps"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+type updatePolicyRequest struct {
+	UpdatePolicy string `json:"update_policy"`
+}
+
+func SetUpdatePolicy(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		appId := c.Param("appId")
+		var request updatePolicyRequest
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		policy, err := apps.ParseUpdatePolicy(request.UpdatePolicy)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if _, err := queries.GetApp(c.Request().Context(), appId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "App not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		err = queries.SetUpdatePolicy(c.Request().Context(), persistence.SetUpdatePolicyParams{
+			UpdatePolicy: string(policy),
+			ID:           appId,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+type updateHistoryRequest struct {
+	Limit int64 `query:"limit"`
+}
+
+func GetUpdateHistory(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := updateHistoryRequest{Limit: 50}
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		history, err := queries.GetUpdateHistory(c.Request().Context(), persistence.GetUpdateHistoryParams{
+			AppID: c.Param("appId"),
+			Limit: request.Limit,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if history == nil {
+			history = []persistence.UpdateHistory{}
+		}
+
+		return c.JSONPretty(http.StatusOK, history, "  ")
+	}
+}
+
+func GetUpdateSettings(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		settings, err := queries.GetUpdateSettings(c.Request().Context())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusOK, settings, "  ")
+	}
+}
+
+type updateSettingsRequest struct {
+	WindowStart int64 `json:"window_start"`
+	WindowEnd   int64 `json:"window_end"`
+}
+
+func SetUpdateSettings(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request updateSettingsRequest
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if request.WindowStart < 0 || request.WindowStart > 23 || request.WindowEnd < 0 || request.WindowEnd > 23 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Maintenance window must be given in hours between 0 and 23")
+		}
+
+		err := queries.SetUpdateSettings(c.Request().Context(), persistence.SetUpdateSettingsParams{
+			WindowStart: request.WindowStart,
+			WindowEnd:   request.WindowEnd,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+type pinRequest struct {
+	Pinned bool `json:"pinned"`
+}
+
+func SetPinned(queries *persistence.Queries) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		appId := c.Param("appId")
+		var request pinRequest
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if _, err := queries.GetApp(c.Request().Context(), appId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "App not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		err := queries.SetPinned(c.Request().Context(), persistence.SetPinnedParams{
+			Pinned: request.Pinned,
+			ID:     appId,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+type changeVersionRequest struct {
+	Version string `json:"version"`
+	Pin     bool   `json:"pin"`
+}
+
+// ChangeAppVersion updates or downgrades an app to the given package version, optionally pinning it to that version
+func ChangeAppVersion(
+	dockerClient *client.Client,
+	storeClient *apps.StoreClient,
+	queries *persistence.Queries,
+	hosts *apps.Hosts,
+	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		appId := c.Param("appId")
+		var request changeVersionRequest
+		if err := c.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if request.Version == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Version must be set")
+		}
+
+		app, err := queries.GetApp(c.Request().Context(), appId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "App not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if app.Sideloaded {
+			return echo.NewHTTPError(http.StatusBadRequest, "Sideloaded apps can't be changed to a store version")
+		}
+
+		appPackage, err := storeClient.GetPackageVersion(appId, request.Version)
+		if err != nil {
+			if errors.Is(err, apps.PackageVersionNotFoundError) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if err := schema.Validate(appPackage); err != nil {
+			return packageValidationError(err)
+		}
+
+		// The app is pinned by the job once the version is changed, since the app is busy until then and a scheduled
+		// update can't replace the chosen version
+		job, err := apps.StartUpdate(
+			c.Request().Context(),
+			jobManager,
+			dockerClient,
+			queries,
+			hosts,
+			appDataHandler,
+			oryConfig,
+			hostConfig,
+			storageConfig,
+			dockerConfig,
+			appPackage,
+			false,
+			request.Pin,
+		)
+		if err != nil {
+			return jobStartError(err)
+		}
+
+		return c.JSONPretty(http.StatusAccepted, job, "  ")
+	}
+}
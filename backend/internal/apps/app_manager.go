@@ -3,22 +3,31 @@ package apps
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/docker/docker/client"
+	hydra "github.com/ory/hydra-client-go/v2"
 	"golang.org/x/mod/semver"
 
+	"github.com/An-Owlbear/homecloud/backend/internal/auth"
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
 	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
 	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
 	"github.com/An-Owlbear/homecloud/backend/internal/storage"
 )
 
-// CheckUpdateApps returns a list of apps with available updates
+// CheckUpdateApps returns a list of apps with available updates, excluding pinned apps
 func CheckUpdateApps(ctx context.Context, queries *persistence.Queries) ([]persistence.FullPackageListItem, error) {
 	apps, err := queries.GetApps(ctx)
 	if err != nil {
@@ -35,9 +44,11 @@ func CheckUpdateApps(ctx context.Context, queries *persistence.Queries) ([]persi
 		return nil, err
 	}
 
+	// Pinned apps are skipped, as they've been set to stay on their current version, as are sideloaded apps since they
+	// weren't installed from the store
 	packagesToUpdate := make([]persistence.FullPackageListItem, 0)
 	for _, appPackage := range packages {
-		if installedApp, ok := appsMap[appPackage.ID]; ok && semver.Compare(appPackage.Version, installedApp.Schema.Version) == 1 {
+		if installedApp, ok := appsMap[appPackage.ID]; ok && !installedApp.Pinned && !installedApp.Sideloaded && semver.Compare(appPackage.Version, installedApp.Schema.Version) == 1 {
 			packagesToUpdate = append(packagesToUpdate, appPackage)
 		}
 	}
@@ -45,6 +56,198 @@ func CheckUpdateApps(ctx context.Context, queries *persistence.Queries) ([]persi
 	return packagesToUpdate, nil
 }
 
+// InstallApp installs the given app package, creating the OAuth2 client, app data and containers it requires
+// before starting it. If any step fails the steps already completed are undone, leaving the app uninstalled
+func InstallApp(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	app persistence.AppPackage,
+) error {
+	return installApp(
+		ctx,
+		progress,
+		dockerClient,
+		queries,
+		hydraAdmin,
+		hosts,
+		appDataHandler,
+		oryConfig,
+		hostConfig,
+		storageConfig,
+		dockerConfig,
+		app,
+		false,
+		func() error {
+			return appDataHandler.SavePackageVersion(app.Id, app.Version)
+		},
+	)
+}
+
+// SideloadApp installs an app from an uploaded package bundle rather than a store, which should first be checked with
+// ReadBundle. Sideloaded apps are ignored when checking for updates from the store
+func SideloadApp(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	app persistence.AppPackage,
+	bundle []byte,
+) error {
+	return installApp(
+		ctx,
+		progress,
+		dockerClient,
+		queries,
+		hydraAdmin,
+		hosts,
+		appDataHandler,
+		oryConfig,
+		hostConfig,
+		storageConfig,
+		dockerConfig,
+		app,
+		true,
+		func() error {
+			return appDataHandler.SaveBundle(app.Id, bytes.NewReader(bundle))
+		},
+	)
+}
+
+// installApp installs the given app package, using savePackage to store the package files in the app's directory
+func installApp(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	app persistence.AppPackage,
+	sideloaded bool,
+	savePackage func() error,
+) (err error) {
+	rollback := &Rollback{}
+	defer rollback.RunOnError(context.Background(), &err)
+
+	if err := schema.Validate(app); err != nil {
+		return err
+	}
+
+	// Converts to json string for storing in DB
+	schemaString, err := json.Marshal(app)
+	if err != nil {
+		return fmt.Errorf("failed to marshal app package json: %w", err)
+	}
+
+	// Downloads images first, since this is by far the longest part of installing an app
+	progress.Step("Downloading images")
+	if err := docker.PullAppImages(ctx, dockerClient, app, progress.PullProgress); err != nil {
+		return fmt.Errorf("failed to download images: %w", err)
+	}
+
+	// Creates oauth2 client for the app if required
+	var clientId string
+	var clientSecret string
+	if app.OidcEnabled {
+		progress.Step("Creating OAuth2 client")
+		oidcClient, err := createOAuthClient(hydraAdmin, hostConfig, app)
+		if err != nil {
+			return fmt.Errorf("failed to create OAuth2 client: %w", err)
+		}
+
+		clientId = oidcClient.GetClientId()
+		clientSecret = oidcClient.GetClientSecret()
+		rollback.Add("create OAuth2 client", func(ctx context.Context) error {
+			_, err := hydraAdmin.OAuth2API.DeleteOAuth2Client(ctx, clientId).Execute()
+			return err
+		})
+	}
+
+	// Generates the secrets declared by the package, which are kept until the app is uninstalled
+	if err := generateSecrets(ctx, rollback, queries, appDataHandler, app, false); err != nil {
+		return err
+	}
+
+	// Applies the variables to the template
+	templatedApp, err := templatePackage(ctx, queries, appDataHandler, app, clientId, clientSecret, oryConfig, hostConfig, storageConfig)
+	if err != nil {
+		return fmt.Errorf("failed to apply app template: %w", err)
+	}
+
+	// Creates app in DB
+	err = queries.CreateApp(
+		ctx, persistence.CreateAppParams{
+			ID:           app.Id,
+			Schema:       schemaString,
+			ClientID:     sql.NullString{String: clientId, Valid: clientId != ""},
+			ClientSecret: sql.NullString{String: clientSecret, Valid: clientSecret != ""},
+			Sideloaded:   sideloaded,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create app entry in DB: %w", err)
+	}
+	rollback.Add("create app entry in DB", func(ctx context.Context) error {
+		_, err := queries.RemoveApp(ctx, app.Id)
+		return err
+	})
+
+	// Downloads the app package and stores required files. The app directory is only removed on failure if it was
+	// created by this install, so existing data is never deleted
+	progress.Step("Saving app data")
+	appDataPath := filepath.Join(storageConfig.DataPath, app.Id)
+	if _, err := os.Stat(appDataPath); os.IsNotExist(err) {
+		rollback.Add("save app data", func(ctx context.Context) error {
+			return os.RemoveAll(appDataPath)
+		})
+	}
+	if err := savePackage(); err != nil {
+		return fmt.Errorf("failed to save app package: %w", err)
+	}
+
+	// Install and sets up app containers, any resources created are removed on failure even if creation didn't finish
+	progress.Step("Creating containers")
+	resources, err := docker.InstallAppResources(dockerClient, templatedApp, hostConfig, storageConfig, dockerConfig)
+	rollback.Add("create app containers", func(ctx context.Context) error {
+		return docker.RemoveResources(ctx, dockerClient, resources)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create app containers: %w", err)
+	}
+
+	// Starts application
+	progress.Step("Starting app")
+	rollback.Add("start app", func(ctx context.Context) error {
+		hosts.RemoveProxy(app.Id)
+		return nil
+	})
+	if err := StartApp(dockerClient, queries, hosts, appDataHandler, hostConfig, oryConfig, app.Id); err != nil {
+		return fmt.Errorf("failed to start app: %w", err)
+	}
+
+	return nil
+}
+
 // UpdateApps updates the list of available apps and updates any outdated apps
 func UpdateApps(
 	dockerClient *client.Client,
@@ -62,88 +265,373 @@ func UpdateApps(
 		return fmt.Errorf("UpdateApps: failed to update packages list: %w", err)
 	}
 
-	apps, err := queries.GetAppsWithCreds(context.Background())
+	packagesToUpdate, err := CheckUpdateApps(context.Background(), queries)
 	if err != nil {
-		return fmt.Errorf("UpdateApps: failed to get application details: %w", err)
+		return fmt.Errorf("UpdateApps: failed to check for updates: %w", err)
 	}
 
-	// converts result to map
-	appsMap := make(map[string]persistence.AppWithCreds)
-	for _, app := range apps {
-		appsMap[app.ID] = app
+	for _, listApp := range packagesToUpdate {
+		// Retrieve the full app package
+		appPackage, err := storeClient.GetPackage(listApp.ID)
+		if err != nil {
+			return fmt.Errorf("UpdateApps: failed to get full package details: %w", err)
+		}
+
+		err = UpdateApp(
+			context.Background(),
+			jobs.Discard,
+			dockerClient,
+			queries,
+			hosts,
+			appDataHandler,
+			oryConfig,
+			hostConfig,
+			storageConfig,
+			dockerConfig,
+			appPackage,
+		)
+		if err != nil {
+			return fmt.Errorf("UpdateApps: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateApp updates an installed app to the given version of its package. The new images are downloaded and a
+// snapshot of the app data taken before the current containers are removed and the package files of the new version
+// are saved. If the new version fails to start and become healthy the previous containers, schema, package files and
+// data are restored
+func UpdateApp(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	appPackage persistence.AppPackage,
+) (err error) {
+	rollback := &Rollback{}
+	defer rollback.RunOnError(context.Background(), &err)
+
+	if err := schema.Validate(appPackage); err != nil {
+		return err
 	}
 
-	packages, err := queries.GetPackages(context.Background())
+	app, err := queries.GetAppWithCreds(ctx, appPackage.Id)
 	if err != nil {
-		return fmt.Errorf("UpdateApps: failed to get packages list: %w", err)
+		return fmt.Errorf("failed to get application details: %w", err)
 	}
 
-	for _, listApp := range packages {
-		// If the app is installed and the new version is greater update
-		if app, ok := appsMap[listApp.ID]; ok && semver.Compare(listApp.Version, app.Schema.Version) == 1 {
-			// Retrieve the full app package
-			appPackage, err := storeClient.GetPackage(listApp.ID)
-			if err != nil {
-				return fmt.Errorf("UpdateApps: failed to get full package details: %w", err)
-			}
+	// Downloads the new images before touching the current containers, so a failed download leaves the app running
+	progress.Step("Downloading images")
+	if err := docker.PullAppImages(ctx, dockerClient, appPackage, progress.PullProgress); err != nil {
+		return fmt.Errorf("failed to download images: %w", err)
+	}
 
-			// Remove the app containers and reinstall in case of required changes
-			err = docker.RemoveContainers(dockerClient, app.ID)
-			if err != nil {
-				return fmt.Errorf("UpdateApps: failed to remove containers: %w", err)
-			}
+	// Stops the app and takes a snapshot of its data, so it can be restored if the new version fails or modifies the
+	// data in a way the previous version can't read
+	progress.Step("Backing up app data")
+	rollback.Add("stop app", func(ctx context.Context) error {
+		return restoreApp(dockerClient, queries, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, app)
+	})
+	if err := docker.StopApp(dockerClient, app.ID); err != nil {
+		return fmt.Errorf("failed to stop app: %w", err)
+	}
 
-			schemaJson, err := json.Marshal(appPackage)
-			if err != nil {
-				return fmt.Errorf("UpdateApps: failed to marshal app package json: %w", err)
-			}
-			var templatedString bytes.Buffer
-			err = storage.ApplyAppTemplate(
-				string(schemaJson),
-				&templatedString,
-				appPackage,
-				app.ClientID.String,
-				app.ClientSecret.String,
-				oryConfig,
-				hostConfig,
-				storageConfig,
-			)
-			if err != nil {
-				return fmt.Errorf("UpdateApps: failed to apply app template to data template files: %w", err)
-			}
+	snapshotPath := storageConfig.GetAppSnapshotPath(app.ID)
+	if err := os.RemoveAll(snapshotPath); err != nil {
+		return fmt.Errorf("failed to remove previous snapshot: %w", err)
+	}
+	if err := os.MkdirAll(snapshotPath, 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	if err := docker.BackupAppData(ctx, dockerClient, storageConfig, app.ID, snapshotPath); err != nil {
+		return fmt.Errorf("failed to take snapshot of app data: %w", err)
+	}
+	rollback.Add("modify app data", func(ctx context.Context) error {
+		return restoreSnapshot(ctx, dockerClient, storageConfig, app.ID, snapshotPath)
+	})
 
-			var templatedPackage persistence.AppPackage
-			err = json.Unmarshal(templatedString.Bytes(), &templatedPackage)
-			if err != nil {
-				return fmt.Errorf("UpdateApps: failed to unmarshal app package json: %w", err)
-			}
+	// Replaces the package files, such as the data templates and icon, with those of the new version before they're
+	// templated. If the update fails the data directory is restored from the snapshot and the other files from a copy
+	if !app.Sideloaded {
+		progress.Step("Downloading package files")
+		restoreFiles, err := appDataHandler.BackupPackageFiles(app.ID)
+		if err != nil {
+			return fmt.Errorf("failed to back up package files: %w", err)
+		}
+		rollback.Add("replace package files", func(ctx context.Context) error {
+			return restoreFiles()
+		})
+		if err := appDataHandler.SavePackageVersion(app.ID, appPackage.Version); err != nil {
+			return fmt.Errorf("failed to download package files: %w", err)
+		}
+	}
 
-			err = docker.InstallApp(dockerClient, templatedPackage, hostConfig, storageConfig, dockerConfig)
-			if err != nil {
-				return fmt.Errorf("UpdateApps: failed to reinstall newer version fo app: %w", err)
-			}
+	// Remove the app containers and reinstall in case of required changes
+	progress.Step("Recreating containers")
+	err = docker.RemoveContainers(dockerClient, app.ID)
+	if err != nil {
+		return fmt.Errorf("failed to remove containers: %w", err)
+	}
 
-			err = queries.UpdateApp(
-				context.Background(), persistence.UpdateAppParams{
-					ID:     app.ID,
-					Schema: templatedString.String(),
-				},
-			)
-			if err != nil {
-				return fmt.Errorf("UpdateApps: failed to update app entry in DB: %w", err)
-			}
+	schemaJson, err := json.Marshal(appPackage)
+	if err != nil {
+		return fmt.Errorf("failed to marshal app package json: %w", err)
+	}
+	// Secrets added by the new version are created, using their upgrade values since the app's data already exists
+	if err := generateSecrets(ctx, rollback, queries, appDataHandler, appPackage, true); err != nil {
+		return err
+	}
 
-			// Starts app, including running new templates
-			err = StartApp(dockerClient, queries, hosts, appDataHandler, hostConfig, oryConfig, appPackage.Id)
-			if err != nil {
-				return fmt.Errorf("UpdateApps: failed to start app: %w", err)
-			}
+	// The settings of the new version are used, so settings it no longer declares are dropped and new settings use
+	// their defaults
+	templatedPackage, err := templatePackage(ctx, queries, appDataHandler, appPackage, app.ClientID.String, app.ClientSecret.String, oryConfig, hostConfig, storageConfig)
+	if err != nil {
+		return fmt.Errorf("failed to apply app template: %w", err)
+	}
+
+	// Limits set by an admin are kept when updating, applying to the containers of the new version
+	limitedPackage, err := applyLimitOverrides(ctx, queries, templatedPackage)
+	if err != nil {
+		return err
+	}
+
+	resources, err := docker.InstallAppResources(dockerClient, limitedPackage, hostConfig, storageConfig, dockerConfig)
+	rollback.Add("create new containers", func(ctx context.Context) error {
+		return docker.RemoveResources(ctx, dockerClient, resources)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reinstall newer version fo app: %w", err)
+	}
+
+	oldSchema, err := json.Marshal(app.Schema)
+	if err != nil {
+		return fmt.Errorf("failed to marshal previous app package json: %w", err)
+	}
+	err = queries.UpdateApp(
+		ctx, persistence.UpdateAppParams{
+			ID:     app.ID,
+			Schema: string(schemaJson),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update app entry in DB: %w", err)
+	}
+	rollback.Add("update app entry in DB", func(ctx context.Context) error {
+		return queries.UpdateApp(ctx, persistence.UpdateAppParams{ID: app.ID, Schema: string(oldSchema)})
+	})
+
+	// Starts app, including running new templates, and waits for the containers to become healthy
+	progress.Step("Starting app")
+	rollback.Add("start app", func(ctx context.Context) error {
+		hosts.RemoveProxy(app.ID)
+		return nil
+	})
+	err = StartApp(dockerClient, queries, hosts, appDataHandler, hostConfig, oryConfig, appPackage.Id)
+	if err != nil {
+		return fmt.Errorf("failed to start app: %w", err)
+	}
+
+	// The snapshot is only kept if the update fails, in case restoring it also fails
+	if err := os.RemoveAll(snapshotPath); err != nil {
+		slog.Error(fmt.Sprintf("failed to remove snapshot for %s: %s", app.ID, err.Error()))
+	}
+
+	return nil
+}
+
+// restoreSnapshot replaces the data and volumes of the given app with the snapshot taken before updating it
+func restoreSnapshot(
+	ctx context.Context,
+	dockerClient *client.Client,
+	storageConfig config.Storage,
+	appId string,
+	snapshotPath string,
+) error {
+	// Containers are removed first since volumes can't be removed while in use
+	if err := docker.RemoveContainers(dockerClient, appId); err != nil {
+		return err
+	}
+	if err := docker.RemoveAppVolumes(ctx, dockerClient, appId); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(storageConfig.DataPath, appId, "data")); err != nil {
+		return err
+	}
+
+	return docker.RestoreAppData(ctx, dockerClient, storageConfig, appId, snapshotPath)
+}
+
+// UninstallApp removes the given app, its containers, OAuth2 client and volumes. If removing the app fails before
+// its volumes are removed, the app is restored to how it was before
+func UninstallApp(
+	ctx context.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	appId string,
+) (err error) {
+	rollback := &Rollback{}
+	defer rollback.RunOnError(context.Background(), &err)
+
+	app, err := queries.GetAppWithCreds(ctx, appId)
+	if err != nil {
+		return fmt.Errorf("failed to get application details: %w", err)
+	}
+
+	// Stops the app and removes its containers, recreating them on failure
+	rollback.Add("remove containers", func(ctx context.Context) error {
+		return restoreApp(dockerClient, queries, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, app)
+	})
+	if err := StopApp(dockerClient, queries, appId); err != nil {
+		return fmt.Errorf("failed to stop app: %w", err)
+	}
+	hosts.RemoveProxy(appId)
+
+	if err := docker.UninstallApp(dockerClient, appId); err != nil {
+		return fmt.Errorf("failed to remove containers: %w", err)
+	}
+
+	// Removes the app entry from the database
+	schemaString, err := json.Marshal(app.Schema)
+	if err != nil {
+		return fmt.Errorf("failed to marshal app package json: %w", err)
+	}
+	if _, err := queries.RemoveApp(ctx, appId); err != nil {
+		return fmt.Errorf("failed to remove app entry from DB: %w", err)
+	}
+	// The row read before removing the app is restored, so its status, update policy and pin aren't lost
+	rollback.Add("remove app entry from DB", func(ctx context.Context) error {
+		return queries.RestoreApp(ctx, persistence.RestoreAppParams{
+			ID:           appId,
+			Schema:       schemaString,
+			DateAdded:    app.DateAdded,
+			ClientID:     app.ClientID,
+			ClientSecret: app.ClientSecret,
+			Status:       app.Status,
+			UpdatePolicy: app.UpdatePolicy,
+			Pinned:       app.Pinned,
+			Sideloaded:   app.Sideloaded,
+		})
+	})
+
+	// Delete the oauth client for the app if there is one. This can't be undone, so is done last
+	if app.ClientID.Valid {
+		_, err = hydraAdmin.OAuth2API.DeleteOAuth2Client(ctx, app.ClientID.String).Execute()
+		if err != nil {
+			return fmt.Errorf("failed to delete OAuth2 client: %w", err)
 		}
 	}
+	rollback.Commit()
+
+	// Removes volumes and settings for app, the app has already been removed at this point so failures aren't rolled
+	// back
+	if err := docker.RemoveAppVolumes(ctx, dockerClient, appId); err != nil {
+		return fmt.Errorf("failed to remove app volumes: %w", err)
+	}
+	if err := queries.DeleteResourceLimits(ctx, appId); err != nil {
+		return fmt.Errorf("failed to remove resource limits: %w", err)
+	}
+	if err := queries.DeleteAppSettings(ctx, appId); err != nil {
+		return fmt.Errorf("failed to remove app settings: %w", err)
+	}
+	if err := queries.DeleteAppSecrets(ctx, appId); err != nil {
+		return fmt.Errorf("failed to remove app secrets: %w", err)
+	}
+	if err := queries.DeleteAppMetrics(ctx, appId); err != nil {
+		return fmt.Errorf("failed to remove app metrics: %w", err)
+	}
+	if err := queries.DeleteAppState(ctx, appId); err != nil {
+		return fmt.Errorf("failed to remove app state: %w", err)
+	}
+	if err := queries.DeleteNotifiedUpdate(ctx, appId); err != nil {
+		return fmt.Errorf("failed to remove update notification: %w", err)
+	}
+	if err := queries.DeleteAppBackupSchedules(ctx, appId); err != nil {
+		return fmt.Errorf("failed to remove backup schedules: %w", err)
+	}
 
 	return nil
 }
 
+// createOAuthClient registers an OAuth2 client for the app with hydra, using the redirect URIs of its containers
+func createOAuthClient(hydraAdmin *hydra.APIClient, hostConfig config.Host, app persistence.AppPackage) (*hydra.OAuth2Client, error) {
+	tokenAuthMethod := "client_secret_basic"
+	if app.OidcEndpointAuthMethod != nil {
+		tokenAuthMethod = *app.OidcEndpointAuthMethod
+	}
+
+	var redirectUris []string
+	for _, appContainer := range app.Containers {
+		// If the redirect uri starts with a slash append the actual host
+		for _, redirectUri := range appContainer.OidcRedirectUris {
+			if strings.HasPrefix(redirectUri, "/") {
+				redirectUri = hostConfig.PublicSubdomain(app.Id) + redirectUri
+			}
+			redirectUris = append(redirectUris, redirectUri)
+		}
+	}
+
+	return auth.SetupAppAuth(
+		hydraAdmin,
+		app.Name,
+		strings.Join(app.OidcScopes[:], " "),
+		redirectUris,
+		tokenAuthMethod,
+	)
+}
+
+// restoreApp recreates the containers for the given app as it was before an operation, starting it if it was running
+func restoreApp(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	app persistence.AppWithCreds,
+) error {
+	templatedApp, err := templatePackage(context.Background(), queries, appDataHandler, app.Schema, app.ClientID.String, app.ClientSecret.String, oryConfig, hostConfig, storageConfig)
+	if err != nil {
+		return err
+	}
+	templatedApp, err = applyLimitOverrides(context.Background(), queries, templatedApp)
+	if err != nil {
+		return err
+	}
+
+	// Removes any containers left over, since the operation may have failed part way through removing them
+	if err := docker.RemoveContainers(dockerClient, app.ID); err != nil {
+		return err
+	}
+
+	if err := docker.InstallApp(dockerClient, templatedApp, hostConfig, storageConfig, dockerConfig); err != nil {
+		return err
+	}
+
+	if err := queries.SetStatus(context.Background(), persistence.SetStatusParams{ID: app.ID, Status: app.Status}); err != nil {
+		return err
+	}
+	if app.Status != string(docker.ContainerRunning) {
+		return nil
+	}
+	return StartApp(dockerClient, queries, hosts, appDataHandler, hostConfig, oryConfig, app.ID)
+}
+
 func StartApp(
 	dockerClient *client.Client,
 	queries *persistence.Queries,
@@ -159,7 +647,7 @@ func StartApp(
 	}
 
 	// Renders the templates in the config files
-	err = appDataHandler.RenderTemplates(context.Background(), queries, oryConfig, hostConfig, appId)
+	_, err = appDataHandler.RenderTemplates(context.Background(), queries, oryConfig, hostConfig, appId)
 	if err != nil {
 		return err
 	}
@@ -181,19 +669,19 @@ func StartApp(
 		}
 	}
 
-	// Check if any containers need proxying and proxy if needed
+	// Proxies the routes of each proxy target, replacing any routes of a previous version
+	var routes []ProxyRoute
 	for _, packageContainer := range app.Schema.Containers {
-		if packageContainer.ProxyTarget {
-			err = hosts.AddProxy(
-				app.Schema.Id,
-				fmt.Sprintf("%s-%s", app.Schema.Id, packageContainer.Name),
-				packageContainer.ProxyPort,
-			)
-			if err != nil {
-				return err
-			}
+		for _, route := range schema.ProxyRoutes(packageContainer) {
+			routes = append(routes, ProxyRoute{
+				Route:   route,
+				Address: fmt.Sprintf("%s-%s", app.Schema.Id, packageContainer.Name),
+			})
 		}
 	}
+	if err := hosts.AddRoutes(app.Schema.Id, routes); err != nil {
+		return err
+	}
 
 	// Sets the status in the database
 	err = queries.SetStatus(
@@ -262,37 +750,21 @@ func SetupProxies(
 
 func BackupApp(
 	ctx context.Context,
+	progress jobs.Progress,
 	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
 	storageConfig config.Storage,
 	appId string,
-	targetDevice string,
+	target backup.TargetConfig,
 ) error {
-	details, err := storage.GetExternalPartition(targetDevice)
-	if err != nil {
-		return fmt.Errorf("error checking drive is external: %w", err)
-	}
-
-	mountPath, err := storage.MountPartition(details)
-	if err != nil {
-		return fmt.Errorf("error mounting partition: %w", err)
-	}
-	defer storage.UnmountPartition(details)
-
-	outputPath := filepath.Join(mountPath, "backup", appId, time.Now().Format("2006-01-02T150405"))
-	if err := os.MkdirAll(outputPath, 0755); err != nil {
-		return fmt.Errorf("error creating backup directory: %w", err)
-	}
-
-	err = docker.BackupAppData(ctx, dockerClient, storageConfig, appId, outputPath)
-	if err != nil {
-		return fmt.Errorf("error backup app data: %w", err)
-	}
-
-	return nil
+	_, err := runBackup(ctx, progress, dockerClient, queries, appDataHandler, storageConfig, appId, target, nil)
+	return err
 }
 
 func RestoreApp(
 	ctx context.Context,
+	progress jobs.Progress,
 	dockerClient *client.Client,
 	queries *persistence.Queries,
 	hosts *Hosts,
@@ -302,28 +774,79 @@ func RestoreApp(
 	oryConfig config.Ory,
 	dockerConfig config.Docker,
 	appId string,
-	targetDevice string,
+	target backup.TargetConfig,
 	targetBackup string,
 ) error {
-	// Checks and mounts drive
-	details, err := storage.GetExternalPartition(targetDevice)
+	// Apps that aren't installed have no schema or secrets to recreate their containers with, since those are only
+	// stored in system backups
+	if appId == SystemBackupId {
+		return errors.New("system backups can only be restored by the launcher when setting up a device")
+	}
+	if _, err := queries.GetApp(ctx, appId); errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", AppNotInstalledError, appId)
+	} else if err != nil {
+		return err
+	}
+
+	progress.Step("Connecting to backup target")
+	backupTarget, err := backup.Open(ctx, target)
 	if err != nil {
-		return fmt.Errorf("error checking drive is external: %w", err)
+		return fmt.Errorf("error opening backup target %s: %w", target.Name, err)
 	}
+	defer backupTarget.Close()
 
-	mountPath, err := storage.MountPartition(details)
+	// Legacy backups are downloaded and repository snapshots are checked before removing anything, so a missing or
+	// unreadable backup leaves the app as it is
+	progress.Step("Checking backup")
+	legacySnapshots, err := backup.ListLegacySnapshots(ctx, backupTarget, appId)
 	if err != nil {
-		return fmt.Errorf("error mounting partition: %w", err)
+		return fmt.Errorf("error listing backups on %s: %w", target.Name, err)
 	}
-	defer storage.UnmountPartition(details)
 
-	// Checks the specified backup exists on the drive
-	backupPath := filepath.Join(mountPath, "backup", appId, targetBackup)
-	if _, err := os.Stat(backupPath); err != nil {
-		return fmt.Errorf("specified backup %s does not exist on drive %s: %w", targetBackup, targetDevice, err)
+	var restoreData func() error
+	if slices.Contains(legacySnapshots, targetBackup) {
+		backupPath := storageConfig.GetBackupStagingPath(appId)
+		if err := os.RemoveAll(backupPath); err != nil {
+			return fmt.Errorf("error clearing backup directory: %w", err)
+		}
+		defer os.RemoveAll(backupPath)
+		if err := backup.GetLegacySnapshot(ctx, backupTarget, appId, targetBackup, backupPath); err != nil {
+			return fmt.Errorf("error downloading backup %s from %s: %w", targetBackup, target.Name, err)
+		}
+
+		restoreData = func() error {
+			if err := docker.RestoreAppData(ctx, dockerClient, storageConfig, appId, backupPath); err != nil {
+				return fmt.Errorf("error restoring app data: %w", err)
+			}
+			secretsJson, err := readLegacySecrets(backupPath)
+			if err != nil {
+				return fmt.Errorf("error reading app secrets: %w", err)
+			}
+			if err := restoreSecrets(ctx, queries, appDataHandler, appId, secretsJson); err != nil {
+				return fmt.Errorf("error restoring app secrets: %w", err)
+			}
+			return nil
+		}
+	} else {
+		repository, err := backup.OpenRepository(ctx, backupTarget, target, false)
+		if err != nil {
+			return fmt.Errorf("error opening backup repository on %s: %w", target.Name, err)
+		}
+		snapshot, err := repository.LoadSnapshot(ctx, appId, targetBackup)
+		if err != nil {
+			return fmt.Errorf("error reading backup %s from %s: %w", targetBackup, target.Name, err)
+		}
+		if err := repository.CheckSnapshot(ctx, snapshot); err != nil {
+			return fmt.Errorf("error checking backup %s: %w", targetBackup, err)
+		}
+
+		restoreData = func() error {
+			return restoreArchives(ctx, dockerClient, queries, appDataHandler, storageConfig, appId, repository, snapshot)
+		}
 	}
 
 	// Stops app
+	progress.Step("Removing current app data")
 	if err := StopApp(dockerClient, queries, appId); err != nil {
 		return fmt.Errorf("error stopping app: %w", err)
 	}
@@ -341,26 +864,33 @@ func RestoreApp(
 		return fmt.Errorf("error removing data directory: %w", err)
 	}
 
-	if err := docker.RestoreAppData(ctx, dockerClient, storageConfig, appId, backupPath); err != nil {
-		return fmt.Errorf("error restoring app data: %w", err)
+	progress.Step("Restoring app data")
+	if err := restoreData(); err != nil {
+		return err
 	}
 
 	// Recreates app containers
+	progress.Step("Recreating containers")
 	app, err := queries.GetAppWithCreds(ctx, appId)
 	if err != nil {
 		return fmt.Errorf("error retrieving app information: %w", err)
 	}
 
 	// fills templated values in schema before starting
-	templatedApp, err := storage.TemplateAppPackage(app.Schema, app.ClientID.String, app.ClientSecret.String, oryConfig, hostConfig, storageConfig)
+	templatedApp, err := templatePackage(ctx, queries, appDataHandler, app.Schema, app.ClientID.String, app.ClientSecret.String, oryConfig, hostConfig, storageConfig)
 	if err != nil {
 		return fmt.Errorf("error creating tempated app package: %w", err)
 	}
+	templatedApp, err = applyLimitOverrides(ctx, queries, templatedApp)
+	if err != nil {
+		return err
+	}
 
 	if err := docker.InstallApp(dockerClient, templatedApp, hostConfig, storageConfig, dockerConfig); err != nil {
 		return fmt.Errorf("error recreating app containers: %w", err)
 	}
 
+	progress.Step("Starting app")
 	if err := StartApp(dockerClient, queries, hosts, appDataHandler, hostConfig, oryConfig, appId); err != nil {
 		return fmt.Errorf("error starting app: %w", err)
 	}
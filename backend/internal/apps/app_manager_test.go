@@ -131,3 +131,70 @@ func TestUpdateApps(t *testing.T) {
 		t.Fatalf("Incorrect app information, difference: %s", diff)
 	}
 }
+
+// Tests an app removed while uninstalling is restored with its status, update policy and pin when rolled back
+func TestRestoreApp(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+	ctx := context.Background()
+
+	schema, err := json.Marshal(persistence.AppPackage{Id: "traefik.whoami", Name: "whoami", Version: "v1.5"})
+	if err != nil {
+		t.Fatalf("Unexpected error marshalling schema: %s", err.Error())
+	}
+	if err := queries.CreateApp(ctx, persistence.CreateAppParams{ID: "traefik.whoami", Schema: schema}); err != nil {
+		t.Fatalf("Unexpected error creating app: %s", err.Error())
+	}
+	if err := queries.SetStatus(ctx, persistence.SetStatusParams{ID: "traefik.whoami", Status: "stopped"}); err != nil {
+		t.Fatalf("Unexpected error setting status: %s", err.Error())
+	}
+	err = queries.SetUpdatePolicy(ctx, persistence.SetUpdatePolicyParams{
+		ID:           "traefik.whoami",
+		UpdatePolicy: string(UpdatePolicyNotify),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error setting update policy: %s", err.Error())
+	}
+	if err := queries.SetPinned(ctx, persistence.SetPinnedParams{Pinned: true, ID: "traefik.whoami"}); err != nil {
+		t.Fatalf("Unexpected error pinning app: %s", err.Error())
+	}
+
+	app, err := queries.GetAppWithCreds(ctx, "traefik.whoami")
+	if err != nil {
+		t.Fatalf("Unexpected error getting app: %s", err.Error())
+	}
+	if _, err := queries.RemoveApp(ctx, "traefik.whoami"); err != nil {
+		t.Fatalf("Unexpected error removing app: %s", err.Error())
+	}
+	err = queries.RestoreApp(ctx, persistence.RestoreAppParams{
+		ID:           app.ID,
+		Schema:       schema,
+		DateAdded:    app.DateAdded,
+		ClientID:     app.ClientID,
+		ClientSecret: app.ClientSecret,
+		Status:       app.Status,
+		UpdatePolicy: app.UpdatePolicy,
+		Pinned:       app.Pinned,
+		Sideloaded:   app.Sideloaded,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error restoring app: %s", err.Error())
+	}
+
+	restored, err := queries.GetAppWithCreds(ctx, "traefik.whoami")
+	if err != nil {
+		t.Fatalf("Unexpected error getting restored app: %s", err.Error())
+	}
+	if restored.Status != "stopped" || restored.UpdatePolicy != string(UpdatePolicyNotify) || !restored.Pinned {
+		t.Errorf(
+			"Expected stopped, notify and pinned, got %s, %s and %t",
+			restored.Status, restored.UpdatePolicy, restored.Pinned,
+		)
+	}
+	if restored.DateAdded != app.DateAdded {
+		t.Errorf("Expected date added %d, got %d", app.DateAdded, restored.DateAdded)
+	}
+	if diff := cmp.Diff(app.Schema, restored.Schema); diff != "" {
+		t.Errorf("Restored schema mismatch (-want +got):\n%s", diff)
+	}
+}
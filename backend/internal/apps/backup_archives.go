@@ -0,0 +1,134 @@
+package apps
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// The archives in an app's snapshot. Each volume is stored as a separate archive, named after the volume
+const (
+	dataArchive         = "data"
+	secretsArchive      = "secrets"
+	volumeArchivePrefix = "volumes/"
+)
+
+// backupSources creates the archives backed up for the app, streaming its data directory and volumes directly into
+// the repository rather than writing them to disk first
+func backupSources(
+	ctx context.Context,
+	dockerClient *client.Client,
+	hooks *backupHooks,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	storageConfig config.Storage,
+	appId string,
+) ([]backup.ArchiveSource, error) {
+	sources, err := dataSources(dockerClient, hooks, storageConfig, appId)
+	if err != nil {
+		return nil, err
+	}
+
+	secretsJson, err := exportSecrets(ctx, queries, appDataHandler, appId)
+	if err != nil {
+		return nil, fmt.Errorf("error backing up app secrets: %w", err)
+	}
+	if secretsJson != nil {
+		sources = append(sources, backup.ArchiveSource{
+			Name: secretsArchive,
+			Open: func(ctx context.Context) (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(secretsJson)), nil
+			},
+		})
+	}
+
+	return sources, nil
+}
+
+// dataSources creates the archives of the app's data directory and volumes, running the app's backup hooks around them
+func dataSources(
+	dockerClient *client.Client,
+	hooks *backupHooks,
+	storageConfig config.Storage,
+	appId string,
+) ([]backup.ArchiveSource, error) {
+	sources := []backup.ArchiveSource{{
+		Name: dataArchive,
+		Open: func(ctx context.Context) (io.ReadCloser, error) {
+			reader, writer := io.Pipe()
+			go func() {
+				writer.CloseWithError(docker.WriteFolderArchive(storageConfig, appId, writer))
+			}()
+			return reader, nil
+		},
+		Tar: true,
+	}}
+
+	volumes, err := docker.GetAppVolumeNames(dockerClient, appId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting volumes for %s: %w", appId, err)
+	}
+	for _, volumeName := range volumes {
+		sources = append(sources, backup.ArchiveSource{
+			Name: volumeArchivePrefix + volumeName,
+			Open: func(ctx context.Context) (io.ReadCloser, error) {
+				return docker.ExportVolume(ctx, dockerClient, volumeName)
+			},
+			Tar: true,
+		})
+	}
+	hooks.wrap(appId, sources)
+	return sources, nil
+}
+
+// restoreArchives restores the app's data directory, volumes and secrets from the snapshot. Assumes the containers
+// and volumes are already removed and that the app data folder has been cleared
+func restoreArchives(
+	ctx context.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	storageConfig config.Storage,
+	appId string,
+	repository *backup.Repository,
+	snapshot backup.Snapshot,
+) error {
+	for _, archive := range snapshot.Archives {
+		reader := repository.OpenArchive(ctx, archive)
+		switch {
+		case archive.Name == dataArchive:
+			if err := docker.ExtractFolderArchive(storageConfig, appId, reader); err != nil {
+				return fmt.Errorf("error restoring app data: %w", err)
+			}
+		case archive.Name == secretsArchive:
+			secretsJson, err := io.ReadAll(reader)
+			if err != nil {
+				return fmt.Errorf("error reading app secrets: %w", err)
+			}
+			if err := restoreSecrets(ctx, queries, appDataHandler, appId, secretsJson); err != nil {
+				return fmt.Errorf("error restoring app secrets: %w", err)
+			}
+		case strings.HasPrefix(archive.Name, volumeArchivePrefix):
+			volumeName := strings.TrimPrefix(archive.Name, volumeArchivePrefix)
+			if !strings.HasPrefix(volumeName, appId) {
+				return fmt.Errorf("volume %s doesn't belong to %s", volumeName, appId)
+			}
+			if err := docker.ImportVolume(ctx, dockerClient, appId, volumeName, reader); err != nil {
+				return fmt.Errorf("error restoring volume %s: %w", volumeName, err)
+			}
+		default:
+			return fmt.Errorf("unknown archive %s in backup", archive.Name)
+		}
+	}
+	return nil
+}
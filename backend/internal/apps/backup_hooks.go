@@ -0,0 +1,79 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+)
+
+// backupHooks prepares each app for backup as its archives are read, using the backup hooks of its containers. Apps
+// are only prepared while their own archives are read, so a system backup doesn't stop every app for its whole length
+type backupHooks struct {
+	dockerClient *client.Client
+	finish       map[string]func() error
+	errs         []error
+}
+
+func newBackupHooks(dockerClient *client.Client) *backupHooks {
+	return &backupHooks{dockerClient: dockerClient, finish: make(map[string]func() error)}
+}
+
+// wrap prepares the app for backup before the first of its archives is opened, and finishes the backup once the last
+// is closed. The archives must be read in order, as they are by backup.Repository.Backup
+func (h *backupHooks) wrap(appId string, sources []backup.ArchiveSource) {
+	if len(sources) == 0 {
+		return
+	}
+
+	first := sources[0].Open
+	sources[0].Open = func(ctx context.Context) (io.ReadCloser, error) {
+		finish, err := docker.PrepareBackup(ctx, h.dockerClient, appId)
+		if err != nil {
+			return nil, fmt.Errorf("error preparing %s for backup: %w", appId, err)
+		}
+		h.finish[appId] = finish
+		return first(ctx)
+	}
+
+	last := &sources[len(sources)-1]
+	open := last.Open
+	last.Open = func(ctx context.Context) (io.ReadCloser, error) {
+		reader, err := open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &cleanupReader{ReadCloser: reader, cleanup: func() error { return h.finishApp(appId) }}, nil
+	}
+}
+
+// finishApp runs the function finishing the app's backup if it hasn't already been run
+func (h *backupHooks) finishApp(appId string) error {
+	finish, ok := h.finish[appId]
+	if !ok {
+		return nil
+	}
+	delete(h.finish, appId)
+
+	if err := finish(); err != nil {
+		err = fmt.Errorf("error finishing backup of %s: %w", appId, err)
+		h.errs = append(h.errs, err)
+		return err
+	}
+	return nil
+}
+
+// Close finishes the backup of apps whose archives weren't all read, such as when the backup failed part way through,
+// and returns the errors from finishing each app's backup. Errors from closing archives aren't returned by the
+// repository, so are only found this way
+func (h *backupHooks) Close() error {
+	for appId := range h.finish {
+		h.finishApp(appId)
+	}
+	return errors.Join(h.errs...)
+}
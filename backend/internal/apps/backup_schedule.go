@@ -0,0 +1,467 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/cron"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// backupSnapshotFormat is the format of the directory names of backups, which are the time the backup started
+const backupSnapshotFormat = "2006-01-02T150405"
+
+// BackupStatus is the result of a backup recorded in the backup history
+type BackupStatus string
+
+const (
+	BackupRunning   BackupStatus = "running"
+	BackupCompleted BackupStatus = "completed"
+	BackupFailed    BackupStatus = "failed"
+)
+
+// scheduleInterval is how often schedules are checked, which is the precision of cron expressions
+const scheduleInterval = time.Minute
+
+// runBackup backs up an app to the given target, recording the result in the backup history, and returns the name of
+// the snapshot made. Backups run by a schedule prune the schedule's older backups afterwards
+func runBackup(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	storageConfig config.Storage,
+	appId string,
+	target backup.TargetConfig,
+	schedule *persistence.BackupSchedule,
+) (string, error) {
+	started := time.Now()
+	snapshot := started.Format(backupSnapshotFormat)
+	var scheduleId int64
+	if schedule != nil {
+		scheduleId = schedule.ID
+	}
+
+	historyId, err := queries.CreateBackupHistory(ctx, persistence.CreateBackupHistoryParams{
+		ScheduleID: scheduleId,
+		AppID:      appId,
+		Target:     target.Name,
+		Snapshot:   snapshot,
+		Status:     string(BackupRunning),
+		StartedAt:  started.Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error recording backup: %w", err)
+	}
+
+	size, err := backupToTarget(ctx, progress, dockerClient, queries, appDataHandler, storageConfig, appId, target, snapshot, schedule)
+	status, message := BackupCompleted, ""
+	if err != nil {
+		status, message = BackupFailed, err.Error()
+	}
+
+	// The result is recorded even if the job's context has been cancelled
+	finishErr := queries.FinishBackupHistory(context.Background(), persistence.FinishBackupHistoryParams{
+		Status:     string(status),
+		Error:      message,
+		Size:       size,
+		FinishedAt: time.Now().Unix(),
+		ID:         historyId,
+	})
+	if finishErr != nil {
+		slog.Error(fmt.Sprintf("Failed to record backup of %s: %s", appId, finishErr.Error()))
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return snapshot, nil
+}
+
+// backupToTarget stores the app's data, volumes and secrets as a snapshot in the target's repository, creating the
+// repository if the target doesn't have one, and returns the size of the backup. Backing up SystemBackupId creates a
+// system backup instead
+func backupToTarget(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	storageConfig config.Storage,
+	appId string,
+	target backup.TargetConfig,
+	snapshot string,
+	schedule *persistence.BackupSchedule,
+) (int64, error) {
+	progress.Step("Connecting to backup target")
+	backupTarget, err := backup.Open(ctx, target)
+	if err != nil {
+		return 0, fmt.Errorf("error opening backup target %s: %w", target.Name, err)
+	}
+	defer backupTarget.Close()
+
+	repository, err := backup.OpenRepository(ctx, backupTarget, target, true)
+	if err != nil {
+		return 0, fmt.Errorf("error opening backup repository on %s: %w", target.Name, err)
+	}
+
+	// Apps are prepared for backup as their archives are read, so hooks must be finished even if the backup fails
+	hooks := newBackupHooks(dockerClient)
+	var sources []backup.ArchiveSource
+	if appId == SystemBackupId {
+		progress.Step("Backing up system")
+		sources, err = systemBackupSources(ctx, dockerClient, hooks, queries, storageConfig)
+	} else {
+		progress.Step("Backing up app data")
+		sources, err = backupSources(ctx, dockerClient, hooks, queries, appDataHandler, storageConfig, appId)
+	}
+	if err != nil {
+		return 0, err
+	}
+	result, err := repository.Backup(ctx, appId, snapshot, sources)
+	hooksErr := hooks.Close()
+	if err != nil {
+		return 0, fmt.Errorf("error backing up app data: %w", errors.Join(err, hooksErr))
+	}
+	// The snapshot is complete even if an app couldn't be restarted afterwards, so the error is only logged
+	if hooksErr != nil {
+		slog.Error(fmt.Sprintf("Failed to finish backup hooks of %s: %s", appId, hooksErr.Error()))
+	}
+
+	// Failing to prune old backups doesn't affect the backup that was just made, so is only logged
+	if schedule != nil {
+		progress.Step("Pruning old backups")
+		if err := pruneBackups(ctx, queries, backupTarget, repository, *schedule, appId, snapshot); err != nil {
+			slog.Error(fmt.Sprintf("Failed to prune backups of %s: %s", appId, err.Error()))
+		}
+	}
+
+	return result.Size(), nil
+}
+
+// pruneBackups removes the backups made by the schedule that are no longer kept by its retention policy, along with
+// the snapshot just made, then removes the data only they used. Backups made manually or by other schedules are never
+// removed
+func pruneBackups(
+	ctx context.Context,
+	queries *persistence.Queries,
+	target backup.Target,
+	repository *backup.Repository,
+	schedule persistence.BackupSchedule,
+	appId string,
+	snapshot string,
+) error {
+	if schedule.KeepDaily == 0 && schedule.KeepWeekly == 0 && schedule.KeepMonthly == 0 {
+		return nil
+	}
+
+	backups, err := queries.GetRetainedBackups(ctx, persistence.GetRetainedBackupsParams{
+		ScheduleID: schedule.ID,
+		AppID:      appId,
+		Target:     schedule.Target,
+	})
+	if err != nil {
+		return err
+	}
+
+	snapshotTime, err := time.ParseInLocation(backupSnapshotFormat, snapshot, time.Local)
+	if err != nil {
+		return err
+	}
+	times := []time.Time{snapshotTime}
+	for _, history := range backups {
+		times = append(times, time.Unix(history.StartedAt, 0))
+	}
+
+	keep := retainedSnapshots(times, int(schedule.KeepDaily), int(schedule.KeepWeekly), int(schedule.KeepMonthly))
+	pruned := false
+	for i, history := range backups {
+		if keep[i+1] {
+			continue
+		}
+		// Backups made before the repository was used are stored as legacy snapshots
+		if err := repository.DeleteSnapshot(ctx, appId, history.Snapshot); err != nil {
+			return err
+		}
+		if err := backup.DeleteLegacySnapshot(ctx, target, appId, history.Snapshot); err != nil {
+			return err
+		}
+		if err := queries.SetBackupPruned(ctx, history.ID); err != nil {
+			return err
+		}
+		pruned = true
+	}
+
+	if pruned {
+		if _, err := repository.Prune(ctx); err != nil {
+			return fmt.Errorf("error removing unused backup data: %w", err)
+		}
+	}
+	return nil
+}
+
+// retainedSnapshots decides which snapshots are kept, given their times from newest to oldest. The newest snapshot
+// of each of the most recent days, ISO weeks and months are kept, up to the given number of each, and the newest
+// snapshot is always kept
+func retainedSnapshots(times []time.Time, keepDaily int, keepWeekly int, keepMonthly int) []bool {
+	keep := make([]bool, len(times))
+	if len(times) == 0 {
+		return keep
+	}
+	keep[0] = true
+
+	periods := []struct {
+		count int
+		key   func(time.Time) string
+	}{
+		{keepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{keepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%d", year, week)
+		}},
+		{keepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, period := range periods {
+		seen := make(map[string]bool)
+		for i, t := range times {
+			if len(seen) >= period.count {
+				break
+			}
+			key := period.key(t)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			keep[i] = true
+		}
+	}
+	return keep
+}
+
+// scheduleDue checks whether a schedule should have run since it last ran, or since it was created if it hasn't
+// run yet. Missed runs, such as while the server was off, result in a single run
+func scheduleDue(schedule persistence.BackupSchedule, now time.Time) (bool, error) {
+	parsed, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return false, err
+	}
+
+	last := schedule.LastRunAt
+	if last == 0 {
+		last = schedule.CreatedAt
+	}
+	next := parsed.Next(time.Unix(last, 0))
+	return !next.IsZero() && !next.After(now), nil
+}
+
+// BackupScheduler runs backup schedules when their cron expressions are due. Each app is backed up as a separate
+// backup job, one at a time so backups don't compete for the drive. Schedules with test restores enabled check each
+// backup with a verify job after it's made
+type BackupScheduler struct {
+	dockerClient   *client.Client
+	queries        *persistence.Queries
+	appDataHandler *storage.AppDataHandler
+	jobManager     *jobs.Manager
+	targets        *backup.TargetStore
+	hostConfig     config.Host
+	storageConfig  config.Storage
+	oryConfig      config.Ory
+	dockerConfig   config.Docker
+
+	mu      sync.Mutex
+	running map[int64]bool
+}
+
+func NewBackupScheduler(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	jobManager *jobs.Manager,
+	targets *backup.TargetStore,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	oryConfig config.Ory,
+	dockerConfig config.Docker,
+) *BackupScheduler {
+	return &BackupScheduler{
+		dockerClient:   dockerClient,
+		queries:        queries,
+		appDataHandler: appDataHandler,
+		jobManager:     jobManager,
+		targets:        targets,
+		hostConfig:     hostConfig,
+		storageConfig:  storageConfig,
+		oryConfig:      oryConfig,
+		dockerConfig:   dockerConfig,
+		running:        make(map[int64]bool),
+	}
+}
+
+// Run checks for due schedules every minute until the context is cancelled. Backups left running when the server
+// stopped are marked as failed first
+func (s *BackupScheduler) Run(ctx context.Context) {
+	if err := s.queries.FailInterruptedBackups(ctx); err != nil {
+		slog.Error(fmt.Sprintf("Failed to mark interrupted backups as failed: %s", err.Error()))
+	}
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runDue(ctx, now)
+		}
+	}
+}
+
+func (s *BackupScheduler) runDue(ctx context.Context, now time.Time) {
+	schedules, err := s.queries.GetBackupSchedules(ctx)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to retrieve backup schedules: %s", err.Error()))
+		return
+	}
+
+	for _, schedule := range schedules {
+		if !schedule.Enabled {
+			continue
+		}
+		due, err := scheduleDue(schedule, now)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Invalid backup schedule %d: %s", schedule.ID, err.Error()))
+			continue
+		}
+		if due {
+			s.RunNow(schedule)
+		}
+	}
+}
+
+// RunNow starts running the schedule in the background, returning false if it's already running
+func (s *BackupScheduler) RunNow(schedule persistence.BackupSchedule) bool {
+	s.mu.Lock()
+	if s.running[schedule.ID] {
+		s.mu.Unlock()
+		return false
+	}
+	s.running[schedule.ID] = true
+	s.mu.Unlock()
+
+	err := s.queries.SetBackupScheduleLastRun(context.Background(), persistence.SetBackupScheduleLastRunParams{
+		LastRunAt: time.Now().Unix(),
+		ID:        schedule.ID,
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to update backup schedule %d: %s", schedule.ID, err.Error()))
+	}
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, schedule.ID)
+			s.mu.Unlock()
+		}()
+		s.runSchedule(context.Background(), schedule)
+	}()
+	return true
+}
+
+// runSchedule backs up each app covered by the schedule to its target, waiting for each backup job to finish before
+// starting the next. Apps with another job running are skipped and recorded as failed. Successful backups are then
+// test restored if the schedule has test restores enabled
+func (s *BackupScheduler) runSchedule(ctx context.Context, schedule persistence.BackupSchedule) {
+	appIds := []string{schedule.AppID}
+	if schedule.AppID == "" {
+		installed, err := s.queries.GetApps(ctx)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to retrieve apps for backup schedule %d: %s", schedule.ID, err.Error()))
+			return
+		}
+		appIds = make([]string, 0, len(installed))
+		for _, app := range installed {
+			appIds = append(appIds, app.ID)
+		}
+	}
+
+	// A missing target is recorded against each app, so it shows in each app's history
+	target, targetErr := s.targets.Get(ctx, schedule.Target)
+
+	for _, appId := range appIds {
+		if targetErr != nil {
+			s.recordSkipped(ctx, schedule, appId, targetErr)
+			continue
+		}
+
+		done := make(chan struct{})
+		var snapshot string
+		_, err := s.jobManager.Start(jobs.Backup, appId, func(ctx context.Context, progress jobs.Progress) error {
+			defer close(done)
+			var err error
+			snapshot, err = runBackup(ctx, progress, s.dockerClient, s.queries, s.appDataHandler, s.storageConfig, appId, target, &schedule)
+			return err
+		})
+		if err != nil {
+			s.recordSkipped(ctx, schedule, appId, err)
+			continue
+		}
+		<-done
+
+		if schedule.TestRestore && snapshot != "" {
+			s.testRestore(appId, target, snapshot)
+		}
+	}
+}
+
+// testRestore test restores the backup just made as a verify job, waiting for it to finish. System backups can't be
+// test restored without replacing the device, so they're verified instead
+func (s *BackupScheduler) testRestore(appId string, target backup.TargetConfig, snapshot string) {
+	done := make(chan struct{})
+	_, err := s.jobManager.Start(jobs.Verify, appId, func(ctx context.Context, progress jobs.Progress) error {
+		defer close(done)
+		if appId == SystemBackupId {
+			return VerifyBackup(ctx, progress, s.queries, appId, target, snapshot)
+		}
+		return TestRestoreBackup(ctx, progress, s.dockerClient, s.queries, s.appDataHandler, s.hostConfig, s.storageConfig, s.oryConfig, s.dockerConfig, appId, target, snapshot)
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to start test restore of %s: %s", appId, err.Error()))
+		return
+	}
+	<-done
+}
+
+// recordSkipped records a backup that couldn't be started in the history, so it doesn't silently go missing
+func (s *BackupScheduler) recordSkipped(ctx context.Context, schedule persistence.BackupSchedule, appId string, reason error) {
+	now := time.Now().Unix()
+	historyId, err := s.queries.CreateBackupHistory(ctx, persistence.CreateBackupHistoryParams{
+		ScheduleID: schedule.ID,
+		AppID:      appId,
+		Target:     schedule.Target,
+		Status:     string(BackupFailed),
+		StartedAt:  now,
+	})
+	if err == nil {
+		err = s.queries.FinishBackupHistory(ctx, persistence.FinishBackupHistoryParams{
+			Status:     string(BackupFailed),
+			Error:      reason.Error(),
+			FinishedAt: now,
+			ID:         historyId,
+		})
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to record skipped backup of %s: %s", appId, err.Error()))
+	}
+}
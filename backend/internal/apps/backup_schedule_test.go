@@ -0,0 +1,86 @@
+package apps
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// Tests the newest snapshot of each day, week and month is kept up to the configured counts
+func TestRetainedSnapshots(t *testing.T) {
+	date := func(month time.Month, day int, hour int) time.Time {
+		return time.Date(2024, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	// Newest first, 15 and 14 May are in the same week, 8 May is the week before and April is the month before
+	times := []time.Time{
+		date(time.May, 15, 12),
+		date(time.May, 15, 6),
+		date(time.May, 14, 6),
+		date(time.May, 8, 6),
+		date(time.May, 1, 6),
+		date(time.April, 20, 6),
+		date(time.March, 3, 6),
+	}
+
+	tests := []struct {
+		name                               string
+		keepDaily, keepWeekly, keepMonthly int
+		expected                           []bool
+	}{
+		{"daily", 2, 0, 0, []bool{true, false, true, false, false, false, false}},
+		{"weekly", 0, 3, 0, []bool{true, false, false, true, true, false, false}},
+		{"monthly", 0, 0, 2, []bool{true, false, false, false, false, true, false}},
+		{"combined", 1, 2, 3, []bool{true, false, false, true, false, true, true}},
+		{"none", 0, 0, 0, []bool{true, false, false, false, false, false, false}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keep := retainedSnapshots(times, test.keepDaily, test.keepWeekly, test.keepMonthly)
+			if diff := cmp.Diff(test.expected, keep); diff != "" {
+				t.Errorf("Unexpected retained snapshots (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// Tests schedules are due once their next run since the last run, or creation, has passed
+func TestScheduleDue(t *testing.T) {
+	created := time.Date(2024, time.May, 15, 1, 30, 0, 0, time.Local)
+	schedule := persistence.BackupSchedule{Cron: "0 3 * * *", CreatedAt: created.Unix()}
+
+	tests := []struct {
+		name     string
+		lastRun  time.Time
+		now      time.Time
+		expected bool
+	}{
+		{"before first run", time.Time{}, created.Add(time.Hour), false},
+		{"first run", time.Time{}, created.Add(90 * time.Minute), true},
+		{"already ran", created.Add(90 * time.Minute), created.Add(2 * time.Hour), false},
+		{"missed runs", created.Add(90 * time.Minute), created.Add(72 * time.Hour), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := schedule
+			if !test.lastRun.IsZero() {
+				schedule.LastRunAt = test.lastRun.Unix()
+			}
+			due, err := scheduleDue(schedule, test.now)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if due != test.expected {
+				t.Errorf("Expected due to be %t, got %t", test.expected, due)
+			}
+		})
+	}
+
+	if _, err := scheduleDue(persistence.BackupSchedule{Cron: "not cron"}, time.Now()); err == nil {
+		t.Errorf("Expected error for invalid cron expression")
+	}
+}
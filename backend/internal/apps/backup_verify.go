@@ -0,0 +1,329 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// restoreTestPrefix is prepended to the ID of an app restored by a test restore, so its containers, volumes and data
+// directory are separate from the installed app's
+const restoreTestPrefix = "restore-test."
+
+var LegacyBackupError = errors.New("backups made before the backup repository was used can't be verified")
+
+// openSnapshot opens the target's repository and loads the app's snapshot. The returned target must be closed
+func openSnapshot(
+	ctx context.Context,
+	target backup.TargetConfig,
+	appId string,
+	snapshotName string,
+) (backup.Target, *backup.Repository, backup.Snapshot, error) {
+	backupTarget, err := backup.Open(ctx, target)
+	if err != nil {
+		return nil, nil, backup.Snapshot{}, fmt.Errorf("error opening backup target %s: %w", target.Name, err)
+	}
+
+	repository, err := backup.OpenRepository(ctx, backupTarget, target, false)
+	if err != nil {
+		backupTarget.Close()
+		return nil, nil, backup.Snapshot{}, fmt.Errorf("error opening backup repository on %s: %w", target.Name, err)
+	}
+	snapshot, err := repository.LoadSnapshot(ctx, appId, snapshotName)
+	if errors.Is(err, backup.NotFoundError) {
+		legacySnapshots, legacyErr := backup.ListLegacySnapshots(ctx, backupTarget, appId)
+		if legacyErr == nil && slices.Contains(legacySnapshots, snapshotName) {
+			err = LegacyBackupError
+		}
+	}
+	if err != nil {
+		backupTarget.Close()
+		return nil, nil, backup.Snapshot{}, fmt.Errorf("error reading backup %s from %s: %w", snapshotName, target.Name, err)
+	}
+	return backupTarget, repository, snapshot, nil
+}
+
+// VerifyBackup reads every archive of the app's backup, checking it against the manifest recorded when it was made.
+// The result is recorded in the backup history
+func VerifyBackup(
+	ctx context.Context,
+	progress jobs.Progress,
+	queries *persistence.Queries,
+	appId string,
+	target backup.TargetConfig,
+	snapshotName string,
+) error {
+	err := verifyBackup(ctx, progress, appId, target, snapshotName)
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+
+	// Backups made on other devices have no history, in which case nothing is recorded
+	recordErr := queries.SetBackupVerified(context.Background(), persistence.SetBackupVerifiedParams{
+		VerifiedAt:  time.Now().Unix(),
+		VerifyError: message,
+		AppID:       appId,
+		Target:      target.Name,
+		Snapshot:    snapshotName,
+	})
+	if recordErr != nil {
+		slog.Error(fmt.Sprintf("Failed to record verification of %s: %s", appId, recordErr.Error()))
+	}
+	return err
+}
+
+func verifyBackup(ctx context.Context, progress jobs.Progress, appId string, target backup.TargetConfig, snapshotName string) error {
+	progress.Step("Connecting to backup target")
+	backupTarget, repository, snapshot, err := openSnapshot(ctx, target, appId, snapshotName)
+	if err != nil {
+		return err
+	}
+	defer backupTarget.Close()
+
+	progress.Step("Verifying backup")
+	result, err := repository.Verify(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("found %d problems in %d archives: %s", len(result.Errors), len(snapshot.Archives), strings.Join(result.Errors, "; "))
+	}
+	return nil
+}
+
+// TestRestoreBackup restores the app's backup as a separate app, with its own volumes and data directory, then checks
+// its containers become healthy. The restored app is always removed afterwards, and the installed app is left running.
+// The result is recorded in the backup history
+func TestRestoreBackup(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	oryConfig config.Ory,
+	dockerConfig config.Docker,
+	appId string,
+	target backup.TargetConfig,
+	snapshotName string,
+) error {
+	if appId == SystemBackupId {
+		return errors.New("system backups can't be test restored, verify them instead")
+	}
+	app, err := queries.GetAppWithCreds(ctx, appId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", AppNotInstalledError, appId)
+	} else if err != nil {
+		return err
+	}
+
+	err = testRestore(ctx, progress, dockerClient, queries, appDataHandler, hostConfig, storageConfig, oryConfig, dockerConfig, app, target, snapshotName)
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+
+	recordErr := queries.SetBackupRestoreTested(context.Background(), persistence.SetBackupRestoreTestedParams{
+		RestoreTestedAt:  time.Now().Unix(),
+		RestoreTestError: message,
+		AppID:            appId,
+		Target:           target.Name,
+		Snapshot:         snapshotName,
+	})
+	if recordErr != nil {
+		slog.Error(fmt.Sprintf("Failed to record test restore of %s: %s", appId, recordErr.Error()))
+	}
+	return err
+}
+
+func testRestore(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	oryConfig config.Ory,
+	dockerConfig config.Docker,
+	app persistence.AppWithCreds,
+	target backup.TargetConfig,
+	snapshotName string,
+) error {
+	progress.Step("Connecting to backup target")
+	backupTarget, repository, snapshot, err := openSnapshot(ctx, target, app.ID, snapshotName)
+	if err != nil {
+		return err
+	}
+	defer backupTarget.Close()
+	if err := repository.CheckSnapshot(ctx, snapshot); err != nil {
+		return fmt.Errorf("error checking backup %s: %w", snapshotName, err)
+	}
+
+	// Anything left by an interrupted test restore is removed first
+	testId := restoreTestPrefix + app.ID
+	if err := removeTestRestore(ctx, dockerClient, storageConfig, testId); err != nil {
+		return fmt.Errorf("error removing previous test restore: %w", err)
+	}
+	defer func() {
+		if err := removeTestRestore(context.Background(), dockerClient, storageConfig, testId); err != nil {
+			slog.Error(fmt.Sprintf("Failed to remove test restore of %s: %s", app.ID, err.Error()))
+		}
+	}()
+
+	progress.Step("Restoring backup")
+	secrets, err := restoreTestArchives(ctx, dockerClient, storageConfig, app.ID, testId, repository, snapshot)
+	if err != nil {
+		return err
+	}
+
+	progress.Step("Starting restored app")
+	testApp, err := testRestorePackage(ctx, queries, appDataHandler, oryConfig, hostConfig, storageConfig, app, testId, secrets)
+	if err != nil {
+		return err
+	}
+	if err := docker.InstallApp(dockerClient, testApp, hostConfig, storageConfig, dockerConfig); err != nil {
+		return fmt.Errorf("error creating containers: %w", err)
+	}
+	if err := docker.StartApp(dockerClient, testId); err != nil {
+		return fmt.Errorf("error starting restored app: %w", err)
+	}
+
+	progress.Step("Checking restored app")
+	containers, err := docker.GetAppContainers(dockerClient, testId)
+	if err != nil {
+		return err
+	}
+	for _, appContainer := range containers {
+		if err := docker.UntilHealthy(ctx, dockerClient, appContainer.ID); err != nil {
+			return fmt.Errorf("restored container %s didn't become healthy: %w", appContainer.Labels[docker.ContainerNameLabel], err)
+		}
+	}
+	return nil
+}
+
+// restoreTestArchives restores the snapshot's data directory and volumes under the test restore's ID, returning the
+// secrets stored in the snapshot. Each archive is read to the end, so it's checked against its hash
+func restoreTestArchives(
+	ctx context.Context,
+	dockerClient *client.Client,
+	storageConfig config.Storage,
+	appId string,
+	testId string,
+	repository *backup.Repository,
+	snapshot backup.Snapshot,
+) (map[string]string, error) {
+	secrets := make(map[string]string)
+	for _, archive := range snapshot.Archives {
+		reader := repository.OpenArchive(ctx, archive)
+		switch {
+		case archive.Name == dataArchive:
+			if err := docker.ExtractFolderArchive(storageConfig, testId, reader); err != nil {
+				return nil, fmt.Errorf("error restoring app data: %w", err)
+			}
+		case archive.Name == secretsArchive:
+			if err := json.NewDecoder(reader).Decode(&secrets); err != nil {
+				return nil, fmt.Errorf("error reading app secrets: %w", err)
+			}
+		case strings.HasPrefix(archive.Name, volumeArchivePrefix):
+			volumeName := strings.TrimPrefix(archive.Name, volumeArchivePrefix)
+			if !strings.HasPrefix(volumeName, appId) {
+				return nil, fmt.Errorf("volume %s doesn't belong to %s", volumeName, appId)
+			}
+			testVolume := testId + strings.TrimPrefix(volumeName, appId)
+			if err := docker.ImportVolume(ctx, dockerClient, testId, testVolume, reader); err != nil {
+				return nil, fmt.Errorf("error restoring volume %s: %w", volumeName, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown archive %s in backup", archive.Name)
+		}
+
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			return nil, fmt.Errorf("error reading archive %s: %w", archive.Name, err)
+		}
+	}
+	return secrets, nil
+}
+
+// testRestorePackage templates the app's package as it would be restored, using the secrets from the backup where it
+// has them, then renames it to the test restore's ID. Ports aren't published and containers aren't proxied, so the
+// restored app doesn't conflict with the installed one
+func testRestorePackage(
+	ctx context.Context,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	app persistence.AppWithCreds,
+	testId string,
+	backupSecrets map[string]string,
+) (persistence.AppPackage, error) {
+	settings, err := appDataHandler.AppSettings(ctx, queries, app.Schema)
+	if err != nil {
+		return persistence.AppPackage{}, fmt.Errorf("failed to get app settings: %w", err)
+	}
+	currentSecrets, err := appDataHandler.ExportSecrets(ctx, queries, app.ID)
+	if err != nil {
+		return persistence.AppPackage{}, fmt.Errorf("failed to get app secrets: %w", err)
+	}
+	secrets := make(map[string]string, len(app.Schema.Secrets))
+	for _, secret := range app.Schema.Secrets {
+		value, ok := backupSecrets[secret.Key]
+		if !ok {
+			value, ok = currentSecrets[secret.Key]
+		}
+		if !ok {
+			return persistence.AppPackage{}, fmt.Errorf("%w: %s", storage.MissingSecretError, secret.Key)
+		}
+		secrets[secret.Key] = value
+	}
+
+	templatedApp, err := storage.TemplateAppPackage(app.Schema, app.ClientID.String, app.ClientSecret.String, oryConfig, hostConfig, storageConfig, settings, secrets)
+	if err != nil {
+		return persistence.AppPackage{}, err
+	}
+	templatedApp, err = applyLimitOverrides(ctx, queries, templatedApp)
+	if err != nil {
+		return persistence.AppPackage{}, err
+	}
+
+	templatedApp.Id = testId
+	templatedApp.Containers = slices.Clone(templatedApp.Containers)
+	for i := range templatedApp.Containers {
+		templatedApp.Containers[i].Ports = nil
+		templatedApp.Containers[i].ProxyTarget = false
+	}
+	return templatedApp, nil
+}
+
+// removeTestRestore removes the containers, networks, volumes and data directory of a test restore
+func removeTestRestore(ctx context.Context, dockerClient *client.Client, storageConfig config.Storage, testId string) error {
+	if err := docker.UninstallApp(dockerClient, testId); err != nil {
+		return err
+	}
+	if err := docker.RemoveAppVolumes(ctx, dockerClient, testId); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(storageConfig.DataPath, testId))
+}
@@ -0,0 +1,69 @@
+package apps
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// Tests test restores are templated with the backup's secrets under their own ID, without ports or proxying
+func TestTestRestorePackage(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+	ctx := context.Background()
+
+	cipher, err := encryption.NewCipher(make([]byte, encryption.KeySize))
+	if err != nil {
+		t.Fatalf("Unexpected error creating cipher: %s", err.Error())
+	}
+	dataHandler := storage.NewAppDataHandler(config.Storage{}, config.Store{})
+	dataHandler.SetCipher(cipher)
+
+	app := persistence.AppWithCreds{
+		Schema: persistence.AppPackage{
+			Id:      "test.app",
+			Secrets: []persistence.PackageSecret{{Key: "db_password"}, {Key: "app_key"}},
+			Containers: []persistence.PackageContainer{
+				{
+					Name:        "server",
+					Ports:       []string{"8080:80"},
+					ProxyTarget: true,
+					Environment: map[string]string{"DB_PASSWORD": "{{.Secrets.db_password}}", "APP_KEY": "{{.Secrets.app_key}}"},
+				},
+			},
+		},
+	}
+	app.ID = "test.app"
+	if err := dataHandler.ImportSecrets(ctx, queries, app.ID, map[string]string{"db_password": "current", "app_key": "key"}); err != nil {
+		t.Fatalf("Unexpected error storing secrets: %s", err.Error())
+	}
+
+	testApp, err := testRestorePackage(ctx, queries, dataHandler, config.Ory{}, config.Host{}, config.Storage{}, app, "restore-test.test.app", map[string]string{"db_password": "restored"})
+	if err != nil {
+		t.Fatalf("Unexpected error templating package: %s", err.Error())
+	}
+	if testApp.Id != "restore-test.test.app" {
+		t.Errorf("Expected test restore ID, got %s", testApp.Id)
+	}
+	server := testApp.Containers[0]
+	if len(server.Ports) != 0 || server.ProxyTarget {
+		t.Errorf("Expected container without ports or proxying, got %+v", server)
+	}
+	// Secrets missing from the backup use the current values
+	expected := map[string]string{"DB_PASSWORD": "restored", "APP_KEY": "key"}
+	if diff := cmp.Diff(expected, server.Environment); diff != "" {
+		t.Errorf("Environment mismatch (-want +got):\n%s", diff)
+	}
+
+	// The installed app's package isn't changed
+	if !app.Schema.Containers[0].ProxyTarget {
+		t.Error("Original package was modified")
+	}
+}
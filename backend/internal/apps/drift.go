@@ -0,0 +1,506 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/client"
+	hydra "github.com/ory/hydra-client-go/v2"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/auth"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// DriftKind is a type of mismatch between the apps in the database and the resources that exist in docker and hydra
+type DriftKind string
+
+const (
+	// DriftMissingContainers is an installed app with some or all of its package's containers missing
+	DriftMissingContainers DriftKind = "missing_containers"
+	// DriftUnexpectedContainer is a container of an installed app that isn't in its package, such as one left behind
+	// by a previous version
+	DriftUnexpectedContainer DriftKind = "unexpected_container"
+	// DriftMissingNetwork is an installed app without its network, or its proxy network when it has proxy targets
+	DriftMissingNetwork DriftKind = "missing_network"
+	// DriftMissingOAuthClient is an installed app using OIDC whose OAuth2 client doesn't exist in hydra
+	DriftMissingOAuthClient DriftKind = "missing_oauth_client"
+	// DriftOrphanedContainers are the containers of an app that isn't installed
+	DriftOrphanedContainers DriftKind = "orphaned_containers"
+	// DriftOrphanedNetwork is a network of an app that isn't installed, or a proxy network of an app without proxy
+	// targets
+	DriftOrphanedNetwork DriftKind = "orphaned_network"
+	// DriftOrphanedVolume is a volume of an app that isn't installed
+	DriftOrphanedVolume DriftKind = "orphaned_volume"
+	// DriftOrphanedOAuthClient is an OAuth2 client in hydra not used by any installed app
+	DriftOrphanedOAuthClient DriftKind = "orphaned_oauth_client"
+)
+
+// RepairAction is a way of fixing drift
+type RepairAction string
+
+const (
+	// RepairReinstall recreates the resources of an installed app, keeping its data
+	RepairReinstall RepairAction = "reinstall"
+	// RepairAdopt installs an orphaned app from the package in its data directory, keeping its volumes
+	RepairAdopt RepairAction = "adopt"
+	// RepairRemove removes the orphaned or unexpected resource
+	RepairRemove RepairAction = "remove"
+)
+
+var DriftNotFoundError = errors.New("drift not found")
+var InvalidRepairError = errors.New("repair action can't be used for this drift")
+
+// Drift is a single mismatch. Resource is the name of the docker resource or client ID affected, or the names of the
+// containers for container drift
+type Drift struct {
+	Kind     DriftKind      `json:"kind"`
+	AppID    string         `json:"app_id"`
+	Resource string         `json:"resource"`
+	Message  string         `json:"message"`
+	Actions  []RepairAction `json:"actions"`
+}
+
+// JobKey is the key the repair of the drift runs under, so only one job changes an app at once. Drift not belonging to
+// an app, such as an orphaned OAuth2 client, is keyed by its resource instead
+func (d Drift) JobKey() string {
+	if d.AppID != "" {
+		return d.AppID
+	}
+	return string(d.Kind) + ":" + d.Resource
+}
+
+// Matches checks whether two drifts refer to the same mismatch, ignoring the message and actions
+func (d Drift) Matches(other Drift) bool {
+	return d.Kind == other.Kind && d.AppID == other.AppID && d.Resource == other.Resource
+}
+
+// DetectDrift compares the apps in the database with the containers, networks and volumes in docker and the OAuth2
+// clients in hydra. System apps installed by the launcher aren't stored in the database so are ignored
+func DetectDrift(
+	ctx context.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+) ([]Drift, error) {
+	installed, err := queries.GetAppsWithCreds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory, err := docker.ListAppResources(ctx, dockerClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list docker resources: %w", err)
+	}
+
+	clients, err := auth.ListClients(ctx, hydraAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OAuth2 clients: %w", err)
+	}
+
+	return findDrift(installed, inventory, clients), nil
+}
+
+// findDrift compares the installed apps with the resources that exist, returning drift for installed apps followed
+// by orphaned resources
+func findDrift(installed []persistence.AppWithCreds, inventory docker.Inventory, clients []hydra.OAuth2Client) []Drift {
+	drift := []Drift{}
+	installedIds := make(map[string]bool)
+	referencedClients := make(map[string]bool)
+	clientIds := make(map[string]bool)
+	for _, oauthClient := range clients {
+		clientIds[oauthClient.GetClientId()] = true
+	}
+
+	for _, app := range installed {
+		installedIds[app.ID] = true
+		if app.ClientID.Valid {
+			referencedClients[app.ClientID.String] = true
+		}
+
+		// Compares the containers that exist with the containers of the package
+		var existing []string
+		for _, appContainer := range inventory.Containers {
+			if appContainer.AppID != app.ID {
+				continue
+			}
+			existing = append(existing, appContainer.PackageName)
+			if !slices.ContainsFunc(app.Schema.Containers, func(c persistence.PackageContainer) bool {
+				return c.Name == appContainer.PackageName
+			}) {
+				drift = append(drift, Drift{
+					Kind:     DriftUnexpectedContainer,
+					AppID:    app.ID,
+					Resource: appContainer.Name,
+					Message:  fmt.Sprintf("Container %s isn't part of the %s package", appContainer.Name, app.ID),
+					Actions:  []RepairAction{RepairRemove},
+				})
+			}
+		}
+
+		var missing []string
+		needsProxy := false
+		for _, packageContainer := range app.Schema.Containers {
+			if !slices.Contains(existing, packageContainer.Name) {
+				missing = append(missing, packageContainer.Name)
+			}
+			needsProxy = needsProxy || packageContainer.ProxyTarget
+		}
+		if len(missing) > 0 {
+			drift = append(drift, Drift{
+				Kind:     DriftMissingContainers,
+				AppID:    app.ID,
+				Resource: strings.Join(missing, ","),
+				Message:  fmt.Sprintf("%s is missing containers %s", app.ID, strings.Join(missing, ", ")),
+				Actions:  []RepairAction{RepairReinstall},
+			})
+		}
+
+		// Checks the app network exists, and the proxy network only exists when needed
+		networks := make(map[string]bool)
+		for _, appNetwork := range inventory.Networks {
+			if appNetwork.AppID == app.ID {
+				networks[appNetwork.Name] = true
+			}
+		}
+		expectedNetworks := []string{app.ID}
+		if needsProxy {
+			expectedNetworks = append(expectedNetworks, app.ID+"-proxy")
+		}
+		for _, networkName := range expectedNetworks {
+			if !networks[networkName] {
+				drift = append(drift, Drift{
+					Kind:     DriftMissingNetwork,
+					AppID:    app.ID,
+					Resource: networkName,
+					Message:  fmt.Sprintf("%s is missing network %s", app.ID, networkName),
+					Actions:  []RepairAction{RepairReinstall},
+				})
+			}
+		}
+		if !needsProxy && networks[app.ID+"-proxy"] {
+			drift = append(drift, Drift{
+				Kind:     DriftOrphanedNetwork,
+				AppID:    app.ID,
+				Resource: app.ID + "-proxy",
+				Message:  fmt.Sprintf("%s has a proxy network but no proxy targets", app.ID),
+				Actions:  []RepairAction{RepairRemove},
+			})
+		}
+
+		if app.Schema.OidcEnabled && (!app.ClientID.Valid || !clientIds[app.ClientID.String]) {
+			drift = append(drift, Drift{
+				Kind:     DriftMissingOAuthClient,
+				AppID:    app.ID,
+				Resource: app.ClientID.String,
+				Message:  fmt.Sprintf("%s uses OIDC but its OAuth2 client doesn't exist", app.ID),
+				Actions:  []RepairAction{RepairReinstall},
+			})
+		}
+	}
+
+	// Resources of apps that aren't installed, grouping containers by app since they're adopted or removed together
+	isOrphaned := func(appId string) bool {
+		return !installedIds[appId] && !slices.Contains(docker.SystemApps, appId)
+	}
+	orphanedContainers := make(map[string][]string)
+	var orphanedApps []string
+	for _, appContainer := range inventory.Containers {
+		if !isOrphaned(appContainer.AppID) {
+			continue
+		}
+		if _, ok := orphanedContainers[appContainer.AppID]; !ok {
+			orphanedApps = append(orphanedApps, appContainer.AppID)
+		}
+		orphanedContainers[appContainer.AppID] = append(orphanedContainers[appContainer.AppID], appContainer.Name)
+	}
+	for _, appId := range orphanedApps {
+		drift = append(drift, Drift{
+			Kind:     DriftOrphanedContainers,
+			AppID:    appId,
+			Resource: strings.Join(orphanedContainers[appId], ","),
+			Message:  fmt.Sprintf("%s has containers but isn't installed", appId),
+			Actions:  []RepairAction{RepairAdopt, RepairRemove},
+		})
+	}
+	for _, appNetwork := range inventory.Networks {
+		if isOrphaned(appNetwork.AppID) {
+			drift = append(drift, Drift{
+				Kind:     DriftOrphanedNetwork,
+				AppID:    appNetwork.AppID,
+				Resource: appNetwork.Name,
+				Message:  fmt.Sprintf("Network %s belongs to %s which isn't installed", appNetwork.Name, appNetwork.AppID),
+				Actions:  []RepairAction{RepairRemove},
+			})
+		}
+	}
+	for _, appVolume := range inventory.Volumes {
+		if isOrphaned(appVolume.AppID) {
+			drift = append(drift, Drift{
+				Kind:     DriftOrphanedVolume,
+				AppID:    appVolume.AppID,
+				Resource: appVolume.Name,
+				Message:  fmt.Sprintf("Volume %s belongs to %s which isn't installed", appVolume.Name, appVolume.AppID),
+				Actions:  []RepairAction{RepairRemove},
+			})
+		}
+	}
+
+	for _, oauthClient := range clients {
+		if !referencedClients[oauthClient.GetClientId()] {
+			drift = append(drift, Drift{
+				Kind:     DriftOrphanedOAuthClient,
+				Resource: oauthClient.GetClientId(),
+				Message:  fmt.Sprintf("OAuth2 client %s (%s) isn't used by any app", oauthClient.GetClientId(), oauthClient.GetClientName()),
+				Actions:  []RepairAction{RepairRemove},
+			})
+		}
+	}
+
+	return drift
+}
+
+// FindDrift detects drift and returns the current drift matching the given one, checking the repair action can be
+// used for it
+func FindDrift(
+	ctx context.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	target Drift,
+	action RepairAction,
+) (Drift, error) {
+	detected, err := DetectDrift(ctx, dockerClient, queries, hydraAdmin)
+	if err != nil {
+		return Drift{}, err
+	}
+
+	index := slices.IndexFunc(detected, target.Matches)
+	if index == -1 {
+		return Drift{}, DriftNotFoundError
+	}
+	if !slices.Contains(detected[index].Actions, action) {
+		return Drift{}, fmt.Errorf("%w: %s", InvalidRepairError, action)
+	}
+	return detected[index], nil
+}
+
+// RepairDrift fixes the given drift using the chosen action, after checking it still exists
+func RepairDrift(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	target Drift,
+	action RepairAction,
+) error {
+	progress.Step("Checking drift")
+	drift, err := FindDrift(ctx, dockerClient, queries, hydraAdmin, target, action)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case RepairReinstall:
+		progress.Step("Reinstalling app")
+		return reinstallApp(ctx, dockerClient, queries, hydraAdmin, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, drift.AppID)
+	case RepairAdopt:
+		progress.Step("Adopting app")
+		return adoptApp(ctx, dockerClient, queries, hydraAdmin, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, drift.AppID)
+	default:
+		progress.Step("Removing " + drift.Resource)
+		return removeDrift(ctx, dockerClient, hydraAdmin, drift)
+	}
+}
+
+// reinstallApp recreates the containers and networks of an installed app, registering a new OAuth2 client first if
+// its client is missing
+func reinstallApp(
+	ctx context.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	appId string,
+) (err error) {
+	rollback := &Rollback{}
+	defer rollback.RunOnError(context.Background(), &err)
+
+	app, err := queries.GetAppWithCreds(ctx, appId)
+	if err != nil {
+		return err
+	}
+
+	if app.Schema.OidcEnabled {
+		clients, err := auth.ListClients(ctx, hydraAdmin)
+		if err != nil {
+			return fmt.Errorf("failed to list OAuth2 clients: %w", err)
+		}
+		if !slices.ContainsFunc(clients, func(c hydra.OAuth2Client) bool {
+			return app.ClientID.Valid && c.GetClientId() == app.ClientID.String
+		}) {
+			if err := replaceOAuthClient(ctx, rollback, queries, hydraAdmin, hostConfig, &app); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Stops any remaining containers, since restoring removes and recreates all of them
+	if err := docker.StopApp(dockerClient, appId); err != nil {
+		return fmt.Errorf("failed to stop app: %w", err)
+	}
+	return restoreApp(dockerClient, queries, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, app)
+}
+
+// replaceOAuthClient registers a new OAuth2 client for the app and stores its credentials
+func replaceOAuthClient(
+	ctx context.Context,
+	rollback *Rollback,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hostConfig config.Host,
+	app *persistence.AppWithCreds,
+) error {
+	oidcClient, err := createOAuthClient(hydraAdmin, hostConfig, app.Schema)
+	if err != nil {
+		return fmt.Errorf("failed to create OAuth2 client: %w", err)
+	}
+	rollback.Add("create OAuth2 client", func(ctx context.Context) error {
+		_, err := hydraAdmin.OAuth2API.DeleteOAuth2Client(ctx, oidcClient.GetClientId()).Execute()
+		return err
+	})
+
+	previousId, previousSecret := app.ClientID, app.ClientSecret
+	app.ClientID = sql.NullString{String: oidcClient.GetClientId(), Valid: true}
+	app.ClientSecret = sql.NullString{String: oidcClient.GetClientSecret(), Valid: true}
+	err = queries.SetAppOAuth(ctx, persistence.SetAppOAuthParams{
+		ClientID:     app.ClientID,
+		ClientSecret: app.ClientSecret,
+		ID:           app.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store OAuth2 client: %w", err)
+	}
+	rollback.Add("store OAuth2 client", func(ctx context.Context) error {
+		return queries.SetAppOAuth(ctx, persistence.SetAppOAuthParams{
+			ClientID:     previousId,
+			ClientSecret: previousSecret,
+			ID:           app.ID,
+		})
+	})
+
+	return nil
+}
+
+// adoptApp adds an app with orphaned containers to the database using the package saved in its data directory, then
+// recreates its containers so they use the new OAuth2 client and secrets. Volumes are kept, so the app's data is
+// preserved. Secrets the package declares are generated using their upgrade values, since the previous values are lost
+func adoptApp(
+	ctx context.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	appId string,
+) (err error) {
+	rollback := &Rollback{}
+	defer rollback.RunOnError(context.Background(), &err)
+
+	schemaData, err := os.ReadFile(filepath.Join(storageConfig.DataPath, appId, "schema.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read saved package: %w", err)
+	}
+	// The package may have been saved by an older version, so is migrated to the current schema
+	appPackage, err := schema.Parse(schemaData)
+	if err != nil {
+		return fmt.Errorf("failed to parse saved package: %w", err)
+	}
+	if appPackage.Id != appId {
+		return fmt.Errorf("saved package is for %s rather than %s", appPackage.Id, appId)
+	}
+	if err := schema.Validate(appPackage); err != nil {
+		return err
+	}
+
+	schemaString, err := json.Marshal(appPackage)
+	if err != nil {
+		return fmt.Errorf("failed to marshal app package json: %w", err)
+	}
+	err = queries.CreateApp(ctx, persistence.CreateAppParams{ID: appId, Schema: schemaString})
+	if err != nil {
+		return fmt.Errorf("failed to create app entry in DB: %w", err)
+	}
+	rollback.Add("create app entry in DB", func(ctx context.Context) error {
+		_, err := queries.RemoveApp(ctx, appId)
+		return err
+	})
+
+	app, err := queries.GetAppWithCreds(ctx, appId)
+	if err != nil {
+		return err
+	}
+	if appPackage.OidcEnabled {
+		if err := replaceOAuthClient(ctx, rollback, queries, hydraAdmin, hostConfig, &app); err != nil {
+			return err
+		}
+	}
+
+	if err := generateSecrets(ctx, rollback, queries, appDataHandler, appPackage, true); err != nil {
+		return err
+	}
+
+	if err := docker.StopApp(dockerClient, appId); err != nil {
+		return fmt.Errorf("failed to stop orphaned containers: %w", err)
+	}
+	return restoreApp(dockerClient, queries, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, app)
+}
+
+// removeDrift removes an orphaned or unexpected resource
+func removeDrift(ctx context.Context, dockerClient *client.Client, hydraAdmin *hydra.APIClient, drift Drift) error {
+	switch drift.Kind {
+	case DriftOrphanedContainers:
+		if err := docker.StopApp(dockerClient, drift.AppID); err != nil {
+			return err
+		}
+		return docker.UninstallApp(dockerClient, drift.AppID)
+	case DriftUnexpectedContainer:
+		return docker.RemoveContainer(ctx, dockerClient, drift.Resource)
+	case DriftOrphanedNetwork:
+		return docker.RemoveResources(ctx, dockerClient, docker.Resources{Networks: []string{drift.Resource}})
+	case DriftOrphanedVolume:
+		return docker.RemoveResources(ctx, dockerClient, docker.Resources{Volumes: []string{drift.Resource}})
+	case DriftOrphanedOAuthClient:
+		_, err := hydraAdmin.OAuth2API.DeleteOAuth2Client(ctx, drift.Resource).Execute()
+		return err
+	default:
+		return fmt.Errorf("%w: %s", InvalidRepairError, RepairRemove)
+	}
+}
@@ -0,0 +1,107 @@
+package apps
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	hydra "github.com/ory/hydra-client-go/v2"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+func installedApp(id string, clientId string, containers ...persistence.PackageContainer) persistence.AppWithCreds {
+	app := persistence.AppWithCreds{Schema: persistence.AppPackage{Id: id, Containers: containers}}
+	app.ID = id
+	if clientId != "" {
+		app.Schema.OidcEnabled = true
+		app.ClientID = sql.NullString{String: clientId, Valid: true}
+	}
+	return app
+}
+
+// Tests mismatches between installed apps, docker resources and OAuth2 clients are found, ignoring system apps
+func TestFindDrift(t *testing.T) {
+	installed := []persistence.AppWithCreds{
+		installedApp("healthy", "healthy-client", persistence.PackageContainer{Name: "server", ProxyTarget: true}),
+		installedApp("broken", "missing-client",
+			persistence.PackageContainer{Name: "server", ProxyTarget: true},
+			persistence.PackageContainer{Name: "database"},
+		),
+		installedApp("internal", "", persistence.PackageContainer{Name: "worker"}),
+	}
+	inventory := docker.Inventory{
+		Containers: []docker.InventoryContainer{
+			{Name: "healthy-server", AppID: "healthy", PackageName: "server"},
+			{Name: "broken-server", AppID: "broken", PackageName: "server"},
+			{Name: "broken-cache", AppID: "broken", PackageName: "cache"},
+			{Name: "internal-worker", AppID: "internal", PackageName: "worker"},
+			{Name: "removed-server", AppID: "removed", PackageName: "server"},
+			{Name: "removed-database", AppID: "removed", PackageName: "database"},
+			{Name: "ory-kratos", AppID: "ory.kratos", PackageName: "kratos"},
+		},
+		Networks: []docker.InventoryResource{
+			{Name: "healthy", AppID: "healthy"},
+			{Name: "healthy-proxy", AppID: "healthy"},
+			{Name: "broken", AppID: "broken"},
+			{Name: "internal", AppID: "internal"},
+			{Name: "internal-proxy", AppID: "internal"},
+			{Name: "removed", AppID: "removed"},
+			{Name: "ory.kratos", AppID: "ory.kratos"},
+		},
+		Volumes: []docker.InventoryResource{
+			{Name: "healthy-data", AppID: "healthy"},
+			{Name: "removed-data", AppID: "removed"},
+			{Name: "ory.kratos-data", AppID: "ory.kratos"},
+		},
+	}
+	clients := []hydra.OAuth2Client{
+		{ClientId: hydra.PtrString("healthy-client")},
+		{ClientId: hydra.PtrString("leftover-client")},
+	}
+
+	type found struct {
+		Kind     DriftKind
+		AppID    string
+		Resource string
+	}
+	expected := []found{
+		{DriftUnexpectedContainer, "broken", "broken-cache"},
+		{DriftMissingContainers, "broken", "database"},
+		{DriftMissingNetwork, "broken", "broken-proxy"},
+		{DriftMissingOAuthClient, "broken", "missing-client"},
+		{DriftOrphanedNetwork, "internal", "internal-proxy"},
+		{DriftOrphanedContainers, "removed", "removed-server,removed-database"},
+		{DriftOrphanedNetwork, "removed", "removed"},
+		{DriftOrphanedVolume, "removed", "removed-data"},
+		{DriftOrphanedOAuthClient, "", "leftover-client"},
+	}
+
+	var actual []found
+	for _, drift := range findDrift(installed, inventory, clients) {
+		actual = append(actual, found{drift.Kind, drift.AppID, drift.Resource})
+		if len(drift.Actions) == 0 {
+			t.Errorf("Expected repair actions for %s drift of %s", drift.Kind, drift.AppID)
+		}
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("Unexpected drift (-want +got):\n%s", diff)
+	}
+}
+
+// Tests repairs of drift without an app are keyed by their resource, so they don't share a key with each other
+func TestDriftJobKey(t *testing.T) {
+	tests := []struct {
+		drift    Drift
+		expected string
+	}{
+		{Drift{Kind: DriftMissingNetwork, AppID: "broken", Resource: "broken"}, "broken"},
+		{Drift{Kind: DriftOrphanedOAuthClient, Resource: "old-client"}, "orphaned_oauth_client:old-client"},
+	}
+	for _, test := range tests {
+		if key := test.drift.JobKey(); key != test.expected {
+			t.Errorf("Expected job key %s for %v, got %s", test.expected, test.drift, key)
+		}
+	}
+}
@@ -1,22 +1,37 @@
 package apps
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net/http"
 	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"golang.org/x/crypto/acme/autocert"
 
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
 )
 
 type HostsMap map[string]*echo.Echo
 
 type Hosts struct {
-	hosts        HostsMap
+	mutex sync.RWMutex
+	hosts HostsMap
+	// addressHosts stores the public hosts added for each host address, so all of an app's subdomains are replaced
+	// and removed together
+	addressHosts map[string][]string
 	tlsManager   *autocert.Manager
 	config       config.Host
 	checkedCerts bool
@@ -25,49 +40,168 @@ type Hosts struct {
 func NewHosts(hosts HostsMap, tlsManager *autocert.Manager, config config.Host) *Hosts {
 	return &Hosts{
 		hosts:        hosts,
+		addressHosts: make(map[string][]string),
 		tlsManager:   tlsManager,
 		config:       config,
 		checkedCerts: false,
 	}
 }
 
-// AddProxy creates and adds a new reverse proxy at the given address
+// ProxyRoute sends requests for a host address matching the route to the container at the given address
+type ProxyRoute struct {
+	Route   persistence.PackageRoute
+	Address string
+}
+
+// hostRoute is a route served by a host, with the proxy requests matching its path are sent to
+type hostRoute struct {
+	path        string
+	stripPrefix bool
+	webSocket   bool
+	proxy       echo.MiddlewareFunc
+}
+
+// AddProxy creates and adds a new reverse proxy at the given address, sending every request to the given container
 func (hosts *Hosts) AddProxy(hostAddress string, proxyAddress string, proxyPort string) error {
-	// creates echo host for the application
-	proxyHost := echo.New()
+	return hosts.AddRoutes(hostAddress, []ProxyRoute{{
+		Route:   persistence.PackageRoute{Path: "/", Port: proxyPort, WebSocket: true},
+		Address: proxyAddress,
+	}})
+}
 
-	appUrl, err := url.Parse(fmt.Sprintf("http://%s:%s", proxyAddress, proxyPort))
-	if err != nil {
-		return err
+// AddRoutes creates a router for each subdomain of the host address used by the routes, replacing the routes
+// previously added for the address. Route paths are expected to be normalised by schema.ProxyRoutes
+func (hosts *Hosts) AddRoutes(hostAddress string, routes []ProxyRoute) error {
+	subdomainRoutes := make(map[string][]hostRoute)
+	for _, route := range routes {
+		targetUrl, err := url.Parse(fmt.Sprintf("http://%s:%s", route.Address, route.Route.Port))
+		if err != nil {
+			return err
+		}
+		targets := []*middleware.ProxyTarget{{URL: targetUrl}}
+		subdomainRoutes[route.Route.Subdomain] = append(subdomainRoutes[route.Route.Subdomain], hostRoute{
+			path:        route.Route.Path,
+			stripPrefix: route.Route.StripPrefix,
+			webSocket:   route.Route.WebSocket,
+			proxy:       middleware.Proxy(middleware.NewRoundRobinBalancer(targets)),
+		})
 	}
 
-	targets := []*middleware.ProxyTarget{
-		{
-			URL: appUrl,
-		},
-	}
+	// creates an echo host for each subdomain, sending requests to the route with the longest matching path
+	routers := make(map[string]*echo.Echo)
+	for subdomain, subdomainRoute := range subdomainRoutes {
+		slices.SortStableFunc(subdomainRoute, func(a, b hostRoute) int {
+			return len(b.path) - len(a.path)
+		})
+		proxyHost := echo.New()
+		proxyHost.Use(routeMiddleware(subdomainRoute))
 
-	proxyHost.Use(middleware.Proxy(middleware.NewRoundRobinBalancer(targets)))
+		publicHost := hosts.publicHost(hostAddress)
+		if subdomain != "" {
+			publicHost = hosts.publicHost(subdomain + "." + hostAddress)
+		}
+		routers[publicHost] = proxyHost
+	}
 
-	publicHost := fmt.Sprintf("%s.%s", hostAddress, hosts.config.Host)
-	if hosts.config.Port != 80 && hosts.config.Port != 443 {
-		publicHost = fmt.Sprintf("%s:%d", publicHost, hosts.config.Port)
+	hosts.mutex.Lock()
+	for _, publicHost := range hosts.addressHosts[hostAddress] {
+		delete(hosts.hosts, publicHost)
+	}
+	publicHosts := make([]string, 0, len(routers))
+	for publicHost, router := range routers {
+		hosts.hosts[publicHost] = router
+		publicHosts = append(publicHosts, publicHost)
 	}
-	hosts.hosts[publicHost] = proxyHost
+	hosts.addressHosts[hostAddress] = publicHosts
+	hosts.mutex.Unlock()
 
-	// If HTTPS is enabled preload certificate, skips when nil, like during startup
+	// If HTTPS is enabled preload certificates, skips when nil, like during startup
 	if hosts.config.HTTPS && hosts.tlsManager != nil {
-		if _, err := hosts.tlsManager.GetCertificate(&tls.ClientHelloInfo{ServerName: publicHost}); err != nil {
-			return err
+		for _, publicHost := range publicHosts {
+			if _, err := hosts.tlsManager.GetCertificate(&tls.ClientHelloInfo{ServerName: publicHost}); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-// RemoveProxy removes the proxy for the given host address
+// routeMiddleware sends each request to the first route with a path prefix matching it, expecting routes to be sorted
+// from the longest path to the shortest
+func routeMiddleware(routes []hostRoute) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		handlers := make([]echo.HandlerFunc, len(routes))
+		for i, route := range routes {
+			handlers[i] = route.proxy(next)
+		}
+
+		return func(c echo.Context) error {
+			request := c.Request()
+			index := slices.IndexFunc(routes, func(route hostRoute) bool {
+				return matchesPath(route.path, request.URL.Path)
+			})
+			if index == -1 {
+				return echo.ErrNotFound
+			}
+
+			route := routes[index]
+			if !route.webSocket && strings.EqualFold(request.Header.Get(echo.HeaderUpgrade), "websocket") {
+				return echo.NewHTTPError(http.StatusBadRequest, "WebSocket connections aren't supported at this path")
+			}
+			if route.stripPrefix && route.path != "/" {
+				request.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(request.URL.Path, route.path), "/")
+				request.URL.RawPath = ""
+			}
+			return handlers[index](c)
+		}
+	}
+}
+
+// matchesPath checks whether the path is under the prefix, only matching whole segments so /api doesn't match /apis
+func matchesPath(prefix string, path string) bool {
+	return prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Host retrieves the echo instance serving the given public host
+func (hosts *Hosts) Host(publicHost string) (*echo.Echo, bool) {
+	hosts.mutex.RLock()
+	defer hosts.mutex.RUnlock()
+	host, ok := hosts.hosts[publicHost]
+	return host, ok
+}
+
+// SetHost serves the public host using the given echo instance, used for hosts other than app proxies
+func (hosts *Hosts) SetHost(publicHost string, host *echo.Echo) {
+	hosts.mutex.Lock()
+	defer hosts.mutex.Unlock()
+	hosts.hosts[publicHost] = host
+}
+
+// RemoveProxy removes the proxies for the given host address, including each of its subdomains
 func (hosts *Hosts) RemoveProxy(hostAddress string) {
-	delete(hosts.hosts, fmt.Sprintf("%s.%s:%d", hostAddress, hosts.config.Host, hosts.config.Port))
+	hosts.mutex.Lock()
+	defer hosts.mutex.Unlock()
+	for _, publicHost := range hosts.addressHosts[hostAddress] {
+		delete(hosts.hosts, publicHost)
+	}
+	delete(hosts.addressHosts, hostAddress)
+}
+
+// publicHosts returns every host currently served, so certificates can be checked without holding the lock
+func (hosts *Hosts) publicHosts() []string {
+	hosts.mutex.RLock()
+	defer hosts.mutex.RUnlock()
+	return slices.Collect(maps.Keys(hosts.hosts))
+}
+
+// publicHost returns the host the given address is accessed at, including the port if it isn't the default
+func (hosts *Hosts) publicHost(hostAddress string) string {
+	publicHost := fmt.Sprintf("%s.%s", hostAddress, hosts.config.Host)
+	if hosts.config.Port != 80 && hosts.config.Port != 443 {
+		publicHost = fmt.Sprintf("%s:%d", publicHost, hosts.config.Port)
+	}
+	return publicHost
 }
 
 // SetAutoTLSManager sets the AutoTLSManager used for retrieving certificates. This is done to skip the process
@@ -78,9 +212,10 @@ func (hosts *Hosts) SetAutoTLSManager(tlsManager *autocert.Manager) {
 
 // EnsureCertificates ensures TLS certificates have been retrieved for all domains
 func (hosts *Hosts) EnsureCertificates() error {
-	totalCerts := len(hosts.hosts)
+	publicHosts := hosts.publicHosts()
+	totalCerts := len(publicHosts)
 	i := 0
-	for host, _ := range hosts.hosts {
+	for _, host := range publicHosts {
 		slog.Info(fmt.Sprintf("Ensuring certificate for %s, %d remaining", host, totalCerts-i))
 		if _, err := hosts.tlsManager.GetCertificate(&tls.ClientHelloInfo{ServerName: host}); err != nil {
 			return err
@@ -94,3 +229,54 @@ func (hosts *Hosts) EnsureCertificates() error {
 func (hosts *Hosts) CertsReady() bool {
 	return !hosts.config.HTTPS || hosts.checkedCerts
 }
+
+// CertificateExpiry retrieves when the cached certificate for each host expires. Hosts without a cached certificate
+// are skipped, and no certificates are returned when HTTPS is disabled
+func (hosts *Hosts) CertificateExpiry(ctx context.Context) (map[string]time.Time, error) {
+	expiry := make(map[string]time.Time)
+	if !hosts.config.HTTPS || hosts.tlsManager == nil || hosts.tlsManager.Cache == nil {
+		return expiry, nil
+	}
+
+	for _, host := range hosts.publicHosts() {
+		// autocert stores ECDSA certificates under the host name, and RSA certificates for older clients with a suffix
+		var data []byte
+		var err error
+		for _, key := range []string{host, host + "+rsa"} {
+			data, err = hosts.tlsManager.Cache.Get(ctx, key)
+			if !errors.Is(err, autocert.ErrCacheMiss) {
+				break
+			}
+		}
+		if errors.Is(err, autocert.ErrCacheMiss) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate for %s: %w", host, err)
+		}
+
+		notAfter, err := certificateNotAfter(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate for %s: %w", host, err)
+		}
+		expiry[host] = notAfter
+	}
+
+	return expiry, nil
+}
+
+// certificateNotAfter finds the expiry of the leaf certificate in autocert's cache format, which is the PEM encoded
+// private key followed by the certificate chain
+func certificateNotAfter(data []byte) (time.Time, error) {
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return certificate.NotAfter, nil
+	}
+	return time.Time{}, errors.New("no certificate found")
+}
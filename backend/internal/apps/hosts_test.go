@@ -0,0 +1,91 @@
+package apps
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// Tests requests are sent to the route with the longest matching path on each subdomain, and all of an app's hosts are
+// replaced and removed together
+func TestHostsRoutes(t *testing.T) {
+	servers := make(map[string]*url.URL)
+	for _, name := range []string{"web", "api", "admin"} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+		}))
+		defer server.Close()
+		serverUrl, err := url.Parse(server.URL)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing server URL: %s", err.Error())
+		}
+		servers[name] = serverUrl
+	}
+	route := func(name string, route persistence.PackageRoute) ProxyRoute {
+		route.Port = servers[name].Port()
+		return ProxyRoute{Route: route, Address: servers[name].Hostname()}
+	}
+
+	hosts := NewHosts(HostsMap{}, nil, testutils.BasicHostConfig)
+	err := hosts.AddRoutes("test.app", []ProxyRoute{
+		route("web", persistence.PackageRoute{Path: "/", WebSocket: true}),
+		route("api", persistence.PackageRoute{Path: "/api", StripPrefix: true}),
+		route("admin", persistence.PackageRoute{Subdomain: "admin", Path: "/"}),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error adding routes: %s", err.Error())
+	}
+
+	tests := []struct {
+		host   string
+		path   string
+		status int
+		body   string
+	}{
+		{"test.app.example.com", "/", http.StatusOK, "web /"},
+		{"test.app.example.com", "/api/users", http.StatusOK, "api /users"},
+		{"test.app.example.com", "/api", http.StatusOK, "api /"},
+		{"test.app.example.com", "/apis", http.StatusOK, "web /apis"},
+		{"admin.test.app.example.com", "/api/users", http.StatusOK, "admin /api/users"},
+	}
+	for _, test := range tests {
+		host, ok := hosts.Host(test.host)
+		if !ok {
+			t.Fatalf("Expected host %s to be served", test.host)
+		}
+		recorder := httptest.NewRecorder()
+		host.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://"+test.host+test.path, nil))
+		if recorder.Code != test.status || recorder.Body.String() != test.body {
+			t.Errorf("Expected %d %q for %s%s, got %d %q", test.status, test.body, test.host, test.path, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	// WebSocket connections are only proxied by routes supporting them
+	host, _ := hosts.Host("test.app.example.com")
+	request := httptest.NewRequest(http.MethodGet, "http://test.app.example.com/api/events", nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	recorder := httptest.NewRecorder()
+	host.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected WebSocket connection to be rejected with %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	// Adding the app's routes again replaces the previous subdomains
+	if err := hosts.AddRoutes("test.app", []ProxyRoute{route("web", persistence.PackageRoute{Path: "/"})}); err != nil {
+		t.Fatalf("Unexpected error adding routes: %s", err.Error())
+	}
+	if _, ok := hosts.Host("admin.test.app.example.com"); ok {
+		t.Error("Expected admin subdomain to be removed")
+	}
+
+	hosts.RemoveProxy("test.app")
+	if _, ok := hosts.Host("test.app.example.com"); ok {
+		t.Error("Expected app host to be removed")
+	}
+}
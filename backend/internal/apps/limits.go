@@ -0,0 +1,126 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
+)
+
+var UnknownContainerError = errors.New("unknown container")
+
+// mergeLimits replaces the package's limits with the values set in the override, keeping the package's values for any
+// left unset
+func mergeLimits(limits *persistence.PackageLimits, override persistence.ResourceLimit) *persistence.PackageLimits {
+	merged := persistence.PackageLimits{}
+	if limits != nil {
+		merged = *limits
+	}
+
+	if override.Memory != "" {
+		merged.Memory = override.Memory
+	}
+	if override.Cpus > 0 {
+		merged.Cpus = override.Cpus
+	}
+	if override.Pids > 0 {
+		merged.Pids = override.Pids
+	}
+	return &merged
+}
+
+// applyLimitOverrides applies the limits set by an admin for an installed app to its package. Overrides are stored
+// separately from the package so they're kept when the app is updated
+func applyLimitOverrides(ctx context.Context, queries *persistence.Queries, app persistence.AppPackage) (persistence.AppPackage, error) {
+	overrides, err := queries.GetResourceLimits(ctx, app.Id)
+	if err != nil {
+		return app, fmt.Errorf("failed to get resource limits: %w", err)
+	}
+
+	containers := slices.Clone(app.Containers)
+	for _, override := range overrides {
+		index := slices.IndexFunc(containers, func(c persistence.PackageContainer) bool {
+			return c.Name == override.Container
+		})
+		if index != -1 {
+			containers[index].Limits = mergeLimits(containers[index].Limits, override)
+		}
+	}
+	app.Containers = containers
+	return app, nil
+}
+
+// SetLimitOverrides replaces the limits set by an admin for an installed app, applying them to the app's existing
+// containers. The overrides are replaced in a transaction, so a failure leaves the previous overrides in place
+func SetLimitOverrides(
+	ctx context.Context,
+	dockerClient *client.Client,
+	db *sql.DB,
+	queries *persistence.Queries,
+	appId string,
+	overrides []persistence.ResourceLimit,
+) error {
+	app, err := queries.GetApp(ctx, appId)
+	if err != nil {
+		return err
+	}
+
+	for _, override := range overrides {
+		if !slices.ContainsFunc(app.Schema.Containers, func(c persistence.PackageContainer) bool {
+			return c.Name == override.Container
+		}) {
+			return fmt.Errorf("%w: %s", UnknownContainerError, override.Container)
+		}
+		err := schema.ValidateLimits(persistence.PackageLimits{
+			Memory: override.Memory,
+			Cpus:   override.Cpus,
+			Pids:   override.Pids,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txQueries := queries.WithTx(tx)
+
+	if err := txQueries.DeleteResourceLimits(ctx, appId); err != nil {
+		return err
+	}
+	for _, override := range overrides {
+		err := txQueries.SetResourceLimit(ctx, persistence.SetResourceLimitParams{
+			AppID:     appId,
+			Container: override.Container,
+			Memory:    override.Memory,
+			Cpus:      override.Cpus,
+			Pids:      override.Pids,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	limitedApp, err := applyLimitOverrides(ctx, queries, app.Schema)
+	if err != nil {
+		return err
+	}
+	limits := make(map[string]*persistence.PackageLimits)
+	for _, appContainer := range limitedApp.Containers {
+		limits[appContainer.Name] = appContainer.Limits
+	}
+	return docker.UpdateLimits(ctx, dockerClient, appId, limits)
+}
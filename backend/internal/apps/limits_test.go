@@ -0,0 +1,59 @@
+package apps
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// Tests limits set by an admin replace the package's limits, keeping package values that aren't overridden
+func TestApplyLimitOverrides(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+	ctx := context.Background()
+
+	app := persistence.AppPackage{
+		Id: "test.app",
+		Containers: []persistence.PackageContainer{
+			{Name: "server", Limits: &persistence.PackageLimits{Memory: "1g", Cpus: 2}},
+			{Name: "machine-learning"},
+			{Name: "database", Limits: &persistence.PackageLimits{Pids: 100}},
+		},
+	}
+
+	overrides := []persistence.SetResourceLimitParams{
+		{AppID: "test.app", Container: "server", Memory: "512m"},
+		{AppID: "test.app", Container: "machine-learning", Memory: "4g", Cpus: 1.5},
+		{AppID: "other.app", Container: "database", Pids: 10},
+	}
+	for _, override := range overrides {
+		if err := queries.SetResourceLimit(ctx, override); err != nil {
+			t.Fatalf("Unexpected error setting limit: %s", err.Error())
+		}
+	}
+
+	limitedApp, err := applyLimitOverrides(ctx, queries, app)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	expected := []*persistence.PackageLimits{
+		{Memory: "512m", Cpus: 2},
+		{Memory: "4g", Cpus: 1.5},
+		{Pids: 100},
+	}
+	for i, appContainer := range limitedApp.Containers {
+		if diff := cmp.Diff(expected[i], appContainer.Limits); diff != "" {
+			t.Errorf("Limits of %s mismatch (-want +got):\n%s", appContainer.Name, diff)
+		}
+	}
+
+	// The original package shouldn't be modified, as it's stored without the overrides
+	if app.Containers[1].Limits != nil {
+		t.Errorf("Original package was modified")
+	}
+}
@@ -0,0 +1,440 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/notifications"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// AppState is the observed state of an app's containers, as opposed to the status, which is whether it should be
+// running
+type AppState string
+
+const (
+	StateRunning    AppState = "running"
+	StateStarting   AppState = "starting"
+	StateRestarting AppState = "restarting"
+	StateDegraded   AppState = "degraded"
+	StateCrashed    AppState = "crashed"
+	StateStopped    AppState = "stopped"
+)
+
+// StateFromStatus is the state an app is assumed to be in before the reconciler has checked it
+func StateFromStatus(status string) AppState {
+	if status == string(docker.ContainerRunning) {
+		return StateRunning
+	}
+	return StateStopped
+}
+
+// settleDelay is how long to wait after a container event before checking the app, giving docker time to apply
+// restart policies and letting several events for the same app be handled at once
+const settleDelay = 5 * time.Second
+
+// reconcileInterval is how often all apps are checked, catching events missed while disconnected from docker and
+// apps skipped while a job was running
+const reconcileInterval = time.Minute
+
+// monitoredActions are the container events which can change the state of an app. Healthchecks create exec events
+// constantly, so only the events relevant to the state are handled
+var monitoredActions = map[events.Action]bool{
+	events.ActionStart:                 true,
+	events.ActionRestart:               true,
+	events.ActionStop:                  true,
+	events.ActionDie:                   true,
+	events.ActionOOM:                   true,
+	events.ActionDestroy:               true,
+	events.ActionHealthStatusHealthy:   true,
+	events.ActionHealthStatusUnhealthy: true,
+}
+
+// recovery tracks the automatic restarts of an app
+type recovery struct {
+	attempts    int
+	lastRestart time.Time
+	nextAttempt time.Time
+	saved       persistence.AppState
+}
+
+type scheduledCheck struct {
+	at    time.Time
+	timer *time.Timer
+}
+
+// Reconciler watches the containers of apps, recording their actual state and restarting containers that crash or
+// become unhealthy while their app should be running
+type Reconciler struct {
+	dockerClient *client.Client
+	queries      *persistence.Queries
+	jobManager   *jobs.Manager
+	notifier     *notifications.Notifier
+	config       config.Recovery
+
+	queue chan string
+
+	mu        sync.Mutex
+	apps      map[string]*recovery
+	scheduled map[string]*scheduledCheck
+	stopped   map[string]bool
+}
+
+func NewReconciler(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	jobManager *jobs.Manager,
+	notifier *notifications.Notifier,
+	recoveryConfig config.Recovery,
+) *Reconciler {
+	return &Reconciler{
+		dockerClient: dockerClient,
+		queries:      queries,
+		jobManager:   jobManager,
+		notifier:     notifier,
+		config:       recoveryConfig,
+		queue:        make(chan string, 64),
+		apps:         make(map[string]*recovery),
+		scheduled:    make(map[string]*scheduledCheck),
+		stopped:      make(map[string]bool),
+	}
+}
+
+// Run watches docker events and reconciles apps as their containers change until the context is cancelled. If the
+// connection to docker is lost it reconnects and checks every app, since events may have been missed
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		eventsCtx, cancel := context.WithCancel(ctx)
+		messages, errs := docker.AppEvents(eventsCtx, r.dockerClient)
+		r.reconcileAll(ctx)
+
+	watch:
+		for {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return
+			case message := <-messages:
+				r.handleEvent(message)
+			case err := <-errs:
+				slog.Error(fmt.Sprintf("Lost connection to docker events: %s", err.Error()))
+				break watch
+			case appId := <-r.queue:
+				r.reconcileLogged(ctx, appId)
+			case <-ticker.C:
+				r.reconcileAll(ctx)
+			}
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(settleDelay):
+		}
+	}
+}
+
+// Reset clears the restart attempts of an app, such as when it's started by a user, and checks its state
+func (r *Reconciler) Reset(appId string) {
+	r.mu.Lock()
+	if appRecovery, ok := r.apps[appId]; ok {
+		appRecovery.attempts = 0
+		appRecovery.nextAttempt = time.Time{}
+	}
+	r.mu.Unlock()
+	r.schedule(appId, settleDelay)
+}
+
+// handleEvent records containers stopped through the docker API, which shouldn't be restarted, and schedules a
+// check of the app
+func (r *Reconciler) handleEvent(message events.Message) {
+	if !monitoredActions[message.Action] {
+		return
+	}
+
+	r.mu.Lock()
+	switch message.Action {
+	case events.ActionStop:
+		r.stopped[message.Actor.ID] = true
+	case events.ActionStart, events.ActionDestroy:
+		delete(r.stopped, message.Actor.ID)
+	}
+	r.mu.Unlock()
+
+	if appId := message.Actor.Attributes[docker.APP_ID_LABEL]; appId != "" {
+		r.schedule(appId, settleDelay)
+	}
+}
+
+// schedule checks the app after the given delay, unless a check is already scheduled sooner
+func (r *Reconciler) schedule(appId string, delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at := time.Now().Add(delay)
+	if existing, ok := r.scheduled[appId]; ok {
+		if !existing.at.After(at) {
+			return
+		}
+		existing.timer.Stop()
+	}
+
+	check := &scheduledCheck{at: at}
+	check.timer = time.AfterFunc(delay, func() {
+		r.mu.Lock()
+		if r.scheduled[appId] == check {
+			delete(r.scheduled, appId)
+		}
+		r.mu.Unlock()
+
+		// If the queue is full the app will be checked by the next full reconcile instead
+		select {
+		case r.queue <- appId:
+		default:
+		}
+	})
+	r.scheduled[appId] = check
+}
+
+func (r *Reconciler) reconcileAll(ctx context.Context) {
+	installedApps, err := r.queries.GetApps(ctx)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to retrieve apps to reconcile: %s", err.Error()))
+		return
+	}
+
+	for _, app := range installedApps {
+		r.reconcileLogged(ctx, app.ID)
+	}
+}
+
+func (r *Reconciler) reconcileLogged(ctx context.Context, appId string) {
+	if err := r.reconcile(ctx, appId, time.Now()); err != nil {
+		slog.Error(fmt.Sprintf("Failed to reconcile %s: %s", appId, err.Error()))
+	}
+}
+
+// reconcile records the current state of the app, restarting failed containers if the app should be running and
+// hasn't run out of restart attempts. Apps with a running job are skipped, since jobs stop and replace containers
+func (r *Reconciler) reconcile(ctx context.Context, appId string, now time.Time) error {
+	app, err := r.queries.GetApp(ctx, appId)
+	if errors.Is(err, sql.ErrNoRows) {
+		r.mu.Lock()
+		delete(r.apps, appId)
+		r.mu.Unlock()
+		return r.queries.DeleteAppState(ctx, appId)
+	}
+	if err != nil {
+		return err
+	}
+
+	if r.jobManager.Active(appId) {
+		return nil
+	}
+
+	statuses, err := docker.AppContainerStatuses(ctx, r.dockerClient, appId)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	state, failed := observeState(app.Status, statuses, r.stopped)
+	appRecovery, ok := r.apps[appId]
+	if !ok {
+		appRecovery = &recovery{}
+		r.apps[appId] = appRecovery
+	}
+
+	message := ""
+	restart := false
+	var checkAfter time.Duration
+	switch {
+	case app.Status != string(docker.ContainerRunning):
+		appRecovery.attempts = 0
+		appRecovery.nextAttempt = time.Time{}
+	case len(failed) == 0:
+		if state == StateRunning && appRecovery.attempts > 0 && now.Sub(appRecovery.lastRestart) >= r.config.ResetAfter {
+			appRecovery.attempts = 0
+			appRecovery.nextAttempt = time.Time{}
+		}
+	case appRecovery.attempts >= r.config.MaxRestarts:
+		message = fmt.Sprintf("Gave up restarting %s after %d attempts", containerNames(failed), appRecovery.attempts)
+	case now.Before(appRecovery.nextAttempt):
+		message = fmt.Sprintf("Restarting %s at %s", containerNames(failed), appRecovery.nextAttempt.Format(time.RFC3339))
+		checkAfter = appRecovery.nextAttempt.Sub(now)
+	default:
+		appRecovery.attempts++
+		appRecovery.lastRestart = now
+		appRecovery.nextAttempt = now.Add(restartBackoff(r.config, appRecovery.attempts))
+		state = StateRestarting
+		message = fmt.Sprintf("Restarting %s, attempt %d of %d", containerNames(failed), appRecovery.attempts, r.config.MaxRestarts)
+		restart = true
+		checkAfter = settleDelay
+	}
+	attempts := appRecovery.attempts
+	r.mu.Unlock()
+
+	if restart {
+		slog.Info(fmt.Sprintf("%s: %s", appId, message))
+		if err := r.restartContainers(ctx, failed); err != nil {
+			message = fmt.Sprintf("Failed to restart %s: %s", containerNames(failed), err.Error())
+		}
+	}
+	if checkAfter > 0 {
+		r.schedule(appId, checkAfter)
+	}
+
+	return r.saveState(ctx, appRecovery, persistence.AppState{
+		AppID:     appId,
+		State:     string(state),
+		Message:   message,
+		Restarts:  int64(attempts),
+		UpdatedAt: now.Unix(),
+	})
+}
+
+// saveState stores the state of the app if it has changed since it was last saved, notifying admins when it crashes
+func (r *Reconciler) saveState(ctx context.Context, appRecovery *recovery, state persistence.AppState) error {
+	saved := appRecovery.saved
+	if saved.State == state.State && saved.Message == state.Message && saved.Restarts == state.Restarts {
+		return nil
+	}
+
+	if state.State == string(StateCrashed) && saved.State != string(StateCrashed) {
+		message := state.Message
+		if message == "" {
+			message = "All of its containers have stopped"
+		}
+		r.notifier.Notify(notifications.Notification{
+			Event:   notifications.AppCrashed,
+			AppID:   state.AppID,
+			Title:   fmt.Sprintf("%s has crashed", state.AppID),
+			Message: message,
+		})
+	}
+
+	err := r.queries.SetAppState(ctx, persistence.SetAppStateParams{
+		AppID:     state.AppID,
+		State:     state.State,
+		Message:   state.Message,
+		Restarts:  state.Restarts,
+		UpdatedAt: state.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	appRecovery.saved = state
+	return nil
+}
+
+// restartContainers restarts unhealthy containers and starts containers that have stopped
+func (r *Reconciler) restartContainers(ctx context.Context, containers []docker.ContainerStatus) error {
+	for _, failed := range containers {
+		var err error
+		if failed.State == docker.ContainerRunning {
+			err = r.dockerClient.ContainerRestart(ctx, failed.ID, container.StopOptions{})
+		} else {
+			err = r.dockerClient.ContainerStart(ctx, failed.ID, container.StartOptions{})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeState determines the state of an app from its containers, along with the containers that have failed and
+// need restarting. Containers stopped through the docker API aren't counted as failed, and neither are containers
+// that exited successfully without being restarted, such as migrations
+func observeState(
+	status string,
+	containers []docker.ContainerStatus,
+	stopped map[string]bool,
+) (AppState, []docker.ContainerStatus) {
+	if status != string(docker.ContainerRunning) {
+		return StateStopped, nil
+	}
+	if len(containers) == 0 {
+		return StateCrashed, nil
+	}
+
+	var failed []docker.ContainerStatus
+	healthy, starting, restarting, stoppedCount := 0, 0, 0, 0
+	for _, appContainer := range containers {
+		switch appContainer.State {
+		case docker.ContainerRunning:
+			switch appContainer.Health {
+			case "unhealthy":
+				failed = append(failed, appContainer)
+			case "starting":
+				starting++
+			default:
+				healthy++
+			}
+		case docker.ContainerRestarting:
+			restarting++
+		case docker.ContainerPaused:
+			stoppedCount++
+		default:
+			if stopped[appContainer.ID] {
+				stoppedCount++
+			} else if appContainer.ExitCode == 0 && appContainer.State == docker.ContainerExited &&
+				appContainer.RestartPolicy != container.RestartPolicyAlways {
+				healthy++
+			} else {
+				failed = append(failed, appContainer)
+			}
+		}
+	}
+
+	switch {
+	case len(failed) > 0 && healthy+starting+restarting == 0:
+		return StateCrashed, failed
+	case len(failed) > 0:
+		return StateDegraded, failed
+	case restarting > 0:
+		return StateRestarting, nil
+	case stoppedCount == len(containers):
+		return StateStopped, nil
+	case stoppedCount > 0:
+		return StateDegraded, nil
+	case starting > 0:
+		return StateStarting, nil
+	default:
+		return StateRunning, nil
+	}
+}
+
+// restartBackoff calculates how long to wait after the given restart attempt before trying again
+func restartBackoff(recoveryConfig config.Recovery, attempt int) time.Duration {
+	backoff := recoveryConfig.Backoff
+	for i := 1; i < attempt && backoff < recoveryConfig.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, recoveryConfig.MaxBackoff)
+}
+
+func containerNames(containers []docker.ContainerStatus) string {
+	names := make([]string, len(containers))
+	for i, appContainer := range containers {
+		names[i] = appContainer.Name
+	}
+	return strings.Join(names, ", ")
+}
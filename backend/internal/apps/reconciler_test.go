@@ -0,0 +1,61 @@
+package apps
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+)
+
+// Tests the state of an app is determined from its containers, and only unexpectedly stopped or unhealthy containers
+// are restarted
+func TestObserveState(t *testing.T) {
+	running := docker.ContainerStatus{ID: "server", State: docker.ContainerRunning}
+	unhealthy := docker.ContainerStatus{ID: "worker", State: docker.ContainerRunning, Health: "unhealthy"}
+	crashed := docker.ContainerStatus{ID: "database", State: docker.ContainerExited, ExitCode: 1, RestartPolicy: container.RestartPolicyAlways}
+	migrated := docker.ContainerStatus{ID: "migrate", State: docker.ContainerExited, RestartPolicy: container.RestartPolicyOnFailure}
+	restarting := docker.ContainerStatus{ID: "cache", State: docker.ContainerRestarting}
+
+	tests := []struct {
+		name       string
+		status     string
+		containers []docker.ContainerStatus
+		stopped    map[string]bool
+		state      AppState
+		failed     int
+	}{
+		{"running", "running", []docker.ContainerStatus{running, migrated}, nil, StateRunning, 0},
+		{"stopped by user", "exited", []docker.ContainerStatus{crashed}, nil, StateStopped, 0},
+		{"unhealthy container", "running", []docker.ContainerStatus{running, unhealthy}, nil, StateDegraded, 1},
+		{"all crashed", "running", []docker.ContainerStatus{crashed}, nil, StateCrashed, 1},
+		{"restarting", "running", []docker.ContainerStatus{running, restarting}, nil, StateRestarting, 0},
+		{"being stopped", "running", []docker.ContainerStatus{crashed}, map[string]bool{"database": true}, StateStopped, 0},
+		{"no containers", "running", nil, nil, StateCrashed, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state, failed := observeState(test.status, test.containers, test.stopped)
+			if state != test.state {
+				t.Errorf("Expected state %s, got %s", test.state, state)
+			}
+			if len(failed) != test.failed {
+				t.Errorf("Expected %d failed containers, got %d", test.failed, len(failed))
+			}
+		})
+	}
+}
+
+// Tests the wait between restarts doubles up to the maximum
+func TestRestartBackoff(t *testing.T) {
+	recoveryConfig := config.Recovery{Backoff: 10 * time.Second, MaxBackoff: time.Minute}
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, want := range expected {
+		if backoff := restartBackoff(recoveryConfig, i+1); backoff != want {
+			t.Errorf("Expected backoff %s for attempt %d, got %s", want, i+1, backoff)
+		}
+	}
+}
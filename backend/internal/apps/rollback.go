@@ -0,0 +1,60 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+)
+
+// Rollback records how to undo each completed step of an operation, so a failure part way through can return the
+// system to the state it was in before the operation started
+type Rollback struct {
+	steps []rollbackStep
+}
+
+type rollbackStep struct {
+	name string
+	undo func(ctx context.Context) error
+}
+
+// Add records a step that has been completed along with the function to undo it
+func (r *Rollback) Add(name string, undo func(ctx context.Context) error) {
+	r.steps = append(r.steps, rollbackStep{name: name, undo: undo})
+}
+
+// Commit discards all recorded steps, used once the operation can no longer be rolled back
+func (r *Rollback) Commit() {
+	r.steps = nil
+}
+
+// Run undoes the recorded steps in reverse order. Failing steps don't stop the remaining steps from being undone,
+// with all errors being returned together
+func (r *Rollback) Run(ctx context.Context) error {
+	var errs []error
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		step := r.steps[i]
+		slog.Info(fmt.Sprintf("Rolling back: %s", step.name))
+		if err := step.undo(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to undo %s: %w", step.name, err))
+		}
+	}
+	r.steps = nil
+	return errors.Join(errs...)
+}
+
+// RunOnError runs the rollback if the error pointed to isn't nil, adding the result of the rollback to it. Intended to
+// be deferred with a named error return value. If there are no steps to undo the error is left unchanged
+func (r *Rollback) RunOnError(ctx context.Context, err *error) {
+	if *err == nil || len(r.steps) == 0 {
+		return
+	}
+
+	if rollbackErr := r.Run(ctx); rollbackErr != nil {
+		*err = fmt.Errorf("%w, rollback failed: %w", *err, rollbackErr)
+	} else {
+		*err = fmt.Errorf("%w, %w", *err, jobs.RolledBackError)
+	}
+}
@@ -0,0 +1,47 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Tests steps are undone in reverse order, with failing steps not preventing the rest from being undone
+func TestRollback(t *testing.T) {
+	var undone []string
+	rollback := &Rollback{}
+	for _, name := range []string{"first", "second", "third"} {
+		rollback.Add(name, func(ctx context.Context) error {
+			undone = append(undone, name)
+			if name == "second" {
+				return errors.New("undo failed")
+			}
+			return nil
+		})
+	}
+
+	err := errors.New("install failed")
+	rollback.RunOnError(context.Background(), &err)
+
+	if diff := cmp.Diff([]string{"third", "second", "first"}, undone); diff != "" {
+		t.Errorf("Undone steps mismatch (-want +got):\n%s", diff)
+	}
+	if err.Error() != "install failed, rollback failed: failed to undo second: undo failed" {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
+// Tests committed steps aren't undone
+func TestRollbackCommit(t *testing.T) {
+	rollback := &Rollback{}
+	rollback.Add("step", func(ctx context.Context) error {
+		t.Fatal("Committed step was undone")
+		return nil
+	})
+	rollback.Commit()
+
+	err := errors.New("failed")
+	rollback.RunOnError(context.Background(), &err)
+}
@@ -0,0 +1,99 @@
+package apps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// secretsBackupFile is the file in a legacy app backup containing its secrets, since the app's data is set up with
+// them
+const secretsBackupFile = "secrets.json"
+
+// generateSecrets creates the secrets declared by the package that don't exist yet, removing them if the operation is
+// rolled back
+func generateSecrets(
+	ctx context.Context,
+	rollback *Rollback,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	app persistence.AppPackage,
+	upgrading bool,
+) error {
+	created, err := appDataHandler.GenerateAppSecrets(ctx, queries, app, upgrading)
+	rollback.Add("generate secrets", func(ctx context.Context) error {
+		for _, key := range created {
+			err := queries.DeleteAppSecret(ctx, persistence.DeleteAppSecretParams{AppID: app.Id, Key: key})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate secrets: %w", err)
+	}
+	return nil
+}
+
+// exportSecrets retrieves the app's secrets for backing up, or nil if it has none. They're stored unencrypted by the
+// server's key so the backup can be restored on a different device, and are encrypted by the backup repository
+func exportSecrets(
+	ctx context.Context,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	appId string,
+) ([]byte, error) {
+	secrets, err := appDataHandler.ExportSecrets(ctx, queries, appId)
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(secrets)
+}
+
+// readLegacySecrets reads the secrets from a legacy backup directory, or nil if the backup doesn't contain any
+func readLegacySecrets(backupPath string) ([]byte, error) {
+	secretsJson, err := os.ReadFile(filepath.Join(backupPath, secretsBackupFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return secretsJson, err
+}
+
+// restoreSecrets replaces the app's secrets with those in the backup, if it contains any. Backups taken before
+// secrets were included keep the current secrets. Secrets the backup is missing are created as they would be for an
+// upgrade, since the restored data was set up without them
+func restoreSecrets(
+	ctx context.Context,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	appId string,
+	secretsJson []byte,
+) error {
+	if secretsJson == nil {
+		return nil
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(secretsJson, &secrets); err != nil {
+		return err
+	}
+	if err := appDataHandler.ImportSecrets(ctx, queries, appId, secrets); err != nil {
+		return err
+	}
+
+	app, err := queries.GetApp(ctx, appId)
+	if err != nil {
+		return err
+	}
+	_, err = appDataHandler.GenerateAppSecrets(ctx, queries, app.Schema, true)
+	return err
+}
@@ -0,0 +1,253 @@
+package apps
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// AppSettingValue is a setting declared by an installed app along with its current value. The values of secret
+// settings are never returned, with Set indicating whether one has been stored
+type AppSettingValue struct {
+	persistence.PackageSetting
+	Value string `json:"value"`
+	Set   bool   `json:"set"`
+}
+
+// templatePackage applies the templated values and the app's current settings and secrets to the given package
+func templatePackage(
+	ctx context.Context,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	app persistence.AppPackage,
+	clientId string,
+	clientSecret string,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+) (persistence.AppPackage, error) {
+	settings, err := appDataHandler.AppSettings(ctx, queries, app)
+	if err != nil {
+		return persistence.AppPackage{}, fmt.Errorf("failed to get app settings: %w", err)
+	}
+	secrets, err := appDataHandler.AppSecrets(ctx, queries, app)
+	if err != nil {
+		return persistence.AppPackage{}, fmt.Errorf("failed to get app secrets: %w", err)
+	}
+	return storage.TemplateAppPackage(app, clientId, clientSecret, oryConfig, hostConfig, storageConfig, settings, secrets)
+}
+
+// GetAppSettings retrieves the settings declared by an installed app and their current values
+func GetAppSettings(
+	ctx context.Context,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	appId string,
+) ([]AppSettingValue, error) {
+	app, err := queries.GetApp(ctx, appId)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := appDataHandler.AppSettings(ctx, queries, app.Schema)
+	if err != nil {
+		return nil, err
+	}
+	storedSettings, err := queries.GetAppSettings(ctx, appId)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make([]AppSettingValue, len(app.Schema.Settings))
+	for i, setting := range app.Schema.Settings {
+		settings[i] = AppSettingValue{
+			PackageSetting: setting,
+			Value:          values[setting.Key],
+			Set: slices.ContainsFunc(storedSettings, func(stored persistence.AppSetting) bool {
+				return stored.Key == setting.Key
+			}),
+		}
+		if setting.Type == persistence.SettingSecret {
+			settings[i].Value = ""
+			settings[i].Default = ""
+		}
+	}
+	return settings, nil
+}
+
+// ValidateSettings checks the given settings are declared by the app and valid for their type. Resetting a setting is
+// checked the same as setting it to an empty value, ensuring the setting exists
+func ValidateSettings(app persistence.AppPackage, values map[string]*string) error {
+	validateValues := make(map[string]string, len(values))
+	for key, value := range values {
+		validateValues[key] = ""
+		if value != nil {
+			validateValues[key] = *value
+		}
+	}
+	return schema.ValidateSettings(app, validateValues)
+}
+
+// SetAppSettings stores the given settings for an installed app, with nil values resetting settings to their defaults.
+// Only the containers affected by the change are recreated, either because their definition uses a changed setting or
+// because they mount a data file rendered from one
+func SetAppSettings(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	appId string,
+	values map[string]*string,
+) (err error) {
+	rollback := &Rollback{}
+	defer rollback.RunOnError(context.Background(), &err)
+
+	app, err := queries.GetAppWithCreds(ctx, appId)
+	if err != nil {
+		return fmt.Errorf("failed to get application details: %w", err)
+	}
+
+	if err := ValidateSettings(app.Schema, values); err != nil {
+		return err
+	}
+
+	currentPackage, err := settingsPackage(ctx, queries, appDataHandler, app, oryConfig, hostConfig, storageConfig)
+	if err != nil {
+		return err
+	}
+
+	// Stores the new settings, restoring the previous values and configuration if applying them fails
+	progress.Step("Saving settings")
+	previousSettings, err := queries.GetAppSettings(ctx, appId)
+	if err != nil {
+		return fmt.Errorf("failed to get app settings: %w", err)
+	}
+	recreated := false
+	rollback.Add("save settings", func(ctx context.Context) error {
+		if err := queries.DeleteAppSettings(ctx, appId); err != nil {
+			return err
+		}
+		for _, setting := range previousSettings {
+			if err := queries.SetAppSetting(ctx, persistence.SetAppSettingParams(setting)); err != nil {
+				return err
+			}
+		}
+		if _, err := appDataHandler.RenderTemplates(ctx, queries, oryConfig, hostConfig, appId); err != nil {
+			return err
+		}
+		if !recreated {
+			return nil
+		}
+		return restoreApp(dockerClient, queries, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, app)
+	})
+
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		index := slices.IndexFunc(app.Schema.Settings, func(setting persistence.PackageSetting) bool {
+			return setting.Key == key
+		})
+		if err := appDataHandler.SetAppSetting(ctx, queries, appId, app.Schema.Settings[index], values[key]); err != nil {
+			return fmt.Errorf("failed to save setting %s: %w", key, err)
+		}
+	}
+
+	newPackage, err := settingsPackage(ctx, queries, appDataHandler, app, oryConfig, hostConfig, storageConfig)
+	if err != nil {
+		return err
+	}
+	changedFiles, err := appDataHandler.RenderTemplates(ctx, queries, oryConfig, hostConfig, appId)
+	if err != nil {
+		return fmt.Errorf("failed to render templates: %w", err)
+	}
+
+	affected := changedContainers(currentPackage, newPackage, changedFiles)
+	if len(affected) == 0 {
+		return nil
+	}
+
+	progress.Step("Recreating containers")
+	recreated = true
+	if err := docker.RecreateContainers(ctx, dockerClient, newPackage, affected, hostConfig, storageConfig, dockerConfig); err != nil {
+		return fmt.Errorf("failed to recreate containers: %w", err)
+	}
+
+	if app.Status != string(docker.ContainerRunning) {
+		return nil
+	}
+	progress.Step("Starting app")
+	if err := StartApp(dockerClient, queries, hosts, appDataHandler, hostConfig, oryConfig, appId); err != nil {
+		return fmt.Errorf("failed to start app: %w", err)
+	}
+	return nil
+}
+
+// settingsPackage templates the package of an installed app with its current settings and limits, as its containers
+// are created
+func settingsPackage(
+	ctx context.Context,
+	queries *persistence.Queries,
+	appDataHandler *storage.AppDataHandler,
+	app persistence.AppWithCreds,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+) (persistence.AppPackage, error) {
+	templatedApp, err := templatePackage(ctx, queries, appDataHandler, app.Schema, app.ClientID.String, app.ClientSecret.String, oryConfig, hostConfig, storageConfig)
+	if err != nil {
+		return persistence.AppPackage{}, fmt.Errorf("failed to apply app template: %w", err)
+	}
+	return applyLimitOverrides(ctx, queries, templatedApp)
+}
+
+// changedContainers returns the names of the containers whose definition differs between the two packages, or which
+// mount one of the changed files from the app's data directory
+func changedContainers(previous persistence.AppPackage, current persistence.AppPackage, changedFiles []string) []string {
+	var changed []string
+	for _, currentContainer := range current.Containers {
+		index := slices.IndexFunc(previous.Containers, func(c persistence.PackageContainer) bool {
+			return c.Name == currentContainer.Name
+		})
+		if index == -1 || !reflect.DeepEqual(previous.Containers[index], currentContainer) ||
+			mountsChangedFile(currentContainer, changedFiles) {
+			changed = append(changed, currentContainer.Name)
+		}
+	}
+	return changed
+}
+
+// mountsChangedFile checks whether any of the container's volumes mounted from the app's data directory contain one of
+// the changed files, which are relative to the data directory
+func mountsChangedFile(container persistence.PackageContainer, changedFiles []string) bool {
+	for _, volume := range container.Volumes {
+		source, _, _ := strings.Cut(volume, ":")
+		if !strings.HasPrefix(source, "./") {
+			continue
+		}
+
+		mounted := path.Clean(strings.TrimPrefix(source, "./"))
+		for _, file := range changedFiles {
+			if mounted == "." || file == mounted || strings.HasPrefix(file, mounted+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package apps
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// Tests only containers whose definition changed or which mount a changed file are recreated
+func TestChangedContainers(t *testing.T) {
+	previous := persistence.AppPackage{
+		Containers: []persistence.PackageContainer{
+			{Name: "server", Environment: map[string]string{"TZ": "UTC"}},
+			{Name: "worker", Volumes: []string{"./config:/config:ro"}},
+			{Name: "proxy", Volumes: []string{"./nginx.conf:/etc/nginx/nginx.conf"}},
+			{Name: "database", Volumes: []string{"data:/var/lib/postgresql/data"}},
+		},
+	}
+	current := persistence.AppPackage{
+		Containers: []persistence.PackageContainer{
+			{Name: "server", Environment: map[string]string{"TZ": "Europe/London"}},
+			{Name: "worker", Volumes: []string{"./config:/config:ro"}},
+			{Name: "proxy", Volumes: []string{"./nginx.conf:/etc/nginx/nginx.conf"}},
+			{Name: "database", Volumes: []string{"data:/var/lib/postgresql/data"}},
+		},
+	}
+
+	changed := changedContainers(previous, current, []string{"config/worker.yml"})
+	if diff := cmp.Diff([]string{"server", "worker"}, changed); diff != "" {
+		t.Errorf("Changed containers mismatch (-want +got):\n%s", diff)
+	}
+
+	if changed := changedContainers(previous, previous, nil); len(changed) != 0 {
+		t.Errorf("Expected no changed containers, got %v", changed)
+	}
+}
@@ -0,0 +1,85 @@
+package apps
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
+)
+
+var InvalidBundleError = errors.New("invalid package bundle")
+
+// ReadBundle checks an uploaded package bundle is valid, returning the package described by its schema. Bundles use the
+// same layout as packages in the store, containing schema.json, icon.png and a data directory of files used by the app
+func ReadBundle(bundle []byte) (persistence.AppPackage, error) {
+	uncompressed, err := gzip.NewReader(bytes.NewReader(bundle))
+	if err != nil {
+		return persistence.AppPackage{}, fmt.Errorf("%w: %w", InvalidBundleError, err)
+	}
+	defer uncompressed.Close()
+	tarReader := tar.NewReader(uncompressed)
+
+	var schemaFile []byte
+	hasIcon := false
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return persistence.AppPackage{}, fmt.Errorf("%w: %w", InvalidBundleError, err)
+		}
+
+		// Files are extracted into the app's directory, so they can't be allowed to point outside it
+		name := path.Clean(header.Name)
+		if !filepath.IsLocal(name) {
+			return persistence.AppPackage{}, fmt.Errorf("%w: %s is outside the bundle", InvalidBundleError, header.Name)
+		}
+		inData := name == "data" || strings.HasPrefix(name, "data/")
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if name != "." && !inData {
+				return persistence.AppPackage{}, fmt.Errorf("%w: unexpected directory %s", InvalidBundleError, header.Name)
+			}
+		case tar.TypeReg:
+			switch {
+			case name == "schema.json":
+				if schemaFile, err = io.ReadAll(tarReader); err != nil {
+					return persistence.AppPackage{}, fmt.Errorf("%w: %w", InvalidBundleError, err)
+				}
+			case name == "icon.png":
+				hasIcon = true
+			case !inData:
+				return persistence.AppPackage{}, fmt.Errorf("%w: unexpected file %s", InvalidBundleError, header.Name)
+			}
+		default:
+			return persistence.AppPackage{}, fmt.Errorf("%w: %s isn't a regular file or directory", InvalidBundleError, header.Name)
+		}
+	}
+
+	if schemaFile == nil {
+		return persistence.AppPackage{}, fmt.Errorf("%w: missing schema.json", InvalidBundleError)
+	}
+	if !hasIcon {
+		return persistence.AppPackage{}, fmt.Errorf("%w: missing icon.png", InvalidBundleError)
+	}
+
+	app, err := schema.Parse(schemaFile)
+	if err != nil {
+		return persistence.AppPackage{}, fmt.Errorf("%w: invalid schema.json: %w", InvalidBundleError, err)
+	}
+	if err := schema.Validate(app); err != nil {
+		return persistence.AppPackage{}, fmt.Errorf("%w: %w", InvalidBundleError, err)
+	}
+
+	return app, nil
+}
@@ -0,0 +1,135 @@
+package apps
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+const testSchema = `{"id": "example.app", "name": "app", "version": "v1.0", "containers": [{"name": "web", "image": "nginx", "proxy_target": true, "proxy_port": "80"}]}`
+
+// createBundle creates a gzipped tar bundle containing the given files, with names ending in / created as directories
+func createBundle(t *testing.T, files map[string]string) []byte {
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(compressed)
+	for name, contents := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}
+		if name[len(name)-1] == '/' {
+			header = &tar.Header{Name: name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write bundle: %s", err.Error())
+		}
+		if _, err := tarWriter.Write([]byte(contents)); err != nil {
+			t.Fatalf("Failed to write bundle: %s", err.Error())
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("Failed to write bundle: %s", err.Error())
+	}
+	if err := compressed.Close(); err != nil {
+		t.Fatalf("Failed to write bundle: %s", err.Error())
+	}
+	return buffer.Bytes()
+}
+
+// Tests valid bundles are read and invalid ones rejected
+func TestReadBundle(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		valid bool
+	}{
+		{
+			name: "valid",
+			files: map[string]string{
+				"./":                 "",
+				"./schema.json":      testSchema,
+				"./icon.png":         "icon",
+				"./data/":            "",
+				"./data/config.tmpl": "{{ .Domain }}",
+				"./data/nested/file": "contents",
+			},
+			valid: true,
+		},
+		{
+			name:  "missing schema",
+			files: map[string]string{"icon.png": "icon"},
+		},
+		{
+			name:  "missing icon",
+			files: map[string]string{"schema.json": testSchema},
+		},
+		{
+			name:  "file outside bundle",
+			files: map[string]string{"schema.json": testSchema, "icon.png": "icon", "../escape": "contents"},
+		},
+		{
+			name:  "unexpected file",
+			files: map[string]string{"schema.json": testSchema, "icon.png": "icon", "other.txt": "contents"},
+		},
+		{
+			name:  "invalid id",
+			files: map[string]string{"schema.json": `{"id": "../app", "name": "app", "version": "v1.0", "containers": [{"name": "web"}]}`, "icon.png": "icon"},
+		},
+		{
+			name:  "invalid version",
+			files: map[string]string{"schema.json": `{"id": "example.app", "name": "app", "version": "latest", "containers": [{"name": "web"}]}`, "icon.png": "icon"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, err := ReadBundle(createBundle(t, test.files))
+			if test.valid {
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err.Error())
+				}
+				if app.Id != "example.app" {
+					t.Errorf("Unexpected package id %s", app.Id)
+				}
+			} else if !errors.Is(err, InvalidBundleError) {
+				t.Errorf("Expected invalid bundle error, got %v", err)
+			}
+		})
+	}
+}
+
+// Tests sideloaded apps aren't included when checking for updates, even if a store has a package with the same id
+func TestCheckUpdateAppsSideloaded(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+	ctx := context.Background()
+
+	err := queries.InsertPackage(ctx, persistence.FullPackageListItem{
+		PackageListItem: persistence.PackageListItem{ID: "example.app", Name: "app", Version: "v2.0"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error inserting package: %s", err.Error())
+	}
+
+	schema, err := json.Marshal(persistence.AppPackage{Id: "example.app", Name: "app", Version: "v1.0"})
+	if err != nil {
+		t.Fatalf("Unexpected error marshalling schema: %s", err.Error())
+	}
+	err = queries.CreateApp(ctx, persistence.CreateAppParams{ID: "example.app", Schema: schema, Sideloaded: true})
+	if err != nil {
+		t.Fatalf("Unexpected error creating app: %s", err.Error())
+	}
+
+	updates, err := CheckUpdateApps(ctx, queries)
+	if err != nil {
+		t.Fatalf("Unexpected error checking updates: %s", err.Error())
+	}
+	if len(updates) != 0 {
+		t.Fatalf("Expected no updates for sideloaded app, got %d", len(updates))
+	}
+}
@@ -1,15 +1,29 @@
 package apps
 
 import (
+	"cmp"
 	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
+	"golang.org/x/mod/semver"
+
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
 	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/schema"
 )
 
 type PackageListItem struct {
@@ -34,43 +48,209 @@ func NewPackageListItem(app persistence.GetAppsRow) PackageListItem {
 	}
 }
 
+// DefaultStoreName is the name of the store set in the configuration, which is always used and can't be removed
+const DefaultStoreName = "default"
+
+var PackageVersionNotFoundError = errors.New("package version not found")
+var InvalidSignatureError = errors.New("invalid store signature")
+var InvalidPackageIdError = errors.New("invalid package ID")
+
+// StoreResponseError is returned when a store responds with an unexpected status code
+type StoreResponseError struct {
+	StatusCode int
+}
+
+func (e StoreResponseError) Error() string {
+	return fmt.Sprintf("invalid HTTP response %d", e.StatusCode)
+}
+
+// isNotFound checks whether the error is the store responding that the file doesn't exist, or the file not existing in
+// a local store
+func isNotFound(err error) bool {
+	var responseErr StoreResponseError
+	return errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound || errors.Is(err, fs.ErrNotExist)
+}
+
+// StoreSource is a store packages can be installed from. When multiple stores provide the same package the one from
+// the store with the highest priority is used. If the store has a public key every file retrieved from it must have
+// a valid signature. Stores are either served over HTTP, with the URL of their list.json, or a local directory given
+// as a file:// URL or an absolute path, to either the directory or its list.json
+type StoreSource struct {
+	Name      string            `json:"name"`
+	Url       string            `json:"url"`
+	Priority  int64             `json:"priority"`
+	PublicKey ed25519.PublicKey `json:"-"`
+}
+
+// isLocal checks whether the store is a directory on this device rather than served over HTTP
+func (source StoreSource) isLocal() bool {
+	return strings.HasPrefix(source.Url, "file://") || filepath.IsAbs(source.Url)
+}
+
+// listUrl returns the URL of the store's package list. Local stores can be given as the directory containing it
+func (source StoreSource) listUrl() string {
+	if source.isLocal() && !strings.HasSuffix(source.Url, "list.json") {
+		return strings.TrimSuffix(source.Url, "/") + "/list.json"
+	}
+	return source.Url
+}
+
+// iconUrl returns the URL the icon of the given package is shown from. Icons in local stores can't be loaded by the
+// browser, so are served by the API instead
+func (source StoreSource) iconUrl(packageId string) string {
+	if source.isLocal() {
+		return "/api/v1/packages/" + packageId + "/icon"
+	}
+	return source.packageFileUrl(packageId, "", "icon.png")
+}
+
+// packageFileUrl returns the URL of a file in the store for the given package. Versioned files are stored in the
+// versions folder of the package, with the latest version also being stored in the package folder itself
+func (source StoreSource) packageFileUrl(packageId string, version string, file string) string {
+	packageUrl := strings.TrimSuffix(source.listUrl(), "list.json") + "packages/" + packageId + "/"
+	if version != "" {
+		packageUrl += "versions/" + version + "/"
+	}
+	return packageUrl + file
+}
+
+// ParsePublicKey parses a base64 encoded ed25519 public key. An empty string returns a nil key, meaning files from the
+// store aren't verified
+func ParsePublicKey(key string) (ed25519.PublicKey, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(decoded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(decoded))
+	}
+	return decoded, nil
+}
+
 type StoreClient struct {
-	config config.Store
+	config  config.Store
+	queries *persistence.Queries
 }
 
 func NewStoreClient(config config.Store) *StoreClient {
-	return &StoreClient{
-		config: config,
+	return &StoreClient{config: config}
+}
+
+// SetQueries sets the database the package list is read from, to find which store each package is retrieved from. If
+// not set, like in the launcher, every package is retrieved from the default store
+func (client *StoreClient) SetQueries(queries *persistence.Queries) {
+	client.queries = queries
+}
+
+// Sources retrieves the stores packages are retrieved from, highest priority first. The default store is always
+// included and comes before other stores of the same priority
+func (client *StoreClient) Sources(ctx context.Context, queries *persistence.Queries) ([]StoreSource, error) {
+	defaultSource, err := client.defaultSource()
+	if err != nil {
+		return nil, err
 	}
+
+	stores, err := queries.GetStores(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []StoreSource{defaultSource}
+	for _, store := range stores {
+		publicKey, err := ParsePublicKey(store.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("store %s: %w", store.Name, err)
+		}
+		sources = append(sources, StoreSource{
+			Name:      store.Name,
+			Url:       store.Url,
+			Priority:  store.Priority,
+			PublicKey: publicKey,
+		})
+	}
+
+	slices.SortStableFunc(sources, func(a, b StoreSource) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+	return sources, nil
 }
 
-// UpdatePackageList updates the package list contained in the StoreClient struct
-func (client *StoreClient) UpdatePackageList(ctx context.Context, queries *persistence.Queries) error {
-	// Retrieve package list over HTTP
-	resp, err := http.Get(client.config.StoreUrl)
+func (client *StoreClient) defaultSource() (StoreSource, error) {
+	publicKey, err := ParsePublicKey(client.config.PublicKey)
 	if err != nil {
-		return err
+		return StoreSource{}, fmt.Errorf("default store: %w", err)
+	}
+	return StoreSource{Name: DefaultStoreName, Url: client.config.StoreUrl, PublicKey: publicKey}, nil
+}
+
+// packageSource retrieves the store the given package was last listed in, using the default store for packages that
+// aren't in the package list
+func (client *StoreClient) packageSource(packageId string) (StoreSource, error) {
+	if !validPathSegment(packageId) {
+		return StoreSource{}, fmt.Errorf("%w: %s", InvalidPackageIdError, packageId)
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	if client.queries == nil {
+		return client.defaultSource()
+	}
+
+	ctx := context.Background()
+	listItem, err := client.queries.GetPackage(ctx, packageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return client.defaultSource()
+	} else if err != nil {
+		return StoreSource{}, err
 	}
 
-	// Parse package list
-	body, err := io.ReadAll(resp.Body)
+	sources, err := client.Sources(ctx, client.queries)
 	if err != nil {
-		return err
+		return StoreSource{}, err
+	}
+	index := slices.IndexFunc(sources, func(source StoreSource) bool {
+		return source.Name == listItem.Store
+	})
+	if index == -1 {
+		return StoreSource{}, fmt.Errorf("store %s listing %s no longer exists", listItem.Store, packageId)
 	}
+	return sources[index], nil
+}
 
-	var packages []persistence.FullPackageListItem
-	err = json.Unmarshal(body, &packages)
+// UpdatePackageList updates the package list stored in the database from all stores. Failing to retrieve the list from
+// an additional store is logged and skipped, so one unavailable store doesn't prevent updates from the others
+func (client *StoreClient) UpdatePackageList(ctx context.Context, queries *persistence.Queries) error {
+	sources, err := client.Sources(ctx, queries)
 	if err != nil {
 		return err
 	}
 
-	for _, appPackage := range packages {
-		appPackage.ImageUrl = strings.Trim(client.config.StoreUrl, "list.json") + "packages/" + appPackage.ID + "/icon.png"
-		err = queries.InsertPackage(ctx, appPackage)
+	// Since sources are in priority order, the first store to list a package is the one used. Packages from stores that
+	// can't be reached keep the store they were last listed in, as their rows aren't replaced
+	selected := make(map[string]persistence.FullPackageListItem)
+	for _, source := range sources {
+		packages, err := client.getPackageList(source)
 		if err != nil {
+			if source.Name == DefaultStoreName {
+				return err
+			}
+			slog.Error(fmt.Sprintf("Failed to update package list from store %s: %s", source.Name, err.Error()))
+			continue
+		}
+
+		for _, appPackage := range packages {
+			if _, ok := selected[appPackage.ID]; ok {
+				continue
+			}
+			appPackage.ImageUrl = source.iconUrl(appPackage.ID)
+			appPackage.Store = source.Name
+			selected[appPackage.ID] = appPackage
+		}
+	}
+
+	for _, appPackage := range selected {
+		if err := queries.InsertPackage(ctx, appPackage); err != nil {
 			return err
 		}
 	}
@@ -78,28 +258,162 @@ func (client *StoreClient) UpdatePackageList(ctx context.Context, queries *persi
 	return nil
 }
 
+// getPackageList retrieves and parses the package list of the given store
+func (client *StoreClient) getPackageList(source StoreSource) ([]persistence.FullPackageListItem, error) {
+	body, err := client.fetch(source, source.listUrl())
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []persistence.FullPackageListItem
+	if err := json.Unmarshal(body, &packages); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// GetPackage retrieves the latest version of the given package
 func (client *StoreClient) GetPackage(packageId string) (appPackage persistence.AppPackage, err error) {
-	// Retrieve package file
-	packagePath := strings.Trim(client.config.StoreUrl, "list.json") + "packages/" + packageId + "/schema.json"
-	resp, err := http.Get(packagePath)
+	return client.GetPackageVersion(packageId, "")
+}
+
+// GetPackageVersion retrieves the given version of a package, retrieving the latest version if version is empty
+func (client *StoreClient) GetPackageVersion(packageId string, version string) (appPackage persistence.AppPackage, err error) {
+	source, err := client.packageSource(packageId)
 	if err != nil {
 		return
 	}
-	if resp.StatusCode != 200 {
-		err = fmt.Errorf("invalid HTTP response %d", resp.StatusCode)
+	if version != "" && !validPathSegment(version) {
+		err = fmt.Errorf("%w: %s %s", PackageVersionNotFoundError, packageId, version)
+		return
+	}
+
+	// Retrieve package file
+	body, err := client.fetch(source, source.packageFileUrl(packageId, version, "schema.json"))
+	if err != nil {
+		if isNotFound(err) && version != "" {
+			err = fmt.Errorf("%w: %s %s", PackageVersionNotFoundError, packageId, version)
+		}
 		return
 	}
 
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	// Parse response, migrating it to the current schema version
+	return schema.Parse(body)
+}
+
+// GetPackageVersions retrieves the versions of the given package available from the store, newest first. Stores that
+// don't publish a version list only provide the latest version
+func (client *StoreClient) GetPackageVersions(packageId string) ([]string, error) {
+	source, err := client.packageSource(packageId)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := client.fetch(source, source.packageFileUrl(packageId, "", "versions.json"))
+	if isNotFound(err) {
+		latest, err := client.GetPackage(packageId)
+		if err != nil {
+			return nil, err
+		}
+		return []string{latest.Version}, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	// Parse response
-	body, err := io.ReadAll(resp.Body)
+	var versions []string
+	if err := json.Unmarshal(body, &versions); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(versions, func(a, b string) int {
+		return semver.Compare(b, a)
+	})
+	return versions, nil
+}
+
+// GetPackageBundle retrieves the package.tar.gz bundle of the given package version, containing its data files. If the
+// store doesn't publish the version separately the latest bundle is used instead
+func (client *StoreClient) GetPackageBundle(packageId string, version string) ([]byte, error) {
+	source, err := client.packageSource(packageId)
 	if err != nil {
-		return
+		return nil, err
+	}
+
+	if version != "" && validPathSegment(version) {
+		bundle, err := client.fetch(source, source.packageFileUrl(packageId, version, "package.tar.gz"))
+		if !isNotFound(err) {
+			return bundle, err
+		}
 	}
 
-	err = json.Unmarshal(body, &appPackage)
-	return
+	return client.fetch(source, source.packageFileUrl(packageId, "", "package.tar.gz"))
+}
+
+// GetPackageIcon retrieves the icon of the latest version of the given package
+func (client *StoreClient) GetPackageIcon(packageId string) ([]byte, error) {
+	source, err := client.packageSource(packageId)
+	if err != nil {
+		return nil, err
+	}
+	return client.fetch(source, source.packageFileUrl(packageId, "", "icon.png"))
+}
+
+// fetch retrieves a file from the given store. If the store has a public key the file is verified against its
+// signature, stored alongside it with a .sig extension and containing the base64 encoded ed25519 signature
+func (client *StoreClient) fetch(source StoreSource, fileUrl string) ([]byte, error) {
+	body, err := readStoreFile(fileUrl)
+	if err != nil {
+		return nil, err
+	}
+	if source.PublicKey == nil {
+		return body, nil
+	}
+
+	signature, err := readStoreFile(fileUrl + ".sig")
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve signature for %s: %w", fileUrl, err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return nil, fmt.Errorf("%w for %s: %w", InvalidSignatureError, fileUrl, err)
+	}
+	if !ed25519.Verify(source.PublicKey, body, decoded) {
+		return nil, fmt.Errorf("%w for %s", InvalidSignatureError, fileUrl)
+	}
+
+	return body, nil
+}
+
+// validPathSegment checks a package ID or version can be used in a store path without leaving the package's folder,
+// which matters for local stores read from disk
+func validPathSegment(segment string) bool {
+	return segment != "" && segment != "." && segment != ".." && !strings.ContainsAny(segment, "/\\")
+}
+
+// readStoreFile reads a file from a local store from disk, or otherwise retrieves it over HTTP
+func readStoreFile(fileUrl string) ([]byte, error) {
+	if strings.HasPrefix(fileUrl, "file://") {
+		parsed, err := url.Parse(fileUrl)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(filepath.FromSlash(parsed.Path))
+	}
+	if filepath.IsAbs(fileUrl) {
+		return os.ReadFile(fileUrl)
+	}
+	return httpGet(fileUrl)
+}
+
+func httpGet(fileUrl string) ([]byte, error) {
+	resp, err := http.Get(fileUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, StoreResponseError{StatusCode: resp.StatusCode}
+	}
+	return io.ReadAll(resp.Body)
 }
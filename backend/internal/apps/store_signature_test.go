@@ -0,0 +1,240 @@
+package apps
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// signedStore serves the given files along with their signatures, created with the given private key
+func signedStore(t *testing.T, privateKey ed25519.PrivateKey, files map[string]string) *httptest.Server {
+	mux := http.NewServeMux()
+	for path, contents := range files {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(contents))
+		})
+		mux.HandleFunc(path+".sig", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(contents)))))
+		})
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// localStore writes the given files and their signatures to a directory, created with the given private key
+func localStore(t *testing.T, privateKey ed25519.PrivateKey, files map[string]string) string {
+	dir := t.TempDir()
+	for path, contents := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("Failed to create store directory: %s", err.Error())
+		}
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(contents)))
+		if err := os.WriteFile(filePath, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write store file: %s", err.Error())
+		}
+		if err := os.WriteFile(filePath+".sig", []byte(signature), 0644); err != nil {
+			t.Fatalf("Failed to write store signature: %s", err.Error())
+		}
+	}
+	return dir
+}
+
+// Tests files signed with the store's key are accepted
+func TestSignedStore(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err.Error())
+	}
+	server := signedStore(t, privateKey, map[string]string{
+		"/list.json":                     `[{"id": "test.app", "name": "app", "version": "v1.0"}]`,
+		"/packages/test.app/schema.json": `{"id": "test.app", "version": "v1.0"}`,
+	})
+
+	client := NewStoreClient(config.Store{
+		StoreUrl:  server.URL + "/list.json",
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+	})
+	if err := client.UpdatePackageList(context.Background(), queries); err != nil {
+		t.Fatalf("Unexpected error updating package list: %s", err.Error())
+	}
+
+	appPackage, err := client.GetPackage("test.app")
+	if err != nil {
+		t.Fatalf("Unexpected error getting package: %s", err.Error())
+	}
+	if appPackage.Version != "v1.0" {
+		t.Errorf("Unexpected package version %s", appPackage.Version)
+	}
+}
+
+// Tests files signed with a different key are rejected
+func TestInvalidStoreSignature(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err.Error())
+	}
+	_, otherPrivateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err.Error())
+	}
+	server := signedStore(t, otherPrivateKey, map[string]string{
+		"/list.json": `[{"id": "test.app", "name": "app", "version": "v1.0"}]`,
+	})
+
+	client := NewStoreClient(config.Store{
+		StoreUrl:  server.URL + "/list.json",
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+	})
+	err = client.UpdatePackageList(context.Background(), queries)
+	if !errors.Is(err, InvalidSignatureError) {
+		t.Fatalf("Expected invalid signature error, got %v", err)
+	}
+}
+
+// Tests packages from a higher priority store replace packages from the default store
+func TestStorePriority(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err.Error())
+	}
+	defaultServer := signedStore(t, privateKey, map[string]string{
+		"/list.json": `[{"id": "test.app", "name": "app", "version": "v1.0"}, {"id": "other.app", "name": "other", "version": "v1.0"}]`,
+	})
+	priorityServer := signedStore(t, privateKey, map[string]string{
+		"/list.json":                     `[{"id": "test.app", "name": "app", "version": "v2.0"}]`,
+		"/packages/test.app/schema.json": `{"id": "test.app", "version": "v2.0"}`,
+	})
+
+	err = queries.CreateStore(context.Background(), persistence.CreateStoreParams{
+		Name:      "priority",
+		Url:       priorityServer.URL + "/list.json",
+		Priority:  10,
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create store: %s", err.Error())
+	}
+
+	client := NewStoreClient(config.Store{StoreUrl: defaultServer.URL + "/list.json"})
+	if err := client.UpdatePackageList(context.Background(), queries); err != nil {
+		t.Fatalf("Unexpected error updating package list: %s", err.Error())
+	}
+
+	expected := map[string]string{"test.app": "priority", "other.app": DefaultStoreName}
+	for packageId, store := range expected {
+		listItem, err := queries.GetPackage(context.Background(), packageId)
+		if err != nil {
+			t.Fatalf("Failed to get package %s: %s", packageId, err.Error())
+		}
+		if listItem.Store != store {
+			t.Errorf("Expected %s to be from store %s, got %s", packageId, store, listItem.Store)
+		}
+	}
+
+	// The store a package is retrieved from is read from the package list, so is known after restarting without
+	// updating the list
+	restarted := NewStoreClient(config.Store{StoreUrl: defaultServer.URL + "/list.json"})
+	restarted.SetQueries(queries)
+	appPackage, err := restarted.GetPackage("test.app")
+	if err != nil {
+		t.Fatalf("Unexpected error getting package: %s", err.Error())
+	}
+	if appPackage.Version != "v2.0" {
+		t.Errorf("Expected package from priority store, got version %s", appPackage.Version)
+	}
+}
+
+// Tests stores in a local directory are read from disk and verified, given as either a path or a file:// URL
+func TestLocalStore(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err.Error())
+	}
+	dir := localStore(t, privateKey, map[string]string{
+		"list.json":                                      `[{"id": "test.app", "name": "app", "version": "v1.1"}]`,
+		"packages/test.app/schema.json":                  `{"id": "test.app", "version": "v1.1"}`,
+		"packages/test.app/icon.png":                     "icon",
+		"packages/test.app/package.tar.gz":               "latest bundle",
+		"packages/test.app/versions/v1.0/schema.json":    `{"id": "test.app", "version": "v1.0"}`,
+		"packages/test.app/versions/v1.0/package.tar.gz": "v1.0 bundle",
+	})
+
+	for _, storeUrl := range []string{dir, "file://" + filepath.ToSlash(dir) + "/list.json"} {
+		queries := testutils.SetupDB(t)
+		client := NewStoreClient(config.Store{
+			StoreUrl:  storeUrl,
+			PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		})
+		if err := client.UpdatePackageList(context.Background(), queries); err != nil {
+			t.Fatalf("Unexpected error updating package list from %s: %s", storeUrl, err.Error())
+		}
+
+		listItem, err := queries.GetPackage(context.Background(), "test.app")
+		if err != nil {
+			t.Fatalf("Failed to get package: %s", err.Error())
+		}
+		if listItem.ImageUrl != "/api/v1/packages/test.app/icon" {
+			t.Errorf("Expected icon to be served by the API, got %s", listItem.ImageUrl)
+		}
+		if icon, err := client.GetPackageIcon("test.app"); err != nil || string(icon) != "icon" {
+			t.Errorf("Expected icon, got %q, %v", icon, err)
+		}
+
+		appPackage, err := client.GetPackageVersion("test.app", "v1.0")
+		if err != nil {
+			t.Fatalf("Unexpected error getting package: %s", err.Error())
+		}
+		if appPackage.Version != "v1.0" {
+			t.Errorf("Unexpected package version %s", appPackage.Version)
+		}
+		if _, err := client.GetPackageVersion("test.app", "v0.9"); !errors.Is(err, PackageVersionNotFoundError) {
+			t.Errorf("Expected version not found error, got %v", err)
+		}
+
+		// Versions without their own bundle use the latest one
+		bundle, err := client.GetPackageBundle("test.app", "v0.9")
+		if err != nil || string(bundle) != "latest bundle" {
+			t.Errorf("Expected latest bundle, got %q, %v", bundle, err)
+		}
+
+		// Package IDs and versions can't be used to read files outside the package's folder
+		if _, err := client.GetPackageIcon(".."); !errors.Is(err, InvalidPackageIdError) {
+			t.Errorf("Expected invalid package ID error, got %v", err)
+		}
+		if _, err := client.GetPackageVersion("test.app", "../../test.app"); !errors.Is(err, PackageVersionNotFoundError) {
+			t.Errorf("Expected version not found error, got %v", err)
+		}
+		testutils.CleanupDB()
+	}
+
+	// Files modified on disk without being signed again are rejected
+	schemaPath := filepath.Join(dir, "packages", "test.app", "schema.json")
+	if err := os.WriteFile(schemaPath, []byte(`{"id": "test.app", "version": "v9.9"}`), 0644); err != nil {
+		t.Fatalf("Failed to modify schema: %s", err.Error())
+	}
+	client := NewStoreClient(config.Store{StoreUrl: dir, PublicKey: base64.StdEncoding.EncodeToString(publicKey)})
+	if _, err := client.GetPackage("test.app"); !errors.Is(err, InvalidSignatureError) {
+		t.Errorf("Expected invalid signature error, got %v", err)
+	}
+}
@@ -35,6 +35,7 @@ func TestUpdatePackageList(t *testing.T) {
 				Author:      "immich-app",
 				Description: "High-performance self-hosted photo and video management solution",
 				ImageUrl:    storeUrl + "/packages/immich-app.immich/icon.png",
+				Store:       DefaultStoreName,
 			},
 		},
 		{
@@ -45,6 +46,7 @@ func TestUpdatePackageList(t *testing.T) {
 				Author:      "paperless-ngx",
 				Description: " A community-supported supercharged version of paperless: scan, index and archive all your physical documents",
 				ImageUrl:    storeUrl + "/packages/paperless-ngx.paperless-ngx/icon.png",
+				Store:       DefaultStoreName,
 			},
 		},
 		{
@@ -55,6 +57,7 @@ func TestUpdatePackageList(t *testing.T) {
 				Author:      "traefik",
 				Description: "Tiny Go webserver that prints OS information and HTTP request to output.",
 				ImageUrl:    storeUrl + "/packages/traefik.whoami/icon.png",
+				Store:       DefaultStoreName,
 			},
 		},
 	}
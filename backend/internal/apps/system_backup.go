@@ -0,0 +1,390 @@
+package apps
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+	hydra "github.com/ory/hydra-client-go/v2"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// SystemBackupId is the ID system backups are stored under in a backup repository, alongside the backups of each app.
+// App IDs always contain a dot, so it can't be used by an app
+const SystemBackupId = "system"
+
+// The archives in a system snapshot. Each app's data directory and volumes are stored under the app's ID, using the
+// same names as in the app's own snapshots. App secrets and schemas are stored in the database, so aren't separate
+const (
+	databaseArchive      = "database"
+	encryptionKeyArchive = "encryption_key"
+	appArchivePrefix     = "apps/"
+)
+
+// identityApps are the system apps storing the Kratos identities and Hydra OAuth2 clients in their volumes. They're
+// installed by the launcher rather than stored in the database, so are backed up separately from other apps
+var identityApps = []string{"ory.kratos", "ory.hydra"}
+
+// systemApp and databaseVolume are the homecloud system app and the volume it stores the database and encryption key
+// in, as defined in its package
+const (
+	systemApp      = "homecloud.app"
+	databaseVolume = "homecloud.app-homecloud-db"
+)
+
+var SystemInstalledError = errors.New("homecloud is already set up on this device")
+var AppNotInstalledError = errors.New("app isn't installed")
+
+// cleanupReader runs a function after the archive is closed, to clean up what was used to create it
+type cleanupReader struct {
+	io.ReadCloser
+	cleanup func() error
+}
+
+func (r *cleanupReader) Close() error {
+	closeErr := r.ReadCloser.Close()
+	return errors.Join(closeErr, r.cleanup())
+}
+
+// systemBackupSources creates the archives of a system backup, containing everything needed to set up a new device as
+// a replacement for this one. The database is copied so it's consistent, and the identity apps are paused while their
+// volumes are exported so their databases aren't copied part way through a write. Other apps are prepared using their
+// backup hooks
+func systemBackupSources(
+	ctx context.Context,
+	dockerClient *client.Client,
+	hooks *backupHooks,
+	queries *persistence.Queries,
+	storageConfig config.Storage,
+) ([]backup.ArchiveSource, error) {
+	sources := []backup.ArchiveSource{
+		{
+			Name: databaseArchive,
+			Open: func(ctx context.Context) (io.ReadCloser, error) {
+				dir, err := os.MkdirTemp("", "homecloud-database")
+				if err != nil {
+					return nil, err
+				}
+				databasePath := filepath.Join(dir, filepath.Base(config.DatabasePath))
+				if err := queries.CopyDatabase(ctx, databasePath); err != nil {
+					os.RemoveAll(dir)
+					return nil, fmt.Errorf("error copying database: %w", err)
+				}
+				file, err := os.Open(databasePath)
+				if err != nil {
+					os.RemoveAll(dir)
+					return nil, err
+				}
+				return &cleanupReader{ReadCloser: file, cleanup: func() error { return os.RemoveAll(dir) }}, nil
+			},
+		},
+		{
+			Name: encryptionKeyArchive,
+			Open: func(ctx context.Context) (io.ReadCloser, error) {
+				return os.Open(config.EncryptionKeyPath)
+			},
+		},
+	}
+
+	for _, appId := range identityApps {
+		volumes, err := docker.GetAppVolumeNames(dockerClient, appId)
+		if err != nil {
+			return nil, fmt.Errorf("error getting volumes for %s: %w", appId, err)
+		}
+		for _, volumeName := range volumes {
+			sources = append(sources, backup.ArchiveSource{
+				Name: appArchivePrefix + appId + "/" + volumeArchivePrefix + volumeName,
+				Open: func(ctx context.Context) (io.ReadCloser, error) {
+					unpause, err := docker.PauseApp(ctx, dockerClient, appId)
+					if err != nil {
+						return nil, fmt.Errorf("error pausing %s: %w", appId, err)
+					}
+					archive, err := docker.ExportVolume(ctx, dockerClient, volumeName)
+					if err != nil {
+						return nil, errors.Join(err, unpause())
+					}
+					return &cleanupReader{ReadCloser: archive, cleanup: unpause}, nil
+				},
+				Tar: true,
+			})
+		}
+	}
+
+	installed, err := queries.GetApps(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving apps: %w", err)
+	}
+	for _, app := range installed {
+		appSources, err := dataSources(dockerClient, hooks, storageConfig, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range appSources {
+			source.Name = appArchivePrefix + app.ID + "/" + source.Name
+			sources = append(sources, source)
+		}
+	}
+
+	return sources, nil
+}
+
+// splitAppArchive finds the app an archive in a system snapshot belongs to and the archive's name in the app's own
+// snapshots, returning false if the archive doesn't belong to an app
+func splitAppArchive(name string) (string, string, bool) {
+	if !strings.HasPrefix(name, appArchivePrefix) {
+		return "", "", false
+	}
+	appId, archive, found := strings.Cut(strings.TrimPrefix(name, appArchivePrefix), "/")
+	valid := found && appId != "" && appId != "." && appId != ".." && archive != ""
+	return appId, archive, valid
+}
+
+// volumeFile is a file written to a volume archive
+type volumeFile struct {
+	name   string
+	size   int64
+	reader io.Reader
+}
+
+// writeVolumeArchive writes the files as an archive in the format created by docker.ExportVolume, so it can be
+// imported into a volume
+func writeVolumeArchive(writer io.Writer, files []volumeFile) error {
+	tarWriter := tar.NewWriter(writer)
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    "volume/" + file.name,
+			Mode:    0600,
+			Size:    file.size,
+			ModTime: time.Now(),
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(tarWriter, file.reader, file.size); err != nil {
+			return fmt.Errorf("error writing %s: %w", file.name, err)
+		}
+	}
+	return tarWriter.Close()
+}
+
+// importVolume replaces the volume with the archive's contents, since volumes left by a previous attempt would
+// otherwise be merged with the backup
+func importVolume(ctx context.Context, dockerClient *client.Client, appId string, volumeName string, archive io.Reader) error {
+	if err := dockerClient.VolumeRemove(ctx, volumeName, false); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("error removing existing volume %s: %w", volumeName, err)
+	}
+	return docker.ImportVolume(ctx, dockerClient, appId, volumeName, archive)
+}
+
+// RestoreSystem restores a system backup onto a device homecloud hasn't been set up on yet, before the system apps are
+// started. The database and encryption key are restored into the database volume along with a marker for the server,
+// which recreates the apps' containers when it starts, see CompleteSystemRestore. The identity apps' volumes and
+// every app's data directory and volumes are restored as they were. The IDs of the restored apps are returned
+func RestoreSystem(
+	ctx context.Context,
+	progress jobs.Progress,
+	dockerClient *client.Client,
+	storageConfig config.Storage,
+	target backup.TargetConfig,
+	snapshotName string,
+) ([]string, error) {
+	installed, err := docker.IsAppInstalled(dockerClient, systemApp)
+	if err != nil {
+		return nil, err
+	}
+	if installed {
+		return nil, SystemInstalledError
+	}
+
+	progress.Step("Checking backup")
+	backupTarget, err := backup.Open(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("error opening backup target %s: %w", target.Name, err)
+	}
+	defer backupTarget.Close()
+
+	// The whole snapshot is checked before anything is restored, so a damaged backup leaves the device unchanged
+	repository, err := backup.OpenRepository(ctx, backupTarget, target, false)
+	if err != nil {
+		return nil, fmt.Errorf("error opening backup repository on %s: %w", target.Name, err)
+	}
+	snapshot, err := repository.LoadSnapshot(ctx, SystemBackupId, snapshotName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup %s from %s: %w", snapshotName, target.Name, err)
+	}
+	if err := repository.CheckSnapshot(ctx, snapshot); err != nil {
+		return nil, fmt.Errorf("error checking backup %s: %w", snapshotName, err)
+	}
+
+	databaseIndex := slices.IndexFunc(snapshot.Archives, func(a backup.Archive) bool { return a.Name == databaseArchive })
+	keyIndex := slices.IndexFunc(snapshot.Archives, func(a backup.Archive) bool { return a.Name == encryptionKeyArchive })
+	if databaseIndex == -1 || keyIndex == -1 {
+		return nil, fmt.Errorf("backup %s is missing the database or encryption key", snapshotName)
+	}
+
+	// Volumes are imported using a container, so its image must be available on a new device
+	progress.Step("Pulling images")
+	err = docker.PullImage(ctx, dockerClient, "busybox", func(message jsonmessage.JSONMessage) {
+		progress.PullProgress("busybox", message)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	progress.Step("Restoring database")
+
+	database, key := snapshot.Archives[databaseIndex], snapshot.Archives[keyIndex]
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeVolumeArchive(writer, []volumeFile{
+			{filepath.Base(config.DatabasePath), database.Size, repository.OpenArchive(ctx, database)},
+			{filepath.Base(config.EncryptionKeyPath), key.Size, repository.OpenArchive(ctx, key)},
+			{filepath.Base(config.RestoreMarkerPath), int64(len(snapshot.Name)), strings.NewReader(snapshot.Name)},
+		}))
+	}()
+	err = importVolume(ctx, dockerClient, systemApp, databaseVolume, reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error restoring database: %w", err)
+	}
+
+	restored := make([]string, 0)
+	for _, archive := range snapshot.Archives {
+		if archive.Name == databaseArchive || archive.Name == encryptionKeyArchive {
+			continue
+		}
+		appId, name, ok := splitAppArchive(archive.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown archive %s in backup", archive.Name)
+		}
+
+		archiveReader := repository.OpenArchive(ctx, archive)
+		switch {
+		case name == dataArchive:
+			progress.Step(fmt.Sprintf("Restoring data of %s", appId))
+			if err := os.RemoveAll(filepath.Join(storageConfig.DataPath, appId, "data")); err != nil {
+				return nil, fmt.Errorf("error clearing data directory of %s: %w", appId, err)
+			}
+			if err := docker.ExtractFolderArchive(storageConfig, appId, archiveReader); err != nil {
+				return nil, fmt.Errorf("error restoring data of %s: %w", appId, err)
+			}
+		case strings.HasPrefix(name, volumeArchivePrefix):
+			volumeName := strings.TrimPrefix(name, volumeArchivePrefix)
+			if !strings.HasPrefix(volumeName, appId) {
+				return nil, fmt.Errorf("volume %s doesn't belong to %s", volumeName, appId)
+			}
+			progress.Step(fmt.Sprintf("Restoring volume %s", volumeName))
+			if err := importVolume(ctx, dockerClient, appId, volumeName, archiveReader); err != nil {
+				return nil, fmt.Errorf("error restoring volume %s: %w", volumeName, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown archive %s in backup", archive.Name)
+		}
+
+		if !slices.Contains(identityApps, appId) && !slices.Contains(restored, appId) {
+			restored = append(restored, appId)
+		}
+	}
+
+	return restored, nil
+}
+
+// CompleteSystemRestore finishes restoring a system backup when the server first starts after the launcher restored
+// it, recreating the containers of each app. Apps are given new OAuth2 clients, since the redirect URIs of their
+// clients are for the address of the previous device. OIDC links between apps and users are kept, since they use the
+// IDs of the restored identities. Apps that can't be recreated are stopped and show as drift, so they can be
+// reinstalled later without preventing the server from starting
+func CompleteSystemRestore(
+	ctx context.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+) error {
+	if _, err := os.Stat(config.RestoreMarkerPath); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	installed, err := queries.GetAppsWithCreds(ctx)
+	if err != nil {
+		return err
+	}
+	for _, app := range installed {
+		slog.Info(fmt.Sprintf("Recreating %s from system backup", app.ID))
+		err := recreateRestoredApp(ctx, dockerClient, queries, hydraAdmin, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, app)
+		if err == nil {
+			continue
+		}
+
+		slog.Error(fmt.Sprintf("Failed to recreate %s from system backup: %s", app.ID, err.Error()))
+		err = queries.SetStatus(ctx, persistence.SetStatusParams{ID: app.ID, Status: string(docker.ContainerExited)})
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(config.RestoreMarkerPath)
+}
+
+// recreateRestoredApp registers a new OAuth2 client for a restored app and creates its containers, removing the
+// client from the previous device afterwards
+func recreateRestoredApp(
+	ctx context.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hydraAdmin *hydra.APIClient,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	app persistence.AppWithCreds,
+) (err error) {
+	rollback := &Rollback{}
+	defer rollback.RunOnError(context.Background(), &err)
+
+	previousClient := app.ClientID
+	if app.Schema.OidcEnabled {
+		if err := replaceOAuthClient(ctx, rollback, queries, hydraAdmin, hostConfig, &app); err != nil {
+			return err
+		}
+	}
+
+	if err := restoreApp(dockerClient, queries, hosts, appDataHandler, oryConfig, hostConfig, storageConfig, dockerConfig, app); err != nil {
+		return err
+	}
+
+	// A client left behind shows as drift, so failing to remove it is only logged
+	if app.Schema.OidcEnabled && previousClient.Valid {
+		if _, err := hydraAdmin.OAuth2API.DeleteOAuth2Client(ctx, previousClient.String).Execute(); err != nil {
+			slog.Error(fmt.Sprintf("Failed to remove previous OAuth2 client of %s: %s", app.ID, err.Error()))
+		}
+	}
+	return nil
+}
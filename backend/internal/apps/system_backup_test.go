@@ -0,0 +1,113 @@
+package apps
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// Tests the database can be copied while it's open, and the copy contains its data
+func TestCopyDatabase(t *testing.T) {
+	ctx := context.Background()
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	err := queries.CreateBackupTarget(ctx, persistence.CreateBackupTargetParams{Name: "drive", Type: "drive", Config: "{}"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating backup target: %s", err.Error())
+	}
+
+	copyPath := filepath.Join(t.TempDir(), "data.db")
+	if err := queries.CopyDatabase(ctx, copyPath); err != nil {
+		t.Fatalf("Unexpected error copying database: %s", err.Error())
+	}
+
+	db, err := sql.Open("sqlite3", copyPath)
+	if err != nil {
+		t.Fatalf("Unexpected error opening copy: %s", err.Error())
+	}
+	defer db.Close()
+	target, err := persistence.New(db).GetBackupTarget(ctx, "drive")
+	if err != nil {
+		t.Fatalf("Unexpected error reading copy: %s", err.Error())
+	}
+	if target.Type != "drive" {
+		t.Errorf("Expected copied backup target, got %+v", target)
+	}
+}
+
+// Tests archive names in system snapshots are split into the app and the archive's name, rejecting invalid app IDs
+func TestSplitAppArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		appId   string
+		archive string
+		valid   bool
+	}{
+		{"apps/memos.memos/data", "memos.memos", "data", true},
+		{"apps/memos.memos/volumes/memos.memos-data", "memos.memos", "volumes/memos.memos-data", true},
+		{"database", "", "", false},
+		{"apps/memos.memos", "", "", false},
+		{"apps/../data", "", "", false},
+		{"apps//data", "", "", false},
+	}
+
+	for _, test := range tests {
+		appId, archive, valid := splitAppArchive(test.name)
+		if valid != test.valid || (valid && (appId != test.appId || archive != test.archive)) {
+			t.Errorf("splitAppArchive(%q) = %q, %q, %t, expected %q, %q, %t", test.name, appId, archive, valid, test.appId, test.archive, test.valid)
+		}
+	}
+}
+
+// Tests files are written in the format of exported volumes
+func TestWriteVolumeArchive(t *testing.T) {
+	var buffer bytes.Buffer
+	err := writeVolumeArchive(&buffer, []volumeFile{
+		{"data.db", 8, strings.NewReader("database")},
+		{"restored", 4, strings.NewReader("2024")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error writing archive: %s", err.Error())
+	}
+
+	files := make(map[string]string)
+	reader := tar.NewReader(&buffer)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error reading archive: %s", err.Error())
+		}
+		contents, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Unexpected error reading %s: %s", header.Name, err.Error())
+		}
+		files[header.Name] = string(contents)
+	}
+
+	expected := map[string]string{"volume/data.db": "database", "volume/restored": "2024"}
+	if diff := cmp.Diff(expected, files); diff != "" {
+		t.Errorf("Archive contents mismatch (-want +got):\n%s", diff)
+	}
+
+	// Files shorter than their size fail rather than writing a truncated archive
+	err = writeVolumeArchive(io.Discard, []volumeFile{{"data.db", 16, strings.NewReader("database")}})
+	if err == nil {
+		t.Error("Expected error writing file shorter than its size")
+	}
+}
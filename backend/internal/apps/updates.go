@@ -0,0 +1,271 @@
+package apps
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/client"
+	"golang.org/x/mod/semver"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/notifications"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+type UpdatePolicy string
+
+const (
+	UpdatePolicyManual    UpdatePolicy = "manual"
+	UpdatePolicyNotify    UpdatePolicy = "notify"
+	UpdatePolicyAutoPatch UpdatePolicy = "auto-patch"
+	UpdatePolicyAutoMinor UpdatePolicy = "auto-minor"
+)
+
+var InvalidUpdatePolicyError = errors.New("invalid update policy")
+
+// ParseUpdatePolicy checks the given string is a valid update policy
+func ParseUpdatePolicy(policy string) (UpdatePolicy, error) {
+	switch UpdatePolicy(policy) {
+	case UpdatePolicyManual, UpdatePolicyNotify, UpdatePolicyAutoPatch, UpdatePolicyAutoMinor:
+		return UpdatePolicy(policy), nil
+	default:
+		return "", fmt.Errorf("%w: %s", InvalidUpdatePolicyError, policy)
+	}
+}
+
+// AllowsAutoUpdate checks whether the policy allows automatically updating from one version to a newer one.
+// auto-patch only allows updates within the same minor version, auto-minor allows updates within the same major version
+func (p UpdatePolicy) AllowsAutoUpdate(fromVersion string, toVersion string) bool {
+	switch p {
+	case UpdatePolicyAutoPatch:
+		return semver.MajorMinor(fromVersion) == semver.MajorMinor(toVersion)
+	case UpdatePolicyAutoMinor:
+		return semver.Major(fromVersion) == semver.Major(toVersion)
+	default:
+		return false
+	}
+}
+
+// InMaintenanceWindow checks whether the given time is within the maintenance window. The window is given in hours
+// and can pass midnight, such as 23 to 2. If the start and end are the same updates are allowed at any time
+func InMaintenanceWindow(settings persistence.UpdateSetting, now time.Time) bool {
+	hour := int64(now.Hour())
+	switch {
+	case settings.WindowStart == settings.WindowEnd:
+		return true
+	case settings.WindowStart < settings.WindowEnd:
+		return hour >= settings.WindowStart && hour < settings.WindowEnd
+	default:
+		return hour >= settings.WindowStart || hour < settings.WindowEnd
+	}
+}
+
+// StartUpdate starts a job updating the given app to the given package, recording the outcome in the update history.
+// If pin is set the app is pinned to the new version once the update succeeds, so scheduled updates don't replace it
+func StartUpdate(
+	ctx context.Context,
+	jobManager *jobs.Manager,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+	appPackage persistence.AppPackage,
+	automatic bool,
+	pin bool,
+) (persistence.JobDetails, error) {
+	app, err := queries.GetApp(ctx, appPackage.Id)
+	if err != nil {
+		return persistence.JobDetails{}, fmt.Errorf("failed to get application details: %w", err)
+	}
+
+	return jobManager.Start(jobs.Update, appPackage.Id, func(ctx context.Context, progress jobs.Progress) error {
+		updateErr := UpdateApp(
+			ctx,
+			progress,
+			dockerClient,
+			queries,
+			hosts,
+			appDataHandler,
+			oryConfig,
+			hostConfig,
+			storageConfig,
+			dockerConfig,
+			appPackage,
+		)
+
+		history := persistence.AddUpdateHistoryParams{
+			AppID:       app.ID,
+			FromVersion: app.Schema.Version,
+			ToVersion:   appPackage.Version,
+			Automatic:   automatic,
+			Status:      string(jobs.Completed),
+		}
+		if updateErr != nil {
+			history.Status = string(jobs.Failed)
+			if errors.Is(updateErr, jobs.RolledBackError) {
+				history.Status = string(jobs.RolledBack)
+			}
+			history.Error = updateErr.Error()
+		}
+		if err := queries.AddUpdateHistory(context.Background(), history); err != nil {
+			slog.Error(fmt.Sprintf("failed to record update of %s: %s", app.ID, err.Error()))
+		}
+
+		if updateErr == nil && pin {
+			err := queries.SetPinned(context.Background(), persistence.SetPinnedParams{Pinned: true, ID: app.ID})
+			if err != nil {
+				return fmt.Errorf("updated to %s but failed to pin the version: %w", appPackage.Version, err)
+			}
+		}
+
+		return updateErr
+	})
+}
+
+// NotifyUpdates notifies admins of available updates for apps with the notify policy, and for apps with an automatic
+// policy that doesn't allow the update, such as a new major version. Each version is only reported once, with the last
+// version reported for each app stored so they aren't reported again after a restart
+func NotifyUpdates(ctx context.Context, queries *persistence.Queries, notifier *notifications.Notifier) error {
+	installedApps, err := queries.GetApps(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get apps: %w", err)
+	}
+	appsMap := make(map[string]persistence.GetAppsRow)
+	for _, app := range installedApps {
+		appsMap[app.ID] = app
+	}
+
+	packagesToUpdate, err := CheckUpdateApps(ctx, queries)
+	if err != nil {
+		return fmt.Errorf("failed to check for updates: %w", err)
+	}
+
+	for _, listApp := range packagesToUpdate {
+		app := appsMap[listApp.ID]
+		policy := UpdatePolicy(app.UpdatePolicy)
+		if policy == UpdatePolicyManual || policy.AllowsAutoUpdate(app.Schema.Version, listApp.Version) {
+			continue
+		}
+
+		notified, err := queries.GetNotifiedUpdate(ctx, app.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get notified update: %w", err)
+		}
+		if notified == listApp.Version {
+			continue
+		}
+
+		notifier.Notify(notifications.Notification{
+			Event:   notifications.UpdateAvailable,
+			AppID:   app.ID,
+			Title:   fmt.Sprintf("Update available for %s", app.ID),
+			Message: fmt.Sprintf("%s can be updated from %s to %s", app.ID, app.Schema.Version, listApp.Version),
+		})
+		err = queries.SetNotifiedUpdate(ctx, persistence.SetNotifiedUpdateParams{AppID: app.ID, Version: listApp.Version})
+		if err != nil {
+			return fmt.Errorf("failed to save notified update: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RunScheduledUpdates starts updates for apps with an update policy allowing the available update, if the current
+// time is within the maintenance window. Updates to a version that has previously failed aren't retried
+func RunScheduledUpdates(
+	ctx context.Context,
+	now time.Time,
+	jobManager *jobs.Manager,
+	dockerClient *client.Client,
+	storeClient *StoreClient,
+	queries *persistence.Queries,
+	hosts *Hosts,
+	appDataHandler *storage.AppDataHandler,
+	oryConfig config.Ory,
+	hostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+) error {
+	settings, err := queries.GetUpdateSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get update settings: %w", err)
+	}
+	if !InMaintenanceWindow(settings, now) {
+		return nil
+	}
+
+	installedApps, err := queries.GetApps(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get apps: %w", err)
+	}
+	appsMap := make(map[string]persistence.GetAppsRow)
+	for _, app := range installedApps {
+		appsMap[app.ID] = app
+	}
+
+	packagesToUpdate, err := CheckUpdateApps(ctx, queries)
+	if err != nil {
+		return fmt.Errorf("failed to check for updates: %w", err)
+	}
+
+	for _, listApp := range packagesToUpdate {
+		app := appsMap[listApp.ID]
+		policy := UpdatePolicy(app.UpdatePolicy)
+		if policy == UpdatePolicyNotify {
+			slog.Info(fmt.Sprintf("Update available for %s: %s to %s", app.ID, app.Schema.Version, listApp.Version))
+			continue
+		}
+		if !policy.AllowsAutoUpdate(app.Schema.Version, listApp.Version) {
+			continue
+		}
+
+		failed, err := queries.HasFailedUpdate(ctx, persistence.HasFailedUpdateParams{
+			AppID:     app.ID,
+			ToVersion: listApp.Version,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to check update history: %w", err)
+		}
+		if failed {
+			slog.Info(fmt.Sprintf("Skipping update of %s to %s as it previously failed", app.ID, listApp.Version))
+			continue
+		}
+
+		appPackage, err := storeClient.GetPackage(listApp.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get full package details: %w", err)
+		}
+
+		slog.Info(fmt.Sprintf("Automatically updating %s from %s to %s", app.ID, app.Schema.Version, appPackage.Version))
+		_, err = StartUpdate(
+			ctx,
+			jobManager,
+			dockerClient,
+			queries,
+			hosts,
+			appDataHandler,
+			oryConfig,
+			hostConfig,
+			storageConfig,
+			dockerConfig,
+			appPackage,
+			true,
+			false,
+		)
+		if err != nil && !errors.Is(err, jobs.AppBusyError) {
+			return fmt.Errorf("failed to start update for %s: %w", app.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package apps
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+func TestAllowsAutoUpdate(t *testing.T) {
+	tests := []struct {
+		policy   UpdatePolicy
+		from     string
+		to       string
+		expected bool
+	}{
+		{UpdatePolicyManual, "v1.0.0", "v1.0.1", false},
+		{UpdatePolicyNotify, "v1.0.0", "v1.0.1", false},
+		{UpdatePolicyAutoPatch, "v1.0.0", "v1.0.1", true},
+		{UpdatePolicyAutoPatch, "v1.0.0", "v1.1.0", false},
+		{UpdatePolicyAutoMinor, "v1.0.0", "v1.1.0", true},
+		{UpdatePolicyAutoMinor, "v1.5", "v2.0", false},
+	}
+
+	for _, test := range tests {
+		if result := test.policy.AllowsAutoUpdate(test.from, test.to); result != test.expected {
+			t.Errorf("%s from %s to %s: expected %t, got %t", test.policy, test.from, test.to, test.expected, result)
+		}
+	}
+}
+
+func TestInMaintenanceWindow(t *testing.T) {
+	tests := []struct {
+		start    int64
+		end      int64
+		hour     int
+		expected bool
+	}{
+		{3, 5, 3, true},
+		{3, 5, 5, false},
+		{3, 5, 12, false},
+		{23, 2, 0, true},
+		{23, 2, 22, false},
+		{0, 0, 12, true},
+	}
+
+	for _, test := range tests {
+		settings := persistence.UpdateSetting{WindowStart: test.start, WindowEnd: test.end}
+		now := time.Date(2025, 1, 1, test.hour, 30, 0, 0, time.Local)
+		if result := InMaintenanceWindow(settings, now); result != test.expected {
+			t.Errorf("window %d-%d at hour %d: expected %t, got %t", test.start, test.end, test.hour, test.expected, result)
+		}
+	}
+}
+
+// Tests pinned apps aren't included when checking for updates
+func TestCheckUpdateAppsPinned(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+	ctx := context.Background()
+
+	err := queries.InsertPackage(ctx, persistence.FullPackageListItem{
+		PackageListItem: persistence.PackageListItem{ID: "traefik.whoami", Name: "whoami", Version: "v1.6"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error inserting package: %s", err.Error())
+	}
+
+	schema, err := json.Marshal(persistence.AppPackage{Id: "traefik.whoami", Name: "whoami", Version: "v1.5"})
+	if err != nil {
+		t.Fatalf("Unexpected error marshalling schema: %s", err.Error())
+	}
+	if err := queries.CreateApp(ctx, persistence.CreateAppParams{ID: "traefik.whoami", Schema: schema}); err != nil {
+		t.Fatalf("Unexpected error creating app: %s", err.Error())
+	}
+
+	updates, err := CheckUpdateApps(ctx, queries)
+	if err != nil {
+		t.Fatalf("Unexpected error checking updates: %s", err.Error())
+	}
+	if len(updates) != 1 {
+		t.Fatalf("Expected 1 update before pinning, got %d", len(updates))
+	}
+
+	if err := queries.SetPinned(ctx, persistence.SetPinnedParams{Pinned: true, ID: "traefik.whoami"}); err != nil {
+		t.Fatalf("Unexpected error pinning app: %s", err.Error())
+	}
+
+	updates, err = CheckUpdateApps(ctx, queries)
+	if err != nil {
+		t.Fatalf("Unexpected error checking updates: %s", err.Error())
+	}
+	if len(updates) != 0 {
+		t.Fatalf("Expected no updates after pinning, got %d", len(updates))
+	}
+}
+
+// Tests the version an app was last notified of is stored, so it isn't notified of again after a restart
+func TestNotifyUpdates(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+	ctx := context.Background()
+
+	err := queries.InsertPackage(ctx, persistence.FullPackageListItem{
+		PackageListItem: persistence.PackageListItem{ID: "traefik.whoami", Name: "whoami", Version: "v1.6"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error inserting package: %s", err.Error())
+	}
+	schema, err := json.Marshal(persistence.AppPackage{Id: "traefik.whoami", Name: "whoami", Version: "v1.5"})
+	if err != nil {
+		t.Fatalf("Unexpected error marshalling schema: %s", err.Error())
+	}
+	if err := queries.CreateApp(ctx, persistence.CreateAppParams{ID: "traefik.whoami", Schema: schema}); err != nil {
+		t.Fatalf("Unexpected error creating app: %s", err.Error())
+	}
+	err = queries.SetUpdatePolicy(ctx, persistence.SetUpdatePolicyParams{UpdatePolicy: string(UpdatePolicyNotify), ID: "traefik.whoami"})
+	if err != nil {
+		t.Fatalf("Unexpected error setting update policy: %s", err.Error())
+	}
+
+	if err := NotifyUpdates(ctx, queries, nil); err != nil {
+		t.Fatalf("Unexpected error notifying updates: %s", err.Error())
+	}
+	notified, err := queries.GetNotifiedUpdate(ctx, "traefik.whoami")
+	if err != nil {
+		t.Fatalf("Unexpected error getting notified update: %s", err.Error())
+	}
+	if notified != "v1.6" {
+		t.Errorf("Expected notified version v1.6, got %s", notified)
+	}
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+	"net/url"
+	"strings"
 
 	hydra "github.com/ory/hydra-client-go/v2"
 )
@@ -29,3 +31,47 @@ func SetupAppAuth(
 
 	return
 }
+
+// clientsPageSize is the number of OAuth2 clients retrieved from hydra in each request
+const clientsPageSize = 500
+
+// ListClients retrieves every OAuth2 client registered with hydra, following the pages given in the link header
+func ListClients(ctx context.Context, hydraAdmin *hydra.APIClient) ([]hydra.OAuth2Client, error) {
+	var clients []hydra.OAuth2Client
+	pageToken := ""
+	for {
+		request := hydraAdmin.OAuth2API.ListOAuth2Clients(ctx).PageSize(clientsPageSize)
+		if pageToken != "" {
+			request = request.PageToken(pageToken)
+		}
+
+		page, response, err := request.Execute()
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, page...)
+
+		pageToken = nextPageToken(response.Header.Get("Link"))
+		if pageToken == "" || len(page) == 0 {
+			return clients, nil
+		}
+	}
+}
+
+// nextPageToken finds the page token of the next page in a link header, such as
+// </clients?page_size=500&page_token=abc>; rel="next". An empty string is returned on the last page
+func nextPageToken(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		target, params, found := strings.Cut(part, ";")
+		if !found || !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+
+		nextUrl, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+		if err != nil {
+			return ""
+		}
+		return nextUrl.Query().Get("page_token")
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Chunk sizes are chosen so a volume of photos is split into a manageable number of objects, while small changes
+// to large files only require a few chunks to be uploaded again
+const (
+	minChunkSize = 256 * 1024
+	maxChunkSize = 4 * 1024 * 1024
+	// chunkMask gives an average chunk size of around 1MiB above the minimum
+	chunkMask = 1<<20 - 1
+)
+
+// chunker splits a stream into content defined chunks using a gear hash, so inserting or removing data only changes
+// the chunks around the change and the rest are deduplicated. The gear table is derived from the repository's key, so
+// chunk boundaries don't reveal anything about the contents
+type chunker struct {
+	reader io.Reader
+	gear   [256]uint64
+	buffer []byte
+	start  int
+	end    int
+	eof    bool
+}
+
+func newChunker(reader io.Reader, seed []byte) *chunker {
+	c := &chunker{reader: reader, buffer: make([]byte, 2*maxChunkSize)}
+	for i := range c.gear {
+		hash := sha256.Sum256(append(binary.BigEndian.AppendUint32(nil, uint32(i)), seed...))
+		c.gear[i] = binary.BigEndian.Uint64(hash[:8])
+	}
+	return c
+}
+
+// fill reads until the buffer holds at least a maximum sized chunk, or the end of the stream is reached
+func (c *chunker) fill() error {
+	if c.end-c.start >= maxChunkSize || c.eof {
+		return nil
+	}
+	copy(c.buffer, c.buffer[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+
+	for c.end < maxChunkSize && !c.eof {
+		n, err := c.reader.Read(c.buffer[c.end:])
+		c.end += n
+		if errors.Is(err, io.EOF) {
+			c.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Next returns the next chunk, which is only valid until the following call. io.EOF is returned after the last chunk
+func (c *chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	available := c.buffer[c.start:c.end]
+	if len(available) == 0 {
+		return nil, io.EOF
+	}
+
+	size := min(len(available), maxChunkSize)
+	if size > minChunkSize {
+		var hash uint64
+		for i := minChunkSize; i < size; i++ {
+			hash = hash<<1 + c.gear[available[i]]
+			if hash&chunkMask == 0 {
+				size = i + 1
+				break
+			}
+		}
+	}
+
+	c.start += size
+	return available[:size], nil
+}
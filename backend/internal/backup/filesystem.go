@@ -0,0 +1,165 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// filesystemTarget stores backups as files in a directory, with keys mapped to paths within it
+type filesystemTarget struct {
+	root  string
+	close func() error
+}
+
+func openLocal(config LocalConfig) (Target, error) {
+	if err := os.MkdirAll(config.Path, 0755); err != nil {
+		return nil, fmt.Errorf("error creating backup directory: %w", err)
+	}
+	return &filesystemTarget{root: config.Path}, nil
+}
+
+// openDrive mounts the removable drive, storing backups from its root so existing backups on the drive are found
+func openDrive(config DriveConfig) (Target, error) {
+	details, err := storage.GetExternalPartition(config.Device)
+	if err != nil {
+		return nil, fmt.Errorf("error checking drive is external: %w", err)
+	}
+
+	mountPath, err := storage.MountPartition(details)
+	if err != nil {
+		return nil, fmt.Errorf("error mounting partition: %w", err)
+	}
+
+	return &filesystemTarget{
+		root:  mountPath,
+		close: func() error { return storage.UnmountPartition(details) },
+	}, nil
+}
+
+func (t *filesystemTarget) path(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(t.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (t *filesystemTarget) List(_ context.Context, prefix string) ([]string, error) {
+	// Walks the deepest directory containing every key with the prefix
+	dir := t.root
+	if index := strings.LastIndex(prefix, "/"); index >= 0 {
+		var err error
+		if dir, err = t.path(prefix[:index]); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0)
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		relative, err := filepath.Rel(t.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		// Partially written files are skipped
+		if strings.HasPrefix(key, prefix) && !strings.HasSuffix(key, partialSuffix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// partialSuffix is added to files while they're written, so an interrupted write doesn't leave an incomplete object
+const partialSuffix = ".partial"
+
+func (t *filesystemTarget) Put(_ context.Context, key string, data io.Reader, size int64) error {
+	filePath, err := t.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	partialPath := filePath + partialSuffix
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(file, data)
+	if err == nil && written != size {
+		err = fmt.Errorf("expected %d bytes for %s, got %d", size, key, written)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partialPath)
+		return err
+	}
+
+	return os.Rename(partialPath, filePath)
+}
+
+func (t *filesystemTarget) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	filePath, err := t.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", NotFoundError, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Delete removes the file, along with any directories left empty up to the root
+func (t *filesystemTarget) Delete(_ context.Context, key string) error {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(t.root, filepath.FromSlash(cleaned))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for dir := path.Dir(cleaned); dir != "."; dir = path.Dir(dir) {
+		if err := os.Remove(filepath.Join(t.root, filepath.FromSlash(dir))); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (t *filesystemTarget) Close() error {
+	if t.close == nil {
+		return nil
+	}
+	return t.close()
+}
@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Tests objects can be stored, listed, retrieved and deleted in a local directory
+func TestLocalTarget(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	target, err := Open(ctx, TargetConfig{Name: "local", Type: LocalTarget, Local: &LocalConfig{Path: root}})
+	if err != nil {
+		t.Fatalf("Unexpected error opening target: %s", err.Error())
+	}
+	defer target.Close()
+
+	objects := map[string]string{
+		"backup/app1/a/data.tar.gz": "app1 data",
+		"backup/app1/b/data.tar.gz": "newer app1 data",
+		"backup/app2/a/data.tar.gz": "app2 data",
+	}
+	for key, data := range objects {
+		if err := target.Put(ctx, key, strings.NewReader(data), int64(len(data))); err != nil {
+			t.Fatalf("Unexpected error putting %s: %s", key, err.Error())
+		}
+	}
+
+	keys, err := target.List(ctx, "backup/app1/")
+	if err != nil {
+		t.Fatalf("Unexpected error listing objects: %s", err.Error())
+	}
+	if diff := cmp.Diff([]string{"backup/app1/a/data.tar.gz", "backup/app1/b/data.tar.gz"}, keys); diff != "" {
+		t.Errorf("Listed keys mismatch (-want +got):\n%s", diff)
+	}
+
+	reader, err := target.Get(ctx, "backup/app1/b/data.tar.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error getting object: %s", err.Error())
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error reading object: %s", err.Error())
+	}
+	if string(data) != "newer app1 data" {
+		t.Errorf("Expected object data newer app1 data, got %s", data)
+	}
+
+	if err := target.Delete(ctx, "backup/app2/a/data.tar.gz"); err != nil {
+		t.Fatalf("Unexpected error deleting object: %s", err.Error())
+	}
+	if _, err := target.Get(ctx, "backup/app2/a/data.tar.gz"); !errors.Is(err, NotFoundError) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	// Directories emptied by deleting should be removed
+	if _, err := os.Stat(filepath.Join(root, "backup", "app2")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected empty directory to be removed, got %v", err)
+	}
+
+	// Writes with the wrong size shouldn't leave an object behind
+	if err := target.Put(ctx, "backup/app3/a/data.tar.gz", strings.NewReader("short"), 100); err == nil {
+		t.Error("Expected error putting object with incorrect size")
+	}
+	if keys, err := target.List(ctx, "backup/app3/"); err != nil || len(keys) != 0 {
+		t.Errorf("Expected no objects after failed put, got %v, %v", keys, err)
+	}
+}
+
+// Tests keys can't refer to files outside the target's directory
+func TestLocalTargetInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	target, err := Open(ctx, TargetConfig{Name: "local", Type: LocalTarget, Local: &LocalConfig{Path: t.TempDir()}})
+	if err != nil {
+		t.Fatalf("Unexpected error opening target: %s", err.Error())
+	}
+	defer target.Close()
+
+	for _, key := range []string{"", "../outside", "backup/../../outside", "/absolute"} {
+		if err := target.Put(ctx, key, strings.NewReader("data"), 4); !errors.Is(err, InvalidKeyError) {
+			t.Errorf("Expected invalid key error for %q, got %v", key, err)
+		}
+	}
+}
+
+// Tests legacy snapshots are downloaded to directories, listed per app and removed
+func TestLegacySnapshots(t *testing.T) {
+	ctx := context.Background()
+	target, err := Open(ctx, TargetConfig{Name: "local", Type: LocalTarget, Local: &LocalConfig{Path: t.TempDir()}})
+	if err != nil {
+		t.Fatalf("Unexpected error opening target: %s", err.Error())
+	}
+	defer target.Close()
+
+	files := map[string]string{"data.tar.gz": "archive", "secrets.json": "{}"}
+	for _, snapshot := range []string{"2024-02-01_00-00-00", "2024-01-01_00-00-00"} {
+		for name, data := range files {
+			key := "backup/app1/" + snapshot + "/" + name
+			if err := target.Put(ctx, key, strings.NewReader(data), int64(len(data))); err != nil {
+				t.Fatalf("Unexpected error putting %s: %s", key, err.Error())
+			}
+		}
+	}
+
+	snapshots, err := ListSnapshots(ctx, target, "app1")
+	if err != nil {
+		t.Fatalf("Unexpected error listing snapshots: %s", err.Error())
+	}
+	if diff := cmp.Diff([]string{"2024-01-01_00-00-00", "2024-02-01_00-00-00"}, snapshots); diff != "" {
+		t.Errorf("Listed snapshots mismatch (-want +got):\n%s", diff)
+	}
+
+	destination := filepath.Join(t.TempDir(), "restore")
+	if err := GetLegacySnapshot(ctx, target, "app1", "2024-01-01_00-00-00", destination); err != nil {
+		t.Fatalf("Unexpected error getting snapshot: %s", err.Error())
+	}
+	for name, expected := range files {
+		data, err := os.ReadFile(filepath.Join(destination, name))
+		if err != nil {
+			t.Fatalf("Unexpected error reading restored file: %s", err.Error())
+		}
+		if string(data) != expected {
+			t.Errorf("Expected %s to contain %s, got %s", name, expected, data)
+		}
+	}
+
+	if err := DeleteLegacySnapshot(ctx, target, "app1", "2024-01-01_00-00-00"); err != nil {
+		t.Fatalf("Unexpected error deleting snapshot: %s", err.Error())
+	}
+	if err := GetLegacySnapshot(ctx, target, "app1", "2024-01-01_00-00-00", destination); !errors.Is(err, NotFoundError) {
+		t.Errorf("Expected not found error for deleted snapshot, got %v", err)
+	}
+	if err := GetLegacySnapshot(ctx, target, "app1", "../app2", destination); !errors.Is(err, InvalidKeyError) {
+		t.Errorf("Expected invalid key error for snapshot outside app, got %v", err)
+	}
+}
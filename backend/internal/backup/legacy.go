@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Legacy snapshots are directories of archives, stored under backup/<app>/<snapshot>/ by versions before backups
+// were stored in a repository. They can still be listed, restored and removed
+
+// snapshotPrefix is the prefix of all objects in the app's legacy snapshot, or all of the app's legacy snapshots if
+// the snapshot is empty
+func snapshotPrefix(appId string, snapshot string) string {
+	if snapshot == "" {
+		return path.Join("backup", appId) + "/"
+	}
+	return path.Join("backup", appId, snapshot) + "/"
+}
+
+// checkNames checks the app ID and snapshot names can't refer to objects outside of the snapshot
+func checkNames(names ...string) error {
+	for _, name := range names {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+			return fmt.Errorf("%w: %s", InvalidKeyError, name)
+		}
+	}
+	return nil
+}
+
+// ListSnapshots lists the names of the app's snapshots stored on the target, both in the repository and legacy
+// snapshots, oldest first. The repository's passphrase isn't needed to list snapshots
+func ListSnapshots(ctx context.Context, target Target, appId string) ([]string, error) {
+	snapshots, err := listRepositorySnapshots(ctx, target, appId)
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := ListLegacySnapshots(ctx, target, appId)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range legacy {
+		if !slices.Contains(snapshots, snapshot) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	slices.Sort(snapshots)
+	return snapshots, nil
+}
+
+// ListLegacySnapshots lists the names of the app's legacy snapshots stored on the target, oldest first
+func ListLegacySnapshots(ctx context.Context, target Target, appId string) ([]string, error) {
+	if err := checkNames(appId); err != nil {
+		return nil, err
+	}
+	prefix := snapshotPrefix(appId, "")
+	keys, err := target.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]string, 0)
+	for _, key := range keys {
+		snapshot, _, found := strings.Cut(strings.TrimPrefix(key, prefix), "/")
+		if found && !slices.Contains(snapshots, snapshot) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	slices.Sort(snapshots)
+	return snapshots, nil
+}
+
+// GetLegacySnapshot downloads the app's legacy snapshot into the directory, returning NotFoundError if the snapshot
+// doesn't exist
+func GetLegacySnapshot(ctx context.Context, target Target, appId string, snapshot string, dir string) error {
+	if err := checkNames(appId, snapshot); err != nil {
+		return err
+	}
+	prefix := snapshotPrefix(appId, snapshot)
+	keys, err := target.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: %s", NotFoundError, snapshot)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		// Snapshots only contain files at the top level
+		if strings.Contains(name, "/") {
+			continue
+		}
+		if err := getFile(ctx, target, key, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getFile(ctx context.Context, target Target, key string, filePath string) error {
+	data, err := target.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, data); err != nil {
+		file.Close()
+		return fmt.Errorf("error downloading %s: %w", key, err)
+	}
+	return file.Close()
+}
+
+// DeleteLegacySnapshot removes all objects in the app's legacy snapshot
+func DeleteLegacySnapshot(ctx context.Context, target Target, appId string, snapshot string) error {
+	if err := checkNames(appId, snapshot); err != nil {
+		return err
+	}
+	keys, err := target.List(ctx, snapshotPrefix(appId, snapshot))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := target.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,806 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var NoRepositoryError = errors.New("no backup repository on target")
+var NoPassphraseError = errors.New("backup target has no passphrase set")
+var WrongPassphraseError = errors.New("incorrect passphrase for backup repository")
+var CorruptError = errors.New("backup data is corrupt")
+
+// The repository is stored alongside backups made before it existed, which are kept under backup/
+const (
+	repositoryConfigKey = "repository/config"
+	chunksPrefix        = "repository/chunks/"
+	snapshotsPrefix     = "repository/snapshots/"
+)
+
+const repositoryVersion = 1
+
+// kdfParams are the argon2id parameters used to derive the key encrypting the repository's keys from the passphrase
+type kdfParams struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+}
+
+var defaultKDFParams = kdfParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// repositoryConfig is stored unencrypted in the repository, with the repository's keys encrypted by the passphrase
+type repositoryConfig struct {
+	Version int       `json:"version"`
+	KDF     kdfParams `json:"kdf"`
+	Keys    []byte    `json:"keys"`
+}
+
+// repositoryKeys are generated when the repository is created, so the passphrase only protects them and data doesn't
+// depend on it directly
+type repositoryKeys struct {
+	Encryption []byte `json:"encryption"`
+	ID         []byte `json:"id"`
+	Chunker    []byte `json:"chunker"`
+}
+
+// Snapshot is a backup of an app, made up of named archives. Each archive is a stream, such as a tar of a volume,
+// split into chunks which are stored once and shared between all snapshots in the repository
+type Snapshot struct {
+	AppID    string    `json:"app_id"`
+	Name     string    `json:"name"`
+	Time     time.Time `json:"time"`
+	Archives []Archive `json:"archives"`
+	// Added is the size of the chunks which weren't already stored in the repository
+	Added int64 `json:"added"`
+}
+
+// Archive is a stored archive along with its manifest, which records what the archive contained when it was backed up
+// so it can be verified later
+type Archive struct {
+	Name   string   `json:"name"`
+	Size   int64    `json:"size"`
+	Chunks []string `json:"chunks"`
+	// SHA256 is the hash of the archive's contents, and Files the number of files in tar archives. Both are empty in
+	// snapshots made before they were recorded
+	SHA256 string `json:"sha256,omitempty"`
+	Tar    bool   `json:"tar,omitempty"`
+	Files  int64  `json:"files,omitempty"`
+}
+
+// Size is the total size of the snapshot's archives before deduplication
+func (s Snapshot) Size() int64 {
+	var size int64
+	for _, archive := range s.Archives {
+		size += archive.Size
+	}
+	return size
+}
+
+// ArchiveSource is an archive to store in a snapshot. Open is called when the archive is stored, so sources such as
+// containers are only created as needed
+type ArchiveSource struct {
+	Name string
+	Open func(ctx context.Context) (io.ReadCloser, error)
+	// Tar marks archives which are tar streams, so the files in them are counted
+	Tar bool
+}
+
+// Repository stores encrypted, deduplicated snapshots on a target. Chunks are named by a keyed hash of their contents,
+// and encrypted with AES-GCM along with snapshots, so the target learns nothing of the data except its size
+type Repository struct {
+	target  Target
+	lock    *sync.RWMutex
+	aead    cipher.AEAD
+	idKey   []byte
+	chunker []byte
+}
+
+// repositoryLocks prevents pruning a repository while a backup is being stored, since the chunks it has uploaded
+// aren't referenced by a snapshot until it finishes. Locks are per target name, as only this server writes to them
+var repositoryLocks sync.Map
+
+func repositoryLock(name string) *sync.RWMutex {
+	lock, _ := repositoryLocks.LoadOrStore(name, &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func passphraseKey(passphrase string, params kdfParams) []byte {
+	return argon2.IDKey([]byte(passphrase), params.Salt, params.Time, params.Memory, params.Threads, 32)
+}
+
+func randomBytes(size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// seal encrypts the data, binding it to the additional data so objects can't be swapped for each other
+func seal(aead cipher.AEAD, data []byte, additional []byte) ([]byte, error) {
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, additional), nil
+}
+
+func unseal(aead cipher.AEAD, data []byte, additional []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, CorruptError
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additional)
+	if err != nil {
+		return nil, CorruptError
+	}
+	return plaintext, nil
+}
+
+// OpenRepository opens the repository on the target using the target's passphrase, returning NoRepositoryError if
+// the target doesn't have one. If create is set a repository is created instead
+func OpenRepository(ctx context.Context, target Target, config TargetConfig, create bool) (*Repository, error) {
+	if config.Passphrase == "" {
+		return nil, NoPassphraseError
+	}
+
+	// Held while creating the repository, so concurrent backups to a new target don't create it twice
+	lock := repositoryLock(config.Name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	configData, err := readObject(ctx, target, repositoryConfigKey)
+	if errors.Is(err, NotFoundError) {
+		if !create {
+			return nil, NoRepositoryError
+		}
+		return initRepository(ctx, target, config.Passphrase, lock)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var repoConfig repositoryConfig
+	if err := json.Unmarshal(configData, &repoConfig); err != nil {
+		return nil, fmt.Errorf("%w: invalid repository config: %w", CorruptError, err)
+	}
+	if repoConfig.Version != repositoryVersion {
+		return nil, fmt.Errorf("unsupported backup repository version %d", repoConfig.Version)
+	}
+
+	keyAEAD, err := newAEAD(passphraseKey(config.Passphrase, repoConfig.KDF))
+	if err != nil {
+		return nil, err
+	}
+	keysJson, err := unseal(keyAEAD, repoConfig.Keys, []byte(repositoryConfigKey))
+	if err != nil {
+		return nil, WrongPassphraseError
+	}
+	var keys repositoryKeys
+	if err := json.Unmarshal(keysJson, &keys); err != nil {
+		return nil, fmt.Errorf("%w: invalid repository keys: %w", CorruptError, err)
+	}
+	return newRepository(target, keys, lock)
+}
+
+func initRepository(ctx context.Context, target Target, passphrase string, lock *sync.RWMutex) (*Repository, error) {
+	var keys repositoryKeys
+	for _, key := range []*[]byte{&keys.Encryption, &keys.ID, &keys.Chunker} {
+		var err error
+		if *key, err = randomBytes(32); err != nil {
+			return nil, err
+		}
+	}
+
+	params := defaultKDFParams
+	var err error
+	if params.Salt, err = randomBytes(16); err != nil {
+		return nil, err
+	}
+	keyAEAD, err := newAEAD(passphraseKey(passphrase, params))
+	if err != nil {
+		return nil, err
+	}
+	keysJson, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	sealedKeys, err := seal(keyAEAD, keysJson, []byte(repositoryConfigKey))
+	if err != nil {
+		return nil, err
+	}
+
+	configData, err := json.Marshal(repositoryConfig{Version: repositoryVersion, KDF: params, Keys: sealedKeys})
+	if err != nil {
+		return nil, err
+	}
+	if err := target.Put(ctx, repositoryConfigKey, bytes.NewReader(configData), int64(len(configData))); err != nil {
+		return nil, fmt.Errorf("error creating backup repository: %w", err)
+	}
+	return newRepository(target, keys, lock)
+}
+
+func newRepository(target Target, keys repositoryKeys, lock *sync.RWMutex) (*Repository, error) {
+	aead, err := newAEAD(keys.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	return &Repository{target: target, lock: lock, aead: aead, idKey: keys.ID, chunker: keys.Chunker}, nil
+}
+
+func readObject(ctx context.Context, target Target, key string) ([]byte, error) {
+	reader, err := target.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// encodeBlob compresses the data if it makes it smaller, prefixing it with whether it's compressed. Most volume data
+// such as photos is already compressed, so is stored as is
+func encodeBlob(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	compressed.WriteByte(1)
+	writer, err := flate.NewWriter(&compressed, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	if compressed.Len() < len(data)+1 {
+		return compressed.Bytes(), nil
+	}
+	return append([]byte{0}, data...), nil
+}
+
+func decodeBlob(blob []byte) ([]byte, error) {
+	if len(blob) == 0 {
+		return nil, CorruptError
+	}
+	switch blob[0] {
+	case 0:
+		return blob[1:], nil
+	case 1:
+		data, err := io.ReadAll(flate.NewReader(bytes.NewReader(blob[1:])))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", CorruptError, err)
+		}
+		return data, nil
+	}
+	return nil, CorruptError
+}
+
+func (r *Repository) chunkId(data []byte) string {
+	mac := hmac.New(sha256.New, r.idKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func chunkKey(id string) string {
+	return chunksPrefix + id[:2] + "/" + id
+}
+
+func snapshotKey(appId string, snapshot string) string {
+	return snapshotsPrefix + appId + "/" + snapshot
+}
+
+// storedChunks lists the IDs of the chunks in the repository
+func (r *Repository) storedChunks(ctx context.Context) (map[string]bool, error) {
+	keys, err := r.target.List(ctx, chunksPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("error listing chunks: %w", err)
+	}
+	chunks := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		// Other files, such as those left by interrupted uploads, are ignored
+		if id := path.Base(key); len(id) == sha256.Size*2 {
+			chunks[id] = true
+		}
+	}
+	return chunks, nil
+}
+
+// putChunk encrypts and uploads the chunk if it isn't already stored, returning its ID and the size uploaded
+func (r *Repository) putChunk(ctx context.Context, data []byte, stored map[string]bool) (string, int64, error) {
+	id := r.chunkId(data)
+	if stored[id] {
+		return id, 0, nil
+	}
+
+	blob, err := encodeBlob(data)
+	if err != nil {
+		return "", 0, err
+	}
+	sealed, err := seal(r.aead, blob, []byte(id))
+	if err != nil {
+		return "", 0, err
+	}
+	if err := r.target.Put(ctx, chunkKey(id), bytes.NewReader(sealed), int64(len(sealed))); err != nil {
+		return "", 0, fmt.Errorf("error uploading chunk: %w", err)
+	}
+	stored[id] = true
+	return id, int64(len(sealed)), nil
+}
+
+// getChunk downloads and decrypts the chunk, checking its contents match its ID
+func (r *Repository) getChunk(ctx context.Context, id string) ([]byte, error) {
+	sealed, err := readObject(ctx, r.target, chunkKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading chunk %s: %w", id, err)
+	}
+	blob, err := unseal(r.aead, sealed, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", id, err)
+	}
+	data, err := decodeBlob(blob)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", id, err)
+	}
+	if r.chunkId(data) != id {
+		return nil, fmt.Errorf("chunk %s: %w", id, CorruptError)
+	}
+	return data, nil
+}
+
+// countFiles counts the regular files in a tar stream, then reads the rest of the stream so it's consumed entirely
+func countFiles(reader io.Reader) (int64, error) {
+	tarReader := tar.NewReader(reader)
+	var files int64
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return files, fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			files++
+		}
+	}
+	_, err := io.Copy(io.Discard, reader)
+	return files, err
+}
+
+// fileCounter counts the files in a tar stream written to it in the background, so an archive can be counted while
+// it's being stored without reading it twice
+type fileCounter struct {
+	writer *io.PipeWriter
+	done   chan struct{}
+	files  int64
+	err    error
+}
+
+func newFileCounter() *fileCounter {
+	reader, writer := io.Pipe()
+	counter := &fileCounter{writer: writer, done: make(chan struct{})}
+	go func() {
+		defer close(counter.done)
+		counter.files, counter.err = countFiles(reader)
+		// Fails writes if the stream isn't a valid tar archive, so the archive isn't stored
+		reader.CloseWithError(counter.err)
+	}()
+	return counter
+}
+
+func (c *fileCounter) Write(p []byte) (int, error) {
+	return c.writer.Write(p)
+}
+
+// Close waits for the rest of the stream to be counted, returning the number of files in it
+func (c *fileCounter) Close() (int64, error) {
+	c.writer.Close()
+	<-c.done
+	return c.files, c.err
+}
+
+// putArchive stores the source's contents, recording its hash and number of files in the archive's manifest
+func (r *Repository) putArchive(ctx context.Context, source ArchiveSource, stored map[string]bool) (Archive, int64, error) {
+	reader, err := source.Open(ctx)
+	if err != nil {
+		return Archive{}, 0, err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	manifest := []io.Writer{hash}
+	var counter *fileCounter
+	if source.Tar {
+		counter = newFileCounter()
+		defer counter.Close()
+		manifest = append(manifest, counter)
+	}
+
+	archive := Archive{Name: source.Name, Chunks: []string{}, Tar: source.Tar}
+	var added int64
+	chunks := newChunker(io.TeeReader(reader, io.MultiWriter(manifest...)), r.chunker)
+	for {
+		data, err := chunks.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Archive{}, 0, err
+		}
+
+		id, uploaded, err := r.putChunk(ctx, data, stored)
+		if err != nil {
+			return Archive{}, 0, err
+		}
+		archive.Chunks = append(archive.Chunks, id)
+		archive.Size += int64(len(data))
+		added += uploaded
+	}
+
+	archive.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if counter != nil {
+		if archive.Files, err = counter.Close(); err != nil {
+			return Archive{}, 0, err
+		}
+	}
+	return archive, added, nil
+}
+
+// Backup stores the archives as the app's snapshot. Only chunks not already in the repository are uploaded, so
+// unchanged data isn't copied again. Chunks uploaded by a failed backup are removed when the repository is pruned
+func (r *Repository) Backup(ctx context.Context, appId string, name string, sources []ArchiveSource) (Snapshot, error) {
+	if err := checkNames(appId, name); err != nil {
+		return Snapshot{}, err
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	stored, err := r.storedChunks(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot := Snapshot{AppID: appId, Name: name, Time: time.Now(), Archives: make([]Archive, 0, len(sources))}
+	for _, source := range sources {
+		archive, added, err := r.putArchive(ctx, source, stored)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("error backing up %s: %w", source.Name, err)
+		}
+		snapshot.Archives = append(snapshot.Archives, archive)
+		snapshot.Added += added
+	}
+
+	if err := r.putSnapshot(ctx, snapshot); err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+func (r *Repository) putSnapshot(ctx context.Context, snapshot Snapshot) error {
+	snapshotJson, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	blob, err := encodeBlob(snapshotJson)
+	if err != nil {
+		return err
+	}
+	key := snapshotKey(snapshot.AppID, snapshot.Name)
+	sealed, err := seal(r.aead, blob, []byte(key))
+	if err != nil {
+		return err
+	}
+	if err := r.target.Put(ctx, key, bytes.NewReader(sealed), int64(len(sealed))); err != nil {
+		return fmt.Errorf("error uploading snapshot: %w", err)
+	}
+	return nil
+}
+
+// ListSnapshots lists the names of the app's snapshots in the repository, oldest first
+func (r *Repository) ListSnapshots(ctx context.Context, appId string) ([]string, error) {
+	return listRepositorySnapshots(ctx, r.target, appId)
+}
+
+// listRepositorySnapshots lists the app's snapshots from their keys, which doesn't need the repository's passphrase
+func listRepositorySnapshots(ctx context.Context, target Target, appId string) ([]string, error) {
+	if err := checkNames(appId); err != nil {
+		return nil, err
+	}
+	prefix := snapshotsPrefix + appId + "/"
+	keys, err := target.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]string, 0, len(keys))
+	for _, key := range keys {
+		snapshots = append(snapshots, strings.TrimPrefix(key, prefix))
+	}
+	slices.Sort(snapshots)
+	return snapshots, nil
+}
+
+// LoadSnapshot retrieves the app's snapshot, returning NotFoundError if it doesn't exist
+func (r *Repository) LoadSnapshot(ctx context.Context, appId string, name string) (Snapshot, error) {
+	if err := checkNames(appId, name); err != nil {
+		return Snapshot{}, err
+	}
+	return r.loadSnapshot(ctx, snapshotKey(appId, name))
+}
+
+func (r *Repository) loadSnapshot(ctx context.Context, key string) (Snapshot, error) {
+	sealed, err := readObject(ctx, r.target, key)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	blob, err := unseal(r.aead, sealed, []byte(key))
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot %s: %w", key, err)
+	}
+	snapshotJson, err := decodeBlob(blob)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot %s: %w", key, err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(snapshotJson, &snapshot); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: invalid snapshot %s: %w", CorruptError, key, err)
+	}
+	return snapshot, nil
+}
+
+// DeleteSnapshot removes the app's snapshot. Its chunks are left until the repository is pruned, since they may be
+// used by other snapshots
+func (r *Repository) DeleteSnapshot(ctx context.Context, appId string, name string) error {
+	if err := checkNames(appId, name); err != nil {
+		return err
+	}
+	return r.target.Delete(ctx, snapshotKey(appId, name))
+}
+
+// CheckSnapshot checks all the chunks used by the snapshot are stored, without downloading them
+func (r *Repository) CheckSnapshot(ctx context.Context, snapshot Snapshot) error {
+	stored, err := r.storedChunks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, archive := range snapshot.Archives {
+		for _, id := range archive.Chunks {
+			if !stored[id] {
+				return fmt.Errorf("%w: archive %s is missing chunk %s", CorruptError, archive.Name, id)
+			}
+		}
+	}
+	return nil
+}
+
+// archiveReader reads an archive's chunks in order, verifying each as it's downloaded, and the archive's size and
+// hash once it's been read
+type archiveReader struct {
+	ctx        context.Context
+	repository *Repository
+	archive    Archive
+	next       int
+	current    []byte
+	read       int64
+	hash       hash.Hash
+}
+
+func (a *archiveReader) Read(p []byte) (int, error) {
+	for len(a.current) == 0 {
+		if a.next == len(a.archive.Chunks) {
+			if a.read != a.archive.Size {
+				return 0, fmt.Errorf("%w: archive %s is %d bytes, expected %d", CorruptError, a.archive.Name, a.read, a.archive.Size)
+			}
+			if a.archive.SHA256 != "" && hex.EncodeToString(a.hash.Sum(nil)) != a.archive.SHA256 {
+				return 0, fmt.Errorf("%w: archive %s doesn't match its hash", CorruptError, a.archive.Name)
+			}
+			return 0, io.EOF
+		}
+		data, err := a.repository.getChunk(a.ctx, a.archive.Chunks[a.next])
+		if err != nil {
+			return 0, err
+		}
+		a.current = data
+		a.next++
+	}
+
+	n := copy(p, a.current)
+	a.hash.Write(p[:n])
+	a.current = a.current[n:]
+	a.read += int64(n)
+	return n, nil
+}
+
+// OpenArchive reads the contents of the archive. Data is verified as it's read, so an error is returned before any
+// corrupt data
+func (r *Repository) OpenArchive(ctx context.Context, archive Archive) io.Reader {
+	return &archiveReader{ctx: ctx, repository: r, archive: archive, hash: sha256.New()}
+}
+
+// VerifyResult describes the archives read while verifying a snapshot, and the problems found with them
+type VerifyResult struct {
+	Archives int      `json:"archives"`
+	Files    int64    `json:"files"`
+	Size     int64    `json:"size"`
+	Errors   []string `json:"errors"`
+}
+
+// Verify reads every archive in the snapshot, checking its contents against its manifest. Archives stored before
+// manifests were recorded are only checked against their size
+func (r *Repository) Verify(ctx context.Context, snapshot Snapshot) (VerifyResult, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	result := VerifyResult{Errors: []string{}}
+	for _, archive := range snapshot.Archives {
+		files, err := r.verifyArchive(ctx, archive)
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("archive %s: %s", archive.Name, err.Error()))
+			continue
+		}
+		result.Archives++
+		result.Files += files
+		result.Size += archive.Size
+	}
+	return result, nil
+}
+
+func (r *Repository) verifyArchive(ctx context.Context, archive Archive) (int64, error) {
+	reader := r.OpenArchive(ctx, archive)
+	if !archive.Tar {
+		_, err := io.Copy(io.Discard, reader)
+		return 0, err
+	}
+
+	files, err := countFiles(reader)
+	if err != nil {
+		return 0, err
+	}
+	if files != archive.Files {
+		return 0, fmt.Errorf("%w: contains %d files, expected %d", CorruptError, files, archive.Files)
+	}
+	return files, nil
+}
+
+// allSnapshots loads every snapshot in the repository
+func (r *Repository) allSnapshots(ctx context.Context) ([]string, []Snapshot, []error, error) {
+	keys, err := r.target.List(ctx, snapshotsPrefix)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error listing snapshots: %w", err)
+	}
+	snapshots := make([]Snapshot, 0, len(keys))
+	loaded := make([]string, 0, len(keys))
+	var errs []error
+	for _, key := range keys {
+		snapshot, err := r.loadSnapshot(ctx, key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		loaded = append(loaded, key)
+		snapshots = append(snapshots, snapshot)
+	}
+	return loaded, snapshots, errs, nil
+}
+
+// Prune removes chunks which aren't used by any snapshot, returning the number removed. Nothing is removed if any
+// snapshot can't be read, since its chunks can't be known
+func (r *Repository) Prune(ctx context.Context) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, snapshots, errs, err := r.allSnapshots(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(errs) > 0 {
+		return 0, fmt.Errorf("error reading snapshots: %w", errors.Join(errs...))
+	}
+
+	used := make(map[string]bool)
+	for _, snapshot := range snapshots {
+		for _, archive := range snapshot.Archives {
+			for _, id := range archive.Chunks {
+				used[id] = true
+			}
+		}
+	}
+
+	stored, err := r.storedChunks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for id := range stored {
+		if used[id] {
+			continue
+		}
+		if err := r.target.Delete(ctx, chunkKey(id)); err != nil {
+			return removed, fmt.Errorf("error removing chunk %s: %w", id, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// CheckResult describes the problems found checking a repository
+type CheckResult struct {
+	Snapshots int      `json:"snapshots"`
+	Chunks    int      `json:"chunks"`
+	Errors    []string `json:"errors"`
+}
+
+// Check verifies every snapshot can be read and that the chunks they use are stored. If readData is set every chunk
+// is also downloaded and checked against its ID, which detects corrupted data but reads the whole repository
+func (r *Repository) Check(ctx context.Context, readData bool) (CheckResult, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	result := CheckResult{Errors: []string{}}
+	keys, snapshots, errs, err := r.allSnapshots(ctx)
+	if err != nil {
+		return result, err
+	}
+	for _, err := range errs {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	result.Snapshots = len(snapshots)
+
+	stored, err := r.storedChunks(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Chunks = len(stored)
+
+	for i, snapshot := range snapshots {
+		for _, archive := range snapshot.Archives {
+			for _, id := range archive.Chunks {
+				if !stored[id] {
+					result.Errors = append(result.Errors, fmt.Sprintf("snapshot %s: archive %s: chunk %s is missing", keys[i], archive.Name, id))
+				}
+			}
+		}
+	}
+
+	if readData {
+		for id := range stored {
+			if _, err := r.getChunk(ctx, id); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+			}
+		}
+	}
+	slices.Sort(result.Errors)
+	return result, nil
+}
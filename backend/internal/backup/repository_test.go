@@ -0,0 +1,347 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testData(size int, seed int64) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func chunkAll(t *testing.T, data []byte, seed []byte) [][]byte {
+	chunks := make([][]byte, 0)
+	c := newChunker(bytes.NewReader(data), seed)
+	for {
+		chunk, err := c.Next()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error chunking data: %s", err.Error())
+		}
+		chunks = append(chunks, bytes.Clone(chunk))
+	}
+}
+
+// Tests chunks are within the size limits, and that inserting data only changes the chunks around it
+func TestChunker(t *testing.T) {
+	seed := []byte("seed")
+	data := testData(16*1024*1024, 1)
+	chunks := chunkAll(t, data, seed)
+
+	if !bytes.Equal(bytes.Join(chunks, nil), data) {
+		t.Fatal("Chunks don't join to the original data")
+	}
+	for i, chunk := range chunks[:len(chunks)-1] {
+		if len(chunk) < minChunkSize || len(chunk) > maxChunkSize {
+			t.Errorf("Chunk %d has size %d outside of limits", i, len(chunk))
+		}
+	}
+
+	inserted := append(append(bytes.Clone(data[:5*1024*1024]), []byte("inserted data")...), data[5*1024*1024:]...)
+	shared := 0
+	for _, chunk := range chunkAll(t, inserted, seed) {
+		for _, original := range chunks {
+			if bytes.Equal(chunk, original) {
+				shared++
+				break
+			}
+		}
+	}
+	if shared < len(chunks)-2 {
+		t.Errorf("Expected at most 2 of %d chunks to change after inserting data, %d changed", len(chunks), len(chunks)-shared)
+	}
+}
+
+func openTestRepository(t *testing.T, root string, passphrase string) (Target, *Repository) {
+	ctx := context.Background()
+	config := TargetConfig{Name: t.Name(), Type: LocalTarget, Passphrase: passphrase, Local: &LocalConfig{Path: root}}
+	target, err := Open(ctx, config)
+	if err != nil {
+		t.Fatalf("Unexpected error opening target: %s", err.Error())
+	}
+	repository, err := OpenRepository(ctx, target, config, true)
+	if err != nil {
+		t.Fatalf("Unexpected error opening repository: %s", err.Error())
+	}
+	return target, repository
+}
+
+func source(name string, data []byte) ArchiveSource {
+	return ArchiveSource{Name: name, Open: func(context.Context) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}}
+}
+
+// Tests snapshots can be restored, and that unchanged data isn't uploaded again
+func TestRepositoryBackup(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	target, repository := openTestRepository(t, root, "correct horse")
+	defer target.Close()
+
+	volume := testData(8*1024*1024, 2)
+	first, err := repository.Backup(ctx, "app1", "first", []ArchiveSource{source("data", []byte("data")), source("volumes/app1-db", volume)})
+	if err != nil {
+		t.Fatalf("Unexpected error backing up: %s", err.Error())
+	}
+	if first.Size() != int64(len(volume)+4) {
+		t.Errorf("Expected snapshot size %d, got %d", len(volume)+4, first.Size())
+	}
+
+	second, err := repository.Backup(ctx, "app1", "second", []ArchiveSource{source("data", []byte("changed")), source("volumes/app1-db", volume)})
+	if err != nil {
+		t.Fatalf("Unexpected error backing up: %s", err.Error())
+	}
+	if second.Added > 1024 {
+		t.Errorf("Expected only changed data to be uploaded, %d bytes were", second.Added)
+	}
+
+	// Data is stored encrypted
+	err = filepath.WalkDir(filepath.Join(root, "repository"), func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		contents, err := os.ReadFile(path)
+		if bytes.Contains(contents, []byte("changed")) || bytes.Contains(contents, volume[:64]) {
+			t.Errorf("Found unencrypted data in %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error reading repository: %s", err.Error())
+	}
+
+	// Reopens the repository, as would be done when restoring on another device
+	_, reopened := openTestRepository(t, root, "correct horse")
+	snapshots, err := reopened.ListSnapshots(ctx, "app1")
+	if err != nil {
+		t.Fatalf("Unexpected error listing snapshots: %s", err.Error())
+	}
+	if diff := cmp.Diff([]string{"first", "second"}, snapshots); diff != "" {
+		t.Errorf("Listed snapshots mismatch (-want +got):\n%s", diff)
+	}
+
+	snapshot, err := reopened.LoadSnapshot(ctx, "app1", "first")
+	if err != nil {
+		t.Fatalf("Unexpected error loading snapshot: %s", err.Error())
+	}
+	expected := map[string][]byte{"data": []byte("data"), "volumes/app1-db": volume}
+	for _, archive := range snapshot.Archives {
+		restored, err := io.ReadAll(reopened.OpenArchive(ctx, archive))
+		if err != nil {
+			t.Fatalf("Unexpected error reading archive %s: %s", archive.Name, err.Error())
+		}
+		if !bytes.Equal(restored, expected[archive.Name]) {
+			t.Errorf("Restored archive %s doesn't match the original", archive.Name)
+		}
+	}
+
+	if _, err := reopened.LoadSnapshot(ctx, "app1", "missing"); !errors.Is(err, NotFoundError) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+// Tests the repository can only be opened with the passphrase it was created with
+func TestRepositoryPassphrase(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	target, _ := openTestRepository(t, root, "correct horse")
+	defer target.Close()
+
+	config := TargetConfig{Name: t.Name(), Type: LocalTarget, Passphrase: "wrong", Local: &LocalConfig{Path: root}}
+	if _, err := OpenRepository(ctx, target, config, false); !errors.Is(err, WrongPassphraseError) {
+		t.Errorf("Expected wrong passphrase error, got %v", err)
+	}
+
+	config.Passphrase = ""
+	if _, err := OpenRepository(ctx, target, config, false); !errors.Is(err, NoPassphraseError) {
+		t.Errorf("Expected no passphrase error, got %v", err)
+	}
+
+	empty := TargetConfig{Name: "empty", Type: LocalTarget, Passphrase: "correct horse", Local: &LocalConfig{Path: t.TempDir()}}
+	emptyTarget, err := Open(ctx, empty)
+	if err != nil {
+		t.Fatalf("Unexpected error opening target: %s", err.Error())
+	}
+	if _, err := OpenRepository(ctx, emptyTarget, empty, false); !errors.Is(err, NoRepositoryError) {
+		t.Errorf("Expected no repository error, got %v", err)
+	}
+}
+
+// Tests checking finds missing and corrupted chunks
+func TestRepositoryCheck(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	target, repository := openTestRepository(t, root, "correct horse")
+	defer target.Close()
+
+	// Larger than the maximum chunk size, so there are always at least two chunks to damage
+	snapshot, err := repository.Backup(ctx, "app1", "first", []ArchiveSource{source("volumes/app1-db", testData(2*maxChunkSize, 3))})
+	if err != nil {
+		t.Fatalf("Unexpected error backing up: %s", err.Error())
+	}
+
+	result, err := repository.Check(ctx, true)
+	if err != nil {
+		t.Fatalf("Unexpected error checking repository: %s", err.Error())
+	}
+	if len(result.Errors) != 0 || result.Snapshots != 1 {
+		t.Fatalf("Expected one snapshot without errors, got %+v", result)
+	}
+
+	chunks := snapshot.Archives[0].Chunks
+	corruptPath := filepath.Join(root, filepath.FromSlash(chunkKey(chunks[0])))
+	corrupt, err := os.ReadFile(corruptPath)
+	if err != nil {
+		t.Fatalf("Unexpected error reading chunk: %s", err.Error())
+	}
+	corrupt[len(corrupt)-1] ^= 1
+	if err := os.WriteFile(corruptPath, corrupt, 0600); err != nil {
+		t.Fatalf("Unexpected error writing chunk: %s", err.Error())
+	}
+	if err := target.Delete(ctx, chunkKey(chunks[1])); err != nil {
+		t.Fatalf("Unexpected error deleting chunk: %s", err.Error())
+	}
+
+	// Missing chunks are found without reading data, corrupted chunks need data to be read
+	result, err = repository.Check(ctx, false)
+	if err != nil {
+		t.Fatalf("Unexpected error checking repository: %s", err.Error())
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "missing") {
+		t.Errorf("Expected one missing chunk error, got %v", result.Errors)
+	}
+	result, err = repository.Check(ctx, true)
+	if err != nil {
+		t.Fatalf("Unexpected error checking repository: %s", err.Error())
+	}
+	if len(result.Errors) != 2 {
+		t.Errorf("Expected missing and corrupt chunk errors, got %v", result.Errors)
+	}
+	if err := repository.CheckSnapshot(ctx, snapshot); !errors.Is(err, CorruptError) {
+		t.Errorf("Expected corrupt error checking snapshot, got %v", err)
+	}
+	if _, err := io.ReadAll(repository.OpenArchive(ctx, snapshot.Archives[0])); !errors.Is(err, CorruptError) {
+		t.Errorf("Expected corrupt error reading archive, got %v", err)
+	}
+}
+
+// Tests pruning only removes chunks no longer used by a snapshot
+func TestRepositoryPrune(t *testing.T) {
+	ctx := context.Background()
+	target, repository := openTestRepository(t, t.TempDir(), "correct horse")
+	defer target.Close()
+
+	shared := testData(1024*1024, 4)
+	if _, err := repository.Backup(ctx, "app1", "first", []ArchiveSource{source("data", shared), source("volumes/app1-db", testData(1024*1024, 5))}); err != nil {
+		t.Fatalf("Unexpected error backing up: %s", err.Error())
+	}
+	second, err := repository.Backup(ctx, "app1", "second", []ArchiveSource{source("data", shared)})
+	if err != nil {
+		t.Fatalf("Unexpected error backing up: %s", err.Error())
+	}
+
+	if err := repository.DeleteSnapshot(ctx, "app1", "first"); err != nil {
+		t.Fatalf("Unexpected error deleting snapshot: %s", err.Error())
+	}
+	removed, err := repository.Prune(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error pruning: %s", err.Error())
+	}
+	if removed == 0 {
+		t.Error("Expected chunks only used by the deleted snapshot to be removed")
+	}
+
+	restored, err := io.ReadAll(repository.OpenArchive(ctx, second.Archives[0]))
+	if err != nil {
+		t.Fatalf("Unexpected error reading archive: %s", err.Error())
+	}
+	if !bytes.Equal(restored, shared) {
+		t.Error("Restored archive doesn't match the original after pruning")
+	}
+}
+
+func tarData(t *testing.T, files map[string][]byte) []byte {
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	if err := writer.WriteHeader(&tar.Header{Name: "volume/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatalf("Unexpected error writing tar: %s", err.Error())
+	}
+	for name, contents := range files {
+		if err := writer.WriteHeader(&tar.Header{Name: "volume/" + name, Size: int64(len(contents)), Mode: 0600}); err != nil {
+			t.Fatalf("Unexpected error writing tar: %s", err.Error())
+		}
+		if _, err := writer.Write(contents); err != nil {
+			t.Fatalf("Unexpected error writing tar: %s", err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Unexpected error writing tar: %s", err.Error())
+	}
+	return buffer.Bytes()
+}
+
+// Tests snapshots record a manifest of their archives, and that verifying finds archives that don't match it
+func TestRepositoryVerify(t *testing.T) {
+	ctx := context.Background()
+	target, repository := openTestRepository(t, t.TempDir(), "correct horse")
+	defer target.Close()
+
+	volume := source("volumes/app1-db", tarData(t, map[string][]byte{"data.db": testData(1024*1024, 6), "wal": []byte("wal")}))
+	volume.Tar = true
+	snapshot, err := repository.Backup(ctx, "app1", "first", []ArchiveSource{volume, source("secrets", []byte("{}"))})
+	if err != nil {
+		t.Fatalf("Unexpected error backing up: %s", err.Error())
+	}
+	if snapshot.Archives[0].Files != 2 || !snapshot.Archives[0].Tar || snapshot.Archives[0].SHA256 == "" {
+		t.Errorf("Expected manifest of tar archive with 2 files, got %+v", snapshot.Archives[0])
+	}
+	if snapshot.Archives[1].Tar || snapshot.Archives[1].SHA256 == "" {
+		t.Errorf("Expected manifest of plain archive, got %+v", snapshot.Archives[1])
+	}
+
+	result, err := repository.Verify(ctx, snapshot)
+	if err != nil {
+		t.Fatalf("Unexpected error verifying snapshot: %s", err.Error())
+	}
+	if len(result.Errors) != 0 || result.Archives != 2 || result.Files != 2 || result.Size != snapshot.Size() {
+		t.Errorf("Expected snapshot to verify, got %+v", result)
+	}
+
+	// Archives which don't match their manifest fail verification
+	mismatched := snapshot
+	mismatched.Archives = []Archive{snapshot.Archives[0], snapshot.Archives[1]}
+	mismatched.Archives[0].Files = 3
+	mismatched.Archives[1].SHA256 = strings.Repeat("0", 64)
+	result, err = repository.Verify(ctx, mismatched)
+	if err != nil {
+		t.Fatalf("Unexpected error verifying snapshot: %s", err.Error())
+	}
+	if len(result.Errors) != 2 || result.Archives != 0 {
+		t.Errorf("Expected both archives to fail verification, got %+v", result)
+	}
+	if _, err := io.ReadAll(repository.OpenArchive(ctx, mismatched.Archives[1])); !errors.Is(err, CorruptError) {
+		t.Errorf("Expected corrupt error reading archive not matching its hash, got %v", err)
+	}
+
+	// Archives marked as tar streams which aren't aren't stored
+	invalid := source("volumes/app1-db", []byte("not a tar archive, but long enough to be read as a header"))
+	invalid.Tar = true
+	if _, err := repository.Backup(ctx, "app1", "second", []ArchiveSource{invalid}); err == nil {
+		t.Error("Expected error backing up invalid tar archive")
+	}
+}
@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Target stores backups as objects in an S3 bucket
+type s3Target struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func openS3(config S3Config) (Target, error) {
+	return openS3WithOptions(config, &minio.Options{})
+}
+
+// openS3WithOptions opens the target with options for the client, such as the transport used for requests
+func openS3WithOptions(config S3Config, options *minio.Options) (Target, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	options.Creds = credentials.NewStaticV4(config.AccessKey, config.SecretKey, "")
+	options.Secure = endpoint.Scheme == "https"
+	options.Region = config.Region
+	options.BucketLookup = minio.BucketLookupDNS
+	if config.PathStyle {
+		options.BucketLookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint.Host, options)
+	if err != nil {
+		return nil, fmt.Errorf("error creating s3 client: %w", err)
+	}
+
+	prefix := ""
+	if config.Prefix != "" {
+		prefix = strings.Trim(config.Prefix, "/") + "/"
+	}
+	return &s3Target{client: client, bucket: config.Bucket, prefix: prefix}, nil
+}
+
+// objectKey adds the configured prefix to the key
+func (t *s3Target) objectKey(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(t.prefix, cleaned), nil
+}
+
+func (t *s3Target) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	for object := range t.client.ListObjects(ctx, t.bucket, minio.ListObjectsOptions{
+		Prefix:    t.prefix + prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		keys = append(keys, strings.TrimPrefix(object.Key, t.prefix))
+	}
+	return keys, nil
+}
+
+// Put uploads the object, which is uploaded in parts if it's larger than a single upload allows
+func (t *s3Target) Put(ctx context.Context, key string, data io.Reader, size int64) error {
+	objectKey, err := t.objectKey(key)
+	if err != nil {
+		return err
+	}
+	if _, err := t.client.PutObject(ctx, t.bucket, objectKey, data, size, minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("error uploading %s: %w", key, err)
+	}
+	return nil
+}
+
+func (t *s3Target) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	objectKey, err := t.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+	object, err := t.client.GetObject(ctx, t.bucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Objects aren't requested until they're used, so the object is checked to return missing objects here
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%w: %s", NotFoundError, key)
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (t *s3Target) Delete(ctx context.Context, key string) error {
+	objectKey, err := t.objectKey(key)
+	if err != nil {
+		return err
+	}
+	return t.client.RemoveObject(ctx, t.bucket, objectKey, minio.RemoveObjectOptions{})
+}
+
+func (t *s3Target) Close() error {
+	return nil
+}
@@ -0,0 +1,156 @@
+package backup
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minio/minio-go/v7"
+)
+
+// fakeS3 is a minimal path style S3 server storing objects in memory, returning at most two keys per list page
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]string
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		s.list(w, r.URL.Query())
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[key] = string(data)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>"))
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write([]byte(data))
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	keys := make([]string, 0)
+	for key := range s.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) && key > query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var result struct {
+		XMLName  xml.Name `xml:"ListBucketResult"`
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+	}
+	if len(keys) > 2 {
+		keys = keys[:2]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[1]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, struct {
+			Key string `xml:"Key"`
+		}{Key: key})
+	}
+	data, _ := xml.Marshal(result)
+	w.Write(data)
+}
+
+// Tests objects are stored under the configured prefix, and lists are read across pages
+func TestS3Target(t *testing.T) {
+	ctx := context.Background()
+	server := &fakeS3{bucket: "backups", objects: map[string]string{"other/file": "not a backup"}}
+	httpServer := httptest.NewTLSServer(server)
+	defer httpServer.Close()
+
+	// HTTPS is used so uploads are sent unchanged, rather than with the chunked signatures used over HTTP
+	target, err := openS3WithOptions(S3Config{
+		Endpoint:  httpServer.URL,
+		Bucket:    "backups",
+		Prefix:    "homecloud",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	}, &minio.Options{Transport: httpServer.Client().Transport})
+	if err != nil {
+		t.Fatalf("Unexpected error opening target: %s", err.Error())
+	}
+	defer target.Close()
+
+	keys := []string{"backup/app1/a/data.tar.gz", "backup/app1/a/secrets.json", "backup/app1/b/data.tar.gz"}
+	for _, key := range keys {
+		if err := target.Put(ctx, key, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Fatalf("Unexpected error putting %s: %s", key, err.Error())
+		}
+	}
+	if _, ok := server.objects["homecloud/backup/app1/a/data.tar.gz"]; !ok {
+		t.Error("Expected object to be stored under the prefix")
+	}
+
+	listed, err := target.List(ctx, "backup/")
+	if err != nil {
+		t.Fatalf("Unexpected error listing objects: %s", err.Error())
+	}
+	if diff := cmp.Diff(keys, listed); diff != "" {
+		t.Errorf("Listed keys mismatch (-want +got):\n%s", diff)
+	}
+
+	reader, err := target.Get(ctx, "backup/app1/b/data.tar.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error getting object: %s", err.Error())
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error reading object: %s", err.Error())
+	}
+	if string(data) != "backup/app1/b/data.tar.gz" {
+		t.Errorf("Expected object data backup/app1/b/data.tar.gz, got %s", data)
+	}
+
+	if err := target.Delete(ctx, "backup/app1/b/data.tar.gz"); err != nil {
+		t.Fatalf("Unexpected error deleting object: %s", err.Error())
+	}
+	if _, err := target.Get(ctx, "backup/app1/b/data.tar.gz"); !errors.Is(err, NotFoundError) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
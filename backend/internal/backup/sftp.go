@@ -0,0 +1,256 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpPosixRename is the OpenSSH extension for renames replacing an existing file, which plain renames in version 3 of
+// the protocol fail to do
+const sftpPosixRename = "posix-rename@openssh.com"
+
+// sftpReplacedSuffix is added to an existing file while it's replaced by a server without the rename extension, so
+// it can be restored if the replacement fails
+const sftpReplacedSuffix = ".replaced" + partialSuffix
+
+const sftpTimeout = 30 * time.Second
+
+// sftpTarget stores backups in a directory on an SFTP server
+type sftpTarget struct {
+	conn   *ssh.Client
+	client *sftp.Client
+	root   string
+}
+
+func openSFTP(ctx context.Context, config SFTPConfig) (Target, error) {
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(config.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if config.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(config.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if config.Password != "" {
+		auth = append(auth, ssh.Password(config.Password))
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = 22
+	}
+	address := net.JoinHostPort(config.Host, strconv.Itoa(port))
+
+	dialer := net.Dialer{Timeout: sftpTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", address, err)
+	}
+	sshConn, channels, requests, err := ssh.NewClientConn(netConn, address, &ssh.ClientConfig{
+		User:            config.Username,
+		Auth:            auth,
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         sftpTimeout,
+	})
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("error logging in to %s: %w", address, err)
+	}
+
+	// Concurrent writes are used so uploads aren't limited by the latency to the server. Writes are always to a
+	// partial file, so the out of order writes can't leave an incomplete object
+	conn := ssh.NewClient(sshConn, channels, requests)
+	client, err := sftp.NewClient(conn, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error starting SFTP session: %w", err)
+	}
+	return &sftpTarget{conn: conn, client: client, root: config.Path}, nil
+}
+
+func (t *sftpTarget) path(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(t.root, cleaned), nil
+}
+
+func (t *sftpTarget) List(ctx context.Context, prefix string) ([]string, error) {
+	dir := ""
+	if index := strings.LastIndex(prefix, "/"); index >= 0 {
+		dir = prefix[:index]
+	}
+
+	keys := make([]string, 0)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, err := t.client.ReadDir(path.Join(t.root, dir))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Entries are sorted so keys are listed in the same order as other targets
+		slices.SortFunc(entries, func(a, b fs.FileInfo) int { return strings.Compare(a.Name(), b.Name()) })
+		for _, entry := range entries {
+			key := path.Join(dir, entry.Name())
+			if entry.IsDir() {
+				if err := walk(key); err != nil {
+					return err
+				}
+			} else if entry.Mode().IsRegular() {
+				if strings.HasPrefix(key, prefix) && !strings.HasSuffix(key, partialSuffix) {
+					keys = append(keys, key)
+				}
+			}
+		}
+		return nil
+	}
+	if dir != "" {
+		if _, err := cleanKey(dir); err != nil {
+			return nil, err
+		}
+	}
+	return keys, walk(dir)
+}
+
+// Put writes the data to a partial file, replacing the object with it once complete
+func (t *sftpTarget) Put(ctx context.Context, key string, data io.Reader, size int64) error {
+	filePath, err := t.path(key)
+	if err != nil {
+		return err
+	}
+	if err := t.client.MkdirAll(path.Dir(filePath)); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", key, err)
+	}
+
+	partialPath := filePath + partialSuffix
+	file, err := t.client.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", key, err)
+	}
+
+	// The client doesn't take a context, so the file is closed to stop the upload if the context is cancelled
+	stop := context.AfterFunc(ctx, func() { file.Close() })
+	written, err := file.ReadFrom(data)
+	stop()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("expected %d bytes, got %d", size, written)
+	}
+	if err == nil {
+		err = t.replace(partialPath, filePath)
+	}
+	if err != nil {
+		t.client.Remove(partialPath)
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	return nil
+}
+
+// replace renames the file over an existing one. Servers without the rename extension can't replace files, so the
+// existing file is moved aside until the new one is in place, and moved back if the rename fails
+func (t *sftpTarget) replace(from string, to string) error {
+	if _, ok := t.client.HasExtension(sftpPosixRename); ok {
+		return t.client.PosixRename(from, to)
+	}
+
+	if _, err := t.client.Stat(to); errors.Is(err, fs.ErrNotExist) {
+		return t.client.Rename(from, to)
+	} else if err != nil {
+		return err
+	}
+
+	replacedPath := to + sftpReplacedSuffix
+	if err := t.client.Remove(replacedPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := t.client.Rename(to, replacedPath); err != nil {
+		return err
+	}
+	if err := t.client.Rename(from, to); err != nil {
+		if restoreErr := t.client.Rename(replacedPath, to); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("error restoring %s: %w", to, restoreErr))
+		}
+		return err
+	}
+	return t.client.Remove(replacedPath)
+}
+
+func (t *sftpTarget) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	filePath, err := t.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := t.client.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", NotFoundError, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFile{File: file, stop: context.AfterFunc(ctx, func() { file.Close() })}, nil
+}
+
+func (t *sftpTarget) Delete(ctx context.Context, key string) error {
+	filePath, err := t.path(key)
+	if err != nil {
+		return err
+	}
+	if err := t.client.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Removes directories left empty, stopping at the first that still has files
+	cleaned, _ := cleanKey(key)
+	for dir := path.Dir(cleaned); dir != "."; dir = path.Dir(dir) {
+		if err := t.client.RemoveDirectory(path.Join(t.root, dir)); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (t *sftpTarget) Close() error {
+	t.client.Close()
+	return t.conn.Close()
+}
+
+// sftpFile is a remote file which is closed when the context it was opened with is cancelled
+type sftpFile struct {
+	*sftp.File
+	stop func() bool
+}
+
+func (f *sftpFile) Close() error {
+	f.stop()
+	return f.File.Close()
+}
@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// listenSFTP starts an SSH server accepting the password "password" and serving SFTP sessions from the local
+// filesystem, returning its address and host key in authorized keys format
+func listenSFTP(t *testing.T) (string, string) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error generating host key: %s", err.Error())
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("Unexpected error creating signer: %s", err.Error())
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() != "backup" || string(password) != "password" {
+				return nil, errors.New("invalid login")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error listening: %s", err.Error())
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTPConn(conn, config)
+		}
+	}()
+	return listener.Addr().String(), string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+}
+
+func serveSFTPConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for request := range channelRequests {
+				isSFTP := request.Type == "subsystem" && string(request.Payload[4:]) == "sftp"
+				request.Reply(isSFTP, nil)
+				if isSFTP {
+					go func() {
+						defer channel.Close()
+						server, err := sftp.NewServer(channel)
+						if err != nil {
+							return
+						}
+						server.Serve()
+					}()
+				}
+			}
+		}()
+	}
+}
+
+// Tests objects can be stored, replaced, listed, retrieved and deleted on an SFTP server
+func TestSFTPTarget(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	address, hostKey := listenSFTP(t)
+	host, port, _ := net.SplitHostPort(address)
+	portNumber, _ := strconv.Atoi(port)
+
+	target, err := Open(ctx, TargetConfig{
+		Name: "sftp",
+		Type: SFTPTarget,
+		SFTP: &SFTPConfig{
+			Host:     host,
+			Port:     portNumber,
+			Username: "backup",
+			Password: "password",
+			HostKey:  hostKey,
+			Path:     filepath.ToSlash(filepath.Join(root, "backups")),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error opening target: %s", err.Error())
+	}
+	defer target.Close()
+
+	// Objects are larger than a single packet so several writes are sent at once
+	large := strings.Repeat("large object ", 1024*1024/13)
+	objects := map[string]string{
+		"backup/app1/a/data.tar.gz": "app1 data",
+		"backup/app1/b/data.tar.gz": large,
+		"backup/app2/a/data.tar.gz": "app2 data",
+	}
+	for key, data := range objects {
+		if err := target.Put(ctx, key, strings.NewReader(data), int64(len(data))); err != nil {
+			t.Fatalf("Unexpected error putting %s: %s", key, err.Error())
+		}
+	}
+
+	// Existing objects are replaced, such as the repository's index
+	if err := target.Put(ctx, "backup/app1/a/data.tar.gz", strings.NewReader("new app1 data"), 13); err != nil {
+		t.Fatalf("Unexpected error replacing object: %s", err.Error())
+	}
+
+	keys, err := target.List(ctx, "backup/app1/")
+	if err != nil {
+		t.Fatalf("Unexpected error listing objects: %s", err.Error())
+	}
+	if diff := cmp.Diff([]string{"backup/app1/a/data.tar.gz", "backup/app1/b/data.tar.gz"}, keys); diff != "" {
+		t.Errorf("Listed keys mismatch (-want +got):\n%s", diff)
+	}
+
+	for key, expected := range map[string]string{
+		"backup/app1/a/data.tar.gz": "new app1 data",
+		"backup/app1/b/data.tar.gz": large,
+	} {
+		reader, err := target.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Unexpected error getting %s: %s", key, err.Error())
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("Unexpected error reading %s: %s", key, err.Error())
+		}
+		if string(data) != expected {
+			t.Errorf("Expected %s to contain %d bytes, got %d", key, len(expected), len(data))
+		}
+	}
+
+	// A failed write shouldn't affect the existing object
+	if err := target.Put(ctx, "backup/app1/a/data.tar.gz", strings.NewReader("short"), 100); err == nil {
+		t.Error("Expected error putting object with incorrect size")
+	}
+	data, err := os.ReadFile(filepath.Join(root, "backups", "backup", "app1", "a", "data.tar.gz"))
+	if err != nil || string(data) != "new app1 data" {
+		t.Errorf("Expected existing object to be kept after failed put, got %q, %v", data, err)
+	}
+
+	if err := target.Delete(ctx, "backup/app2/a/data.tar.gz"); err != nil {
+		t.Fatalf("Unexpected error deleting object: %s", err.Error())
+	}
+	if _, err := target.Get(ctx, "backup/app2/a/data.tar.gz"); !errors.Is(err, NotFoundError) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "backups", "backup", "app2")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected empty directory to be removed, got %v", err)
+	}
+
+	// No partial files should be left behind
+	filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err == nil && strings.HasSuffix(filePath, partialSuffix) {
+			t.Errorf("Expected no partial files, found %s", filePath)
+		}
+		return err
+	})
+}
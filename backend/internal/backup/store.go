@@ -0,0 +1,270 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+var TargetNotFoundError = errors.New("backup target not found")
+var TargetExistsError = errors.New("backup target already exists")
+var TargetInUseError = errors.New("backup target is used by a backup schedule")
+var NoCipherError = errors.New("no encryption key configured for backup target credentials")
+
+// targetSecrets are the credentials of a target, which are stored encrypted separately from the rest of the config
+type targetSecrets struct {
+	Passphrase string `json:"passphrase,omitempty"`
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	SecretKey  string `json:"secret_key,omitempty"`
+}
+
+func (s targetSecrets) empty() bool {
+	return s == targetSecrets{}
+}
+
+// copyConfig copies the config, including the type specific config, so it can be changed without affecting the
+// original
+func copyConfig(c TargetConfig) TargetConfig {
+	if c.Local != nil {
+		local := *c.Local
+		c.Local = &local
+	}
+	if c.Drive != nil {
+		drive := *c.Drive
+		c.Drive = &drive
+	}
+	if c.SFTP != nil {
+		sftp := *c.SFTP
+		c.SFTP = &sftp
+	}
+	if c.S3 != nil {
+		s3 := *c.S3
+		c.S3 = &s3
+	}
+	return c
+}
+
+// Redacted retrieves a copy of the config without its credentials, for returning from the API
+func (c TargetConfig) Redacted() TargetConfig {
+	redacted, _ := splitSecrets(c)
+	return redacted
+}
+
+// splitSecrets separates the credentials from the rest of the config
+func splitSecrets(c TargetConfig) (TargetConfig, targetSecrets) {
+	c = copyConfig(c)
+	var secrets targetSecrets
+	secrets.Passphrase, c.Passphrase = c.Passphrase, ""
+	if c.SFTP != nil {
+		secrets.Password, c.SFTP.Password = c.SFTP.Password, ""
+		secrets.PrivateKey, c.SFTP.PrivateKey = c.SFTP.PrivateKey, ""
+	}
+	if c.S3 != nil {
+		secrets.SecretKey, c.S3.SecretKey = c.S3.SecretKey, ""
+	}
+	return c, secrets
+}
+
+// withSecrets sets the credentials in the config that aren't already set
+func withSecrets(c TargetConfig, secrets targetSecrets) TargetConfig {
+	c = copyConfig(c)
+	if c.Passphrase == "" {
+		c.Passphrase = secrets.Passphrase
+	}
+	if c.SFTP != nil {
+		if c.SFTP.Password == "" {
+			c.SFTP.Password = secrets.Password
+		}
+		if c.SFTP.PrivateKey == "" {
+			c.SFTP.PrivateKey = secrets.PrivateKey
+		}
+	}
+	if c.S3 != nil && c.S3.SecretKey == "" {
+		c.S3.SecretKey = secrets.SecretKey
+	}
+	return c
+}
+
+// TargetStore saves the configuration of backup targets, encrypting their credentials
+type TargetStore struct {
+	queries *persistence.Queries
+	cipher  *encryption.Cipher
+}
+
+func NewTargetStore(queries *persistence.Queries, cipher *encryption.Cipher) *TargetStore {
+	return &TargetStore{queries: queries, cipher: cipher}
+}
+
+// List retrieves all targets, without their credentials
+func (s *TargetStore) List(ctx context.Context) ([]TargetConfig, error) {
+	rows, err := s.queries.GetBackupTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]TargetConfig, 0, len(rows))
+	for _, row := range rows {
+		var config TargetConfig
+		if err := json.Unmarshal([]byte(row.Config), &config); err != nil {
+			return nil, fmt.Errorf("invalid config for backup target %s: %w", row.Name, err)
+		}
+		config.Name = row.Name
+		config.Type = TargetType(row.Type)
+		targets = append(targets, config)
+	}
+	return targets, nil
+}
+
+// Get retrieves the target, including its credentials
+func (s *TargetStore) Get(ctx context.Context, name string) (TargetConfig, error) {
+	row, err := s.queries.GetBackupTarget(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TargetConfig{}, fmt.Errorf("%w: %s", TargetNotFoundError, name)
+	}
+	if err != nil {
+		return TargetConfig{}, err
+	}
+
+	var config TargetConfig
+	if err := json.Unmarshal([]byte(row.Config), &config); err != nil {
+		return TargetConfig{}, fmt.Errorf("invalid config for backup target %s: %w", name, err)
+	}
+	config.Name = row.Name
+	config.Type = TargetType(row.Type)
+
+	if row.Secrets == "" {
+		return config, nil
+	}
+	if s.cipher == nil {
+		return TargetConfig{}, NoCipherError
+	}
+	decrypted, err := s.cipher.Decrypt(row.Secrets)
+	if err != nil {
+		return TargetConfig{}, err
+	}
+	var secrets targetSecrets
+	if err := json.Unmarshal([]byte(decrypted), &secrets); err != nil {
+		return TargetConfig{}, fmt.Errorf("invalid credentials for backup target %s: %w", name, err)
+	}
+	return withSecrets(config, secrets), nil
+}
+
+// Resolve retrieves the named target, or a removable drive target for the device if no name is given, which is how
+// backups were made before targets could be configured
+func (s *TargetStore) Resolve(ctx context.Context, name string, device string) (TargetConfig, error) {
+	if name != "" {
+		return s.Get(ctx, name)
+	}
+	if device != "" {
+		config := DriveTargetConfig(device)
+		return config, config.Validate()
+	}
+	return TargetConfig{}, fmt.Errorf("%w: a target or device must be given", InvalidTargetError)
+}
+
+// encode converts the config to the values stored, encrypting the credentials
+func (s *TargetStore) encode(config TargetConfig) (string, string, error) {
+	public, secrets := splitSecrets(config)
+	public.Name, public.Type = "", ""
+	configJson, err := json.Marshal(public)
+	if err != nil {
+		return "", "", err
+	}
+
+	if secrets.empty() {
+		return string(configJson), "", nil
+	}
+	if s.cipher == nil {
+		return "", "", NoCipherError
+	}
+	secretsJson, err := json.Marshal(secrets)
+	if err != nil {
+		return "", "", err
+	}
+	encrypted, err := s.cipher.Encrypt(string(secretsJson))
+	if err != nil {
+		return "", "", err
+	}
+	return string(configJson), encrypted, nil
+}
+
+// Create saves a new target, returning TargetExistsError if the name is already used
+func (s *TargetStore) Create(ctx context.Context, config TargetConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if _, err := s.queries.GetBackupTarget(ctx, config.Name); err == nil {
+		return fmt.Errorf("%w: %s", TargetExistsError, config.Name)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	configJson, secrets, err := s.encode(config)
+	if err != nil {
+		return err
+	}
+	return s.queries.CreateBackupTarget(ctx, persistence.CreateBackupTargetParams{
+		Name:      config.Name,
+		Type:      string(config.Type),
+		Config:    configJson,
+		Secrets:   secrets,
+		CreatedAt: time.Now().Unix(),
+	})
+}
+
+// Update replaces the target's config. Credentials left empty keep their current values, so they don't need to be
+// entered again to change other settings
+func (s *TargetStore) Update(ctx context.Context, config TargetConfig) error {
+	existing, err := s.Get(ctx, config.Name)
+	if err != nil {
+		return err
+	}
+	if existing.Type == config.Type {
+		_, secrets := splitSecrets(existing)
+		config = withSecrets(config, secrets)
+	} else if config.Passphrase == "" {
+		config.Passphrase = existing.Passphrase
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	configJson, secrets, err := s.encode(config)
+	if err != nil {
+		return err
+	}
+	_, err = s.queries.UpdateBackupTarget(ctx, persistence.UpdateBackupTargetParams{
+		Type:    string(config.Type),
+		Config:  configJson,
+		Secrets: secrets,
+		Name:    config.Name,
+	})
+	return err
+}
+
+// Delete removes the target, returning TargetInUseError if a schedule still backs up to it
+func (s *TargetStore) Delete(ctx context.Context, name string) error {
+	schedules, err := s.queries.CountBackupTargetSchedules(ctx, name)
+	if err != nil {
+		return err
+	}
+	if schedules > 0 {
+		return fmt.Errorf("%w: %s", TargetInUseError, name)
+	}
+
+	deleted, err := s.queries.DeleteBackupTarget(ctx, name)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w: %s", TargetNotFoundError, name)
+	}
+	return nil
+}
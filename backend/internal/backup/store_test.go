@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// Tests credentials are stored encrypted, never listed, and kept when updating without them
+func TestTargetStore(t *testing.T) {
+	ctx := context.Background()
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	cipher, err := encryption.NewCipher(make([]byte, encryption.KeySize))
+	if err != nil {
+		t.Fatalf("Unexpected error creating cipher: %s", err.Error())
+	}
+	store := NewTargetStore(queries, cipher)
+
+	config := TargetConfig{
+		Name:       "offsite",
+		Type:       S3Target,
+		Passphrase: "correct horse",
+		S3: &S3Config{
+			Endpoint:  "https://s3.example.com",
+			Bucket:    "backups",
+			AccessKey: "access",
+			SecretKey: "top-secret",
+		},
+	}
+	if err := store.Create(ctx, config); err != nil {
+		t.Fatalf("Unexpected error creating target: %s", err.Error())
+	}
+	if err := store.Create(ctx, config); !errors.Is(err, TargetExistsError) {
+		t.Errorf("Expected target exists error, got %v", err)
+	}
+
+	row, err := queries.GetBackupTarget(ctx, "offsite")
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving target: %s", err.Error())
+	}
+	for _, secret := range []string{"top-secret", "correct horse"} {
+		if strings.Contains(row.Config, secret) || strings.Contains(row.Secrets, secret) {
+			t.Errorf("Expected %s to be stored encrypted", secret)
+		}
+	}
+
+	listed, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error listing targets: %s", err.Error())
+	}
+	if len(listed) != 1 || listed[0].S3.SecretKey != "" || listed[0].Passphrase != "" {
+		t.Errorf("Expected one target without its secret key, got %+v", listed)
+	}
+
+	// Updating without the secrets keeps the existing ones
+	config.Passphrase = ""
+	config.S3 = &S3Config{Endpoint: "https://s3.example.com", Bucket: "other", AccessKey: "access"}
+	if err := store.Update(ctx, config); err != nil {
+		t.Fatalf("Unexpected error updating target: %s", err.Error())
+	}
+	updated, err := store.Get(ctx, "offsite")
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving target: %s", err.Error())
+	}
+	if updated.S3.Bucket != "other" || updated.S3.SecretKey != "top-secret" || updated.Passphrase != "correct horse" {
+		t.Errorf("Expected updated bucket with existing secrets, got %+v", updated)
+	}
+
+	if err := store.Delete(ctx, "offsite"); err != nil {
+		t.Fatalf("Unexpected error deleting target: %s", err.Error())
+	}
+	if _, err := store.Get(ctx, "offsite"); !errors.Is(err, TargetNotFoundError) {
+		t.Errorf("Expected target not found error, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var NotFoundError = errors.New("backup not found")
+var InvalidKeyError = errors.New("invalid backup key")
+var InvalidTargetError = errors.New("invalid backup target")
+
+// Target is a place backups are stored. Backups are stored as objects identified by slash separated keys, such as
+// backup/<app>/<snapshot>/data.tar.gz, so the same layout is used whether the target is a directory or object storage
+type Target interface {
+	// List retrieves the keys of all objects starting with the prefix, including those in nested directories
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Put stores the data as the given key, replacing any existing object. The size must be the length of the data
+	Put(ctx context.Context, key string, data io.Reader, size int64) error
+	// Get opens the object with the given key, returning NotFoundError if it doesn't exist
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object with the given key. Deleting an object that doesn't exist isn't an error
+	Delete(ctx context.Context, key string) error
+	// Close releases the target, such as unmounting a drive or closing a connection
+	Close() error
+}
+
+type TargetType string
+
+const (
+	LocalTarget TargetType = "local"
+	DriveTarget TargetType = "drive"
+	SFTPTarget  TargetType = "sftp"
+	S3Target    TargetType = "s3"
+)
+
+// LocalConfig stores backups in a directory on the server
+type LocalConfig struct {
+	Path string `json:"path"`
+}
+
+// DriveConfig stores backups on a removable drive, which is mounted while it's used
+type DriveConfig struct {
+	Device string `json:"device"`
+}
+
+// SFTPConfig stores backups in a directory on an SFTP server. The host key is required so the server can be verified,
+// and either a password or private key is used to log in
+type SFTPConfig struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Username   string `json:"username"`
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	HostKey    string `json:"host_key"`
+	Path       string `json:"path"`
+}
+
+// S3Config stores backups in a bucket on S3 compatible object storage, such as MinIO. Path style requests are needed
+// by most self hosted services
+type S3Config struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key,omitempty"`
+	PathStyle bool   `json:"path_style"`
+}
+
+// TargetConfig is the configuration of a named target. Only the configuration for the target's type is set. The
+// passphrase encrypts the backups stored on the target, and is needed to restore them if the server is lost
+type TargetConfig struct {
+	Name       string       `json:"name"`
+	Type       TargetType   `json:"type"`
+	Passphrase string       `json:"passphrase,omitempty"`
+	Local      *LocalConfig `json:"local,omitempty"`
+	Drive      *DriveConfig `json:"drive,omitempty"`
+	SFTP       *SFTPConfig  `json:"sftp,omitempty"`
+	S3         *S3Config    `json:"s3,omitempty"`
+}
+
+// DriveTargetConfig creates the configuration for a removable drive that hasn't been saved as a target, named after
+// the device
+func DriveTargetConfig(device string) TargetConfig {
+	return TargetConfig{Name: device, Type: DriveTarget, Drive: &DriveConfig{Device: device}}
+}
+
+// Validate checks the configuration is complete for the target's type, without connecting to the target
+func (c TargetConfig) Validate() error {
+	if c.Name == "" || strings.ContainsAny(c.Name, "/\\") {
+		return fmt.Errorf("%w: name must be set and can't contain slashes", InvalidTargetError)
+	}
+
+	switch c.Type {
+	case LocalTarget:
+		if c.Local == nil || !filepath.IsAbs(c.Local.Path) {
+			return fmt.Errorf("%w: local targets require an absolute path", InvalidTargetError)
+		}
+	case DriveTarget:
+		if c.Drive == nil || c.Drive.Device == "" || strings.Contains(c.Drive.Device, "/") {
+			return fmt.Errorf("%w: drive targets require a device name", InvalidTargetError)
+		}
+	case SFTPTarget:
+		if c.SFTP == nil || c.SFTP.Host == "" || c.SFTP.Username == "" || c.SFTP.Path == "" {
+			return fmt.Errorf("%w: SFTP targets require a host, username and path", InvalidTargetError)
+		}
+		if c.SFTP.Port < 0 || c.SFTP.Port > 65535 {
+			return fmt.Errorf("%w: invalid port %d", InvalidTargetError, c.SFTP.Port)
+		}
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(c.SFTP.HostKey)); err != nil {
+			return fmt.Errorf("%w: invalid host key: %w", InvalidTargetError, err)
+		}
+		if c.SFTP.Password == "" && c.SFTP.PrivateKey == "" {
+			return fmt.Errorf("%w: SFTP targets require a password or private key", InvalidTargetError)
+		}
+		if c.SFTP.PrivateKey != "" {
+			if _, err := ssh.ParsePrivateKey([]byte(c.SFTP.PrivateKey)); err != nil {
+				return fmt.Errorf("%w: invalid private key: %w", InvalidTargetError, err)
+			}
+		}
+	case S3Target:
+		if c.S3 == nil || c.S3.Bucket == "" || c.S3.AccessKey == "" || c.S3.SecretKey == "" {
+			return fmt.Errorf("%w: S3 targets require a bucket and credentials", InvalidTargetError)
+		}
+		endpoint, err := url.Parse(c.S3.Endpoint)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return fmt.Errorf("%w: S3 endpoint must be an http or https URL", InvalidTargetError)
+		}
+		if strings.Trim(endpoint.Path, "/") != "" {
+			return fmt.Errorf("%w: S3 endpoint can't include a path", InvalidTargetError)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %s", InvalidTargetError, c.Type)
+	}
+	return nil
+}
+
+// Open connects to the target, mounting drives and logging in to remote targets. The target must be closed after use
+func Open(ctx context.Context, config TargetConfig) (Target, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch config.Type {
+	case LocalTarget:
+		return openLocal(*config.Local)
+	case DriveTarget:
+		return openDrive(*config.Drive)
+	case SFTPTarget:
+		return openSFTP(ctx, *config.SFTP)
+	case S3Target:
+		return openS3(*config.S3)
+	}
+	return nil, fmt.Errorf("%w: unknown type %s", InvalidTargetError, config.Type)
+}
+
+// cleanKey checks the key is a relative slash separated path that can't escape the target's root
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean(key)
+	if key == "" || path.IsAbs(key) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") ||
+		strings.Contains(key, "\\") {
+		return "", fmt.Errorf("%w: %s", InvalidKeyError, key)
+	}
+	return cleaned, nil
+}
@@ -1,12 +1,15 @@
 package config
 
 type Config struct {
-	Host     Host
-	Ory      Ory
-	Store    Store
-	Storage  Storage
-	Launcher LauncherEnv
-	Docker   Docker
+	Host          Host
+	Ory           Ory
+	Store         Store
+	Storage       Storage
+	Launcher      LauncherEnv
+	Docker        Docker
+	Metrics       Metrics
+	Recovery      Recovery
+	Notifications Notifications
 }
 
 func LoadConfig() (*Config, error) {
@@ -34,13 +37,31 @@ func LoadConfig() (*Config, error) {
 
 	docker := NewDocker()
 
+	metrics, err := NewMetrics()
+	if err != nil {
+		return nil, err
+	}
+
+	recovery, err := NewRecovery()
+	if err != nil {
+		return nil, err
+	}
+
+	notifications, err := NewNotifications()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		Host:     *host,
-		Ory:      *ory,
-		Store:    *store,
-		Storage:  *storage,
-		Launcher: *launcher,
-		Docker:   *docker,
+		Host:          *host,
+		Ory:           *ory,
+		Store:         *store,
+		Storage:       *storage,
+		Launcher:      *launcher,
+		Docker:        *docker,
+		Metrics:       *metrics,
+		Recovery:      *recovery,
+		Notifications: *notifications,
 	}, nil
 }
 
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// Metrics configures the Prometheus metrics endpoint. When HealthServer is set metrics are served on the health check
+// server instead of the main host, and when Token is set scrapers must send it as a bearer token
+type Metrics struct {
+	Enabled      bool
+	HealthServer bool
+	Token        string
+}
+
+func NewMetrics() (*Metrics, error) {
+	enabled, err := strconv.ParseBool(Getenv("METRICS_ENABLED", "false"))
+	if err != nil {
+		return nil, err
+	}
+
+	healthServer, err := strconv.ParseBool(Getenv("METRICS_HEALTH_SERVER", "false"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Metrics{
+		Enabled:      enabled,
+		HealthServer: healthServer,
+		Token:        os.Getenv("METRICS_TOKEN"),
+	}, nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SMTP configures the server emails are sent through. Email notifications are disabled when Host isn't set
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Address retrieves the host and port of the SMTP server
+func (s SMTP) Address() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// Notifications configures when notifications are sent and how long they're kept in users' inboxes.
+// DiskThreshold is the percentage of the disk used before warning it's nearly full, and CertificateWarning is how long
+// before a certificate expires to warn about it
+type Notifications struct {
+	SMTP               SMTP
+	DiskThreshold      float64
+	CertificateWarning time.Duration
+	Retention          time.Duration
+}
+
+func NewNotifications() (*Notifications, error) {
+	port, err := strconv.Atoi(Getenv("SMTP_PORT", "587"))
+	if err != nil {
+		return nil, err
+	}
+
+	diskThreshold, err := strconv.ParseFloat(Getenv("NOTIFY_DISK_THRESHOLD", "90"), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	certificateWarning, err := time.ParseDuration(Getenv("NOTIFY_CERTIFICATE_WARNING", "336h"))
+	if err != nil {
+		return nil, err
+	}
+
+	retention, err := time.ParseDuration(Getenv("NOTIFY_RETENTION", "2160h"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Notifications{
+		SMTP: SMTP{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		},
+		DiskThreshold:      diskThreshold,
+		CertificateWarning: certificateWarning,
+		Retention:          retention,
+	}, nil
+}
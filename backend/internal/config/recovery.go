@@ -0,0 +1,44 @@
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+// Recovery configures how crashed app containers are restarted. Each restart waits twice as long as the previous,
+// starting at Backoff up to MaxBackoff, and gives up after MaxRestarts until the app has run for ResetAfter
+type Recovery struct {
+	MaxRestarts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	ResetAfter  time.Duration
+}
+
+func NewRecovery() (*Recovery, error) {
+	maxRestarts, err := strconv.Atoi(Getenv("RESTART_MAX_ATTEMPTS", "5"))
+	if err != nil {
+		return nil, err
+	}
+
+	backoff, err := time.ParseDuration(Getenv("RESTART_BACKOFF", "10s"))
+	if err != nil {
+		return nil, err
+	}
+
+	maxBackoff, err := time.ParseDuration(Getenv("RESTART_MAX_BACKOFF", "5m"))
+	if err != nil {
+		return nil, err
+	}
+
+	resetAfter, err := time.ParseDuration(Getenv("RESTART_RESET_AFTER", "10m"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recovery{
+		MaxRestarts: maxRestarts,
+		Backoff:     backoff,
+		MaxBackoff:  maxBackoff,
+		ResetAfter:  resetAfter,
+	}, nil
+}
@@ -5,6 +5,14 @@ import (
 	"path/filepath"
 )
 
+// The database and the key encrypting the secrets stored in it are kept in their own volume rather than the data path.
+// RestoreMarkerPath is written alongside them when a system backup is restored, until the server finishes restoring
+const (
+	DatabasePath      = "db/data.db"
+	EncryptionKeyPath = "db/secret.key"
+	RestoreMarkerPath = "db/restored"
+)
+
 type Storage struct {
 	DataPath string
 	AppDir   string
@@ -16,6 +24,26 @@ func (s Storage) GetAppDataMountPath(appId string) string {
 	return filepath.Join(s.AppDir, s.DataPath, appId, "data")
 }
 
+// GetMountPath converts a path written to by homecloud to the equivalent path on the host, for mounting in docker
+// containers. Absolute paths, such as mounted external drives, are the same on the host so are left unchanged
+func (s Storage) GetMountPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(s.AppDir, path)
+}
+
+// GetAppSnapshotPath retrieves the path the local snapshot of an app's data is stored at while it's being updated
+func (s Storage) GetAppSnapshotPath(appId string) string {
+	return filepath.Join(s.DataPath, appId, "snapshot")
+}
+
+// GetBackupStagingPath retrieves the path an app's backup is written to before it's uploaded to a backup target, and
+// that backups are downloaded to before being restored
+func (s Storage) GetBackupStagingPath(appId string) string {
+	return filepath.Join(s.DataPath, appId, "backup")
+}
+
 // NewStorage create the configuration for the storage, if the user is in the host environment the path is found from
 // the working directory, otherwise it is from the environment variable
 func NewStorage(inHost bool) (*Storage, error) {
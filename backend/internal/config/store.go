@@ -4,10 +4,13 @@ import "os"
 
 type Store struct {
 	StoreUrl string
+	// PublicKey is the base64 encoded ed25519 key used to verify files from the store, if empty files aren't verified
+	PublicKey string
 }
 
 func NewStore() *Store {
 	return &Store{
-		StoreUrl: os.Getenv("STORE_URL"),
+		StoreUrl:  os.Getenv("STORE_URL"),
+		PublicKey: os.Getenv("STORE_PUBLIC_KEY"),
 	}
 }
@@ -0,0 +1,51 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Tests the next run time is found for common expressions
+func TestNext(t *testing.T) {
+	after := time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 31, 10, 31, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, time.February, 1, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 45, 0, 0, time.UTC)},
+		{"0 2 * * 0", time.Date(2024, time.February, 4, 2, 0, 0, 0, time.UTC)},
+		{"0 2 * * 7", time.Date(2024, time.February, 4, 2, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 4 1,15 * *", time.Date(2024, time.February, 1, 4, 0, 0, 0, time.UTC)},
+		{"30 9-17/4 * * 1-5", time.Date(2024, time.January, 31, 13, 30, 0, 0, time.UTC)},
+		// Both the day of month and day of week are restricted, so either matching runs the schedule
+		{"0 0 13 * 5", time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			schedule, err := Parse(test.expression)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing expression: %s", err.Error())
+			}
+			if next := schedule.Next(after); !next.Equal(test.expected) {
+				t.Errorf("Expected next run at %s, got %s", test.expected, next)
+			}
+		})
+	}
+}
+
+// Tests invalid expressions are rejected
+func TestParseInvalid(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := Parse(expression); !errors.Is(err, InvalidExpressionError) {
+			t.Errorf("Expected %q to be invalid", expression)
+		}
+	}
+}
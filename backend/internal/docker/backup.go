@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,7 +12,9 @@ import (
 	"strings"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
@@ -60,7 +63,9 @@ func BackupVolume(
 	}
 
 	// Waits until the containers are removed to ensure the backups are complete
-	err = UntilRemoved(ctx, dockerClient, result.ID)
+	if err := UntilRemoved(ctx, dockerClient, result.ID); err != nil {
+		return fmt.Errorf("failed backing up volume %s: %w", volumeName, err)
+	}
 
 	return nil
 }
@@ -75,16 +80,131 @@ func BackupFolder(storageConfig config.Storage, appId string, outputDir string)
 	defer output.Close()
 	gw := gzip.NewWriter(output)
 	defer gw.Close()
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
 
-	dirfs := os.DirFS(filepath.Join(storageConfig.DataPath, appId, "data"))
-	if err := tw.AddFS(dirfs); err != nil {
+	if err := WriteFolderArchive(storageConfig, appId, gw); err != nil {
 		return "", fmt.Errorf("failed adding folder %s to tarball: %w", outputPath, err)
 	}
 	return outputPath, nil
 }
 
+// WriteFolderArchive writes the data directory of the specified app as an uncompressed tar archive
+func WriteFolderArchive(storageConfig config.Storage, appId string, output io.Writer) error {
+	tw := tar.NewWriter(output)
+	dirfs := os.DirFS(filepath.Join(storageConfig.DataPath, appId, "data"))
+	if err := tw.AddFS(dirfs); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ExportVolume streams the contents of the volume as an uncompressed tar archive, with entries under volume/. The
+// volume is accessed through a container which is never started, and is removed when the archive is closed
+func ExportVolume(ctx context.Context, dockerClient *client.Client, volumeName string) (io.ReadCloser, error) {
+	containerConfig := container.Config{Image: "busybox"}
+	hostConfig := container.HostConfig{
+		Mounts: []mount.Mount{
+			{
+				Type:     mount.TypeVolume,
+				Source:   volumeName,
+				Target:   "/volume",
+				ReadOnly: true,
+			},
+		},
+	}
+
+	result, err := dockerClient.ContainerCreate(ctx, &containerConfig, &hostConfig, nil, nil, fmt.Sprintf("%s-export", volumeName))
+	if err != nil {
+		return nil, fmt.Errorf("failed creating volume export container for %s: %w", volumeName, err)
+	}
+	remove := func() error {
+		return dockerClient.ContainerRemove(context.Background(), result.ID, container.RemoveOptions{Force: true})
+	}
+
+	archive, _, err := dockerClient.CopyFromContainer(ctx, result.ID, "/volume")
+	if err != nil {
+		remove()
+		return nil, fmt.Errorf("failed exporting volume %s: %w", volumeName, err)
+	}
+	return &volumeArchive{ReadCloser: archive, remove: remove}, nil
+}
+
+// volumeArchive removes the container used to export a volume when the archive is closed
+type volumeArchive struct {
+	io.ReadCloser
+	remove func() error
+}
+
+func (a *volumeArchive) Close() error {
+	closeErr := a.ReadCloser.Close()
+	if err := a.remove(); err != nil {
+		return fmt.Errorf("failed removing volume export container: %w", err)
+	}
+	return closeErr
+}
+
+// PauseApp pauses the app's running containers so they can't write to their volumes while the volumes are exported,
+// returning a function that unpauses them
+func PauseApp(ctx context.Context, dockerClient *client.Client, appId string) (func() error, error) {
+	containers, err := dockerClient.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(AppFilter(appId), filters.Arg("status", "running")),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paused := make([]string, 0, len(containers))
+	unpause := func() error {
+		var errs []error
+		for _, id := range paused {
+			if err := dockerClient.ContainerUnpause(context.Background(), id); err != nil {
+				errs = append(errs, fmt.Errorf("failed unpausing container %s: %w", id, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	for _, appContainer := range containers {
+		if err := dockerClient.ContainerPause(ctx, appContainer.ID); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed pausing container %s: %w", appContainer.ID, err), unpause())
+		}
+		paused = append(paused, appContainer.ID)
+	}
+	return unpause, nil
+}
+
+// ImportVolume creates the app's volume and extracts an archive created by ExportVolume into it
+func ImportVolume(ctx context.Context, dockerClient *client.Client, appId string, volumeName string, archive io.Reader) error {
+	// Creates the volume first so it's labelled with the app, otherwise docker creates it when mounted
+	_, err := dockerClient.VolumeCreate(ctx, volume.CreateOptions{
+		Name:   volumeName,
+		Labels: map[string]string{APP_ID_LABEL: appId},
+	})
+	if err != nil {
+		return fmt.Errorf("failed creating volume %s: %w", volumeName, err)
+	}
+
+	containerConfig := container.Config{Image: "busybox"}
+	hostConfig := container.HostConfig{
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeVolume,
+				Source: volumeName,
+				Target: "/volume",
+			},
+		},
+	}
+	result, err := dockerClient.ContainerCreate(ctx, &containerConfig, &hostConfig, nil, nil, fmt.Sprintf("%s-import", volumeName))
+	if err != nil {
+		return fmt.Errorf("failed creating volume import container for %s: %w", volumeName, err)
+	}
+	defer dockerClient.ContainerRemove(context.Background(), result.ID, container.RemoveOptions{Force: true})
+
+	// Entries are under volume/, so are extracted into the mounted volume
+	if err := dockerClient.CopyToContainer(ctx, result.ID, "/", archive, container.CopyToContainerOptions{}); err != nil {
+		return fmt.Errorf("failed importing volume %s: %w", volumeName, err)
+	}
+	return nil
+}
+
 // BackupAppData backs up all volumes and the data directory for the given app
 func BackupAppData(
 	ctx context.Context,
@@ -105,7 +225,7 @@ func BackupAppData(
 	for _, appContainer := range appContainers {
 		for _, appMount := range appContainer.Mounts {
 			if appMount.Type == mount.TypeVolume {
-				if err := BackupVolume(ctx, dockerClient, appMount.Name, outputDir); err != nil {
+				if err := BackupVolume(ctx, dockerClient, appMount.Name, storageConfig.GetMountPath(outputDir)); err != nil {
 					return fmt.Errorf("failed backing up volume %s for %s: %w", appMount.Name, appId, err)
 				}
 			}
@@ -166,12 +286,6 @@ func RestoreVolume(
 
 // RestoreFolder restores data from the specified backup to an app's data folder
 func RestoreFolder(storageConfig config.Storage, appId string, backupPath string) error {
-	// Ensures path to restore to exists
-	restorePath := filepath.Join(storageConfig.DataPath, appId, "data")
-	if err := os.MkdirAll(restorePath, 0755); err != nil {
-		return fmt.Errorf("error creating app folder to restore backup: %w", err)
-	}
-
 	// Opens backup archive
 	fileReader, err := os.Open(backupPath)
 	if err != nil {
@@ -183,7 +297,18 @@ func RestoreFolder(storageConfig config.Storage, appId string, backupPath string
 		return fmt.Errorf("error creating gzip reader: %w", err)
 	}
 	defer gzipReader.Close()
-	tarReader := tar.NewReader(gzipReader)
+
+	return ExtractFolderArchive(storageConfig, appId, gzipReader)
+}
+
+// ExtractFolderArchive extracts an uncompressed tar archive to an app's data folder
+func ExtractFolderArchive(storageConfig config.Storage, appId string, archive io.Reader) error {
+	// Ensures path to restore to exists
+	restorePath := filepath.Join(storageConfig.DataPath, appId, "data")
+	if err := os.MkdirAll(restorePath, 0755); err != nil {
+		return fmt.Errorf("error creating app folder to restore backup: %w", err)
+	}
+	tarReader := tar.NewReader(archive)
 
 	// Restore archive
 	for {
@@ -195,6 +320,9 @@ func RestoreFolder(storageConfig config.Storage, appId string, backupPath string
 		if err != nil {
 			return fmt.Errorf("error reading tar entry: %w", err)
 		}
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("invalid path in backup: %s", header.Name)
+		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
@@ -241,7 +369,17 @@ func RestoreAppData(
 
 	for _, file := range files {
 		if strings.HasPrefix(file.Name(), appId) {
-			err = RestoreVolume(ctx, dockerClient, strings.TrimSuffix(file.Name(), ".tar.gz"), filepath.Join(backupPath, file.Name()))
+			// Creates the volume first so it's labelled with the app, otherwise docker creates it when mounted
+			volumeName := strings.TrimSuffix(file.Name(), ".tar.gz")
+			_, err = dockerClient.VolumeCreate(ctx, volume.CreateOptions{
+				Name:   volumeName,
+				Labels: map[string]string{APP_ID_LABEL: appId},
+			})
+			if err != nil {
+				return fmt.Errorf("failed creating volume %s: %w", volumeName, err)
+			}
+
+			err = RestoreVolume(ctx, dockerClient, volumeName, storageConfig.GetMountPath(filepath.Join(backupPath, file.Name())))
 			if err != nil {
 				return fmt.Errorf("failed restoring app data: %w", err)
 			}
@@ -0,0 +1,215 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// BackupHooksLabel stores the backup hooks of a container, so its app can be prepared for a backup without its package
+const BackupHooksLabel = "AppBackup"
+
+const defaultBackupHookTimeout = 10 * time.Minute
+
+// hookOutputSize is how much of a failed command's output is kept for its error
+const hookOutputSize = 4096
+
+// formatBackupHooks encodes a container's backup hooks for storing in a label
+func formatBackupHooks(hooks persistence.PackageBackup) (string, error) {
+	hooksJson, err := json.Marshal(hooks)
+	if err != nil {
+		return "", err
+	}
+	return string(hooksJson), nil
+}
+
+// parseBackupHooks decodes the backup hooks stored in a container's label, returning nil if the container has none
+func parseBackupHooks(label string) (*persistence.PackageBackup, error) {
+	if label == "" {
+		return nil, nil
+	}
+
+	var hooks persistence.PackageBackup
+	if err := json.Unmarshal([]byte(label), &hooks); err != nil {
+		return nil, err
+	}
+	return &hooks, nil
+}
+
+// backupStep is a container with backup hooks and the hooks it's prepared for a backup with
+type backupStep struct {
+	container types.Container
+	hooks     persistence.PackageBackup
+}
+
+// backupSteps finds the running containers with backup hooks, in the reverse of the order they're started so each
+// container is prepared before the containers it depends on. Stopped containers aren't writing to their data, so
+// don't need preparing
+func backupSteps(containers []types.Container) ([]backupStep, error) {
+	ordered, err := orderContainers(containers)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []backupStep
+	for _, containerResult := range slices.Backward(ordered) {
+		if containerResult.State != string(ContainerRunning) {
+			continue
+		}
+		hooks, err := parseBackupHooks(containerResult.Labels[BackupHooksLabel])
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid backup hooks for %s", InvalidContainerError, containerName(containerResult))
+		}
+		if hooks != nil {
+			steps = append(steps, backupStep{container: containerResult, hooks: *hooks})
+		}
+	}
+	return steps, nil
+}
+
+// PrepareBackup runs the pre backup hooks of the app's containers and stops the containers marked to be stopped during
+// backup, so the app's data is consistent while it's read. Containers are prepared in the reverse of the order they're
+// started, so an app stops writing to its database before the database is dumped. The returned function runs the post
+// backup hooks and starts the stopped containers in the order they're started, and must be called once the data has
+// been read, even if reading it failed
+func PrepareBackup(ctx context.Context, dockerClient *client.Client, appId string) (func() error, error) {
+	containers, err := GetAppContainers(dockerClient, appId)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := backupSteps(containers)
+	if err != nil {
+		return nil, err
+	}
+
+	var prepared []backupStep
+	finish := func() error {
+		var errs []error
+		for _, step := range slices.Backward(prepared) {
+			name := containerName(step.container)
+			if step.hooks.Stop {
+				if err := dockerClient.ContainerStart(context.Background(), step.container.ID, container.StartOptions{}); err != nil {
+					errs = append(errs, fmt.Errorf("failed starting %s: %w", name, err))
+					continue
+				}
+				// Waits for the container so the containers depending on it are started after it's ready
+				if err := UntilHealthy(context.Background(), dockerClient, step.container.ID); err != nil {
+					errs = append(errs, fmt.Errorf("%s didn't become healthy: %w", name, err))
+				}
+			}
+			if len(step.hooks.Post) > 0 {
+				if err := runBackupHook(context.Background(), dockerClient, step.container.ID, step.hooks.Post, step.hooks.Timeout); err != nil {
+					errs = append(errs, fmt.Errorf("post backup command failed in %s: %w", name, err))
+				}
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	for _, step := range steps {
+		// Added before running the hooks so the post hook still cleans up after a pre hook that fails part way through
+		prepared = append(prepared, step)
+		name := containerName(step.container)
+		if step.hooks.Stop {
+			if err := dockerClient.ContainerStop(ctx, step.container.ID, container.StopOptions{}); err != nil {
+				return nil, errors.Join(fmt.Errorf("failed stopping %s: %w", name, err), finish())
+			}
+		}
+		if len(step.hooks.Pre) > 0 {
+			if err := runBackupHook(ctx, dockerClient, step.container.ID, step.hooks.Pre, step.hooks.Timeout); err != nil {
+				return nil, errors.Join(fmt.Errorf("pre backup command failed in %s: %w", name, err), finish())
+			}
+		}
+	}
+
+	return finish, nil
+}
+
+// runBackupHook runs a backup hook's command in the container, stopping waiting for it after the hook's timeout
+func runBackupHook(ctx context.Context, dockerClient *client.Client, containerId string, command []string, timeout string) error {
+	duration := defaultBackupHookTimeout
+	if timeout != "" {
+		parsed, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("%w: invalid backup hook timeout %s", InvalidContainerError, timeout)
+		}
+		duration = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	return execCommand(ctx, dockerClient, containerId, command)
+}
+
+// execCommand runs a command in the container and waits for it to exit, returning an error containing the end of its
+// output if it doesn't exit successfully
+func execCommand(ctx context.Context, dockerClient *client.Client, containerId string, command []string) error {
+	exec, err := dockerClient.ContainerExecCreate(ctx, containerId, container.ExecOptions{
+		Cmd:          command,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+	attach, err := dockerClient.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return err
+	}
+	defer attach.Close()
+
+	// The output is read in the background, as reading the connection isn't stopped by the context
+	output := &tailWriter{size: hookOutputSize}
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(output, output, attach.Reader)
+		done <- err
+	}()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%s didn't finish: %w", command[0], ctx.Err())
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+	}
+
+	info, err := dockerClient.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return err
+	}
+	if info.ExitCode != 0 {
+		return fmt.Errorf(
+			"%s exited with status %d: %s",
+			strings.Join(command, " "),
+			info.ExitCode,
+			strings.TrimSpace(string(output.buffer)),
+		)
+	}
+	return nil
+}
+
+// tailWriter keeps the last bytes written to it, so the output of long-running commands isn't all kept in memory
+type tailWriter struct {
+	buffer []byte
+	size   int
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+	if len(w.buffer) > w.size {
+		w.buffer = w.buffer[len(w.buffer)-w.size:]
+	}
+	return len(p), nil
+}
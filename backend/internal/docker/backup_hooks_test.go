@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// Tests running containers with backup hooks are prepared before the containers they depend on
+func TestBackupSteps(t *testing.T) {
+	serverHooks, err := formatBackupHooks(persistence.PackageBackup{Stop: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	databaseHooks, err := formatBackupHooks(persistence.PackageBackup{Pre: []string{"pg_dump", "-f", "/data/dump.sql"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	containers := []types.Container{
+		{
+			ID:    "database",
+			State: string(ContainerRunning),
+			Labels: map[string]string{
+				APP_ID_LABEL:       "test.app",
+				ContainerNameLabel: "database",
+				BackupHooksLabel:   databaseHooks,
+			},
+		},
+		{
+			ID:    "worker",
+			State: string(ContainerExited),
+			Labels: map[string]string{
+				APP_ID_LABEL:       "test.app",
+				ContainerNameLabel: "worker",
+				DependsOnLabel:     "database:healthy",
+				BackupHooksLabel:   serverHooks,
+			},
+		},
+		{
+			ID:    "server",
+			State: string(ContainerRunning),
+			Labels: map[string]string{
+				APP_ID_LABEL:       "test.app",
+				ContainerNameLabel: "server",
+				DependsOnLabel:     "database:healthy,redis:started",
+				BackupHooksLabel:   serverHooks,
+			},
+		},
+		{
+			ID:     "redis",
+			State:  string(ContainerRunning),
+			Labels: map[string]string{APP_ID_LABEL: "test.app", ContainerNameLabel: "redis"},
+		},
+	}
+
+	steps, err := backupSteps(containers)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	var order []string
+	for _, step := range steps {
+		order = append(order, step.container.ID)
+	}
+	if diff := cmp.Diff([]string{"server", "database"}, order); diff != "" {
+		t.Errorf("Order mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(persistence.PackageBackup{Pre: []string{"pg_dump", "-f", "/data/dump.sql"}}, steps[1].hooks); diff != "" {
+		t.Errorf("Hooks mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Tests only the end of a command's output is kept
+func TestTailWriter(t *testing.T) {
+	writer := &tailWriter{size: 8}
+	for _, line := range []string{"dumping\n", "schema\n", "failed\n"} {
+		if _, err := writer.Write([]byte(line)); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+	}
+	if got := string(writer.buffer); got != "\nfailed\n" {
+		t.Errorf("Expected output %q, got %q", "\nfailed\n", got)
+	}
+}
@@ -294,3 +294,101 @@ func TestRestoreFolder(t *testing.T) {
 		}
 	}
 }
+
+func TestExportImportVolume(t *testing.T) {
+	dockerClient, err := testutils.CreateDindClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testutils.CleanupDind()
+
+	download, err := dockerClient.ImagePull(context.Background(), "busybox:latest", image.PullOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(io.Discard, download)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes test data to a volume, then exports it and imports it into a new volume
+	writer, err := dockerClient.ContainerCreate(
+		context.Background(),
+		&container.Config{
+			Image: "busybox",
+			Cmd:   []string{"/bin/sh", "-c", "mkdir /volume/sub && echo testing > /volume/sub/test.txt"},
+		},
+		&container.HostConfig{Binds: []string{"export-test:/volume"}, AutoRemove: true},
+		nil,
+		nil,
+		"export-test-writer",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dockerClient.ContainerStart(context.Background(), writer.ID, container.StartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := docker.UntilRemoved(context.Background(), dockerClient, writer.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := docker.ExportVolume(context.Background(), dockerClient, "export-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = docker.ImportVolume(context.Background(), dockerClient, "test.app", "test.app-import-test", archive)
+	archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Exports the imported volume to check its contents
+	imported, err := docker.ExportVolume(context.Background(), dockerClient, "test.app-import-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.Close()
+	tarReader := tar.NewReader(imported)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			t.Fatal("Imported volume doesn't contain test file")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Name == "volume/sub/test.txt" {
+			content, err := io.ReadAll(tarReader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "testing\n" {
+				t.Fatalf("Expected `testing` but got `%q`", content)
+			}
+			return
+		}
+	}
+}
+
+func TestExtractFolderArchiveInvalidPath(t *testing.T) {
+	storageConfig := testutils.SetupTempStorage()
+
+	var archive strings.Builder
+	tarWriter := tar.NewWriter(&archive)
+	if err := tarWriter.WriteHeader(&tar.Header{Name: "../outside.txt", Mode: 0644, Size: 4, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tarWriter.Write([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	tarWriter.Close()
+
+	err := docker.ExtractFolderArchive(storageConfig, "test.app", strings.NewReader(archive.String()))
+	if err == nil {
+		t.Fatal("Expected error extracting file outside of app folder")
+	}
+	if _, err := os.Stat(filepath.Join(storageConfig.DataPath, "test.app", "outside.txt")); !os.IsNotExist(err) {
+		t.Fatal("File outside of app folder was extracted")
+	}
+}
@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/util"
+)
+
+// formatDependencies encodes a container's dependencies for storing in a label, such as database:healthy,redis:started
+func formatDependencies(dependencies []persistence.PackageDependency) string {
+	formatted := make([]string, len(dependencies))
+	for i, dependency := range dependencies {
+		condition := dependency.Condition
+		if condition == "" {
+			condition = persistence.DependencyStarted
+		}
+		formatted[i] = dependency.Container + ":" + condition
+	}
+	return strings.Join(formatted, ",")
+}
+
+// parseDependencies decodes the dependencies stored in a container's label
+func parseDependencies(label string) []persistence.PackageDependency {
+	if label == "" {
+		return nil
+	}
+
+	var dependencies []persistence.PackageDependency
+	for _, dependency := range strings.Split(label, ",") {
+		name, condition, _ := strings.Cut(dependency, ":")
+		dependencies = append(dependencies, persistence.PackageDependency{Container: name, Condition: condition})
+	}
+	return dependencies
+}
+
+// containerName retrieves the name of the container within its package. Containers created before the name was
+// stored in a label use the docker container name without the app ID prefix
+func containerName(containerResult types.Container) string {
+	if name, ok := containerResult.Labels[ContainerNameLabel]; ok {
+		return name
+	}
+	if len(containerResult.Names) == 0 {
+		return containerResult.ID
+	}
+	return strings.TrimPrefix(containerResult.Names[0], "/"+containerResult.Labels[APP_ID_LABEL]+"-")
+}
+
+// orderContainers sorts an app's containers so each container comes after the containers it depends on
+func orderContainers(containers []types.Container) ([]types.Container, error) {
+	names := make([]string, len(containers))
+	containersByName := make(map[string]types.Container)
+	dependencies := make(map[string][]string)
+	for i, containerResult := range containers {
+		name := containerName(containerResult)
+		names[i] = name
+		containersByName[name] = containerResult
+		for _, dependency := range parseDependencies(containerResult.Labels[DependsOnLabel]) {
+			dependencies[name] = append(dependencies[name], dependency.Container)
+		}
+	}
+
+	order, err := util.TopologicalSort(names, dependencies)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make([]types.Container, len(order))
+	for i, name := range order {
+		ordered[i] = containersByName[name]
+	}
+	return ordered, nil
+}
+
+// healthConfig converts a package healthcheck to the health config used by docker
+func healthConfig(healthcheck *persistence.PackageHealthcheck) (*container.HealthConfig, error) {
+	if healthcheck == nil {
+		return nil, nil
+	}
+
+	config := &container.HealthConfig{
+		Test:    healthcheck.Test,
+		Retries: healthcheck.Retries,
+	}
+	durations := []struct {
+		value  string
+		target *time.Duration
+	}{
+		{healthcheck.Interval, &config.Interval},
+		{healthcheck.Timeout, &config.Timeout},
+		{healthcheck.StartPeriod, &config.StartPeriod},
+	}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid healthcheck duration %s", InvalidContainerError, duration.value)
+		}
+		*duration.target = parsed
+	}
+
+	return config, nil
+}
@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Tests containers are ordered after their dependencies, including containers created without a name label
+func TestOrderContainers(t *testing.T) {
+	containers := []types.Container{
+		{
+			ID: "server",
+			Labels: map[string]string{
+				APP_ID_LABEL:       "test.app",
+				ContainerNameLabel: "server",
+				DependsOnLabel:     "database:healthy,redis:started",
+			},
+		},
+		{
+			ID:     "redis",
+			Names:  []string{"/test.app-redis"},
+			Labels: map[string]string{APP_ID_LABEL: "test.app"},
+		},
+		{
+			ID:     "database",
+			Labels: map[string]string{APP_ID_LABEL: "test.app", ContainerNameLabel: "database"},
+		},
+	}
+
+	ordered, err := orderContainers(containers)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	var order []string
+	for _, containerResult := range ordered {
+		order = append(order, containerResult.ID)
+	}
+	if diff := cmp.Diff([]string{"database", "redis", "server"}, order); diff != "" {
+		t.Errorf("Order mismatch (-want +got):\n%s", diff)
+	}
+}
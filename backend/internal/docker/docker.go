@@ -2,11 +2,13 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -18,6 +20,8 @@ import (
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/go-connections/nat"
 
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
@@ -38,9 +42,26 @@ const (
 const APP_ID_LABEL = "AppID"
 const AppVersionLabel = "AppVersion"
 
+// ContainerNameLabel stores the name of the container within its package, and DependsOnLabel the containers it depends
+// on, so the start order of an app's containers can be found without its package
+const ContainerNameLabel = "AppContainer"
+const DependsOnLabel = "AppDependsOn"
+
+// SystemApps are the packages installed by the launcher, in the order they're started. They're labelled the same as
+// apps but aren't stored in the apps table
+var SystemApps = []string{"ory.kratos", "ory.hydra", "homecloud.app"}
+
 var NotFoundError = errors.New("no containers for app found")
 var InvalidContainerError = errors.New("container has invalid configuration")
 
+// Resources lists the docker resources created while installing an app, so a partially completed install can be
+// removed
+type Resources struct {
+	Containers []string
+	Networks   []string
+	Volumes    []string
+}
+
 // InstallApp downloads images and creates containers for the given app package. Also sets up configuration and local files
 func InstallApp(
 	dockerClient *client.Client,
@@ -49,149 +70,325 @@ func InstallApp(
 	storageConfig config.Storage,
 	dockerConfig config.Docker,
 ) error {
+	_, err := InstallAppResources(dockerClient, app, serverHostConfig, storageConfig, dockerConfig)
+	return err
+}
+
+// InstallAppResources installs the app the same as InstallApp, also returning the docker resources it created. Resources
+// that already existed, such as volumes kept from a previous version, aren't included. The resources are returned even
+// when an error occurs so the partial install can be removed with RemoveResources
+func InstallAppResources(
+	dockerClient *client.Client,
+	app persistence.AppPackage,
+	serverHostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+) (resources Resources, err error) {
 	// Creates the network if it doesn't already exist
-	networkId, err := GetOrCreateNetwork(context.Background(), dockerClient, app.Id, map[string]string{
+	networkId, created, err := getOrCreateNetwork(context.Background(), dockerClient, app.Id, map[string]string{
 		APP_ID_LABEL:    app.Id,
 		AppVersionLabel: app.Version,
 	})
 	if err != nil {
-		return err
+		return resources, err
+	}
+	if created {
+		resources.Networks = append(resources.Networks, networkId)
 	}
 
 	for _, containerDef := range app.Containers {
-		// Checks if the image is already downloaded and downloads it if not
-		alreadyDownloaded, err := IsImageDownloaded(dockerClient, containerDef.Image)
+		if err = createContainer(dockerClient, app, containerDef, networkId, &resources, serverHostConfig, storageConfig, dockerConfig); err != nil {
+			return resources, err
+		}
+	}
+
+	return resources, nil
+}
+
+// RecreateContainers removes and creates the given containers of an app again, leaving the rest of the app untouched.
+// Used when the definition of some containers has changed, such as when their settings are changed
+func RecreateContainers(
+	ctx context.Context,
+	dockerClient *client.Client,
+	app persistence.AppPackage,
+	containerNames []string,
+	serverHostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+) error {
+	containers, err := GetAppContainers(dockerClient, app.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, containerResult := range containers {
+		if !slices.Contains(containerNames, containerName(containerResult)) {
+			continue
+		}
+		if err := dockerClient.ContainerStop(ctx, containerResult.ID, container.StopOptions{}); err != nil {
+			return err
+		}
+		err = dockerClient.ContainerRemove(ctx, containerResult.ID, container.RemoveOptions{RemoveVolumes: true})
 		if err != nil {
 			return err
 		}
+	}
 
-		// If not downloaded the image
-		if !alreadyDownloaded {
-			reader, err := dockerClient.ImagePull(context.Background(), containerDef.Image, image.PullOptions{})
-			if err != nil {
-				return err
-			}
+	networkId, _, err := getOrCreateNetwork(ctx, dockerClient, app.Id, map[string]string{
+		APP_ID_LABEL:    app.Id,
+		AppVersionLabel: app.Version,
+	})
+	if err != nil {
+		return err
+	}
 
-			_, err = io.ReadAll(reader)
-			if err != nil {
-				return err
-			}
+	var resources Resources
+	for _, containerDef := range app.Containers {
+		if !slices.Contains(containerNames, containerDef.Name) {
+			continue
 		}
-
-		// sets up the environment variables for the container
-		var env []string
-		for key, value := range containerDef.Environment {
-			env = append(env, fmt.Sprintf("%s=%s", key, value))
+		if err := createContainer(dockerClient, app, containerDef, networkId, &resources, serverHostConfig, storageConfig, dockerConfig); err != nil {
+			return err
 		}
+	}
 
-		containerConfig := &container.Config{
-			Image:    containerDef.Image,
-			Hostname: containerDef.Name,
-			Env:      env,
-			Labels: map[string]string{
-				APP_ID_LABEL:    app.Id,
-				AppVersionLabel: app.Version,
-			},
-		}
+	return nil
+}
 
-		// Sets the command if given
-		if containerDef.Command != "" {
-			containerConfig.Cmd = strings.Split(containerDef.Command, " ")
+// createContainer creates a single container of an app, pulling its image if needed, adding the resources it creates to
+// resources
+func createContainer(
+	dockerClient *client.Client,
+	app persistence.AppPackage,
+	containerDef persistence.PackageContainer,
+	networkId string,
+	resources *Resources,
+	serverHostConfig config.Host,
+	storageConfig config.Storage,
+	dockerConfig config.Docker,
+) error {
+	// Checks if the image is already downloaded and downloads it if not
+	alreadyDownloaded, err := IsImageDownloaded(dockerClient, containerDef.Image)
+	if err != nil {
+		return err
+	}
+
+	// If not downloaded the image
+	if !alreadyDownloaded {
+		if err = PullImage(context.Background(), dockerClient, containerDef.Image, nil); err != nil {
+			return err
 		}
+	}
 
-		// creates port mappings
-		portMap := nat.PortMap{}
-		for _, ports := range containerDef.Ports {
-			portParts := strings.Split(ports, ":")
-			var containerPort = portParts[1]
-			if !strings.HasSuffix(containerPort, "/tcp") && !strings.HasSuffix(containerPort, "/udp") {
-				containerPort += "/tcp"
-			}
-			portMap[nat.Port(containerPort)] = []nat.PortBinding{
-				{
-					HostIP:   "0.0.0.0",
-					HostPort: portParts[0],
-				},
-			}
+	// sets up the environment variables for the container
+	var env []string
+	for key, value := range containerDef.Environment {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	healthcheck, err := healthConfig(containerDef.Healthcheck)
+	if err != nil {
+		return err
+	}
+	limits, err := resourceLimits(containerDef.Limits)
+	if err != nil {
+		return err
+	}
+
+	containerConfig := &container.Config{
+		Image:       containerDef.Image,
+		Hostname:    containerDef.Name,
+		Env:         env,
+		Healthcheck: healthcheck,
+		Labels: map[string]string{
+			APP_ID_LABEL:       app.Id,
+			AppVersionLabel:    app.Version,
+			ContainerNameLabel: containerDef.Name,
+		},
+	}
+	if len(containerDef.DependsOn) > 0 {
+		containerConfig.Labels[DependsOnLabel] = formatDependencies(containerDef.DependsOn)
+	}
+	if containerDef.Backup != nil {
+		hooks, err := formatBackupHooks(*containerDef.Backup)
+		if err != nil {
+			return err
 		}
+		containerConfig.Labels[BackupHooksLabel] = hooks
+	}
 
-		// creates required volumes
-		formattedVolumes := []string{}
-		for _, vol := range containerDef.Volumes {
-			volumeParts := strings.Split(vol, ":")
+	// Sets the command if given
+	if containerDef.Command != "" {
+		containerConfig.Cmd = strings.Split(containerDef.Command, " ")
+	}
 
-			// mounts to app specific data folder if mount is local file
-			if strings.HasPrefix(volumeParts[0], "./") {
-				// local files are converted to map to the data folder - e.g. ./config.json becomes data_dir/app_id/data/config.json
-				volumeParts[0] = filepath.Join(storageConfig.GetAppDataMountPath(app.Id), volumeParts[0][2:])
-			} else if strings.HasPrefix(volumeParts[0], "!AppDir") {
-				appDir, err := os.Getwd()
+	// creates port mappings
+	portMap := nat.PortMap{}
+	for _, ports := range containerDef.Ports {
+		portParts := strings.Split(ports, ":")
+		if len(portParts) != 2 {
+			return fmt.Errorf("invalid port mapping %s", ports)
+		}
+		var containerPort = portParts[1]
+		if !strings.HasSuffix(containerPort, "/tcp") && !strings.HasSuffix(containerPort, "/udp") {
+			containerPort += "/tcp"
+		}
+		portMap[nat.Port(containerPort)] = []nat.PortBinding{
+			{
+				HostIP:   "0.0.0.0",
+				HostPort: portParts[0],
+			},
+		}
+	}
+
+	// creates required volumes
+	formattedVolumes := []string{}
+	for _, vol := range containerDef.Volumes {
+		volumeParts := strings.Split(vol, ":")
+
+		// mounts to app specific data folder if mount is local file
+		if strings.HasPrefix(volumeParts[0], "./") {
+			// local files are converted to map to the data folder - e.g. ./config.json becomes data_dir/app_id/data/config.json
+			volumeParts[0] = filepath.Join(storageConfig.GetAppDataMountPath(app.Id), volumeParts[0][2:])
+		} else if strings.HasPrefix(volumeParts[0], "!AppDir") {
+			var appDir string
+			appDir, err = os.Getwd()
+			if err != nil {
+				return err
+			}
+			volumeParts[0] = filepath.Join(appDir, strings.TrimPrefix(volumeParts[0], "!AppDir"))
+		} else if !strings.HasPrefix(volumeParts[0], "/") {
+			// Checks if the volume exists before creating
+			volumeParts[0] = fmt.Sprintf("%s-%s", app.Id, volumeParts[0])
+			if _, err = dockerClient.VolumeInspect(context.Background(), volumeParts[0]); err != nil {
+				_, err = dockerClient.VolumeCreate(context.Background(), volume.CreateOptions{
+					Name:   volumeParts[0],
+					Labels: map[string]string{APP_ID_LABEL: app.Id},
+				})
 				if err != nil {
 					return err
 				}
-				volumeParts[0] = filepath.Join(appDir, strings.TrimPrefix(volumeParts[0], "!AppDir"))
-			} else if !strings.HasPrefix(volumeParts[0], "/") {
-				// Checks if the volume exists before creating
-				volumeParts[0] = fmt.Sprintf("%s-%s", app.Id, volumeParts[0])
-				if _, err = dockerClient.VolumeInspect(context.Background(), volumeParts[0]); err != nil {
-					_, err = dockerClient.VolumeCreate(context.Background(), volume.CreateOptions{
-						Name:   volumeParts[0],
-						Labels: map[string]string{APP_ID_LABEL: app.Id},
-					})
-					if err != nil {
-						return err
-					}
-				}
+				resources.Volumes = append(resources.Volumes, volumeParts[0])
 			}
+		}
+
+		formattedVolumes = append(formattedVolumes, strings.Join(volumeParts, ":"))
+	}
+
+	// Gets restart policy, defaults to always
+	restart := container.RestartPolicyAlways
+	if containerDef.Restart != "" {
+		restart = container.RestartPolicyMode(containerDef.Restart)
+	}
+
+	hostConfig := &container.HostConfig{
+		NetworkMode: "bridge",
+		RestartPolicy: container.RestartPolicy{
+			Name: restart,
+		},
+		PortBindings: portMap,
+		Binds:        formattedVolumes,
+		ExtraHosts: append(containerDef.ExtraHosts,
+			fmt.Sprintf("hydra.%s:host-gateway", serverHostConfig.Host),
+			fmt.Sprintf("%s:host-gateway", serverHostConfig.Host),
+		),
+		Privileged: containerDef.Privileged,
+		Resources:  limits,
+	}
 
-			formattedVolumes = append(formattedVolumes, strings.Join(volumeParts, ":"))
+	containerName := app.Id + "-" + containerDef.Name
+
+	// sets up the network config for the container
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{networkId: {NetworkID: networkId}},
+	}
+	if containerDef.ProxyTarget {
+		// adds the network shared with homecloud api to the network config
+		proxyNetworkId, created, err := getOrCreateNetwork(context.Background(), dockerClient, app.Id+"-proxy", map[string]string{
+			APP_ID_LABEL:    app.Id,
+			AppVersionLabel: app.Version,
+		})
+		if err != nil {
+			return err
+		}
+		if created {
+			resources.Networks = append(resources.Networks, proxyNetworkId)
 		}
 
-		// Gets restart policy, defaults to always
-		restart := container.RestartPolicyAlways
-		if containerDef.Restart != "" {
-			restart = container.RestartPolicyMode(containerDef.Restart)
+		// Ensures main container is connected to proxy network
+		err = dockerClient.NetworkConnect(context.Background(), proxyNetworkId, dockerConfig.ContainerName, &network.EndpointSettings{})
+		if err != nil && !IsNetworkAlreadyConnectErr(err) {
+			return err
 		}
+		networkingConfig.EndpointsConfig[proxyNetworkId] = &network.EndpointSettings{NetworkID: proxyNetworkId}
+	}
 
-		hostConfig := &container.HostConfig{
-			NetworkMode: "bridge",
-			RestartPolicy: container.RestartPolicy{
-				Name: restart,
-			},
-			PortBindings: portMap,
-			Binds:        formattedVolumes,
-			ExtraHosts: append(containerDef.ExtraHosts,
-				fmt.Sprintf("hydra.%s:host-gateway", serverHostConfig.Host),
-				fmt.Sprintf("%s:host-gateway", serverHostConfig.Host),
-			),
-			Privileged: containerDef.Privileged,
-		}
-
-		containerName := app.Id + "-" + containerDef.Name
-
-		// sets up the network config for the container
-		networkingConfig := &network.NetworkingConfig{
-			EndpointsConfig: map[string]*network.EndpointSettings{networkId: {NetworkID: networkId}},
-		}
-		if containerDef.ProxyTarget {
-			// adds the network shared with homecloud api to the network config
-			proxyNetworkId, err := GetOrCreateNetwork(context.Background(), dockerClient, app.Id+"-proxy", map[string]string{
-				APP_ID_LABEL:    app.Id,
-				AppVersionLabel: app.Version,
-			})
-			if err != nil {
-				return err
-			}
+	var createdContainer container.CreateResponse
+	createdContainer, err = dockerClient.ContainerCreate(context.Background(), containerConfig, hostConfig, networkingConfig, nil, containerName)
+	if err != nil {
+		return err
+	}
+	resources.Containers = append(resources.Containers, createdContainer.ID)
+	return nil
+}
 
-			// Ensures main container is connected to proxy network
-			err = dockerClient.NetworkConnect(context.Background(), proxyNetworkId, dockerConfig.ContainerName, &network.EndpointSettings{})
-			if err != nil && !IsNetworkAlreadyConnectErr(err) {
-				return err
+// PullImage downloads the given image, passing each progress message sent by the docker daemon to onProgress if it
+// isn't nil
+func PullImage(
+	ctx context.Context,
+	dockerClient *client.Client,
+	imageName string,
+	onProgress func(message jsonmessage.JSONMessage),
+) error {
+	reader, err := dockerClient.ImagePull(ctx, imageName, image.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// Reads the stream of progress messages until the pull completes, errors during the pull are sent as messages
+	// rather than failing the request
+	decoder := json.NewDecoder(reader)
+	for {
+		var message jsonmessage.JSONMessage
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
 			}
-			networkingConfig.EndpointsConfig[proxyNetworkId] = &network.EndpointSettings{NetworkID: proxyNetworkId}
+			return fmt.Errorf("error reading pull progress for %s: %w", imageName, err)
+		}
+
+		if message.Error != nil {
+			return fmt.Errorf("error pulling image %s: %w", imageName, message.Error)
 		}
 
-		_, err = dockerClient.ContainerCreate(context.Background(), containerConfig, hostConfig, networkingConfig, nil, containerName)
+		if onProgress != nil {
+			onProgress(message)
+		}
+	}
+}
+
+// PullAppImages downloads the images for all containers of the given app that aren't already downloaded
+func PullAppImages(
+	ctx context.Context,
+	dockerClient *client.Client,
+	app persistence.AppPackage,
+	onProgress func(image string, message jsonmessage.JSONMessage),
+) error {
+	for _, containerDef := range app.Containers {
+		alreadyDownloaded, err := IsImageDownloaded(dockerClient, containerDef.Image)
+		if err != nil {
+			return err
+		}
+		if alreadyDownloaded {
+			continue
+		}
+
+		err = PullImage(ctx, dockerClient, containerDef.Image, func(message jsonmessage.JSONMessage) {
+			if onProgress != nil {
+				onProgress(containerDef.Image, message)
+			}
+		})
 		if err != nil {
 			return err
 		}
@@ -200,7 +397,8 @@ func InstallApp(
 	return nil
 }
 
-// StartApp starts all containers related to the app
+// StartApp starts all containers related to the app. Containers are started after the containers they depend on,
+// waiting for dependencies to become healthy first where required
 func StartApp(dockerClient *client.Client, appID string) error {
 	// Retrieves filtered list of containers filtered by app ID
 	containers, err := dockerClient.ContainerList(context.Background(), container.ListOptions{
@@ -211,8 +409,27 @@ func StartApp(dockerClient *client.Client, appID string) error {
 		return err
 	}
 
+	containers, err = orderContainers(containers)
+	if err != nil {
+		return err
+	}
+	containerIds := make(map[string]string)
+	for _, containerResult := range containers {
+		containerIds[containerName(containerResult)] = containerResult.ID
+	}
+
 	// Starts each container
 	for _, containerResult := range containers {
+		for _, dependency := range parseDependencies(containerResult.Labels[DependsOnLabel]) {
+			dependencyId, ok := containerIds[dependency.Container]
+			if !ok || dependency.Condition != persistence.DependencyHealthy {
+				continue
+			}
+			if err := UntilHealthy(context.Background(), dockerClient, dependencyId); err != nil {
+				return fmt.Errorf("%s didn't become healthy: %w", dependency.Container, err)
+			}
+		}
+
 		err = dockerClient.ContainerStart(context.Background(), containerResult.ID, container.StartOptions{})
 		if err != nil {
 			return err
@@ -222,7 +439,7 @@ func StartApp(dockerClient *client.Client, appID string) error {
 	return nil
 }
 
-// StopApp stops all containers related to the app
+// StopApp stops all containers related to the app, in the reverse of the order they're started
 func StopApp(dockerClient *client.Client, appID string) error {
 	// Retrieves list of containers filtered by app ID
 	containers, err := dockerClient.ContainerList(context.Background(), container.ListOptions{
@@ -232,9 +449,14 @@ func StopApp(dockerClient *client.Client, appID string) error {
 		return err
 	}
 
+	containers, err = orderContainers(containers)
+	if err != nil {
+		return err
+	}
+
 	// Stops each container
-	for _, containerResult := range containers {
-		err = dockerClient.ContainerStop(context.Background(), containerResult.ID, container.StopOptions{})
+	for i := len(containers) - 1; i >= 0; i-- {
+		err = dockerClient.ContainerStop(context.Background(), containers[i].ID, container.StopOptions{})
 		if err != nil {
 			return err
 		}
@@ -331,6 +553,46 @@ func UninstallApp(dockerClient *client.Client, appId string) error {
 	return nil
 }
 
+// RemoveResources removes the given docker resources, used to clean up a partially completed install. Resources that
+// no longer exist are skipped, and removal continues after errors so as much as possible is removed
+func RemoveResources(ctx context.Context, dockerClient *client.Client, resources Resources) error {
+	var errs []error
+	for _, containerId := range resources.Containers {
+		err := dockerClient.ContainerRemove(ctx, containerId, container.RemoveOptions{Force: true, RemoveVolumes: true})
+		if err != nil && !errdefs.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to remove container %s: %w", containerId, err))
+		}
+	}
+
+	for _, networkId := range resources.Networks {
+		// Disconnects any containers still attached, such as Homecloud itself for proxy networks
+		networkInspect, err := dockerClient.NetworkInspect(ctx, networkId, network.InspectOptions{})
+		if err != nil {
+			if !errdefs.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("failed to inspect network %s: %w", networkId, err))
+			}
+			continue
+		}
+		for containerId := range networkInspect.Containers {
+			if err := dockerClient.NetworkDisconnect(ctx, networkId, containerId, true); err != nil && !errdefs.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("failed to disconnect container %s: %w", containerId, err))
+			}
+		}
+
+		if err := dockerClient.NetworkRemove(ctx, networkId); err != nil && !errdefs.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to remove network %s: %w", networkId, err))
+		}
+	}
+
+	for _, volumeName := range resources.Volumes {
+		if err := dockerClient.VolumeRemove(ctx, volumeName, true); err != nil && !errdefs.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to remove volume %s: %w", volumeName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // GetAppContainers retrieves a list of all containers belonging to the specified app
 func GetAppContainers(dockerClient *client.Client, appId string) (containers []types.Container, err error) {
 	return dockerClient.ContainerList(context.Background(), container.ListOptions{
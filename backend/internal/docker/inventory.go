@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// InventoryContainer is a container labelled with an app ID. Name is the docker container name, while PackageName
+// is the name of the container within its package
+type InventoryContainer struct {
+	ID          string
+	Name        string
+	AppID       string
+	PackageName string
+	State       State
+}
+
+// InventoryResource is a network or volume labelled with an app ID
+type InventoryResource struct {
+	Name  string
+	AppID string
+}
+
+// Inventory lists all docker resources labelled as belonging to an app, including system apps
+type Inventory struct {
+	Containers []InventoryContainer
+	Networks   []InventoryResource
+	Volumes    []InventoryResource
+}
+
+// ListAppResources retrieves every container, network and volume labelled with an app ID
+func ListAppResources(ctx context.Context, dockerClient *client.Client) (Inventory, error) {
+	labelFilter := filters.NewArgs(filters.Arg("label", APP_ID_LABEL))
+
+	containers, err := dockerClient.ContainerList(ctx, container.ListOptions{All: true, Filters: labelFilter})
+	if err != nil {
+		return Inventory{}, err
+	}
+	networks, err := dockerClient.NetworkList(ctx, network.ListOptions{Filters: labelFilter})
+	if err != nil {
+		return Inventory{}, err
+	}
+	volumes, err := dockerClient.VolumeList(ctx, volume.ListOptions{Filters: labelFilter})
+	if err != nil {
+		return Inventory{}, err
+	}
+
+	var inventory Inventory
+	for _, containerResult := range containers {
+		name := containerResult.ID
+		if len(containerResult.Names) > 0 {
+			name = strings.TrimPrefix(containerResult.Names[0], "/")
+		}
+		inventory.Containers = append(inventory.Containers, InventoryContainer{
+			ID:          containerResult.ID,
+			Name:        name,
+			AppID:       containerResult.Labels[APP_ID_LABEL],
+			PackageName: containerName(containerResult),
+			State:       State(containerResult.State),
+		})
+	}
+	for _, networkResult := range networks {
+		inventory.Networks = append(inventory.Networks, InventoryResource{
+			Name:  networkResult.Name,
+			AppID: networkResult.Labels[APP_ID_LABEL],
+		})
+	}
+	for _, volumeResult := range volumes.Volumes {
+		inventory.Volumes = append(inventory.Volumes, InventoryResource{
+			Name:  volumeResult.Name,
+			AppID: volumeResult.Labels[APP_ID_LABEL],
+		})
+	}
+
+	return inventory, nil
+}
+
+// RemoveContainer stops and removes a single container along with its anonymous volumes
+func RemoveContainer(ctx context.Context, dockerClient *client.Client, containerId string) error {
+	if err := dockerClient.ContainerStop(ctx, containerId, container.StopOptions{}); err != nil {
+		return err
+	}
+	return dockerClient.ContainerRemove(ctx, containerId, container.RemoveOptions{RemoveVolumes: true})
+}
@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// resourceLimits converts a container's limits to the resources used by docker. Swap is limited to the same amount as
+// memory, matching docker's default when a memory limit is set
+func resourceLimits(limits *persistence.PackageLimits) (container.Resources, error) {
+	var resources container.Resources
+	if limits == nil {
+		return resources, nil
+	}
+
+	if limits.Memory != "" {
+		memory, err := units.RAMInBytes(limits.Memory)
+		if err != nil {
+			return resources, fmt.Errorf("%w: invalid memory limit %s", InvalidContainerError, limits.Memory)
+		}
+		resources.Memory = memory
+		resources.MemorySwap = memory * 2
+	}
+	if limits.Cpus > 0 {
+		resources.NanoCPUs = int64(limits.Cpus * 1e9)
+	}
+	if limits.Pids > 0 {
+		resources.PidsLimit = &limits.Pids
+	}
+
+	return resources, nil
+}
+
+// UpdateLimits applies new limits to an app's existing containers without recreating them, with limits given by the
+// name of the container within the package. Containers without limits are left unchanged, as docker can't remove
+// limits from a running container, so removed limits only take effect once the containers are recreated
+func UpdateLimits(
+	ctx context.Context,
+	dockerClient *client.Client,
+	appId string,
+	limits map[string]*persistence.PackageLimits,
+) error {
+	containers, err := GetAppContainers(dockerClient, appId)
+	if err != nil {
+		return err
+	}
+
+	for _, containerResult := range containers {
+		containerLimits, ok := limits[containerName(containerResult)]
+		if !ok || containerLimits == nil {
+			continue
+		}
+
+		resources, err := resourceLimits(containerLimits)
+		if err != nil {
+			return err
+		}
+		if _, err := dockerClient.ContainerUpdate(ctx, containerResult.ID, container.UpdateConfig{Resources: resources}); err != nil {
+			return fmt.Errorf("failed to update limits of %s: %w", containerName(containerResult), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// LogOptions filters the logs retrieved for an app. Since and Until accept timestamps or durations relative to now,
+// such as 10m, and Tail the number of lines to retrieve from the end of each container's logs or all. If Containers is
+// empty the logs of every container are retrieved
+type LogOptions struct {
+	Containers []string
+	Since      string
+	Until      string
+	Tail       string
+	Follow     bool
+}
+
+// LogLine is a single line written by one of an app's containers
+type LogLine struct {
+	Container string    `json:"container"`
+	Stream    string    `json:"stream"`
+	Time      time.Time `json:"time"`
+	Text      string    `json:"text"`
+}
+
+// AppLogs retrieves the logs of an app's containers, calling onLine for each line. Logs from multiple containers are
+// sorted by time, or when following are passed on as each container writes them until the context is cancelled
+func AppLogs(
+	ctx context.Context,
+	dockerClient *client.Client,
+	appId string,
+	options LogOptions,
+	onLine func(line LogLine) error,
+) error {
+	containers, err := GetAppContainers(dockerClient, appId)
+	if err != nil {
+		return err
+	}
+	containers = slices.DeleteFunc(containers, func(c types.Container) bool {
+		return len(options.Containers) > 0 && !slices.Contains(options.Containers, containerName(c))
+	})
+
+	if !options.Follow {
+		var lines []LogLine
+		for _, appContainer := range containers {
+			err := containerLogs(ctx, dockerClient, appContainer, options, func(line LogLine) error {
+				lines = append(lines, line)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		slices.SortStableFunc(lines, func(a, b LogLine) int {
+			return a.Time.Compare(b.Time)
+		})
+		for _, line := range lines {
+			if err := onLine(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Each container is followed separately, passing lines to onLine one at a time
+	followCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tasks, tasksCtx := errgroup.WithContext(followCtx)
+	lines := make(chan LogLine)
+	for _, appContainer := range containers {
+		tasks.Go(func() error {
+			return containerLogs(tasksCtx, dockerClient, appContainer, options, func(line LogLine) error {
+				select {
+				case lines <- line:
+					return nil
+				case <-tasksCtx.Done():
+					return tasksCtx.Err()
+				}
+			})
+		})
+	}
+	go func() {
+		_ = tasks.Wait()
+		close(lines)
+	}()
+
+	for line := range lines {
+		if err := onLine(line); err != nil {
+			// Stops following the remaining containers, draining any lines they're waiting to send so they can finish
+			cancel()
+			go func() {
+				for range lines {
+				}
+			}()
+			return err
+		}
+	}
+	if err := tasks.Wait(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// containerLogs reads the logs of a single container, separating stdout and stderr
+func containerLogs(
+	ctx context.Context,
+	dockerClient *client.Client,
+	appContainer types.Container,
+	options LogOptions,
+	onLine func(line LogLine) error,
+) error {
+	inspect, err := dockerClient.ContainerInspect(ctx, appContainer.ID)
+	if err != nil {
+		return err
+	}
+
+	logs, err := dockerClient.ContainerLogs(ctx, appContainer.ID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Since:      options.Since,
+		Until:      options.Until,
+		Tail:       options.Tail,
+		Follow:     options.Follow,
+		Timestamps: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	name := containerName(appContainer)
+	stdout := &logWriter{container: name, stream: StreamStdout, onLine: onLine}
+	stderr := &logWriter{container: name, stream: StreamStderr, onLine: onLine}
+
+	// Containers with a TTY don't multiplex their output, with everything written to stdout
+	if inspect.Config != nil && inspect.Config.Tty {
+		_, err = io.Copy(stdout, logs)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, logs)
+	}
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	if err := stdout.flush(); err != nil {
+		return err
+	}
+	return stderr.flush()
+}
+
+// logWriter splits the output of a container into lines, parsing the timestamp docker adds to the start of each
+type logWriter struct {
+	container string
+	stream    string
+	onLine    func(line LogLine) error
+	buffer    bytes.Buffer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buffer.Write(p)
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err == io.EOF {
+			// Keeps the incomplete line until the rest of it is written
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return len(p), nil
+		}
+		if err := w.writeLine(strings.TrimSuffix(line, "\n")); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// flush writes any remaining output that didn't end with a newline
+func (w *logWriter) flush() error {
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	line := w.buffer.String()
+	w.buffer.Reset()
+	return w.writeLine(line)
+}
+
+func (w *logWriter) writeLine(line string) error {
+	logLine := LogLine{Container: w.container, Stream: w.stream, Text: line}
+	if timestamp, text, ok := strings.Cut(line, " "); ok {
+		if parsed, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+			logLine.Time = parsed
+			logLine.Text = text
+		}
+	}
+	return w.onLine(logLine)
+}
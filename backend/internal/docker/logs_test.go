@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Tests container output is split into lines with their timestamps, including lines split across writes
+func TestLogWriter(t *testing.T) {
+	var lines []LogLine
+	writer := &logWriter{container: "server", stream: StreamStderr, onLine: func(line LogLine) error {
+		lines = append(lines, line)
+		return nil
+	}}
+
+	writes := []string{
+		"2025-01-02T10:00:00.5Z Starting server\n2025-01-02T10:00:01Z Listen",
+		"ing on port 80\n",
+		"no timestamp\n",
+		"2025-01-02T10:00:02Z Shutting down",
+	}
+	for _, write := range writes {
+		if _, err := writer.Write([]byte(write)); err != nil {
+			t.Fatalf("Unexpected error writing logs: %s", err.Error())
+		}
+	}
+	if err := writer.flush(); err != nil {
+		t.Fatalf("Unexpected error flushing logs: %s", err.Error())
+	}
+
+	expected := []LogLine{
+		{Container: "server", Stream: StreamStderr, Time: time.Date(2025, 1, 2, 10, 0, 0, 500_000_000, time.UTC), Text: "Starting server"},
+		{Container: "server", Stream: StreamStderr, Time: time.Date(2025, 1, 2, 10, 0, 1, 0, time.UTC), Text: "Listening on port 80"},
+		{Container: "server", Stream: StreamStderr, Text: "no timestamp"},
+		{Container: "server", Stream: StreamStderr, Time: time.Date(2025, 1, 2, 10, 0, 2, 0, time.UTC), Text: "Shutting down"},
+	}
+	if diff := cmp.Diff(expected, lines); diff != "" {
+		t.Errorf("Log lines mismatch (-want +got):\n%s", diff)
+	}
+}
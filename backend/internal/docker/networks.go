@@ -19,21 +19,31 @@ func GetOrCreateNetwork(
 	networkName string,
 	labels map[string]string,
 ) (string, error) {
-	var networkId string
+	networkId, _, err := getOrCreateNetwork(ctx, dockerClient, networkName, labels)
+	return networkId, err
+}
+
+// getOrCreateNetwork retrieves the ID of the specified docker network, creating it if it doesn't exist. Also returns
+// whether the network was created
+func getOrCreateNetwork(
+	ctx context.Context,
+	dockerClient *client.Client,
+	networkName string,
+	labels map[string]string,
+) (string, bool, error) {
 	networkInspect, err := dockerClient.NetworkInspect(ctx, networkName, network.InspectOptions{})
+	if err == nil {
+		return networkInspect.ID, false, nil
+	}
+
+	networkVar, err := dockerClient.NetworkCreate(ctx, networkName, network.CreateOptions{
+		Labels: labels,
+	})
 	if err != nil {
-		networkVar, err := dockerClient.NetworkCreate(ctx, networkName, network.CreateOptions{
-			Labels: labels,
-		})
-		if err != nil {
-			return "", err
-		}
-		networkId = networkVar.ID
-	} else {
-		networkId = networkInspect.ID
+		return "", false, err
 	}
 
-	return networkId, nil
+	return networkVar.ID, true, nil
 }
 
 // ConnectProxyNetworks connects all proxy networks to the backend contain to allow apps to be reverse proxied
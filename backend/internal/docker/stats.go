@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// ContainerStats is a single reading of a running container's resource usage, labelled with the app it belongs to
+type ContainerStats struct {
+	ContainerID string
+	AppID       string
+	Stats       container.StatsResponse
+}
+
+// AllAppStats reads the current resource usage of every running container belonging to an app
+func AllAppStats(ctx context.Context, dockerClient *client.Client) ([]ContainerStats, error) {
+	containers, err := dockerClient.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", APP_ID_LABEL)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []ContainerStats
+	for _, appContainer := range containers {
+		response, err := dockerClient.ContainerStatsOneShot(ctx, appContainer.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stats for %s: %w", appContainer.ID, err)
+		}
+
+		var containerStats container.StatsResponse
+		err = json.NewDecoder(response.Body).Decode(&containerStats)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode stats for %s: %w", appContainer.ID, err)
+		}
+
+		stats = append(stats, ContainerStats{
+			ContainerID: appContainer.ID,
+			AppID:       appContainer.Labels[APP_ID_LABEL],
+			Stats:       containerStats,
+		})
+	}
+
+	return stats, nil
+}
+
+// VolumeUsage is the disk space used by a docker volume
+type VolumeUsage struct {
+	Name  string `json:"name"`
+	AppID string `json:"app_id"`
+	Size  int64  `json:"size"`
+}
+
+// DiskUsage is the disk space used by docker, as reported by docker system df
+type DiskUsage struct {
+	Volumes    []VolumeUsage `json:"volumes"`
+	ImagesSize int64         `json:"images_size"`
+}
+
+// GetDiskUsage retrieves the size of every volume and the total size of images. Volumes not created by an app have no
+// app ID
+func GetDiskUsage(ctx context.Context, dockerClient *client.Client) (DiskUsage, error) {
+	usage, err := dockerClient.DiskUsage(ctx, types.DiskUsageOptions{
+		Types: []types.DiskUsageObject{types.VolumeObject, types.ImageObject},
+	})
+	if err != nil {
+		return DiskUsage{}, err
+	}
+
+	diskUsage := DiskUsage{Volumes: []VolumeUsage{}, ImagesSize: usage.LayersSize}
+	for _, dockerVolume := range usage.Volumes {
+		volumeUsage := VolumeUsage{Name: dockerVolume.Name, AppID: dockerVolume.Labels[APP_ID_LABEL]}
+		if dockerVolume.UsageData != nil && dockerVolume.UsageData.Size > 0 {
+			volumeUsage.Size = dockerVolume.UsageData.Size
+		}
+		diskUsage.Volumes = append(diskUsage.Volumes, volumeUsage)
+	}
+	return diskUsage, nil
+}
@@ -0,0 +1,67 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// ContainerStatus is the current state of one of an app's containers. Health is empty for containers without a
+// healthcheck
+type ContainerStatus struct {
+	ID            string
+	Name          string
+	State         State
+	Health        string
+	ExitCode      int
+	RestartPolicy container.RestartPolicyMode
+}
+
+// AppContainerStatuses retrieves the current state of each of an app's containers
+func AppContainerStatuses(ctx context.Context, dockerClient *client.Client, appId string) ([]ContainerStatus, error) {
+	containers, err := dockerClient.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(AppFilter(appId)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]ContainerStatus, 0, len(containers))
+	for _, appContainer := range containers {
+		info, err := dockerClient.ContainerInspect(ctx, appContainer.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect container %s: %w", appContainer.ID, err)
+		}
+
+		status := ContainerStatus{
+			ID:       info.ID,
+			Name:     info.Config.Labels[ContainerNameLabel],
+			State:    State(info.State.Status),
+			ExitCode: info.State.ExitCode,
+		}
+		if info.State.Health != nil {
+			status.Health = info.State.Health.Status
+		}
+		if info.HostConfig != nil {
+			status.RestartPolicy = info.HostConfig.RestartPolicy.Name
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// AppEvents subscribes to the events of all containers belonging to apps
+func AppEvents(ctx context.Context, dockerClient *client.Client) (<-chan events.Message, <-chan error) {
+	return dockerClient.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("label", APP_ID_LABEL),
+		),
+	})
+}
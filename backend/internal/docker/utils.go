@@ -11,7 +11,8 @@ import (
 	"github.com/docker/docker/errdefs"
 )
 
-// UntilRemoved waits until the specified docker container no longer exists
+// UntilRemoved waits until the specified docker container no longer exists, returning an error if the container
+// exited unsuccessfully
 func UntilRemoved(ctx context.Context, dockerClient *client.Client, containerId string) error {
 	statusCh, errCh := dockerClient.ContainerWait(ctx, containerId, container.WaitConditionRemoved)
 	select {
@@ -19,8 +20,13 @@ func UntilRemoved(ctx context.Context, dockerClient *client.Client, containerId
 		if err != nil && !errdefs.IsNotFound(err) {
 			return fmt.Errorf("error waiting for container :%s: %v", containerId, err)
 		}
-	case <-statusCh:
-		return nil
+	case status := <-statusCh:
+		if status.Error != nil {
+			return fmt.Errorf("error waiting for container %s: %s", containerId, status.Error.Message)
+		}
+		if status.StatusCode != 0 {
+			return fmt.Errorf("container %s exited with status %d", containerId, status.StatusCode)
+		}
 	}
 
 	return nil
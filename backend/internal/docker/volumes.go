@@ -2,8 +2,10 @@ package docker
 
 import (
 	"context"
+	"slices"
 
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 )
@@ -23,3 +25,22 @@ func RemoveAppVolumes(ctx context.Context, dockerClient *client.Client, appId st
 
 	return nil
 }
+
+// GetAppVolumeNames retrieves the names of the volumes mounted by the app's containers, sorted by name
+func GetAppVolumeNames(dockerClient *client.Client, appId string) ([]string, error) {
+	appContainers, err := GetAppContainers(dockerClient, appId)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, appContainer := range appContainers {
+		for _, appMount := range appContainer.Mounts {
+			if appMount.Type == mount.TypeVolume && !slices.Contains(names, appMount.Name) {
+				names = append(names, appMount.Name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
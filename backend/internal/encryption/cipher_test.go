@@ -0,0 +1,49 @@
+package encryption
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Tests encrypted values can be decrypted with the same key, and only the same key
+func TestCipher(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "secret.key")
+	key, err := LoadOrCreateKey(keyPath)
+	if err != nil {
+		t.Fatalf("Unexpected error creating key: %s", err.Error())
+	}
+
+	// The key should be saved and reused
+	loadedKey, err := LoadOrCreateKey(keyPath)
+	if err != nil {
+		t.Fatalf("Unexpected error loading key: %s", err.Error())
+	}
+	if string(key) != string(loadedKey) {
+		t.Fatal("Loaded key doesn't match created key")
+	}
+
+	cipher, err := NewCipher(key)
+	if err != nil {
+		t.Fatalf("Unexpected error creating cipher: %s", err.Error())
+	}
+	encrypted, err := cipher.Encrypt("smtp-password")
+	if err != nil {
+		t.Fatalf("Unexpected error encrypting: %s", err.Error())
+	}
+	decrypted, err := cipher.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Unexpected error decrypting: %s", err.Error())
+	}
+	if decrypted != "smtp-password" {
+		t.Errorf("Expected decrypted value smtp-password, got %s", decrypted)
+	}
+
+	otherCipher, err := NewCipher(make([]byte, KeySize))
+	if err != nil {
+		t.Fatalf("Unexpected error creating cipher: %s", err.Error())
+	}
+	if _, err := otherCipher.Decrypt(encrypted); !errors.Is(err, InvalidCiphertextError) {
+		t.Errorf("Expected invalid ciphertext error, got %v", err)
+	}
+}
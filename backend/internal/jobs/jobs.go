@@ -0,0 +1,347 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+type Type string
+
+const (
+	Install   Type = "install"
+	Update    Type = "update"
+	Backup    Type = "backup"
+	Restore   Type = "restore"
+	Configure Type = "configure"
+	Repair    Type = "repair"
+	Check     Type = "check"
+	Verify    Type = "verify"
+)
+
+type Status string
+
+const (
+	Pending    Status = "pending"
+	Running    Status = "running"
+	Completed  Status = "completed"
+	Failed     Status = "failed"
+	RolledBack Status = "rolled_back"
+)
+
+var AppBusyError = errors.New("another job is already running for this app")
+
+// RolledBackError is included in errors returned by jobs that failed but were able to undo their changes
+var RolledBackError = errors.New("changes have been rolled back")
+
+// progressSaveInterval limits how often image pull progress is written to the database, since the docker daemon
+// sends many progress messages a second. Updates are still sent to subscribers immediately
+const progressSaveInterval = time.Second
+
+// Progress is used by long-running operations to report what they're currently doing
+type Progress interface {
+	// Step marks the previous step as complete and begins a new one
+	Step(name string)
+	// PullProgress records a progress message received while pulling the given image
+	PullProgress(image string, message jsonmessage.JSONMessage)
+}
+
+type discardProgress struct{}
+
+func (discardProgress) Step(string)                                  {}
+func (discardProgress) PullProgress(string, jsonmessage.JSONMessage) {}
+
+// Discard is a Progress which ignores all updates, for running operations outside a job
+var Discard Progress = discardProgress{}
+
+// IsFinished checks whether the given job status is final
+func IsFinished(status string) bool {
+	return status == string(Completed) || status == string(Failed) || status == string(RolledBack)
+}
+
+// Manager runs jobs in the background, storing their state in the database and sending updates to subscribers
+type Manager struct {
+	queries     *persistence.Queries
+	mu          sync.Mutex
+	activeApps  map[string]string
+	running     map[string]*Job
+	subscribers map[string][]chan persistence.JobDetails
+	finishHook  func(details persistence.JobDetails, duration time.Duration)
+}
+
+func NewManager(queries *persistence.Queries) *Manager {
+	return &Manager{
+		queries:     queries,
+		activeApps:  make(map[string]string),
+		running:     make(map[string]*Job),
+		subscribers: make(map[string][]chan persistence.JobDetails),
+	}
+}
+
+// SetFinishHook sets a function called with the final state of each job and how long it ran for, such as for
+// recording metrics
+func (m *Manager) SetFinishHook(hook func(details persistence.JobDetails, duration time.Duration)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finishHook = hook
+}
+
+// FailInterrupted marks jobs that were still running when the server stopped as failed
+func (m *Manager) FailInterrupted(ctx context.Context) error {
+	return m.queries.FailInterruptedJobs(ctx)
+}
+
+// Start creates a job and runs it in the background, returning the initial state of the job. Only one job can run
+// for an app at a time, AppBusyError is returned if one is already running
+func (m *Manager) Start(
+	jobType Type,
+	appId string,
+	run func(ctx context.Context, progress Progress) error,
+) (persistence.JobDetails, error) {
+	id, err := newJobId()
+	if err != nil {
+		return persistence.JobDetails{}, err
+	}
+
+	m.mu.Lock()
+	if _, ok := m.activeApps[appId]; ok {
+		m.mu.Unlock()
+		return persistence.JobDetails{}, AppBusyError
+	}
+	m.activeApps[appId] = id
+	m.mu.Unlock()
+
+	err = m.queries.CreateJob(context.Background(), persistence.CreateJobParams{
+		ID:     id,
+		Type:   string(jobType),
+		AppID:  appId,
+		Status: string(Running),
+	})
+	if err != nil {
+		m.mu.Lock()
+		delete(m.activeApps, appId)
+		m.mu.Unlock()
+		return persistence.JobDetails{}, fmt.Errorf("error creating job: %w", err)
+	}
+
+	now := time.Now().Unix()
+	job := &Job{
+		manager: m,
+		started: time.Now(),
+		details: persistence.JobDetails{
+			Job: persistence.Job{
+				ID:        id,
+				Type:      string(jobType),
+				AppID:     appId,
+				Status:    string(Running),
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			Steps:    []persistence.JobStep{},
+			Progress: map[string]persistence.LayerProgress{},
+		},
+	}
+
+	m.mu.Lock()
+	m.running[id] = job
+	m.mu.Unlock()
+
+	go func() {
+		err := run(context.Background(), job)
+		job.finish(err)
+
+		// Removes the job from the active list and closes subscriptions, letting subscribers know it's finished
+		m.mu.Lock()
+		delete(m.activeApps, appId)
+		delete(m.running, id)
+		for _, subscriber := range m.subscribers[id] {
+			close(subscriber)
+		}
+		delete(m.subscribers, id)
+		finishHook := m.finishHook
+		m.mu.Unlock()
+
+		if finishHook != nil {
+			finishHook(job.snapshot(), time.Since(job.started))
+		}
+	}()
+
+	return job.snapshot(), nil
+}
+
+// Active checks whether a job is currently running for the given app
+func (m *Manager) Active(appId string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.activeApps[appId]
+	return ok
+}
+
+// Get retrieves the current state of the given job, using the in memory state for running jobs as the database is
+// only periodically updated with pull progress
+func (m *Manager) Get(ctx context.Context, id string) (persistence.JobDetails, error) {
+	m.mu.Lock()
+	job, ok := m.running[id]
+	m.mu.Unlock()
+	if ok {
+		return job.snapshot(), nil
+	}
+
+	return m.queries.GetJob(ctx, id)
+}
+
+// Subscribe returns a channel receiving updates for the given job, which is closed when the job finishes. If the job
+// isn't running the returned channel is already closed. The returned function must be called to unsubscribe
+func (m *Manager) Subscribe(id string) (<-chan persistence.JobDetails, func()) {
+	updates := make(chan persistence.JobDetails, 16)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.running[id]; !ok {
+		close(updates)
+		return updates, func() {}
+	}
+	m.subscribers[id] = append(m.subscribers[id], updates)
+
+	return updates, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, subscriber := range m.subscribers[id] {
+			if subscriber == updates {
+				m.subscribers[id] = append(m.subscribers[id][:i], m.subscribers[id][i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// publish sends the job state to all subscribers, skipping those that aren't keeping up
+func (m *Manager) publish(details persistence.JobDetails) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, subscriber := range m.subscribers[details.ID] {
+		select {
+		case subscriber <- details:
+		default:
+		}
+	}
+}
+
+// Job is a single running job, implementing Progress to record its state
+type Job struct {
+	manager   *Manager
+	mu        sync.Mutex
+	details   persistence.JobDetails
+	started   time.Time
+	lastSaved time.Time
+}
+
+func (j *Job) Step(name string) {
+	j.mu.Lock()
+	j.completeStep()
+	j.details.Steps = append(j.details.Steps, persistence.JobStep{Name: name, Status: string(Running)})
+	j.mu.Unlock()
+
+	j.update(true)
+}
+
+func (j *Job) PullProgress(image string, message jsonmessage.JSONMessage) {
+	// Messages without an ID are about the image as a whole, such as the digest, rather than a layer
+	if message.ID == "" {
+		return
+	}
+
+	j.mu.Lock()
+	layer := j.details.Progress[message.ID]
+	layer.Image = image
+	layer.Status = message.Status
+	if message.Progress != nil {
+		layer.Current = message.Progress.Current
+		layer.Total = message.Progress.Total
+	}
+	j.details.Progress[message.ID] = layer
+	save := time.Since(j.lastSaved) > progressSaveInterval
+	j.mu.Unlock()
+
+	j.update(save)
+}
+
+// completeStep marks the current step as completed, the lock must be held by the caller
+func (j *Job) completeStep() {
+	if len(j.details.Steps) > 0 {
+		current := &j.details.Steps[len(j.details.Steps)-1]
+		if current.Status == string(Running) {
+			current.Status = string(Completed)
+		}
+	}
+}
+
+// finish sets the final status of the job based on the error returned by it
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	if err != nil {
+		j.details.Status = string(Failed)
+		if errors.Is(err, RolledBackError) {
+			j.details.Status = string(RolledBack)
+		}
+		j.details.Error = err.Error()
+		if len(j.details.Steps) > 0 {
+			current := &j.details.Steps[len(j.details.Steps)-1]
+			current.Status = string(Failed)
+			current.Error = err.Error()
+		}
+		slog.Error(fmt.Sprintf("%s job %s for %s failed: %s", j.details.Type, j.details.ID, j.details.AppID, err.Error()))
+	} else {
+		j.completeStep()
+		j.details.Status = string(Completed)
+	}
+	j.mu.Unlock()
+
+	j.update(true)
+}
+
+// update sends the current job state to subscribers, and optionally saves it to the database
+func (j *Job) update(save bool) {
+	details := j.snapshot()
+	if save {
+		if err := j.manager.queries.SaveJob(context.Background(), details); err != nil {
+			slog.Error(fmt.Sprintf("error saving job %s: %s", details.ID, err.Error()))
+		}
+		j.mu.Lock()
+		j.lastSaved = time.Now()
+		j.mu.Unlock()
+	}
+	j.manager.publish(details)
+}
+
+// snapshot creates a copy of the job state that can be safely passed to other goroutines
+func (j *Job) snapshot() persistence.JobDetails {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	details := j.details
+	details.UpdatedAt = time.Now().Unix()
+	details.Steps = append([]persistence.JobStep{}, j.details.Steps...)
+	details.Progress = make(map[string]persistence.LayerProgress, len(j.details.Progress))
+	for layer, progress := range j.details.Progress {
+		details.Progress[layer] = progress
+	}
+	return details
+}
+
+func newJobId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
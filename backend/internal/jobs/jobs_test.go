@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/google/go-cmp/cmp"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// Tests a job records its steps and progress, and that only one job can run for an app at a time
+func TestStartJob(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	manager := NewManager(queries)
+	release := make(chan struct{})
+	job, err := manager.Start(Install, "traefik.whoami", func(ctx context.Context, progress Progress) error {
+		progress.Step("Downloading images")
+		progress.PullProgress("traefik/whoami:v1.10.3", jsonmessage.JSONMessage{
+			ID:       "abc123",
+			Status:   "Downloading",
+			Progress: &jsonmessage.JSONProgress{Current: 50, Total: 100},
+		})
+		<-release
+		progress.Step("Starting app")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error starting job: %s", err.Error())
+	}
+
+	updates, unsubscribe := manager.Subscribe(job.ID)
+	defer unsubscribe()
+
+	_, err = manager.Start(Update, "traefik.whoami", func(ctx context.Context, progress Progress) error {
+		return nil
+	})
+	if !errors.Is(err, AppBusyError) {
+		t.Fatalf("Expected AppBusyError starting second job, got: %v", err)
+	}
+
+	close(release)
+	for range updates {
+	}
+
+	finalJob, err := queries.GetJob(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving job: %s", err.Error())
+	}
+
+	if finalJob.Status != string(Completed) {
+		t.Fatalf("Expected job status %s, got %s", Completed, finalJob.Status)
+	}
+
+	expectedSteps := []persistence.JobStep{
+		{Name: "Downloading images", Status: string(Completed)},
+		{Name: "Starting app", Status: string(Completed)},
+	}
+	if diff := cmp.Diff(expectedSteps, finalJob.Steps); diff != "" {
+		t.Errorf("Job steps mismatch (-want +got):\n%s", diff)
+	}
+
+	expectedProgress := map[string]persistence.LayerProgress{
+		"abc123": {Image: "traefik/whoami:v1.10.3", Status: "Downloading", Current: 50, Total: 100},
+	}
+	if diff := cmp.Diff(expectedProgress, finalJob.Progress); diff != "" {
+		t.Errorf("Job progress mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Tests a failing job records the error against the step it failed on
+func TestFailedJob(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	manager := NewManager(queries)
+	job, err := manager.Start(Backup, "traefik.whoami", func(ctx context.Context, progress Progress) error {
+		progress.Step("Mounting drive")
+		return errors.New("no valid drive found")
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error starting job: %s", err.Error())
+	}
+
+	updates, unsubscribe := manager.Subscribe(job.ID)
+	defer unsubscribe()
+	for range updates {
+	}
+
+	finalJob, err := manager.Get(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving job: %s", err.Error())
+	}
+
+	if finalJob.Status != string(Failed) || finalJob.Error != "no valid drive found" {
+		t.Fatalf("Unexpected final job state: %+v", finalJob)
+	}
+	if finalJob.Steps[0].Status != string(Failed) {
+		t.Fatalf("Expected failed step, got %+v", finalJob.Steps[0])
+	}
+}
+
+// Tests a job that undid its changes after failing is marked as rolled back
+func TestRolledBackJob(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	manager := NewManager(queries)
+	job, err := manager.Start(Update, "traefik.whoami", func(ctx context.Context, progress Progress) error {
+		progress.Step("Starting app")
+		return fmt.Errorf("container failed to become healthy, %w", RolledBackError)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error starting job: %s", err.Error())
+	}
+
+	updates, unsubscribe := manager.Subscribe(job.ID)
+	defer unsubscribe()
+	for range updates {
+	}
+
+	finalJob, err := manager.Get(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving job: %s", err.Error())
+	}
+
+	if finalJob.Status != string(RolledBack) {
+		t.Fatalf("Expected job status %s, got %s", RolledBack, finalJob.Status)
+	}
+}
@@ -1,6 +1,7 @@
 package launcher
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -13,8 +14,11 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 
 	"github.com/An-Owlbear/homecloud/backend/internal/apps"
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
 	"github.com/An-Owlbear/homecloud/backend/internal/networking"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
 )
 
 func AddRoutes(
@@ -33,6 +37,11 @@ func AddRoutes(
 	e.POST("/api/v1/set_subdomain", SetSubdomainHandler(dockerClient, storeClient, hostConfig, oryConfig, storageConfig, launcherEnvConfig, deviceConfig, launcherConfig))
 	e.POST("/api/v1/check_subdomain", CheckSubdomain())
 	e.GET("/api/v1/current_subdomain", GetRegisteredDomain(launcherConfig))
+	e.GET("/api/v1/restore/devices", ListRestoreDevices())
+	e.GET("/api/v1/restore/backups", ListSystemBackups())
+	systemRestore := NewSystemRestore()
+	e.GET("/api/v1/restore", GetRestoreStatus(systemRestore))
+	e.POST("/api/v1/restore", RestoreSystemHandler(dockerClient, storageConfig, launcherConfig, systemRestore))
 
 	e.Use(middleware.StaticWithConfig(middleware.StaticConfig{
 		Root:  "launcher_spa",
@@ -194,3 +203,95 @@ func GetRegisteredDomain(launcherConfig *Config) echo.HandlerFunc {
 		return c.JSON(http.StatusOK, getRegisteredDomainResponse{Subdomain: launcherConfig.Subdomain})
 	}
 }
+
+// ListRestoreDevices lists the removable drives system backups can be restored from
+func ListRestoreDevices() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		devices, err := storage.ListExternalStorage()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, devices)
+	}
+}
+
+type listSystemBackupsRequest struct {
+	Device string `query:"device"`
+}
+
+// ListSystemBackups lists the system backups on a removable drive. The passphrase isn't needed to list them
+func ListSystemBackups() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req listSystemBackupsRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		targetConfig := backup.DriveTargetConfig(req.Device)
+		if err := targetConfig.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		target, err := backup.Open(c.Request().Context(), targetConfig)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		defer target.Close()
+
+		backups, err := backup.ListSnapshots(c.Request().Context(), target, apps.SystemBackupId)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, backups)
+	}
+}
+
+type restoreSystemRequest struct {
+	Device     string `json:"device"`
+	Passphrase string `json:"passphrase"`
+	Backup     string `json:"backup"`
+}
+
+// RestoreSystemHandler starts restoring a system backup from a removable drive onto this device, which must not have
+// been set up yet. The restore runs in the background, with its progress retrieved by GetRestoreStatus. The system is
+// started once an address is registered, as during a normal setup
+func RestoreSystemHandler(
+	dockerClient *client.Client,
+	storageConfig config.Storage,
+	launcherConfig *Config,
+	systemRestore *SystemRestore,
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req restoreSystemRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+		if launcherConfig.Subdomain != "" {
+			return echo.NewHTTPError(http.StatusConflict, apps.SystemInstalledError.Error())
+		}
+
+		target := backup.DriveTargetConfig(req.Device)
+		target.Passphrase = req.Passphrase
+		if err := target.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		status, err := systemRestore.Start(func(ctx context.Context, progress jobs.Progress) ([]string, error) {
+			return apps.RestoreSystem(ctx, progress, dockerClient, storageConfig, target, req.Backup)
+		})
+		if errors.Is(err, RestoreRunningError) || errors.Is(err, RestoreCompletedError) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSON(http.StatusAccepted, status)
+	}
+}
+
+// GetRestoreStatus retrieves the progress of the system restore, and the restored apps once it's complete
+func GetRestoreStatus(systemRestore *SystemRestore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, systemRestore.Status())
+	}
+}
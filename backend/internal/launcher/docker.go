@@ -23,12 +23,10 @@ import (
 	"github.com/An-Owlbear/homecloud/backend/internal/storage"
 )
 
-var appPackages = []string{"ory.kratos", "ory.hydra", "homecloud.app"}
-
 // StopContainers used to ensure all containers are stopped during startup. This is mainly to allow for checking
 // port forwarding
 func StopContainers(dockerClient *client.Client) error {
-	for _, packageName := range appPackages {
+	for _, packageName := range docker.SystemApps {
 		if err := docker.StopApp(dockerClient, packageName); err != nil {
 			return err
 		}
@@ -45,7 +43,7 @@ func StartContainers(
 	launcherConfig config.LauncherEnv,
 ) error {
 	// Installs ory hydra and kratos
-	for _, packageName := range appPackages {
+	for _, packageName := range docker.SystemApps {
 		// Retrieves package definition
 		appPackage, err := storeClient.GetPackage(packageName)
 		if err != nil {
@@ -117,7 +115,7 @@ func TemplateInstall(
 	}
 
 	var templatedApp bytes.Buffer
-	err = storage.ApplyAppTemplate(string(appSchema), &templatedApp, appPackage, "", "", oryConfig, hostConfig, storageConfig)
+	err = storage.ApplyAppTemplate(string(appSchema), &templatedApp, appPackage, "", "", oryConfig, hostConfig, storageConfig, nil, nil)
 	if err != nil {
 		return err
 	}
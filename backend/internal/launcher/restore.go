@@ -0,0 +1,104 @@
+package launcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+var RestoreRunningError = errors.New("a system restore is already running")
+var RestoreCompletedError = errors.New("a system backup has already been restored")
+
+// RestoreStatus is the progress of a system restore, which the setup page polls while the restore runs. The status is
+// empty until a restore is started
+type RestoreStatus struct {
+	Status string                `json:"status"`
+	Steps  []persistence.JobStep `json:"steps"`
+	Apps   []string              `json:"apps"`
+	Error  string                `json:"error,omitempty"`
+}
+
+// SystemRestore runs a system restore in the background, since restoring every app's data can take much longer than
+// a request. Only one restore can run at once, and once a restore completes another can't be started
+type SystemRestore struct {
+	mu     sync.Mutex
+	status RestoreStatus
+}
+
+func NewSystemRestore() *SystemRestore {
+	return &SystemRestore{status: RestoreStatus{Steps: []persistence.JobStep{}, Apps: []string{}}}
+}
+
+// Status retrieves a copy of the current status
+func (r *SystemRestore) Status() RestoreStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.status
+	status.Steps = append([]persistence.JobStep{}, r.status.Steps...)
+	return status
+}
+
+// Start runs the restore in the background with its own context, so it isn't cancelled when the request starting it
+// finishes. Failed restores can be retried
+func (r *SystemRestore) Start(run func(ctx context.Context, progress jobs.Progress) ([]string, error)) (RestoreStatus, error) {
+	r.mu.Lock()
+	switch r.status.Status {
+	case string(jobs.Running):
+		r.mu.Unlock()
+		return RestoreStatus{}, RestoreRunningError
+	case string(jobs.Completed):
+		r.mu.Unlock()
+		return RestoreStatus{}, RestoreCompletedError
+	}
+	r.status = RestoreStatus{Status: string(jobs.Running), Steps: []persistence.JobStep{}, Apps: []string{}}
+	r.mu.Unlock()
+
+	go func() {
+		restored, err := run(context.Background(), r)
+		r.finish(restored, err)
+	}()
+	return r.Status(), nil
+}
+
+// Step marks the previous step as complete and begins a new one
+func (r *SystemRestore) Step(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completeStep(jobs.Completed, "")
+	r.status.Steps = append(r.status.Steps, persistence.JobStep{Name: name, Status: string(jobs.Running)})
+}
+
+// PullProgress ignores the progress of pulling images, since the only image pulled for a restore is small
+func (r *SystemRestore) PullProgress(string, jsonmessage.JSONMessage) {}
+
+func (r *SystemRestore) finish(restored []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.completeStep(jobs.Failed, err.Error())
+		r.status.Status = string(jobs.Failed)
+		r.status.Error = err.Error()
+		return
+	}
+
+	r.completeStep(jobs.Completed, "")
+	r.status.Status = string(jobs.Completed)
+	r.status.Apps = restored
+}
+
+// completeStep sets the status of the current step, if it's still running
+func (r *SystemRestore) completeStep(status jobs.Status, message string) {
+	if len(r.status.Steps) == 0 {
+		return
+	}
+	current := &r.status.Steps[len(r.status.Steps)-1]
+	if current.Status == string(jobs.Running) {
+		current.Status = string(status)
+		current.Error = message
+	}
+}
@@ -0,0 +1,313 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// Resolutions are the length of time each stored sample covers
+const (
+	Minute = time.Minute
+	Hour   = time.Hour
+	Day    = 24 * time.Hour
+)
+
+// retention is how long samples of each resolution are kept for. Minute samples are averaged into hourly samples, and
+// hourly samples into daily samples, so longer periods of history take up less space
+var retention = map[time.Duration]time.Duration{
+	Minute: 24 * time.Hour,
+	Hour:   30 * 24 * time.Hour,
+	Day:    365 * 24 * time.Hour,
+}
+
+// Usage is the resource usage of one or more containers. CPU usage is a percentage of one CPU, and network and block
+// IO are in bytes per second
+type Usage struct {
+	CpuPercent  float64 `json:"cpu_percent"`
+	MemoryBytes int64   `json:"memory_bytes"`
+	NetworkRx   float64 `json:"network_rx"`
+	NetworkTx   float64 `json:"network_tx"`
+	BlockRead   float64 `json:"block_read"`
+	BlockWrite  float64 `json:"block_write"`
+}
+
+func (u *Usage) add(other Usage) {
+	u.CpuPercent += other.CpuPercent
+	u.MemoryBytes += other.MemoryBytes
+	u.NetworkRx += other.NetworkRx
+	u.NetworkTx += other.NetworkTx
+	u.BlockRead += other.BlockRead
+	u.BlockWrite += other.BlockWrite
+}
+
+// Sample is the resource usage of all of an app's containers at a point in time
+type Sample struct {
+	AppID string    `json:"app_id"`
+	Time  time.Time `json:"time"`
+	Usage
+}
+
+func sampleFromMetric(metric persistence.AppMetric) Sample {
+	return Sample{
+		AppID: metric.AppID,
+		Time:  time.Unix(metric.Timestamp, 0).UTC(),
+		Usage: Usage{
+			CpuPercent:  metric.CpuPercent,
+			MemoryBytes: metric.MemoryBytes,
+			NetworkRx:   metric.NetworkRx,
+			NetworkTx:   metric.NetworkTx,
+			BlockRead:   metric.BlockRead,
+			BlockWrite:  metric.BlockWrite,
+		},
+	}
+}
+
+// counters are the cumulative values read from a container, used to calculate usage since the previous reading
+type counters struct {
+	read       time.Time
+	cpuUsage   uint64
+	systemCpu  uint64
+	networkRx  uint64
+	networkTx  uint64
+	blockRead  uint64
+	blockWrite uint64
+}
+
+// Collector periodically samples the resource usage of every app's containers, storing the history in the database
+type Collector struct {
+	dockerClient *client.Client
+	queries      *persistence.Queries
+
+	mu       sync.RWMutex
+	previous map[string]counters
+	latest   map[string]Sample
+}
+
+func NewCollector(dockerClient *client.Client, queries *persistence.Queries) *Collector {
+	return &Collector{
+		dockerClient: dockerClient,
+		queries:      queries,
+		previous:     make(map[string]counters),
+		latest:       make(map[string]Sample),
+	}
+}
+
+// Run samples resource usage every minute until the context is cancelled
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(Minute)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Collect(ctx, time.Now()); err != nil {
+			slog.Error(fmt.Sprintf("Failed to collect app metrics: %s", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect reads the current usage of every app's containers and stores it, updating the downsampled history and
+// removing samples older than their retention period
+func (c *Collector) Collect(ctx context.Context, now time.Time) error {
+	stats, err := docker.AllAppStats(ctx, c.dockerClient)
+	if err != nil {
+		return err
+	}
+
+	samples := c.aggregate(stats, now)
+	for _, sample := range samples {
+		err := c.queries.SetAppMetric(ctx, persistence.SetAppMetricParams{
+			AppID:       sample.AppID,
+			Resolution:  int64(Minute.Seconds()),
+			Timestamp:   now.Truncate(Minute).Unix(),
+			CpuPercent:  sample.CpuPercent,
+			MemoryBytes: sample.MemoryBytes,
+			NetworkRx:   sample.NetworkRx,
+			NetworkTx:   sample.NetworkTx,
+			BlockRead:   sample.BlockRead,
+			BlockWrite:  sample.BlockWrite,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return Downsample(ctx, c.queries, now)
+}
+
+// Latest retrieves the most recent sample of each running app
+func (c *Collector) Latest() map[string]Sample {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return maps.Clone(c.latest)
+}
+
+// aggregate calculates the usage of each container since its previous reading and sums it for each app. Containers
+// read for the first time only contribute their memory usage, since the others need a previous reading
+func (c *Collector) aggregate(stats []docker.ContainerStats, now time.Time) map[string]Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	samples := make(map[string]Sample)
+	current := make(map[string]counters)
+	for _, containerStats := range stats {
+		sample, ok := samples[containerStats.AppID]
+		if !ok {
+			sample = Sample{AppID: containerStats.AppID, Time: now}
+		}
+
+		reading := readCounters(containerStats.Stats, now)
+		current[containerStats.ContainerID] = reading
+		usage := Usage{MemoryBytes: int64(memoryUsage(containerStats.Stats.MemoryStats))}
+		if previous, ok := c.previous[containerStats.ContainerID]; ok {
+			seconds := reading.read.Sub(previous.read).Seconds()
+			usage.CpuPercent = cpuPercent(previous, reading, containerStats.Stats.CPUStats)
+			usage.NetworkRx = rate(previous.networkRx, reading.networkRx, seconds)
+			usage.NetworkTx = rate(previous.networkTx, reading.networkTx, seconds)
+			usage.BlockRead = rate(previous.blockRead, reading.blockRead, seconds)
+			usage.BlockWrite = rate(previous.blockWrite, reading.blockWrite, seconds)
+		}
+		sample.add(usage)
+		samples[containerStats.AppID] = sample
+	}
+
+	// Containers that have stopped are forgotten, along with apps that are no longer running
+	c.previous = current
+	c.latest = samples
+	return samples
+}
+
+// Downsample averages the minute samples into hourly samples and hourly samples into daily samples, then removes
+// samples older than their retention. The current and previous period are recalculated each time, so samples for the
+// current hour and day are kept up to date
+func Downsample(ctx context.Context, queries *persistence.Queries, now time.Time) error {
+	rollups := []struct{ from, to time.Duration }{{Minute, Hour}, {Hour, Day}}
+	for _, rollup := range rollups {
+		err := queries.RollupAppMetrics(ctx, persistence.RollupAppMetricsParams{
+			ToResolution:   int64(rollup.to.Seconds()),
+			FromResolution: int64(rollup.from.Seconds()),
+			Since:          now.Truncate(rollup.to).Add(-rollup.to).Unix(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to downsample metrics: %w", err)
+		}
+	}
+
+	for resolution, keep := range retention {
+		err := queries.DeleteOldAppMetrics(ctx, persistence.DeleteOldAppMetricsParams{
+			Resolution: int64(resolution.Seconds()),
+			Before:     now.Add(-keep).Unix(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove old metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// History retrieves the samples of an app covering the given period, using the finest resolution still kept for the
+// whole period
+func History(ctx context.Context, queries *persistence.Queries, appId string, period time.Duration, now time.Time) ([]Sample, error) {
+	resolution := Day
+	for _, candidate := range []time.Duration{Minute, Hour} {
+		if period <= retention[candidate] {
+			resolution = candidate
+			break
+		}
+	}
+
+	metrics, err := queries.GetAppMetrics(ctx, persistence.GetAppMetricsParams{
+		AppID:      appId,
+		Resolution: int64(resolution.Seconds()),
+		Since:      now.Add(-period).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]Sample, len(metrics))
+	for i, metric := range metrics {
+		samples[i] = sampleFromMetric(metric)
+	}
+	return samples, nil
+}
+
+func readCounters(stats container.StatsResponse, now time.Time) counters {
+	reading := counters{
+		read:      stats.Read,
+		cpuUsage:  stats.CPUStats.CPUUsage.TotalUsage,
+		systemCpu: stats.CPUStats.SystemUsage,
+	}
+	if reading.read.IsZero() {
+		reading.read = now
+	}
+
+	for _, network := range stats.Networks {
+		reading.networkRx += network.RxBytes
+		reading.networkTx += network.TxBytes
+	}
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			reading.blockRead += entry.Value
+		case "write":
+			reading.blockWrite += entry.Value
+		}
+	}
+	return reading
+}
+
+// cpuPercent calculates the CPU usage between two readings the same way as docker stats, where 100% is one CPU
+func cpuPercent(previous counters, current counters, cpuStats container.CPUStats) float64 {
+	if current.cpuUsage < previous.cpuUsage || current.systemCpu <= previous.systemCpu {
+		return 0
+	}
+
+	onlineCpus := float64(cpuStats.OnlineCPUs)
+	if onlineCpus == 0 {
+		onlineCpus = float64(len(cpuStats.CPUUsage.PercpuUsage))
+	}
+	if onlineCpus == 0 {
+		onlineCpus = 1
+	}
+
+	cpuDelta := float64(current.cpuUsage - previous.cpuUsage)
+	systemDelta := float64(current.systemCpu - previous.systemCpu)
+	return cpuDelta / systemDelta * onlineCpus * 100
+}
+
+// memoryUsage calculates the memory used by a container the same as docker stats, excluding the inactive page cache
+// which can be reclaimed
+func memoryUsage(memoryStats container.MemoryStats) uint64 {
+	// cgroup v1 reports total_inactive_file, while cgroup v2 reports inactive_file
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+		if inactive, ok := memoryStats.Stats[key]; ok && inactive < memoryStats.Usage {
+			return memoryStats.Usage - inactive
+		}
+	}
+	return memoryStats.Usage
+}
+
+// rate calculates the bytes per second between two cumulative readings. A counter that has gone backwards, such as
+// after a container restarts, gives no rate
+func rate(previous uint64, current uint64, seconds float64) float64 {
+	if current < previous || seconds <= 0 {
+		return 0
+	}
+	return float64(current-previous) / seconds
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/google/go-cmp/cmp"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+func testStats(read time.Time, cpuUsage uint64, systemCpu uint64, memory uint64, networkRx uint64) container.StatsResponse {
+	return container.StatsResponse{
+		Stats: container.Stats{
+			Read: read,
+			CPUStats: container.CPUStats{
+				CPUUsage:    container.CPUUsage{TotalUsage: cpuUsage},
+				SystemUsage: systemCpu,
+				OnlineCPUs:  2,
+			},
+			MemoryStats: container.MemoryStats{
+				Usage: memory,
+				Stats: map[string]uint64{"inactive_file": 100},
+			},
+		},
+		Networks: map[string]container.NetworkStats{"eth0": {RxBytes: networkRx}},
+	}
+}
+
+// Tests container usage is calculated from the previous reading and summed per app
+func TestAggregate(t *testing.T) {
+	collector := NewCollector(nil, nil)
+	start := time.Unix(1000, 0).UTC()
+	later := start.Add(time.Minute)
+
+	collector.aggregate([]docker.ContainerStats{
+		{ContainerID: "a", AppID: "app", Stats: testStats(start, 0, 0, 1100, 0)},
+		{ContainerID: "b", AppID: "app", Stats: testStats(start, 0, 0, 600, 0)},
+	}, start)
+	if first := collector.Latest()["app"]; first.CpuPercent != 0 || first.MemoryBytes != 1500 {
+		t.Errorf("Expected first sample to only contain memory usage, got %+v", first)
+	}
+
+	samples := collector.aggregate([]docker.ContainerStats{
+		{ContainerID: "a", AppID: "app", Stats: testStats(later, 50, 200, 1100, 6000)},
+		{ContainerID: "b", AppID: "app", Stats: testStats(later, 100, 200, 600, 0)},
+		{ContainerID: "c", AppID: "other", Stats: testStats(later, 100, 200, 300, 0)},
+	}, later)
+
+	expected := map[string]Sample{
+		"app": {AppID: "app", Time: later, Usage: Usage{
+			CpuPercent:  150,
+			MemoryBytes: 1500,
+			NetworkRx:   100,
+		}},
+		"other": {AppID: "other", Time: later, Usage: Usage{MemoryBytes: 200}},
+	}
+	if diff := cmp.Diff(expected, samples); diff != "" {
+		t.Errorf("Unexpected samples (-want +got):\n%s", diff)
+	}
+}
+
+// Tests minute samples are averaged into hourly samples, and history uses the finest resolution for the period
+func TestDownsampleHistory(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+	ctx := context.Background()
+
+	now := time.Unix(10*60*60+30*60, 0).UTC()
+	for i, cpu := range []float64{10, 20, 30} {
+		err := queries.SetAppMetric(ctx, persistence.SetAppMetricParams{
+			AppID:       "app",
+			Resolution:  int64(Minute.Seconds()),
+			Timestamp:   now.Add(-time.Duration(i) * time.Minute).Unix(),
+			CpuPercent:  cpu,
+			MemoryBytes: 1000,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error storing metric: %s", err.Error())
+		}
+	}
+
+	if err := Downsample(ctx, queries, now); err != nil {
+		t.Fatalf("Unexpected error downsampling metrics: %s", err.Error())
+	}
+
+	minutes, err := History(ctx, queries, "app", time.Hour, now)
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving history: %s", err.Error())
+	}
+	if len(minutes) != 3 {
+		t.Errorf("Expected 3 minute samples, got %d", len(minutes))
+	}
+
+	hours, err := History(ctx, queries, "app", 7*24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving history: %s", err.Error())
+	}
+	expected := []Sample{{
+		AppID: "app",
+		Time:  now.Truncate(time.Hour),
+		Usage: Usage{CpuPercent: 20, MemoryBytes: 1000},
+	}}
+	if diff := cmp.Diff(expected, hours); diff != "" {
+		t.Errorf("Unexpected hourly samples (-want +got):\n%s", diff)
+	}
+
+	// Minute samples are removed once older than a day
+	if err := Downsample(ctx, queries, now.Add(25*time.Hour)); err != nil {
+		t.Fatalf("Unexpected error downsampling metrics: %s", err.Error())
+	}
+	minutes, err = History(ctx, queries, "app", 48*time.Hour, now.Add(25*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error retrieving history: %s", err.Error())
+	}
+	if len(minutes) != 1 {
+		t.Errorf("Expected only the hourly sample to remain, got %d samples", len(minutes))
+	}
+}
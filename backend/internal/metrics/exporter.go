@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/apps"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// OtherHost is the host label used for requests to hosts that aren't served, to stop unknown hosts creating new series
+const OtherHost = "other"
+
+// ContentType is the content type of the Prometheus text exposition format written by Write
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Exporter records the activity of the server and reads the state of apps, writing them in the Prometheus text
+// exposition format when scraped
+type Exporter struct {
+	dockerClient *client.Client
+	queries      *persistence.Queries
+	hosts        *apps.Hosts
+	collector    *Collector
+
+	mu                 sync.Mutex
+	requests           map[string]map[int]uint64
+	requestDurations   map[string]*histogram
+	jobDurations       map[string]map[string]*histogram
+	storeRefreshes     map[string]uint64
+	lastStoreRefreshed time.Time
+}
+
+func NewExporter(
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	hosts *apps.Hosts,
+	collector *Collector,
+) *Exporter {
+	return &Exporter{
+		dockerClient:     dockerClient,
+		queries:          queries,
+		hosts:            hosts,
+		collector:        collector,
+		requests:         make(map[string]map[int]uint64),
+		requestDurations: make(map[string]*histogram),
+		jobDurations:     make(map[string]map[string]*histogram),
+		storeRefreshes:   make(map[string]uint64),
+	}
+}
+
+// ObserveRequest records a request made to the given host. Use OtherHost for hosts that aren't served
+func (e *Exporter) ObserveRequest(host string, status int, duration time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.requests[host] == nil {
+		e.requests[host] = make(map[int]uint64)
+		e.requestDurations[host] = newHistogram(requestBuckets)
+	}
+	e.requests[host][status]++
+	e.requestDurations[host].observe(duration.Seconds())
+}
+
+// ObserveJob records the duration and final status of a job, such as an install or update
+func (e *Exporter) ObserveJob(details persistence.JobDetails, duration time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.jobDurations[details.Type] == nil {
+		e.jobDurations[details.Type] = make(map[string]*histogram)
+	}
+	if e.jobDurations[details.Type][details.Status] == nil {
+		e.jobDurations[details.Type][details.Status] = newHistogram(jobBuckets)
+	}
+	e.jobDurations[details.Type][details.Status].observe(duration.Seconds())
+}
+
+// ObserveStoreRefresh records the result of refreshing the package list from the stores
+func (e *Exporter) ObserveStoreRefresh(err error, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err != nil {
+		e.storeRefreshes["failure"]++
+		return
+	}
+	e.storeRefreshes["success"]++
+	e.lastStoreRefreshed = now
+}
+
+// Write writes all metrics in the Prometheus text exposition format. The state of apps, containers and certificates
+// is read when called
+func (e *Exporter) Write(ctx context.Context, w io.Writer) error {
+	installedApps, err := e.queries.GetApps(ctx)
+	if err != nil {
+		return err
+	}
+
+	states, err := e.queries.GetAppStates(ctx)
+	if err != nil {
+		return err
+	}
+
+	containers, err := e.dockerClient.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", docker.APP_ID_LABEL)),
+	})
+	if err != nil {
+		return err
+	}
+
+	certificates, err := e.hosts.CertificateExpiry(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := &expositionWriter{w: w}
+
+	out.header("homecloud_app_status", "gauge", "Status of each installed app, set to 1 for the current status.")
+	for _, app := range installedApps {
+		out.sample("homecloud_app_status", []label{{"app_id", app.ID}, {"status", app.Status}}, 1)
+	}
+
+	out.header("homecloud_app_state", "gauge", "Observed state of each app's containers, set to 1 for the current state.")
+	for _, state := range states {
+		out.sample("homecloud_app_state", []label{{"app_id", state.AppID}, {"state", state.State}}, 1)
+	}
+	out.header("homecloud_app_restarts", "gauge", "Automatic restarts of each app since it last ran stably.")
+	for _, state := range states {
+		out.sample("homecloud_app_restarts", []label{{"app_id", state.AppID}}, float64(state.Restarts))
+	}
+
+	out.header("homecloud_container_state", "gauge", "State of each app container, set to 1 for the current state.")
+	for _, appContainer := range containers {
+		out.sample("homecloud_container_state", []label{
+			{"app_id", appContainer.Labels[docker.APP_ID_LABEL]},
+			{"container", appContainer.Labels[docker.ContainerNameLabel]},
+			{"state", appContainer.State},
+		}, 1)
+	}
+
+	latest := e.collector.Latest()
+	out.header("homecloud_app_cpu_percent", "gauge", "CPU usage of each running app, where 100 is one CPU.")
+	for _, appId := range slices.Sorted(maps.Keys(latest)) {
+		out.sample("homecloud_app_cpu_percent", []label{{"app_id", appId}}, latest[appId].CpuPercent)
+	}
+	out.header("homecloud_app_memory_bytes", "gauge", "Memory usage of each running app.")
+	for _, appId := range slices.Sorted(maps.Keys(latest)) {
+		out.sample("homecloud_app_memory_bytes", []label{{"app_id", appId}}, float64(latest[appId].MemoryBytes))
+	}
+
+	out.header("homecloud_certificate_expiry_timestamp_seconds", "gauge", "Unix time the TLS certificate of each host expires.")
+	for _, host := range slices.Sorted(maps.Keys(certificates)) {
+		out.sample("homecloud_certificate_expiry_timestamp_seconds", []label{{"host", host}}, float64(certificates[host].Unix()))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out.header("homecloud_http_requests_total", "counter", "Requests served for each host by status code.")
+	for _, host := range slices.Sorted(maps.Keys(e.requests)) {
+		for _, status := range slices.Sorted(maps.Keys(e.requests[host])) {
+			out.sample("homecloud_http_requests_total", []label{{"host", host}, {"code", strconv.Itoa(status)}}, float64(e.requests[host][status]))
+		}
+	}
+
+	out.header("homecloud_http_request_duration_seconds", "histogram", "Time taken to serve requests for each host.")
+	for _, host := range slices.Sorted(maps.Keys(e.requestDurations)) {
+		out.histogram("homecloud_http_request_duration_seconds", []label{{"host", host}}, e.requestDurations[host])
+	}
+
+	out.header("homecloud_job_duration_seconds", "histogram", "Time taken by jobs such as installs and updates, by type and final status.")
+	for _, jobType := range slices.Sorted(maps.Keys(e.jobDurations)) {
+		for _, status := range slices.Sorted(maps.Keys(e.jobDurations[jobType])) {
+			out.histogram("homecloud_job_duration_seconds", []label{{"type", jobType}, {"status", status}}, e.jobDurations[jobType][status])
+		}
+	}
+
+	out.header("homecloud_store_refreshes_total", "counter", "Attempts to refresh the package list from stores by result.")
+	for _, result := range []string{"success", "failure"} {
+		out.sample("homecloud_store_refreshes_total", []label{{"result", result}}, float64(e.storeRefreshes[result]))
+	}
+
+	out.header("homecloud_store_last_refresh_timestamp_seconds", "gauge", "Unix time of the last successful package list refresh, 0 if none since starting.")
+	lastRefreshed := 0.0
+	if !e.lastStoreRefreshed.IsZero() {
+		lastRefreshed = float64(e.lastStoreRefreshed.Unix())
+	}
+	out.sample("homecloud_store_last_refresh_timestamp_seconds", nil, lastRefreshed)
+
+	return out.err()
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// requestBuckets are the upper bounds in seconds of the request duration histogram buckets
+var requestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// jobBuckets are the upper bounds in seconds of the job duration histogram buckets, which cover pulling images
+var jobBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+// label is a single label name and value of a metric
+type label struct {
+	name  string
+	value string
+}
+
+// histogram counts observations into cumulative buckets, as in the Prometheus histogram type
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// expositionWriter writes metrics in the Prometheus text exposition format. The first error is kept and returned by
+// err, so writes can be made without checking each one
+type expositionWriter struct {
+	w      io.Writer
+	failed error
+}
+
+func (e *expositionWriter) printf(format string, args ...any) {
+	if e.failed != nil {
+		return
+	}
+	_, e.failed = fmt.Fprintf(e.w, format, args...)
+}
+
+func (e *expositionWriter) err() error {
+	return e.failed
+}
+
+// header writes the help and type of a metric family, which must come before its samples
+func (e *expositionWriter) header(name string, metricType string, help string) {
+	e.printf("# HELP %s %s\n", name, help)
+	e.printf("# TYPE %s %s\n", name, metricType)
+}
+
+func (e *expositionWriter) sample(name string, labels []label, value float64) {
+	e.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+func (e *expositionWriter) histogram(name string, labels []label, h *histogram) {
+	for i, bound := range h.bounds {
+		e.sample(name+"_bucket", append(labels, label{"le", formatValue(bound)}), float64(h.counts[i]))
+	}
+	e.sample(name+"_bucket", append(labels, label{"le", "+Inf"}), float64(h.count))
+	e.sample(name+"_sum", labels, h.sum)
+	e.sample(name+"_count", labels, float64(h.count))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	formatted := make([]string, len(labels))
+	for i, l := range labels {
+		formatted[i] = fmt.Sprintf(`%s="%s"`, l.name, labelEscaper.Replace(l.value))
+	}
+	return "{" + strings.Join(formatted, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
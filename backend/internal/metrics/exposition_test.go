@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Tests histograms are written with cumulative buckets and label values are escaped
+func TestExpositionWriter(t *testing.T) {
+	h := newHistogram([]float64{0.1, 1})
+	h.observe(0.05)
+	h.observe(0.5)
+	h.observe(2)
+
+	var buffer bytes.Buffer
+	out := &expositionWriter{w: &buffer}
+	out.header("test_duration_seconds", "histogram", "Test durations.")
+	out.histogram("test_duration_seconds", []label{{"host", `a"b`}}, h)
+	out.sample("test_total", nil, 3)
+	if err := out.err(); err != nil {
+		t.Fatalf("Unexpected error writing metrics: %s", err.Error())
+	}
+
+	expected := `# HELP test_duration_seconds Test durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{host="a\"b",le="0.1"} 1
+test_duration_seconds_bucket{host="a\"b",le="1"} 2
+test_duration_seconds_bucket{host="a\"b",le="+Inf"} 3
+test_duration_seconds_sum{host="a\"b"} 2.55
+test_duration_seconds_count{host="a\"b"} 3
+test_total 3
+`
+	if diff := cmp.Diff(expected, buffer.String()); diff != "" {
+		t.Errorf("Unexpected metrics output (-want +got):\n%s", diff)
+	}
+}
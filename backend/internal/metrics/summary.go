@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/docker/docker/client"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/docker"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// AppSummary is the current resource usage of an app, along with the disk space used by its volumes and data
+// directory. Apps that aren't running have no usage
+type AppSummary struct {
+	AppID       string `json:"app_id"`
+	Usage       Usage  `json:"usage"`
+	VolumesSize int64  `json:"volumes_size"`
+	DataSize    int64  `json:"data_size"`
+}
+
+// SystemSummary is the resource usage of the whole system
+type SystemSummary struct {
+	Apps       []AppSummary         `json:"apps"`
+	Total      Usage                `json:"total"`
+	Volumes    []docker.VolumeUsage `json:"volumes"`
+	ImagesSize int64                `json:"images_size"`
+	Disk       storage.DiskSpace    `json:"disk"`
+}
+
+// Summary retrieves the latest usage of every installed app and the disk space used by each of them
+func Summary(
+	ctx context.Context,
+	dockerClient *client.Client,
+	queries *persistence.Queries,
+	collector *Collector,
+	storageConfig config.Storage,
+) (SystemSummary, error) {
+	installedApps, err := queries.GetApps(ctx)
+	if err != nil {
+		return SystemSummary{}, err
+	}
+
+	diskUsage, err := docker.GetDiskUsage(ctx, dockerClient)
+	if err != nil {
+		return SystemSummary{}, err
+	}
+
+	disk, err := storage.GetDiskSpace(storageConfig.DataPath)
+	if err != nil {
+		return SystemSummary{}, err
+	}
+
+	latest := collector.Latest()
+	summary := SystemSummary{
+		Apps:       make([]AppSummary, 0, len(installedApps)),
+		Volumes:    diskUsage.Volumes,
+		ImagesSize: diskUsage.ImagesSize,
+		Disk:       disk,
+	}
+	for _, app := range installedApps {
+		appSummary := AppSummary{AppID: app.ID, Usage: latest[app.ID].Usage}
+		for _, volume := range diskUsage.Volumes {
+			if volume.AppID == app.ID {
+				appSummary.VolumesSize += volume.Size
+			}
+		}
+
+		appSummary.DataSize, err = storage.DirectorySize(filepath.Join(storageConfig.DataPath, app.ID))
+		if err != nil {
+			return SystemSummary{}, err
+		}
+
+		summary.Total.add(appSummary.Usage)
+		summary.Apps = append(summary.Apps, appSummary)
+	}
+
+	return summary, nil
+}
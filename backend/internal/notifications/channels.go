@@ -0,0 +1,218 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// WebhookFormat is the format of the request sent to a user's webhook
+type WebhookFormat string
+
+const (
+	// WebhookGeneric posts the notification as JSON
+	WebhookGeneric WebhookFormat = "generic"
+	// WebhookNtfy posts the message to an ntfy topic URL, with the title and priority as headers
+	WebhookNtfy WebhookFormat = "ntfy"
+	// WebhookGotify posts to the message endpoint of a Gotify server, using the token as the application token
+	WebhookGotify WebhookFormat = "gotify"
+)
+
+var InvalidWebhookFormatError = errors.New("invalid webhook format")
+
+// ParseWebhookFormat checks the webhook format is supported, defaulting to the generic format
+func ParseWebhookFormat(format string) (WebhookFormat, error) {
+	switch WebhookFormat(format) {
+	case "":
+		return WebhookGeneric, nil
+	case WebhookGeneric, WebhookNtfy, WebhookGotify:
+		return WebhookFormat(format), nil
+	default:
+		return "", fmt.Errorf("%w: %s", InvalidWebhookFormatError, format)
+	}
+}
+
+// InboxChannel stores notifications in the database to be shown in the web interface
+type InboxChannel struct {
+	queries *persistence.Queries
+}
+
+func NewInboxChannel(queries *persistence.Queries) *InboxChannel {
+	return &InboxChannel{queries: queries}
+}
+
+func (c *InboxChannel) Name() string {
+	return "inbox"
+}
+
+func (c *InboxChannel) Default() bool {
+	return true
+}
+
+func (c *InboxChannel) Available(recipient Recipient) bool {
+	return true
+}
+
+func (c *InboxChannel) Send(ctx context.Context, recipient Recipient, notification Notification) error {
+	return c.queries.CreateNotification(ctx, persistence.CreateNotificationParams{
+		UserID:    recipient.UserID,
+		Event:     string(notification.Event),
+		AppID:     notification.AppID,
+		Title:     notification.Title,
+		Message:   notification.Message,
+		CreatedAt: notification.Time.Unix(),
+	})
+}
+
+// EmailChannel sends notifications to the email address of the user's account through the configured SMTP server
+type EmailChannel struct {
+	config config.SMTP
+}
+
+func NewEmailChannel(smtpConfig config.SMTP) *EmailChannel {
+	return &EmailChannel{config: smtpConfig}
+}
+
+func (c *EmailChannel) Name() string {
+	return "email"
+}
+
+func (c *EmailChannel) Default() bool {
+	return false
+}
+
+func (c *EmailChannel) Available(recipient Recipient) bool {
+	return c.config.Host != "" && c.config.From != "" && recipient.Email != ""
+}
+
+func (c *EmailChannel) Send(ctx context.Context, recipient Recipient, notification Notification) error {
+	var auth smtp.Auth
+	if c.config.Username != "" {
+		auth = smtp.PlainAuth("", c.config.Username, c.config.Password, c.config.Host)
+	}
+	return smtp.SendMail(c.config.Address(), auth, c.config.From, []string{recipient.Email}, emailMessage(c.config.From, recipient, notification))
+}
+
+// emailMessage formats the notification as a plain text email. Header values have line breaks removed so they can't
+// add extra headers
+func emailMessage(from string, recipient Recipient, notification Notification) []byte {
+	headerValue := strings.NewReplacer("\r", " ", "\n", " ")
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", headerValue.Replace(from))
+	fmt.Fprintf(&message, "To: %s\r\n", headerValue.Replace(recipient.Email))
+	fmt.Fprintf(&message, "Subject: [Homecloud] %s\r\n", headerValue.Replace(notification.Title))
+	fmt.Fprintf(&message, "Date: %s\r\n", notification.Time.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(notification.Message, "\n", "\r\n"))
+	message.WriteString("\r\n")
+	return message.Bytes()
+}
+
+// WebhookChannel sends notifications to the webhook URL set in the user's options
+type WebhookChannel struct {
+	client *http.Client
+}
+
+func NewWebhookChannel() *WebhookChannel {
+	return &WebhookChannel{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *WebhookChannel) Name() string {
+	return "webhook"
+}
+
+func (c *WebhookChannel) Default() bool {
+	return true
+}
+
+func (c *WebhookChannel) Available(recipient Recipient) bool {
+	return recipient.Options.WebhookUrl != ""
+}
+
+func (c *WebhookChannel) Send(ctx context.Context, recipient Recipient, notification Notification) error {
+	request, err := webhookRequest(ctx, recipient.Options, notification)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", response.Status)
+	}
+	return nil
+}
+
+// webhookRequest creates the request for sending the notification in the format chosen by the user
+func webhookRequest(ctx context.Context, options persistence.UserOption, notification Notification) (*http.Request, error) {
+	format, err := ParseWebhookFormat(options.WebhookFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case WebhookNtfy:
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, options.WebhookUrl, strings.NewReader(notification.Message))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Title", notification.Title)
+		request.Header.Set("Tags", string(notification.Event))
+		if notification.Event.Urgent() {
+			request.Header.Set("Priority", "high")
+		}
+		if options.WebhookToken != "" {
+			request.Header.Set("Authorization", "Bearer "+options.WebhookToken)
+		}
+		return request, nil
+	case WebhookGotify:
+		priority := 5
+		if notification.Event.Urgent() {
+			priority = 8
+		}
+		body, err := json.Marshal(map[string]any{
+			"title":    notification.Title,
+			"message":  notification.Message,
+			"priority": priority,
+		})
+		if err != nil {
+			return nil, err
+		}
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, options.WebhookUrl, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		if options.WebhookToken != "" {
+			request.Header.Set("X-Gotify-Key", options.WebhookToken)
+		}
+		return request, nil
+	default:
+		body, err := json.Marshal(notification)
+		if err != nil {
+			return nil, err
+		}
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, options.WebhookUrl, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		if options.WebhookToken != "" {
+			request.Header.Set("Authorization", "Bearer "+options.WebhookToken)
+		}
+		return request, nil
+	}
+}
@@ -0,0 +1,92 @@
+package notifications
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// Event is a type of notification users can subscribe to
+type Event string
+
+const (
+	AppCrashed          Event = "app_crashed"
+	UpdateAvailable     Event = "update_available"
+	UpdateFailed        Event = "update_failed"
+	BackupFailed        Event = "backup_failed"
+	DiskNearlyFull      Event = "disk_nearly_full"
+	CertificateExpiring Event = "certificate_expiring"
+	UserRegistered      Event = "user_registered"
+)
+
+// Events lists every event in the order they're shown to users
+var Events = []Event{AppCrashed, UpdateAvailable, UpdateFailed, BackupFailed, DiskNearlyFull, CertificateExpiring, UserRegistered}
+
+// Urgent checks whether the event reports something that has gone wrong, rather than something to look at when
+// convenient
+func (e Event) Urgent() bool {
+	return e != UpdateAvailable && e != UserRegistered
+}
+
+// Notification is a message about an event. Notifications with a Key are only sent once, so the same condition found
+// by repeated checks isn't reported multiple times
+type Notification struct {
+	Event   Event     `json:"event"`
+	AppID   string    `json:"app_id"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	Key     string    `json:"-"`
+}
+
+// Recipient is a user notifications are sent to, along with their options for configuring channels
+type Recipient struct {
+	UserID  string
+	Name    string
+	Email   string
+	Options persistence.UserOption
+}
+
+// Channel is a way of sending notifications to users
+type Channel interface {
+	// Name identifies the channel in subscription preferences
+	Name() string
+	// Default is whether users are subscribed to events on this channel without choosing to be
+	Default() bool
+	// Available checks whether the channel is configured so notifications can be sent to the recipient
+	Available(recipient Recipient) bool
+	Send(ctx context.Context, recipient Recipient, notification Notification) error
+}
+
+// Subscription is whether a user receives notifications of an event through a channel
+type Subscription struct {
+	Event   Event  `json:"event"`
+	Channel string `json:"channel"`
+	Enabled bool   `json:"enabled"`
+}
+
+// resolveSubscriptions combines a user's stored preferences with the defaults of each channel, giving a subscription
+// for every event and channel
+func resolveSubscriptions(stored []persistence.NotificationSubscription, channels []Channel) []Subscription {
+	subscriptions := make([]Subscription, 0, len(Events)*len(channels))
+	for _, event := range Events {
+		for _, channel := range channels {
+			subscription := Subscription{Event: event, Channel: channel.Name(), Enabled: channel.Default()}
+			index := slices.IndexFunc(stored, func(s persistence.NotificationSubscription) bool {
+				return s.Event == string(event) && s.Channel == channel.Name()
+			})
+			if index != -1 {
+				subscription.Enabled = stored[index].Enabled
+			}
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions
+}
+
+// ValidEvent checks the event is one users can subscribe to
+func ValidEvent(event Event) bool {
+	return slices.Contains(Events, event)
+}
@@ -0,0 +1,231 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// Tests stored preferences override the channel defaults, and events without preferences use the defaults
+func TestResolveSubscriptions(t *testing.T) {
+	channels := []Channel{NewInboxChannel(nil), NewEmailChannel(config.SMTP{}), NewWebhookChannel()}
+	stored := []persistence.NotificationSubscription{
+		{Event: string(AppCrashed), Channel: "inbox", Enabled: false},
+		{Event: string(AppCrashed), Channel: "email", Enabled: true},
+	}
+
+	subscriptions := resolveSubscriptions(stored, channels)
+	if len(subscriptions) != len(Events)*len(channels) {
+		t.Fatalf("Expected %d subscriptions, got %d", len(Events)*len(channels), len(subscriptions))
+	}
+
+	expected := map[Subscription]bool{
+		{Event: AppCrashed, Channel: "inbox"}:       false,
+		{Event: AppCrashed, Channel: "email"}:       true,
+		{Event: AppCrashed, Channel: "webhook"}:     true,
+		{Event: BackupFailed, Channel: "inbox"}:     true,
+		{Event: BackupFailed, Channel: "email"}:     false,
+		{Event: UserRegistered, Channel: "webhook"}: true,
+		{Event: UpdateAvailable, Channel: "email"}:  false,
+		{Event: DiskNearlyFull, Channel: "inbox"}:   true,
+	}
+	for _, subscription := range subscriptions {
+		key := Subscription{Event: subscription.Event, Channel: subscription.Channel}
+		if enabled, ok := expected[key]; ok && enabled != subscription.Enabled {
+			t.Errorf("Expected %s on %s enabled to be %t", subscription.Event, subscription.Channel, enabled)
+		}
+	}
+}
+
+// Tests webhook requests are formatted for each supported service
+func TestWebhookRequest(t *testing.T) {
+	notification := Notification{
+		Event:   BackupFailed,
+		AppID:   "traefik.whoami",
+		Title:   "Backing up traefik.whoami failed",
+		Message: "drive not found",
+		Time:    time.Unix(1700000000, 0),
+	}
+
+	tests := []struct {
+		format      string
+		body        string
+		headers     map[string]string
+		expectError bool
+	}{
+		{"", `"event":"backup_failed"`, map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/json"}, false},
+		{"ntfy", "drive not found", map[string]string{"Authorization": "Bearer secret", "Title": notification.Title, "Priority": "high"}, false},
+		{"gotify", `"priority":8`, map[string]string{"X-Gotify-Key": "secret", "Content-Type": "application/json"}, false},
+		{"slack", "", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			options := persistence.UserOption{WebhookUrl: "https://example.com/hook", WebhookFormat: test.format, WebhookToken: "secret"}
+			request, err := webhookRequest(context.Background(), options, notification)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("Expected error for format %s", test.format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err.Error())
+			}
+
+			body, err := io.ReadAll(request.Body)
+			if err != nil {
+				t.Fatalf("Unexpected error reading body: %s", err.Error())
+			}
+			if !strings.Contains(string(body), test.body) {
+				t.Errorf("Expected body to contain %s, got %s", test.body, string(body))
+			}
+			for header, value := range test.headers {
+				if request.Header.Get(header) != value {
+					t.Errorf("Expected header %s to be %s, got %s", header, value, request.Header.Get(header))
+				}
+			}
+		})
+	}
+}
+
+// Tests line breaks in header values can't be used to add headers to emails
+func TestEmailMessage(t *testing.T) {
+	message := string(emailMessage("homecloud@example.com", Recipient{Email: "admin@example.com"}, Notification{
+		Title:   "Update available\r\nBcc: attacker@example.com",
+		Message: "line one\nline two",
+		Time:    time.Unix(1700000000, 0),
+	}))
+
+	headers, body, _ := strings.Cut(message, "\r\n\r\n")
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Errorf("Expected title not to add a header, got %s", line)
+		}
+	}
+	if body != "line one\r\nline two\r\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+}
+
+// Tests notifications with the same key are only queued once until forgotten
+func TestNotifyDeduplicates(t *testing.T) {
+	notifier := &Notifier{queue: make(chan Notification, 8), sent: make(map[string]bool)}
+	notification := Notification{Event: DiskNearlyFull, Key: string(DiskNearlyFull)}
+
+	notifier.Notify(notification)
+	notifier.Notify(notification)
+	notifier.Notify(Notification{Event: AppCrashed})
+	if len(notifier.queue) != 2 {
+		t.Fatalf("Expected 2 queued notifications, got %d", len(notifier.queue))
+	}
+
+	notifier.forget(string(DiskNearlyFull))
+	notifier.Notify(notification)
+	if len(notifier.queue) != 3 {
+		t.Errorf("Expected notification to be sent again after being forgotten, got %d queued", len(notifier.queue))
+	}
+}
+
+// Tests the inbox stores notifications for the user, and they can be filtered to unread notifications
+func TestInbox(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	inbox := NewInboxChannel(queries)
+	recipient := Recipient{UserID: "admin"}
+	for _, title := range []string{"first", "second"} {
+		err := inbox.Send(context.Background(), recipient, Notification{Event: AppCrashed, Title: title, Time: time.Now()})
+		if err != nil {
+			t.Fatalf("Unexpected error sending notification: %s", err.Error())
+		}
+	}
+
+	all, err := queries.ListNotifications(context.Background(), persistence.ListNotificationsParams{UserID: "admin", UnreadOnly: false, Limit: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error listing notifications: %s", err.Error())
+	}
+	if len(all) != 2 || all[0].Title != "second" {
+		data, _ := json.Marshal(all)
+		t.Fatalf("Expected newest notification first, got %s", data)
+	}
+
+	if _, err := queries.MarkNotificationRead(context.Background(), persistence.MarkNotificationReadParams{ID: all[0].ID, UserID: "admin"}); err != nil {
+		t.Fatalf("Unexpected error marking notification read: %s", err.Error())
+	}
+	unread, err := queries.ListNotifications(context.Background(), persistence.ListNotificationsParams{UserID: "admin", UnreadOnly: true, Limit: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error listing notifications: %s", err.Error())
+	}
+	if len(unread) != 1 || unread[0].Title != "first" {
+		t.Errorf("Expected only the unread notification, got %d", len(unread))
+	}
+
+	// Other users can't mark notifications they don't own as read
+	updated, err := queries.MarkNotificationRead(context.Background(), persistence.MarkNotificationReadParams{ID: unread[0].ID, UserID: "other"})
+	if err != nil || updated != 0 {
+		t.Errorf("Expected no notifications to be updated for another user")
+	}
+}
+
+// Tests webhook tokens are stored encrypted, including tokens saved before they were encrypted
+func TestWebhookTokenEncryption(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+
+	cipher, err := encryption.NewCipher(make([]byte, encryption.KeySize))
+	if err != nil {
+		t.Fatalf("Unexpected error creating cipher: %s", err.Error())
+	}
+	notifier := &Notifier{queries: queries, cipher: cipher}
+	ctx := context.Background()
+	for _, userId := range []string{"admin", "legacy"} {
+		if err := queries.AddUser(ctx, userId); err != nil {
+			t.Fatalf("Unexpected error adding user: %s", err.Error())
+		}
+	}
+
+	if err := notifier.SetWebhook(ctx, "admin", "https://example.com/hook", WebhookGeneric, "secret"); err != nil {
+		t.Fatalf("Unexpected error setting webhook: %s", err.Error())
+	}
+	err = queries.SetUserWebhook(ctx, persistence.SetUserWebhookParams{
+		WebhookUrl:    "https://example.com/legacy",
+		WebhookFormat: string(WebhookNtfy),
+		WebhookToken:  "legacy secret",
+		UserID:        "legacy",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error setting webhook: %s", err.Error())
+	}
+	if err := notifier.EncryptWebhookTokens(ctx); err != nil {
+		t.Fatalf("Unexpected error encrypting webhook tokens: %s", err.Error())
+	}
+
+	for userId, token := range map[string]string{"admin": "secret", "legacy": "legacy secret"} {
+		stored, err := queries.GetUserOptions(ctx, userId)
+		if err != nil {
+			t.Fatalf("Unexpected error getting user options: %s", err.Error())
+		}
+		if !stored.WebhookTokenEncrypted || strings.Contains(stored.WebhookToken, token) {
+			t.Errorf("Expected webhook token of %s to be stored encrypted, got %q", userId, stored.WebhookToken)
+		}
+
+		options, err := notifier.DecryptWebhook(stored)
+		if err != nil {
+			t.Fatalf("Unexpected error decrypting webhook token: %s", err.Error())
+		}
+		if options.WebhookToken != token {
+			t.Errorf("Expected webhook token of %s to be %q, got %q", userId, token, options.WebhookToken)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	kratos "github.com/ory/kratos-client-go"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/auth"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/storage"
+)
+
+// checkInterval is how often the disk space and certificates are checked
+const checkInterval = time.Hour
+
+var NoCipherError = errors.New("no encryption key configured for webhook tokens")
+
+// CertificateSource retrieves when the certificates of each host expire
+type CertificateSource interface {
+	CertificateExpiry(ctx context.Context) (map[string]time.Time, error)
+}
+
+// Notifier sends notifications to the admins subscribed to each event. Notifications are queued and sent in the
+// background, so sending them doesn't hold up the code reporting the event
+type Notifier struct {
+	queries       *persistence.Queries
+	kratosAdmin   kratos.IdentityAPI
+	cipher        *encryption.Cipher
+	config        config.Notifications
+	storageConfig config.Storage
+	channels      []Channel
+
+	queue chan Notification
+
+	mu   sync.Mutex
+	sent map[string]bool
+}
+
+func NewNotifier(
+	queries *persistence.Queries,
+	kratosAdmin kratos.IdentityAPI,
+	cipher *encryption.Cipher,
+	notificationsConfig config.Notifications,
+	storageConfig config.Storage,
+) *Notifier {
+	return &Notifier{
+		queries:       queries,
+		kratosAdmin:   kratosAdmin,
+		cipher:        cipher,
+		config:        notificationsConfig,
+		storageConfig: storageConfig,
+		channels: []Channel{
+			NewInboxChannel(queries),
+			NewEmailChannel(notificationsConfig.SMTP),
+			NewWebhookChannel(),
+		},
+		queue: make(chan Notification, 64),
+		sent:  make(map[string]bool),
+	}
+}
+
+// Channels retrieves the channels notifications can be sent through
+func (n *Notifier) Channels() []Channel {
+	return n.channels
+}
+
+// Notify queues the notification to be sent. Notifications with a key that has already been sent are ignored, and
+// calling it on a nil Notifier does nothing so notifications can be left out in tests
+func (n *Notifier) Notify(notification Notification) {
+	if n == nil {
+		return
+	}
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+
+	if notification.Key != "" {
+		n.mu.Lock()
+		if n.sent[notification.Key] {
+			n.mu.Unlock()
+			return
+		}
+		n.sent[notification.Key] = true
+		n.mu.Unlock()
+	}
+
+	select {
+	case n.queue <- notification:
+	default:
+		slog.Error(fmt.Sprintf("Notification queue is full, dropping %s notification", notification.Event))
+	}
+}
+
+// forget allows a notification with the given key to be sent again, such as when the condition it reported has
+// been resolved
+func (n *Notifier) forget(key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.sent, key)
+}
+
+// ObserveJob notifies admins of failed updates, backups and backup verifications. It's used as the job manager's finish hook
+func (n *Notifier) ObserveJob(details persistence.JobDetails, duration time.Duration) {
+	if details.Status != string(jobs.Failed) && details.Status != string(jobs.RolledBack) {
+		return
+	}
+
+	switch jobs.Type(details.Type) {
+	case jobs.Update:
+		n.Notify(Notification{
+			Event:   UpdateFailed,
+			AppID:   details.AppID,
+			Title:   fmt.Sprintf("Updating %s failed", details.AppID),
+			Message: details.Error,
+		})
+	case jobs.Backup:
+		n.Notify(Notification{
+			Event:   BackupFailed,
+			AppID:   details.AppID,
+			Title:   fmt.Sprintf("Backing up %s failed", details.AppID),
+			Message: details.Error,
+		})
+	case jobs.Verify:
+		n.Notify(Notification{
+			Event:   BackupFailed,
+			AppID:   details.AppID,
+			Title:   fmt.Sprintf("Verifying the backup of %s failed", details.AppID),
+			Message: details.Error,
+		})
+	}
+}
+
+// Run sends queued notifications and periodically checks the disk space and certificates until the context is
+// cancelled. Old notifications are removed from inboxes at the same time
+func (n *Notifier) Run(ctx context.Context, certificates CertificateSource) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	n.check(ctx, certificates, time.Now())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-n.queue:
+			if err := n.send(ctx, notification); err != nil {
+				slog.Error(fmt.Sprintf("Failed to send %s notification: %s", notification.Event, err.Error()))
+			}
+		case <-ticker.C:
+			n.check(ctx, certificates, time.Now())
+		}
+	}
+}
+
+func (n *Notifier) check(ctx context.Context, certificates CertificateSource, now time.Time) {
+	if err := n.checkDisk(); err != nil {
+		slog.Error(fmt.Sprintf("Failed to check disk space: %s", err.Error()))
+	}
+	if err := n.checkCertificates(ctx, certificates, now); err != nil {
+		slog.Error(fmt.Sprintf("Failed to check certificate expiry: %s", err.Error()))
+	}
+	if err := n.queries.DeleteOldNotifications(ctx, now.Add(-n.config.Retention).Unix()); err != nil {
+		slog.Error(fmt.Sprintf("Failed to remove old notifications: %s", err.Error()))
+	}
+}
+
+// checkDisk notifies admins when the disk app data is stored on is nearly full. Once space has been freed up the
+// notification can be sent again
+func (n *Notifier) checkDisk() error {
+	disk, err := storage.GetDiskSpace(n.storageConfig.DataPath)
+	if err != nil {
+		return err
+	}
+	if disk.Total == 0 {
+		return nil
+	}
+
+	used := float64(disk.Total-disk.Free) / float64(disk.Total) * 100
+	key := string(DiskNearlyFull)
+	if used < n.config.DiskThreshold {
+		n.forget(key)
+		return nil
+	}
+
+	n.Notify(Notification{
+		Event:   DiskNearlyFull,
+		Title:   "Disk nearly full",
+		Message: fmt.Sprintf("The disk is %.0f%% full, with %.1f GB free", used, float64(disk.Free)/1e9),
+		Key:     key,
+	})
+	return nil
+}
+
+// checkCertificates notifies admins of certificates expiring soon. Each certificate is only reported once, and a
+// renewed certificate has a new expiry so is reported separately
+func (n *Notifier) checkCertificates(ctx context.Context, certificates CertificateSource, now time.Time) error {
+	expiry, err := certificates.CertificateExpiry(ctx)
+	if err != nil {
+		return err
+	}
+
+	for host, notAfter := range expiry {
+		if notAfter.Sub(now) > n.config.CertificateWarning {
+			continue
+		}
+		n.Notify(Notification{
+			Event:   CertificateExpiring,
+			Title:   fmt.Sprintf("Certificate for %s expiring", host),
+			Message: fmt.Sprintf("The certificate for %s expires at %s and hasn't been renewed", host, notAfter.Format(time.RFC1123)),
+			Key:     fmt.Sprintf("%s:%s:%d", CertificateExpiring, host, notAfter.Unix()),
+		})
+	}
+	return nil
+}
+
+// send delivers the notification through every channel each admin is subscribed to. A failure sending to one
+// recipient or channel doesn't stop it being sent through the others
+func (n *Notifier) send(ctx context.Context, notification Notification) error {
+	recipients, err := n.recipients(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients {
+		stored, err := n.queries.GetNotificationSubscriptions(ctx, recipient.UserID)
+		if err != nil {
+			return err
+		}
+
+		for _, subscription := range resolveSubscriptions(stored, n.channels) {
+			if subscription.Event != notification.Event || !subscription.Enabled {
+				continue
+			}
+			channel := n.channels[slices.IndexFunc(n.channels, func(c Channel) bool { return c.Name() == subscription.Channel })]
+			if !channel.Available(recipient) {
+				continue
+			}
+			if err := channel.Send(ctx, recipient, notification); err != nil {
+				slog.Error(fmt.Sprintf("Failed to send %s notification to %s by %s: %s", notification.Event, recipient.UserID, channel.Name(), err.Error()))
+			}
+		}
+	}
+	return nil
+}
+
+// recipients retrieves the admins notifications are sent to
+func (n *Notifier) recipients(ctx context.Context) ([]Recipient, error) {
+	users, err := auth.ListUsers(ctx, n.kratosAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	var recipients []Recipient
+	for _, user := range users {
+		metadata, err := auth.ParseMetadataPublic(user.MetadataPublic)
+		if err != nil || !slices.Contains(metadata.Roles, "admin") {
+			continue
+		}
+
+		var traits auth.Traits
+		if err := auth.ParseSessionData(user.Traits, &traits); err != nil {
+			return nil, err
+		}
+
+		options, err := n.queries.GetUserOptions(ctx, user.Id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		options, err = n.DecryptWebhook(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt webhook token of %s: %w", user.Id, err)
+		}
+
+		recipients = append(recipients, Recipient{
+			UserID:  user.Id,
+			Name:    traits.Name,
+			Email:   traits.Email,
+			Options: options,
+		})
+	}
+	return recipients, nil
+}
+
+// Subscriptions retrieves a user's subscription to every event and channel
+func (n *Notifier) Subscriptions(ctx context.Context, userId string) ([]Subscription, error) {
+	stored, err := n.queries.GetNotificationSubscriptions(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return resolveSubscriptions(stored, n.channels), nil
+}
+
+// SetWebhook saves the user's webhook, encrypting its token
+func (n *Notifier) SetWebhook(ctx context.Context, userId string, url string, format WebhookFormat, token string) error {
+	encrypted := false
+	if token != "" {
+		if n.cipher == nil {
+			return NoCipherError
+		}
+		var err error
+		token, err = n.cipher.Encrypt(token)
+		if err != nil {
+			return err
+		}
+		encrypted = true
+	}
+
+	return n.queries.SetUserWebhook(ctx, persistence.SetUserWebhookParams{
+		WebhookUrl:            url,
+		WebhookFormat:         string(format),
+		WebhookToken:          token,
+		WebhookTokenEncrypted: encrypted,
+		UserID:                userId,
+	})
+}
+
+// DecryptWebhook returns the user's options with the webhook token decrypted
+func (n *Notifier) DecryptWebhook(options persistence.UserOption) (persistence.UserOption, error) {
+	if !options.WebhookTokenEncrypted {
+		return options, nil
+	}
+	if n.cipher == nil {
+		return persistence.UserOption{}, NoCipherError
+	}
+
+	token, err := n.cipher.Decrypt(options.WebhookToken)
+	if err != nil {
+		return persistence.UserOption{}, err
+	}
+	options.WebhookToken = token
+	options.WebhookTokenEncrypted = false
+	return options, nil
+}
+
+// EncryptWebhookTokens encrypts the webhook tokens saved before they were encrypted
+func (n *Notifier) EncryptWebhookTokens(ctx context.Context) error {
+	unencrypted, err := n.queries.GetUnencryptedWebhookTokens(ctx)
+	if err != nil {
+		return err
+	}
+	for _, options := range unencrypted {
+		err := n.SetWebhook(ctx, options.UserID, options.WebhookUrl, WebhookFormat(options.WebhookFormat), options.WebhookToken)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt webhook token of %s: %w", options.UserID, err)
+		}
+	}
+	return nil
+}
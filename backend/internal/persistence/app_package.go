@@ -12,19 +12,103 @@ type AppPackage struct {
 	OidcScopes             []string           `json:"oidc_scopes"`
 	Containers             []PackageContainer `json:"containers"`
 	OidcEndpointAuthMethod *string            `json:"oidc_endpoint_auth_method"`
+	Settings               []PackageSetting   `json:"settings"`
+	Secrets                []PackageSecret    `json:"secrets"`
+}
+
+// PackageSecret is a random value generated when the app is installed, such as a database password, available in
+// templates as {{ .Secrets.key }}. Secrets are alphanumeric and 32 characters long unless a length is given. Installs
+// from before a package declared the secret use UpgradeValue instead, for values that can't be changed once set
+type PackageSecret struct {
+	Key          string `json:"key"`
+	Length       int    `json:"length"`
+	UpgradeValue string `json:"upgrade_value"`
+}
+
+const (
+	SettingString  = "string"
+	SettingNumber  = "number"
+	SettingBoolean = "boolean"
+	SettingSecret  = "secret"
+)
+
+// PackageSetting is a value of an app that can be changed by admins, available in templates as {{ .Settings.key }}.
+// Secret settings are stored encrypted and never returned by the API
+type PackageSetting struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Default     string `json:"default"`
+	Description string `json:"description"`
 }
 
 type PackageContainer struct {
-	Name             string            `json:"name"`
-	Image            string            `json:"image"`
-	Command          string            `json:"command"`
-	Restart          string            `json:"restart"`
-	Environment      map[string]string `json:"environment"`
-	Ports            []string          `json:"ports"`
-	Volumes          []string          `json:"volumes"`
-	ExtraHosts       []string          `json:"extra_hosts"`
-	Privileged       bool              `json:"privileged"`
-	ProxyTarget      bool              `json:"proxy_target"`
-	ProxyPort        string            `json:"proxy_port"`
-	OidcRedirectUris []string          `json:"oidc_redirect_uris"`
+	Name             string              `json:"name"`
+	Image            string              `json:"image"`
+	Command          string              `json:"command"`
+	Restart          string              `json:"restart"`
+	Environment      map[string]string   `json:"environment"`
+	Ports            []string            `json:"ports"`
+	Volumes          []string            `json:"volumes"`
+	ExtraHosts       []string            `json:"extra_hosts"`
+	Privileged       bool                `json:"privileged"`
+	ProxyTarget      bool                `json:"proxy_target"`
+	ProxyPort        string              `json:"proxy_port"`
+	OidcRedirectUris []string            `json:"oidc_redirect_uris"`
+	DependsOn        []PackageDependency `json:"depends_on"`
+	Healthcheck      *PackageHealthcheck `json:"healthcheck"`
+	Limits           *PackageLimits      `json:"limits"`
+	Backup           *PackageBackup      `json:"backup"`
+	Routes           []PackageRoute      `json:"routes"`
+}
+
+// PackageRoute sends requests for the app to a proxy target container. Routes with a subdomain are served at
+// <subdomain>.<app id>.<host>, such as admin.author.app.example.com, and others at the app's own host. Requests are sent
+// to the route with the longest path prefix matching them, with the prefix removed first if strip_prefix is set.
+// WebSocket connections are only proxied when websocket is set, and the port defaults to the container's proxy port
+type PackageRoute struct {
+	Subdomain   string `json:"subdomain"`
+	Path        string `json:"path"`
+	Port        string `json:"port"`
+	StripPrefix bool   `json:"strip_prefix"`
+	WebSocket   bool   `json:"websocket"`
+}
+
+// PackageLimits restricts the resources a container can use. Memory is given with a unit such as 512m or 2g, and cpus
+// as the number of CPUs the container can use such as 1.5. Unset values are unlimited
+type PackageLimits struct {
+	Memory string  `json:"memory"`
+	Cpus   float64 `json:"cpus"`
+	Pids   int64   `json:"pids"`
+}
+
+const (
+	DependencyStarted = "started"
+	DependencyHealthy = "healthy"
+)
+
+// PackageDependency is a container that must meet a condition before the container depending on it is started, either
+// being started or healthy. If no condition is given the container only needs to be started
+type PackageDependency struct {
+	Container string `json:"container"`
+	Condition string `json:"condition"`
+}
+
+// PackageHealthcheck configures how docker checks whether a container is healthy, with durations such as 10s
+type PackageHealthcheck struct {
+	Test        []string `json:"test"`
+	Interval    string   `json:"interval"`
+	Timeout     string   `json:"timeout"`
+	StartPeriod string   `json:"start_period"`
+	Retries     int      `json:"retries"`
+}
+
+// PackageBackup prepares a container for its app's data to be backed up. Pre is a command run in the container before
+// the data is read, such as dumping a database into the data directory, and post a command run afterwards, even if the
+// backup failed. Commands are in exec form, like ["pg_dump", "-f", "/data/dump.sql"], and are stopped after the
+// timeout, 10m by default. If stop is set the container is stopped while the data is read instead
+type PackageBackup struct {
+	Pre     []string `json:"pre"`
+	Post    []string `json:"post"`
+	Timeout string   `json:"timeout"`
+	Stop    bool     `json:"stop"`
 }
@@ -11,8 +11,8 @@ import (
 )
 
 const createApp = `-- name: CreateApp :exec
-INSERT INTO apps (id, schema, date_added, client_id, client_secret, status)
-VALUES (?1, jsonb(?2), unixepoch(), ?3, ?4, 'running')
+INSERT INTO apps (id, schema, date_added, client_id, client_secret, status, sideloaded)
+VALUES (?1, jsonb(?2), unixepoch(), ?3, ?4, 'running', ?5)
 `
 
 type CreateAppParams struct {
@@ -20,6 +20,7 @@ type CreateAppParams struct {
 	Schema       interface{}    `json:"schema"`
 	ClientID     sql.NullString `json:"client_id"`
 	ClientSecret sql.NullString `json:"client_secret"`
+	Sideloaded   bool           `json:"sideloaded"`
 }
 
 func (q *Queries) CreateApp(ctx context.Context, arg CreateAppParams) error {
@@ -28,6 +29,7 @@ func (q *Queries) CreateApp(ctx context.Context, arg CreateAppParams) error {
 		arg.Schema,
 		arg.ClientID,
 		arg.ClientSecret,
+		arg.Sideloaded,
 	)
 	return err
 }
@@ -58,6 +60,72 @@ func (q *Queries) RemoveApp(ctx context.Context, id string) (sql.Result, error)
 	return q.db.ExecContext(ctx, removeApp, id)
 }
 
+const restoreApp = `-- name: RestoreApp :exec
+INSERT INTO apps (id, schema, date_added, client_id, client_secret, status, update_policy, pinned, sideloaded)
+VALUES (
+    ?1, jsonb(?2), ?3, ?4, ?5,
+    ?6, ?7, ?8, ?9
+)
+`
+
+type RestoreAppParams struct {
+	ID           string         `json:"id"`
+	Schema       interface{}    `json:"schema"`
+	DateAdded    int64          `json:"date_added"`
+	ClientID     sql.NullString `json:"client_id"`
+	ClientSecret sql.NullString `json:"client_secret"`
+	Status       string         `json:"status"`
+	UpdatePolicy string         `json:"update_policy"`
+	Pinned       bool           `json:"pinned"`
+	Sideloaded   bool           `json:"sideloaded"`
+}
+
+func (q *Queries) RestoreApp(ctx context.Context, arg RestoreAppParams) error {
+	_, err := q.db.ExecContext(ctx, restoreApp,
+		arg.ID,
+		arg.Schema,
+		arg.DateAdded,
+		arg.ClientID,
+		arg.ClientSecret,
+		arg.Status,
+		arg.UpdatePolicy,
+		arg.Pinned,
+		arg.Sideloaded,
+	)
+	return err
+}
+
+const setAppOAuth = `-- name: SetAppOAuth :exec
+UPDATE apps SET client_id = ?1, client_secret = ?2
+WHERE id = ?3
+`
+
+type SetAppOAuthParams struct {
+	ClientID     sql.NullString `json:"client_id"`
+	ClientSecret sql.NullString `json:"client_secret"`
+	ID           string         `json:"id"`
+}
+
+func (q *Queries) SetAppOAuth(ctx context.Context, arg SetAppOAuthParams) error {
+	_, err := q.db.ExecContext(ctx, setAppOAuth, arg.ClientID, arg.ClientSecret, arg.ID)
+	return err
+}
+
+const setPinned = `-- name: SetPinned :exec
+UPDATE apps SET pinned = ?1
+WHERE id = ?2
+`
+
+type SetPinnedParams struct {
+	Pinned bool   `json:"pinned"`
+	ID     string `json:"id"`
+}
+
+func (q *Queries) SetPinned(ctx context.Context, arg SetPinnedParams) error {
+	_, err := q.db.ExecContext(ctx, setPinned, arg.Pinned, arg.ID)
+	return err
+}
+
 const setStatus = `-- name: SetStatus :exec
 UPDATE apps SET status = ?1
 WHERE id = ?2
@@ -73,6 +141,21 @@ func (q *Queries) SetStatus(ctx context.Context, arg SetStatusParams) error {
 	return err
 }
 
+const setUpdatePolicy = `-- name: SetUpdatePolicy :exec
+UPDATE apps SET update_policy = ?1
+WHERE id = ?2
+`
+
+type SetUpdatePolicyParams struct {
+	UpdatePolicy string `json:"update_policy"`
+	ID           string `json:"id"`
+}
+
+func (q *Queries) SetUpdatePolicy(ctx context.Context, arg SetUpdatePolicyParams) error {
+	_, err := q.db.ExecContext(ctx, setUpdatePolicy, arg.UpdatePolicy, arg.ID)
+	return err
+}
+
 const updateApp = `-- name: UpdateApp :exec
 UPDATE apps SET schema = jsonb(?1)
 WHERE id = ?2
@@ -89,15 +172,18 @@ func (q *Queries) UpdateApp(ctx context.Context, arg UpdateAppParams) error {
 }
 
 const getAppUnparsed = `-- name: getAppUnparsed :one
-SELECT id, json(schema) as schema, date_added, status FROM apps
+SELECT id, json(schema) as schema, date_added, status, update_policy, pinned, sideloaded FROM apps
 WHERE id = ?1
 `
 
 type getAppUnparsedRow struct {
-	ID        string      `json:"id"`
-	Schema    interface{} `json:"schema"`
-	DateAdded int64       `json:"date_added"`
-	Status    string      `json:"status"`
+	ID           string      `json:"id"`
+	Schema       interface{} `json:"schema"`
+	DateAdded    int64       `json:"date_added"`
+	Status       string      `json:"status"`
+	UpdatePolicy string      `json:"update_policy"`
+	Pinned       bool        `json:"pinned"`
+	Sideloaded   bool        `json:"sideloaded"`
 }
 
 func (q *Queries) getAppUnparsed(ctx context.Context, id string) (getAppUnparsedRow, error) {
@@ -108,12 +194,15 @@ func (q *Queries) getAppUnparsed(ctx context.Context, id string) (getAppUnparsed
 		&i.Schema,
 		&i.DateAdded,
 		&i.Status,
+		&i.UpdatePolicy,
+		&i.Pinned,
+		&i.Sideloaded,
 	)
 	return i, err
 }
 
 const getAppWithCredsUnparsed = `-- name: getAppWithCredsUnparsed :one
-SELECT id, json(schema) as schema, date_added, client_id, client_secret, status from apps
+SELECT id, json(schema) as schema, date_added, client_id, client_secret, status, update_policy, pinned, sideloaded from apps
 WHERE id = ?1
 `
 
@@ -124,6 +213,9 @@ type getAppWithCredsUnparsedRow struct {
 	ClientID     sql.NullString `json:"client_id"`
 	ClientSecret sql.NullString `json:"client_secret"`
 	Status       string         `json:"status"`
+	UpdatePolicy string         `json:"update_policy"`
+	Pinned       bool           `json:"pinned"`
+	Sideloaded   bool           `json:"sideloaded"`
 }
 
 func (q *Queries) getAppWithCredsUnparsed(ctx context.Context, id string) (getAppWithCredsUnparsedRow, error) {
@@ -136,19 +228,25 @@ func (q *Queries) getAppWithCredsUnparsed(ctx context.Context, id string) (getAp
 		&i.ClientID,
 		&i.ClientSecret,
 		&i.Status,
+		&i.UpdatePolicy,
+		&i.Pinned,
+		&i.Sideloaded,
 	)
 	return i, err
 }
 
 const getAppsUnparsed = `-- name: getAppsUnparsed :many
-SELECT id, json(schema) as schema, date_added, status FROM apps
+SELECT id, json(schema) as schema, date_added, status, update_policy, pinned, sideloaded FROM apps
 `
 
 type getAppsUnparsedRow struct {
-	ID        string      `json:"id"`
-	Schema    interface{} `json:"schema"`
-	DateAdded int64       `json:"date_added"`
-	Status    string      `json:"status"`
+	ID           string      `json:"id"`
+	Schema       interface{} `json:"schema"`
+	DateAdded    int64       `json:"date_added"`
+	Status       string      `json:"status"`
+	UpdatePolicy string      `json:"update_policy"`
+	Pinned       bool        `json:"pinned"`
+	Sideloaded   bool        `json:"sideloaded"`
 }
 
 func (q *Queries) getAppsUnparsed(ctx context.Context) ([]getAppsUnparsedRow, error) {
@@ -165,6 +263,9 @@ func (q *Queries) getAppsUnparsed(ctx context.Context) ([]getAppsUnparsedRow, er
 			&i.Schema,
 			&i.DateAdded,
 			&i.Status,
+			&i.UpdatePolicy,
+			&i.Pinned,
+			&i.Sideloaded,
 		); err != nil {
 			return nil, err
 		}
@@ -180,7 +281,7 @@ func (q *Queries) getAppsUnparsed(ctx context.Context) ([]getAppsUnparsedRow, er
 }
 
 const getAppsWithCredsUnparsed = `-- name: getAppsWithCredsUnparsed :many
-SELECT id, json(schema) as schema, date_added, client_Id, client_secret, status from apps
+SELECT id, json(schema) as schema, date_added, client_Id, client_secret, status, update_policy, pinned, sideloaded from apps
 `
 
 type getAppsWithCredsUnparsedRow struct {
@@ -190,6 +291,9 @@ type getAppsWithCredsUnparsedRow struct {
 	ClientID     sql.NullString `json:"client_id"`
 	ClientSecret sql.NullString `json:"client_secret"`
 	Status       string         `json:"status"`
+	UpdatePolicy string         `json:"update_policy"`
+	Pinned       bool           `json:"pinned"`
+	Sideloaded   bool           `json:"sideloaded"`
 }
 
 func (q *Queries) getAppsWithCredsUnparsed(ctx context.Context) ([]getAppsWithCredsUnparsedRow, error) {
@@ -208,6 +312,9 @@ func (q *Queries) getAppsWithCredsUnparsed(ctx context.Context) ([]getAppsWithCr
 			&i.ClientID,
 			&i.ClientSecret,
 			&i.Status,
+			&i.UpdatePolicy,
+			&i.Pinned,
+			&i.Sideloaded,
 		); err != nil {
 			return nil, err
 		}
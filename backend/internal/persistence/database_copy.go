@@ -0,0 +1,10 @@
+package persistence
+
+import "context"
+
+// CopyDatabase writes a consistent copy of the database to the given path, which mustn't already exist. The database
+// can be used while it's being copied
+func (q *Queries) CopyDatabase(ctx context.Context, path string) error {
+	_, err := q.db.ExecContext(ctx, "VACUUM INTO ?1", path)
+	return err
+}
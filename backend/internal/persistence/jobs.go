@@ -0,0 +1,83 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type JobStep struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type LayerProgress struct {
+	Image   string `json:"image"`
+	Status  string `json:"status"`
+	Current int64  `json:"current"`
+	Total   int64  `json:"total"`
+}
+
+type JobDetails struct {
+	Job
+	Steps    []JobStep                `json:"steps"`
+	Progress map[string]LayerProgress `json:"progress"`
+}
+
+func (q *Queries) parseJob(job Job) (JobDetails, error) {
+	details := JobDetails{Job: job}
+	if err := json.Unmarshal([]byte(job.Steps), &details.Steps); err != nil {
+		return details, err
+	}
+	if err := json.Unmarshal([]byte(job.Progress), &details.Progress); err != nil {
+		return details, err
+	}
+	return details, nil
+}
+
+// GetJob retrieves a single job, parsing the steps and progress columns
+func (q *Queries) GetJob(ctx context.Context, id string) (JobDetails, error) {
+	job, err := q.getJob(ctx, id)
+	if err != nil {
+		return JobDetails{}, err
+	}
+	return q.parseJob(job)
+}
+
+// GetJobs retrieves the most recent jobs, optionally filtered to a single app when appId isn't empty
+func (q *Queries) GetJobs(ctx context.Context, appId string, limit int64) ([]JobDetails, error) {
+	jobs, err := q.getJobs(ctx, getJobsParams{AppID: appId, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	parsedJobs := make([]JobDetails, 0, len(jobs))
+	for _, job := range jobs {
+		parsedJob, err := q.parseJob(job)
+		if err != nil {
+			return nil, err
+		}
+		parsedJobs = append(parsedJobs, parsedJob)
+	}
+	return parsedJobs, nil
+}
+
+// SaveJob writes the current state of the job to the database
+func (q *Queries) SaveJob(ctx context.Context, job JobDetails) error {
+	steps, err := json.Marshal(job.Steps)
+	if err != nil {
+		return err
+	}
+	progress, err := json.Marshal(job.Progress)
+	if err != nil {
+		return err
+	}
+
+	return q.UpdateJob(ctx, UpdateJobParams{
+		Status:   job.Status,
+		Steps:    string(steps),
+		Progress: string(progress),
+		Error:    job.Error,
+		ID:       job.ID,
+	})
+}
@@ -16,6 +16,82 @@ type App struct {
 	ClientID     sql.NullString `json:"client_id"`
 	ClientSecret sql.NullString `json:"client_secret"`
 	Status       string         `json:"status"`
+	UpdatePolicy string         `json:"update_policy"`
+	Pinned       bool           `json:"pinned"`
+	Sideloaded   bool           `json:"sideloaded"`
+}
+
+type AppMetric struct {
+	AppID       string  `json:"app_id"`
+	Resolution  int64   `json:"resolution"`
+	Timestamp   int64   `json:"timestamp"`
+	CpuPercent  float64 `json:"cpu_percent"`
+	MemoryBytes int64   `json:"memory_bytes"`
+	NetworkRx   float64 `json:"network_rx"`
+	NetworkTx   float64 `json:"network_tx"`
+	BlockRead   float64 `json:"block_read"`
+	BlockWrite  float64 `json:"block_write"`
+}
+
+type AppSecret struct {
+	AppID string `json:"app_id"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type AppSetting struct {
+	AppID     string `json:"app_id"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+type AppState struct {
+	AppID     string `json:"app_id"`
+	State     string `json:"state"`
+	Message   string `json:"message"`
+	Restarts  int64  `json:"restarts"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type BackupHistory struct {
+	ID               int64  `json:"id"`
+	ScheduleID       int64  `json:"schedule_id"`
+	AppID            string `json:"app_id"`
+	Target           string `json:"target"`
+	Snapshot         string `json:"snapshot"`
+	Status           string `json:"status"`
+	Error            string `json:"error"`
+	Size             int64  `json:"size"`
+	Pruned           bool   `json:"pruned"`
+	StartedAt        int64  `json:"started_at"`
+	FinishedAt       int64  `json:"finished_at"`
+	VerifiedAt       int64  `json:"verified_at"`
+	VerifyError      string `json:"verify_error"`
+	RestoreTestedAt  int64  `json:"restore_tested_at"`
+	RestoreTestError string `json:"restore_test_error"`
+}
+
+type BackupSchedule struct {
+	ID          int64  `json:"id"`
+	AppID       string `json:"app_id"`
+	Cron        string `json:"cron"`
+	Target      string `json:"target"`
+	KeepDaily   int64  `json:"keep_daily"`
+	KeepWeekly  int64  `json:"keep_weekly"`
+	KeepMonthly int64  `json:"keep_monthly"`
+	Enabled     bool   `json:"enabled"`
+	LastRunAt   int64  `json:"last_run_at"`
+	CreatedAt   int64  `json:"created_at"`
+	TestRestore bool   `json:"test_restore"`
+}
+
+type BackupTarget struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Config    string `json:"config"`
+	Secrets   string `json:"secrets"`
+	CreatedAt int64  `json:"created_at"`
 }
 
 type InviteCode struct {
@@ -24,6 +100,36 @@ type InviteCode struct {
 	Roles      []byte    `json:"roles"`
 }
 
+type Job struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	AppID     string `json:"app_id"`
+	Status    string `json:"status"`
+	Steps     string `json:"steps"`
+	Progress  string `json:"progress"`
+	Error     string `json:"error"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type Notification struct {
+	ID        int64  `json:"id"`
+	UserID    string `json:"user_id"`
+	Event     string `json:"event"`
+	AppID     string `json:"app_id"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+	Read      bool   `json:"read"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type NotificationSubscription struct {
+	UserID  string `json:"user_id"`
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Enabled bool   `json:"enabled"`
+}
+
 type PackageCategory struct {
 	Category string `json:"category"`
 }
@@ -40,9 +146,51 @@ type PackageListItem struct {
 	Author      string `json:"author"`
 	Description string `json:"description"`
 	ImageUrl    string `json:"image_url"`
+	Store       string `json:"store"`
+}
+
+type ResourceLimit struct {
+	AppID     string  `json:"app_id"`
+	Container string  `json:"container"`
+	Memory    string  `json:"memory"`
+	Cpus      float64 `json:"cpus"`
+	Pids      int64   `json:"pids"`
+}
+
+type Store struct {
+	Name      string `json:"name"`
+	Url       string `json:"url"`
+	Priority  int64  `json:"priority"`
+	PublicKey string `json:"public_key"`
+}
+
+type UpdateHistory struct {
+	ID          int64  `json:"id"`
+	AppID       string `json:"app_id"`
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+	Automatic   bool   `json:"automatic"`
+	Status      string `json:"status"`
+	Error       string `json:"error"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+type UpdateNotification struct {
+	AppID   string `json:"app_id"`
+	Version string `json:"version"`
+}
+
+type UpdateSetting struct {
+	ID          int64 `json:"id"`
+	WindowStart int64 `json:"window_start"`
+	WindowEnd   int64 `json:"window_end"`
 }
 
 type UserOption struct {
-	UserID           string `json:"user_id"`
-	CompletedWelcome bool   `json:"completed_welcome"`
+	UserID                string `json:"user_id"`
+	CompletedWelcome      bool   `json:"completed_welcome"`
+	WebhookUrl            string `json:"webhook_url"`
+	WebhookFormat         string `json:"webhook_format"`
+	WebhookToken          string `json:"webhook_token"`
+	WebhookTokenEncrypted bool   `json:"webhook_token_encrypted"`
 }
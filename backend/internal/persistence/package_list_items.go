@@ -106,3 +106,11 @@ func (q *Queries) SearchPackages(ctx context.Context, query string, category str
 	castedResults := *(*[]getPackageListItemsRow)(unsafe.Pointer(&queryResult))
 	return q.handlePackageResult(castedResults), nil
 }
+
+// RemoveStorePackages removes all packages provided by the given store, along with their category definitions
+func (q *Queries) RemoveStorePackages(ctx context.Context, store string) error {
+	if err := q.deleteStoreCategoryDefinitions(ctx, store); err != nil {
+		return err
+	}
+	return q.deleteStorePackages(ctx, store)
+}
@@ -38,7 +38,7 @@ func (q *Queries) GetCategories(ctx context.Context) ([]string, error) {
 }
 
 const getNewPackages = `-- name: GetNewPackages :many
-SELECT id, name, version, author, description, image_url FROM package_list_items
+SELECT id, name, version, author, description, image_url, store FROM package_list_items
 LIMIT 10
 `
 
@@ -58,6 +58,7 @@ func (q *Queries) GetNewPackages(ctx context.Context) ([]PackageListItem, error)
 			&i.Author,
 			&i.Description,
 			&i.ImageUrl,
+			&i.Store,
 		); err != nil {
 			return nil, err
 		}
@@ -145,6 +146,26 @@ func (q *Queries) deletePackageCategoryDefinitions(ctx context.Context, packageI
 	return err
 }
 
+const deleteStoreCategoryDefinitions = `-- name: deleteStoreCategoryDefinitions :exec
+DELETE FROM package_category_definitions
+WHERE package_id IN (SELECT id FROM package_list_items WHERE store = ?1)
+`
+
+func (q *Queries) deleteStoreCategoryDefinitions(ctx context.Context, store string) error {
+	_, err := q.db.ExecContext(ctx, deleteStoreCategoryDefinitions, store)
+	return err
+}
+
+const deleteStorePackages = `-- name: deleteStorePackages :exec
+DELETE FROM package_list_items
+WHERE store = ?1
+`
+
+func (q *Queries) deleteStorePackages(ctx context.Context, store string) error {
+	_, err := q.db.ExecContext(ctx, deleteStorePackages, store)
+	return err
+}
+
 const getPackageCategoryDefinitions = `-- name: getPackageCategoryDefinitions :many
 SELECT category FROM package_category_definitions
 WHERE package_id = ?1
@@ -174,7 +195,7 @@ func (q *Queries) getPackageCategoryDefinitions(ctx context.Context, packageID s
 }
 
 const getPackageListItem = `-- name: getPackageListItem :one
-SELECT package_list_items.id, package_list_items.name, package_list_items.version, package_list_items.author, package_list_items.description, package_list_items.image_url, category, CAST(CASE WHEN apps.id IS NOT NULL THEN TRUE ELSE FALSE END AS BOOLEAN) AS installed
+SELECT package_list_items.id, package_list_items.name, package_list_items.version, package_list_items.author, package_list_items.description, package_list_items.image_url, package_list_items.store, category, CAST(CASE WHEN apps.id IS NOT NULL THEN TRUE ELSE FALSE END AS BOOLEAN) AS installed
 FROM package_list_items
 LEFT JOIN package_category_definitions ON package_list_items.id = package_category_definitions.package_id
 LEFT JOIN apps ON package_list_items.id = apps.id
@@ -197,6 +218,7 @@ func (q *Queries) getPackageListItem(ctx context.Context, id string) (getPackage
 		&i.PackageListItem.Author,
 		&i.PackageListItem.Description,
 		&i.PackageListItem.ImageUrl,
+		&i.PackageListItem.Store,
 		&i.Category,
 		&i.Installed,
 	)
@@ -205,7 +227,7 @@ func (q *Queries) getPackageListItem(ctx context.Context, id string) (getPackage
 
 const getPackageListItems = `-- name: getPackageListItems :many
 
-SELECT package_list_items.id, package_list_items.name, package_list_items.version, package_list_items.author, package_list_items.description, package_list_items.image_url, category, CAST(CASE WHEN apps.id IS NOT NULL THEN TRUE ELSE FALSE END AS BOOLEAN) AS installed
+SELECT package_list_items.id, package_list_items.name, package_list_items.version, package_list_items.author, package_list_items.description, package_list_items.image_url, package_list_items.store, category, CAST(CASE WHEN apps.id IS NOT NULL THEN TRUE ELSE FALSE END AS BOOLEAN) AS installed
 FROM package_list_items
 LEFT JOIN package_category_definitions ON package_list_items.id = package_category_definitions.package_id
 LEFT JOIN apps ON package_list_items.id = apps.id
@@ -235,6 +257,7 @@ func (q *Queries) getPackageListItems(ctx context.Context) ([]getPackageListItem
 			&i.PackageListItem.Author,
 			&i.PackageListItem.Description,
 			&i.PackageListItem.ImageUrl,
+			&i.PackageListItem.Store,
 			&i.Category,
 			&i.Installed,
 		); err != nil {
@@ -257,7 +280,7 @@ WITH has_category AS (
     FROM package_category_definitions
     GROUP BY package_id
 )
-SELECT package_list_items.id, package_list_items.name, package_list_items.version, package_list_items.author, package_list_items.description, package_list_items.image_url, category, CAST(CASE WHEN apps.id IS NOT NULL THEN TRUE ELSE FALSE END AS BOOLEAN) AS installed
+SELECT package_list_items.id, package_list_items.name, package_list_items.version, package_list_items.author, package_list_items.description, package_list_items.image_url, package_list_items.store, category, CAST(CASE WHEN apps.id IS NOT NULL THEN TRUE ELSE FALSE END AS BOOLEAN) AS installed
 FROM package_list_items
 LEFT JOIN has_category ON package_list_items.id = has_category.package_id
 LEFT JOIN package_category_definitions ON package_list_items.id = package_category_definitions.package_id
@@ -296,6 +319,7 @@ func (q *Queries) searchPackageListItems(ctx context.Context, arg searchPackageL
 			&i.PackageListItem.Author,
 			&i.PackageListItem.Description,
 			&i.PackageListItem.ImageUrl,
+			&i.PackageListItem.Store,
 			&i.Category,
 			&i.Installed,
 		); err != nil {
@@ -313,8 +337,8 @@ func (q *Queries) searchPackageListItems(ctx context.Context, arg searchPackageL
 }
 
 const writePackageListItem = `-- name: writePackageListItem :exec
-INSERT OR REPLACE INTO package_list_items (id, name, version, author, description, image_url)
-VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+INSERT OR REPLACE INTO package_list_items (id, name, version, author, description, image_url, store)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)
 `
 
 type writePackageListItemParams struct {
@@ -324,6 +348,7 @@ type writePackageListItemParams struct {
 	Author      string `json:"author"`
 	Description string `json:"description"`
 	ImageUrl    string `json:"image_url"`
+	Store       string `json:"store"`
 }
 
 func (q *Queries) writePackageListItem(ctx context.Context, arg writePackageListItemParams) error {
@@ -334,6 +359,7 @@ func (q *Queries) writePackageListItem(ctx context.Context, arg writePackageList
 		arg.Author,
 		arg.Description,
 		arg.ImageUrl,
+		arg.Store,
 	)
 	return err
 }
@@ -20,17 +20,84 @@ func (q *Queries) AddUser(ctx context.Context, userID string) error {
 	return err
 }
 
+const getUnencryptedWebhookTokens = `-- name: GetUnencryptedWebhookTokens :many
+SELECT user_id, completed_welcome, webhook_url, webhook_format, webhook_token, webhook_token_encrypted FROM user_options WHERE webhook_token != '' AND NOT webhook_token_encrypted
+`
+
+func (q *Queries) GetUnencryptedWebhookTokens(ctx context.Context) ([]UserOption, error) {
+	rows, err := q.db.QueryContext(ctx, getUnencryptedWebhookTokens)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserOption
+	for rows.Next() {
+		var i UserOption
+		if err := rows.Scan(
+			&i.UserID,
+			&i.CompletedWelcome,
+			&i.WebhookUrl,
+			&i.WebhookFormat,
+			&i.WebhookToken,
+			&i.WebhookTokenEncrypted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserOptions = `-- name: GetUserOptions :one
-SELECT user_id, completed_welcome FROM user_options WHERE user_id = ?1
+SELECT user_id, completed_welcome, webhook_url, webhook_format, webhook_token, webhook_token_encrypted FROM user_options WHERE user_id = ?1
 `
 
 func (q *Queries) GetUserOptions(ctx context.Context, userID string) (UserOption, error) {
 	row := q.db.QueryRowContext(ctx, getUserOptions, userID)
 	var i UserOption
-	err := row.Scan(&i.UserID, &i.CompletedWelcome)
+	err := row.Scan(
+		&i.UserID,
+		&i.CompletedWelcome,
+		&i.WebhookUrl,
+		&i.WebhookFormat,
+		&i.WebhookToken,
+		&i.WebhookTokenEncrypted,
+	)
 	return i, err
 }
 
+const setUserWebhook = `-- name: SetUserWebhook :exec
+UPDATE user_options
+SET webhook_url = ?1, webhook_format = ?2, webhook_token = ?3,
+    webhook_token_encrypted = ?4
+WHERE user_id = ?5
+`
+
+type SetUserWebhookParams struct {
+	WebhookUrl            string `json:"webhook_url"`
+	WebhookFormat         string `json:"webhook_format"`
+	WebhookToken          string `json:"webhook_token"`
+	WebhookTokenEncrypted bool   `json:"webhook_token_encrypted"`
+	UserID                string `json:"user_id"`
+}
+
+func (q *Queries) SetUserWebhook(ctx context.Context, arg SetUserWebhookParams) error {
+	_, err := q.db.ExecContext(ctx, setUserWebhook,
+		arg.WebhookUrl,
+		arg.WebhookFormat,
+		arg.WebhookToken,
+		arg.WebhookTokenEncrypted,
+		arg.UserID,
+	)
+	return err
+}
+
 const updateUserOptions = `-- name: UpdateUserOptions :exec
 UPDATE user_options
 SET completed_welcome = coalesce(?1, completed_welcome)
@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/util"
+)
+
+// CurrentVersion is the schema version matching persistence.AppPackage. Packages using older versions are migrated to
+// it when parsed
+const CurrentVersion = "v1.0"
+
+// legacyVersion is used for packages that don't specify a schema version
+const legacyVersion = "v1.0"
+
+var UnsupportedVersionError = errors.New("unsupported package schema version")
+
+// migration converts a package from one schema version to the next. Packages are migrated as generic JSON objects, so
+// fields can be renamed, moved or restructured before the package is decoded to the internal model
+type migration struct {
+	from    string
+	to      string
+	migrate func(app map[string]any) error
+}
+
+// migrations contains the migration from each previous schema version to the next. When the package format changes
+// CurrentVersion is increased and a migration from the previous version is added, so existing packages keep working
+var migrations []migration
+
+// Parse decodes a package schema, migrating it to the current schema version
+func Parse(data []byte) (persistence.AppPackage, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return persistence.AppPackage{}, err
+	}
+
+	version, _ := raw["schema"].(string)
+	if version == "" {
+		version = legacyVersion
+	}
+	if err := migrate(raw, version); err != nil {
+		return persistence.AppPackage{}, err
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return persistence.AppPackage{}, err
+	}
+	var app persistence.AppPackage
+	if err := json.Unmarshal(migrated, &app); err != nil {
+		return persistence.AppPackage{}, err
+	}
+	return app, nil
+}
+
+// migrate applies migrations to the package until it reaches the current schema version
+func migrate(raw map[string]any, version string) error {
+	for version != CurrentVersion {
+		index := slices.IndexFunc(migrations, func(m migration) bool {
+			return m.from == version
+		})
+		if index == -1 {
+			return fmt.Errorf("%w: %s", UnsupportedVersionError, version)
+		}
+
+		if err := migrations[index].migrate(raw); err != nil {
+			return fmt.Errorf("failed to migrate package from %s to %s: %w", version, migrations[index].to, err)
+		}
+		version = migrations[index].to
+		raw["schema"] = version
+	}
+
+	raw["schema"] = version
+	return nil
+}
+
+// startOrder returns the names of the package's containers ordered so each container comes after the containers it
+// depends on
+func startOrder(app persistence.AppPackage) ([]string, error) {
+	names := make([]string, len(app.Containers))
+	dependencies := make(map[string][]string)
+	for i, container := range app.Containers {
+		names[i] = container.Name
+		for _, dependency := range container.DependsOn {
+			dependencies[container.Name] = append(dependencies[container.Name], dependency.Container)
+		}
+	}
+	return util.TopologicalSort(names, dependencies)
+}
+
+// ProxyRoutes returns the routes proxied to the container, with paths normalised to start with a slash and not end with
+// one. Proxy targets without routes are served at the root of the app's host, and routes without a port use the
+// container's proxy port
+func ProxyRoutes(container persistence.PackageContainer) []persistence.PackageRoute {
+	if !container.ProxyTarget {
+		return nil
+	}
+	if len(container.Routes) == 0 {
+		return []persistence.PackageRoute{{Path: "/", Port: container.ProxyPort, WebSocket: true}}
+	}
+
+	routes := make([]persistence.PackageRoute, len(container.Routes))
+	for i, route := range container.Routes {
+		route.Path = "/" + strings.Trim(route.Path, "/")
+		if route.Port == "" {
+			route.Port = container.ProxyPort
+		}
+		routes[i] = route
+	}
+	return routes
+}
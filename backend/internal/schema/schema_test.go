@@ -0,0 +1,387 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// Tests every package in the store parses and is valid
+func TestStorePackages(t *testing.T) {
+	schemaFiles, err := filepath.Glob("../../../apps/packages/*/schema.json")
+	if err != nil {
+		t.Fatalf("Failed to find packages: %s", err.Error())
+	}
+	if len(schemaFiles) == 0 {
+		t.Fatal("No packages found")
+	}
+
+	for _, schemaFile := range schemaFiles {
+		t.Run(filepath.Base(filepath.Dir(schemaFile)), func(t *testing.T) {
+			data, err := os.ReadFile(schemaFile)
+			if err != nil {
+				t.Fatalf("Failed to read package: %s", err.Error())
+			}
+			app, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Failed to parse package: %s", err.Error())
+			}
+			if err := Validate(app); err != nil {
+				t.Errorf("Unexpected validation error: %s", err.Error())
+			}
+		})
+	}
+}
+
+// Tests every problem with a package is reported
+func TestValidate(t *testing.T) {
+	restart := "sometimes"
+	app := persistence.AppPackage{
+		Schema:                 CurrentVersion,
+		Version:                "latest",
+		Id:                     "Invalid",
+		Name:                   "app",
+		OidcEndpointAuthMethod: &restart,
+		Containers: []persistence.PackageContainer{
+			{
+				Name:        "web",
+				Image:       "nginx",
+				Restart:     restart,
+				Ports:       []string{"8080", "80:80/sctp", "8080:80/udp"},
+				Volumes:     []string{"data", "./../secrets:/secrets", "data:relative", "data:/data:ro,shared", "data:/data:bad"},
+				ProxyTarget: true,
+				ProxyPort:   "http",
+			},
+			{
+				Name:        "web",
+				ProxyTarget: true,
+				ProxyPort:   "80",
+			},
+		},
+	}
+
+	var validationErr ValidationError
+	if !errors.As(Validate(app), &validationErr) {
+		t.Fatal("Expected validation error")
+	}
+
+	expected := []FieldError{
+		{Field: "id", Message: "must be lowercase words separated by dots, such as author.app"},
+		{Field: "version", Message: `"latest" isn't a valid semantic version`},
+		{Field: "oidc_endpoint_auth_method", Message: `unknown method "sometimes"`},
+		{Field: "containers[0].restart", Message: `unknown restart policy "sometimes"`},
+		{Field: "containers[0].ports[0]", Message: `"8080" must be in the format host:container`},
+		{Field: "containers[0].ports[1]", Message: `unknown protocol "sctp"`},
+		{Field: "containers[0].volumes[0]", Message: `"data" must be in the format source:target or source:target:options`},
+		{Field: "containers[0].volumes[1]", Message: `"./../secrets" is outside the app's data directory`},
+		{Field: "containers[0].volumes[2]", Message: `target "relative" must be an absolute path`},
+		{Field: "containers[0].volumes[4]", Message: `unknown volume option "bad"`},
+		{Field: "containers[0].proxy_port", Message: `"http" isn't a valid port`},
+		{Field: "containers[1].name", Message: `"web" is used by another container`},
+		{Field: "containers[1].image", Message: "must be set"},
+		{Field: "containers[1]", Message: "route / is already sent to web"},
+	}
+	if diff := cmp.Diff(expected, validationErr.Errors); diff != "" {
+		t.Errorf("Validation errors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Tests packages are migrated through each schema version in order
+func TestParseMigrations(t *testing.T) {
+	previousMigrations := migrations
+	defer func() { migrations = previousMigrations }()
+
+	// Simulates the current version being reached from two older versions, the oldest of which used a different name
+	// for the containers field
+	migrations = []migration{
+		{from: "v0.8", to: "v0.9", migrate: func(app map[string]any) error {
+			app["containers"] = app["services"]
+			delete(app, "services")
+			return nil
+		}},
+		{from: "v0.9", to: CurrentVersion, migrate: func(app map[string]any) error {
+			app["name"] = app["name"].(string) + " migrated"
+			return nil
+		}},
+	}
+
+	app, err := Parse([]byte(`{"schema": "v0.8", "id": "test.app", "name": "app", "services": [{"name": "web"}]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	expected := persistence.AppPackage{
+		Schema:     CurrentVersion,
+		Id:         "test.app",
+		Name:       "app migrated",
+		Containers: []persistence.PackageContainer{{Name: "web"}},
+	}
+	if diff := cmp.Diff(expected, app); diff != "" {
+		t.Errorf("Parsed package mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := Parse([]byte(`{"schema": "v9.0"}`)); !errors.Is(err, UnsupportedVersionError) {
+		t.Errorf("Expected unsupported version error, got %v", err)
+	}
+}
+
+// Tests dependencies, healthchecks and limits are checked
+func TestValidateDependencies(t *testing.T) {
+	app := persistence.AppPackage{
+		Schema:  CurrentVersion,
+		Version: "v1.0",
+		Id:      "test.app",
+		Name:    "app",
+		Containers: []persistence.PackageContainer{
+			{
+				Name:      "server",
+				Image:     "server",
+				DependsOn: []persistence.PackageDependency{{Container: "database", Condition: persistence.DependencyHealthy}},
+				Healthcheck: &persistence.PackageHealthcheck{
+					Test:     []string{"curl", "localhost"},
+					Interval: "often",
+					Retries:  -1,
+				},
+				ProxyTarget: true,
+				ProxyPort:   "80",
+			},
+			{
+				Name:  "database",
+				Image: "postgres",
+				DependsOn: []persistence.PackageDependency{
+					{Container: "server"},
+					{Container: "database", Condition: "ready"},
+					{Container: "cache"},
+				},
+				Healthcheck: &persistence.PackageHealthcheck{Test: []string{"CMD", "pg_isready"}, Interval: "10s"},
+				Limits:      &persistence.PackageLimits{Memory: "lots", Cpus: -1, Pids: 100},
+			},
+		},
+	}
+
+	var validationErr ValidationError
+	if !errors.As(Validate(app), &validationErr) {
+		t.Fatal("Expected validation error")
+	}
+
+	expected := []FieldError{
+		{Field: "containers[0].healthcheck.test", Message: "must start with NONE, CMD or CMD-SHELL"},
+		{Field: "containers[0].healthcheck.interval", Message: `"often" isn't a valid duration`},
+		{Field: "containers[0].healthcheck.retries", Message: "can't be negative"},
+		{Field: "containers[1].depends_on[1]", Message: "container can't depend on itself"},
+		{Field: "containers[1].depends_on[1]", Message: `unknown condition "ready"`},
+		{Field: "containers[1].depends_on[2]", Message: `unknown container "cache"`},
+		{Field: "containers[1].limits.memory", Message: `"lots" isn't a valid size, such as 512m or 2g`},
+		{Field: "containers[1].limits.cpus", Message: "can't be negative"},
+		{Field: "containers", Message: "dependency cycle: server -> database -> server"},
+	}
+	if diff := cmp.Diff(expected, validationErr.Errors); diff != "" {
+		t.Errorf("Validation errors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Tests setting declarations and the values set by admins are checked against their types
+func TestValidateSettings(t *testing.T) {
+	app := persistence.AppPackage{
+		Schema:  CurrentVersion,
+		Version: "v1.0",
+		Id:      "test.app",
+		Name:    "app",
+		Containers: []persistence.PackageContainer{
+			{Name: "server", Image: "server", ProxyTarget: true, ProxyPort: "80"},
+		},
+		Settings: []persistence.PackageSetting{
+			{Key: "timezone", Type: persistence.SettingString, Default: "UTC"},
+			{Key: "workers", Type: persistence.SettingNumber, Default: "many"},
+			{Key: "workers", Type: persistence.SettingBoolean, Default: "yes"},
+			{Key: "Smtp-Password", Type: persistence.SettingSecret},
+			{Key: "colour", Type: "color"},
+		},
+	}
+
+	var validationErr ValidationError
+	if !errors.As(Validate(app), &validationErr) {
+		t.Fatal("Expected validation error")
+	}
+	expected := []FieldError{
+		{Field: "settings[1].default", Message: `"many" isn't a number`},
+		{Field: "settings[2].key", Message: `"workers" is used by another setting`},
+		{Field: "settings[2].default", Message: `"yes" must be true or false`},
+		{Field: "settings[3].key", Message: `"Smtp-Password" must be lowercase letters, numbers and underscores`},
+		{Field: "settings[4].type", Message: `unknown type "color"`},
+	}
+	if diff := cmp.Diff(expected, validationErr.Errors); diff != "" {
+		t.Errorf("Validation errors mismatch (-want +got):\n%s", diff)
+	}
+
+	app.Settings = app.Settings[:2]
+	app.Settings[1].Default = "4"
+	if err := Validate(app); err != nil {
+		t.Fatalf("Unexpected validation error: %s", err.Error())
+	}
+
+	err := ValidateSettings(app, map[string]string{"timezone": "Europe/London", "workers": "four", "theme": "dark"})
+	if !errors.As(err, &validationErr) {
+		t.Fatal("Expected validation error")
+	}
+	expected = []FieldError{
+		{Field: "settings.theme", Message: "unknown setting"},
+		{Field: "settings.workers", Message: `"four" isn't a number`},
+	}
+	if diff := cmp.Diff(expected, validationErr.Errors); diff != "" {
+		t.Errorf("Validation errors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Tests secret keys and lengths are checked
+func TestValidateSecrets(t *testing.T) {
+	app := persistence.AppPackage{
+		Schema:  CurrentVersion,
+		Version: "v1.0",
+		Id:      "test.app",
+		Name:    "app",
+		Containers: []persistence.PackageContainer{
+			{Name: "server", Image: "server", ProxyTarget: true, ProxyPort: "80"},
+		},
+		Secrets: []persistence.PackageSecret{
+			{Key: "db_password"},
+			{Key: "db_password", Length: 16},
+			{Key: "app-key", Length: 4},
+		},
+	}
+
+	var validationErr ValidationError
+	if !errors.As(Validate(app), &validationErr) {
+		t.Fatal("Expected validation error")
+	}
+	expected := []FieldError{
+		{Field: "secrets[1].key", Message: `"db_password" is used by another secret`},
+		{Field: "secrets[2].key", Message: `"app-key" must be lowercase letters, numbers and underscores`},
+		{Field: "secrets[2].length", Message: "must be between 8 and 256"},
+	}
+	if diff := cmp.Diff(expected, validationErr.Errors); diff != "" {
+		t.Errorf("Validation errors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Tests backup hooks are checked and can't run in containers stopped during backup
+func TestValidateBackup(t *testing.T) {
+	app := persistence.AppPackage{
+		Schema:  CurrentVersion,
+		Version: "v1.0",
+		Id:      "test.app",
+		Name:    "app",
+		Containers: []persistence.PackageContainer{
+			{
+				Name:        "server",
+				Image:       "server",
+				ProxyTarget: true,
+				ProxyPort:   "80",
+				Backup:      &persistence.PackageBackup{Stop: true},
+			},
+			{
+				Name:   "database",
+				Image:  "postgres",
+				Backup: &persistence.PackageBackup{Pre: []string{"pg_dump", "-f", "/data/dump.sql"}, Timeout: "30m"},
+			},
+			{
+				Name:   "cache",
+				Image:  "redis",
+				Backup: &persistence.PackageBackup{Pre: []string{"redis-cli", "save"}, Post: []string{}, Timeout: "soon", Stop: true},
+			},
+		},
+	}
+
+	var validationErr ValidationError
+	if !errors.As(Validate(app), &validationErr) {
+		t.Fatal("Expected validation error")
+	}
+	expected := []FieldError{
+		{Field: "containers[2].backup.pre", Message: "can't be run in a container stopped during backup"},
+		{Field: "containers[2].backup.post", Message: `must be a command in exec form, such as ["pg_dump", "-f", "/data/dump.sql"]`},
+		{Field: "containers[2].backup.timeout", Message: `"soon" isn't a valid duration`},
+	}
+	if diff := cmp.Diff(expected, validationErr.Errors); diff != "" {
+		t.Errorf("Validation errors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Tests routes are checked and can't be sent to more than one container
+func TestValidateRoutes(t *testing.T) {
+	app := persistence.AppPackage{
+		Schema:  CurrentVersion,
+		Version: "v1.0",
+		Id:      "test.app",
+		Name:    "app",
+		Containers: []persistence.PackageContainer{
+			{
+				Name:        "web",
+				Image:       "web",
+				ProxyTarget: true,
+				ProxyPort:   "80",
+			},
+			{
+				Name:        "api",
+				Image:       "api",
+				ProxyTarget: true,
+				Routes: []persistence.PackageRoute{
+					{Path: "/api/", Port: "8080", StripPrefix: true},
+					{Subdomain: "admin", Path: "/", Port: "8081"},
+					{Subdomain: "Admin_", Path: "admin", Port: "http"},
+					{Path: "/"},
+				},
+			},
+			{
+				Name:   "worker",
+				Image:  "worker",
+				Routes: []persistence.PackageRoute{{Path: "/jobs", Port: "9000"}},
+			},
+		},
+	}
+
+	var validationErr ValidationError
+	if !errors.As(Validate(app), &validationErr) {
+		t.Fatal("Expected validation error")
+	}
+	expected := []FieldError{
+		{Field: "containers[1].routes[2].subdomain", Message: `"Admin_" must be lowercase letters, numbers and hyphens`},
+		{Field: "containers[1].routes[2].path", Message: `"admin" must start with /`},
+		{Field: "containers[1].routes[2].port", Message: `"http" isn't a valid port`},
+		{Field: "containers[1]", Message: "route / is already sent to web"},
+		{Field: "containers[1].proxy_port", Message: `"" isn't a valid port`},
+		{Field: "containers[2].routes", Message: "can only be set on proxy targets"},
+	}
+	if diff := cmp.Diff(expected, validationErr.Errors); diff != "" {
+		t.Errorf("Validation errors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Tests proxy targets without routes are served at the root of the app's host, and route paths and ports are filled in
+func TestProxyRoutes(t *testing.T) {
+	container := persistence.PackageContainer{Name: "web", ProxyTarget: true, ProxyPort: "80"}
+	if diff := cmp.Diff([]persistence.PackageRoute{{Path: "/", Port: "80", WebSocket: true}}, ProxyRoutes(container)); diff != "" {
+		t.Errorf("Routes mismatch (-want +got):\n%s", diff)
+	}
+
+	container.Routes = []persistence.PackageRoute{
+		{Path: "/api/", StripPrefix: true},
+		{Subdomain: "admin", Port: "8081", WebSocket: true},
+	}
+	expected := []persistence.PackageRoute{
+		{Path: "/api", Port: "80", StripPrefix: true},
+		{Subdomain: "admin", Path: "/", Port: "8081", WebSocket: true},
+	}
+	if diff := cmp.Diff(expected, ProxyRoutes(container)); diff != "" {
+		t.Errorf("Routes mismatch (-want +got):\n%s", diff)
+	}
+
+	container.ProxyTarget = false
+	if routes := ProxyRoutes(container); routes != nil {
+		t.Errorf("Expected no routes for container that isn't a proxy target, got %+v", routes)
+	}
+}
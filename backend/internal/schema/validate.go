@@ -0,0 +1,402 @@
+package schema
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"golang.org/x/mod/semver"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+// FieldError describes a problem with a single field of a package, such as containers[0].ports[1]
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError contains every problem found when validating a package
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fmt.Sprintf("%s: %s", fieldErr.Field, fieldErr.Message)
+	}
+	return "invalid package: " + strings.Join(messages, "; ")
+}
+
+var (
+	// IDs are used in container, network and volume names, so are limited to characters docker accepts in them
+	packageIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*(\.[a-z0-9][a-z0-9_-]*)+$`)
+	namePattern      = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	// Setting and secret keys are used as template fields, so must be valid Go identifiers
+	settingKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	subdomainPattern  = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+)
+
+const (
+	minSecretLength = 8
+	maxSecretLength = 256
+)
+
+var restartPolicies = []string{"", "no", "always", "on-failure", "unless-stopped"}
+var volumeOptions = []string{"ro", "rw", "z", "Z", "shared", "rshared", "slave", "rslave", "private", "rprivate", "nocopy"}
+var dependencyConditions = []string{"", persistence.DependencyStarted, persistence.DependencyHealthy}
+var healthcheckTypes = []string{"NONE", "CMD", "CMD-SHELL"}
+var settingTypes = []string{persistence.SettingString, persistence.SettingNumber, persistence.SettingBoolean, persistence.SettingSecret}
+var endpointAuthMethods = []string{"client_secret_basic", "client_secret_post", "client_secret_jwt", "private_key_jwt", "none"}
+
+// validator collects errors for each field checked
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field string, format string, args ...any) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks every field of a package can be installed, returning a ValidationError listing all problems found
+func Validate(app persistence.AppPackage) error {
+	v := &validator{}
+
+	if app.Schema != CurrentVersion {
+		v.add("schema", "unsupported schema version %q, expected %s", app.Schema, CurrentVersion)
+	}
+	if !packageIdPattern.MatchString(app.Id) {
+		v.add("id", "must be lowercase words separated by dots, such as author.app")
+	}
+	if app.Name == "" {
+		v.add("name", "must be set")
+	}
+	if !semver.IsValid(app.Version) {
+		v.add("version", "%q isn't a valid semantic version", app.Version)
+	}
+	if app.OidcEndpointAuthMethod != nil && !slices.Contains(endpointAuthMethods, *app.OidcEndpointAuthMethod) {
+		v.add("oidc_endpoint_auth_method", "unknown method %q", *app.OidcEndpointAuthMethod)
+	}
+
+	if len(app.Containers) == 0 {
+		v.add("containers", "must have at least one container")
+	}
+
+	names := make(map[string]bool)
+	proxyTargets := 0
+	// The container each route is sent to, keyed by the route's subdomain and path
+	routes := make(map[[2]string]string)
+	for i, container := range app.Containers {
+		field := fmt.Sprintf("containers[%d]", i)
+
+		if !namePattern.MatchString(container.Name) {
+			v.add(field+".name", "%q isn't a valid container name", container.Name)
+		} else if names[container.Name] {
+			v.add(field+".name", "%q is used by another container", container.Name)
+		}
+		names[container.Name] = true
+
+		if container.Image == "" {
+			v.add(field+".image", "must be set")
+		}
+		if !slices.Contains(restartPolicies, container.Restart) {
+			v.add(field+".restart", "unknown restart policy %q", container.Restart)
+		}
+
+		for j, port := range container.Ports {
+			v.validatePort(fmt.Sprintf("%s.ports[%d]", field, j), port)
+		}
+		for j, volume := range container.Volumes {
+			v.validateVolume(fmt.Sprintf("%s.volumes[%d]", field, j), volume)
+		}
+		for j, extraHost := range container.ExtraHosts {
+			if host, address, ok := strings.Cut(extraHost, ":"); !ok || host == "" || address == "" {
+				v.add(fmt.Sprintf("%s.extra_hosts[%d]", field, j), "%q must be in the format host:address", extraHost)
+			}
+		}
+
+		for j, dependency := range container.DependsOn {
+			dependencyField := fmt.Sprintf("%s.depends_on[%d]", field, j)
+			if dependency.Container == container.Name {
+				v.add(dependencyField, "container can't depend on itself")
+			} else if !slices.ContainsFunc(app.Containers, func(c persistence.PackageContainer) bool {
+				return c.Name == dependency.Container
+			}) {
+				v.add(dependencyField, "unknown container %q", dependency.Container)
+			}
+			if !slices.Contains(dependencyConditions, dependency.Condition) {
+				v.add(dependencyField, "unknown condition %q", dependency.Condition)
+			}
+		}
+		if container.Healthcheck != nil {
+			v.validateHealthcheck(field+".healthcheck", *container.Healthcheck)
+		}
+		if container.Limits != nil {
+			v.validateLimits(field+".limits", *container.Limits)
+		}
+		if container.Backup != nil {
+			v.validateBackup(field+".backup", *container.Backup)
+		}
+
+		for j, route := range container.Routes {
+			v.validateRoute(fmt.Sprintf("%s.routes[%d]", field, j), route)
+		}
+		if len(container.Routes) > 0 && !container.ProxyTarget {
+			v.add(field+".routes", "can only be set on proxy targets")
+		}
+
+		if container.ProxyTarget {
+			proxyTargets++
+			usesProxyPort := false
+			for _, route := range ProxyRoutes(container) {
+				usesProxyPort = usesProxyPort || route.Port == container.ProxyPort
+				key := [2]string{route.Subdomain, route.Path}
+				if other, ok := routes[key]; ok {
+					v.add(field, "route %s is already sent to %s", describeRoute(route), other)
+				}
+				routes[key] = container.Name
+			}
+			if usesProxyPort && !validPortNumber(container.ProxyPort) {
+				v.add(field+".proxy_port", "%q isn't a valid port", container.ProxyPort)
+			}
+		}
+	}
+
+	if proxyTargets == 0 {
+		v.add("containers", "at least one container must be the proxy target")
+	}
+	if _, err := startOrder(app); err != nil {
+		v.add("containers", err.Error())
+	}
+
+	keys := make(map[string]bool)
+	for i, setting := range app.Settings {
+		field := fmt.Sprintf("settings[%d]", i)
+
+		if !settingKeyPattern.MatchString(setting.Key) {
+			v.add(field+".key", "%q must be lowercase letters, numbers and underscores", setting.Key)
+		} else if keys[setting.Key] {
+			v.add(field+".key", "%q is used by another setting", setting.Key)
+		}
+		keys[setting.Key] = true
+
+		if !slices.Contains(settingTypes, setting.Type) {
+			v.add(field+".type", "unknown type %q", setting.Type)
+		} else if setting.Default != "" {
+			v.validateSettingValue(field+".default", setting, setting.Default)
+		}
+	}
+
+	secretKeys := make(map[string]bool)
+	for i, secret := range app.Secrets {
+		field := fmt.Sprintf("secrets[%d]", i)
+
+		if !settingKeyPattern.MatchString(secret.Key) {
+			v.add(field+".key", "%q must be lowercase letters, numbers and underscores", secret.Key)
+		} else if secretKeys[secret.Key] {
+			v.add(field+".key", "%q is used by another secret", secret.Key)
+		}
+		secretKeys[secret.Key] = true
+
+		if secret.Length != 0 && (secret.Length < minSecretLength || secret.Length > maxSecretLength) {
+			v.add(field+".length", "must be between %d and %d", minSecretLength, maxSecretLength)
+		}
+	}
+
+	if len(v.errors) > 0 {
+		return ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+// validatePort checks a port mapping is in the format host:container, optionally followed by /tcp or /udp
+func (v *validator) validatePort(field string, port string) {
+	hostPort, containerPort, ok := strings.Cut(port, ":")
+	if !ok {
+		v.add(field, "%q must be in the format host:container", port)
+		return
+	}
+
+	containerPort, protocol, hasProtocol := strings.Cut(containerPort, "/")
+	if hasProtocol && protocol != "tcp" && protocol != "udp" {
+		v.add(field, "unknown protocol %q", protocol)
+	}
+	if !validPortNumber(hostPort) || !validPortNumber(containerPort) {
+		v.add(field, "%q must map between valid port numbers", port)
+	}
+}
+
+// validateVolume checks a volume is in the format source:target, optionally followed by mount options. The source can
+// be a named volume, an absolute path, a path within the app's data directory starting with ./ or !AppDir
+func (v *validator) validateVolume(field string, volume string) {
+	parts := strings.Split(volume, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		v.add(field, "%q must be in the format source:target or source:target:options", volume)
+		return
+	}
+
+	source := parts[0]
+	switch {
+	case strings.HasPrefix(source, "./"):
+		if relative := strings.TrimPrefix(source, "./"); relative != "" && !filepath.IsLocal(relative) {
+			v.add(field, "%q is outside the app's data directory", source)
+		}
+	case strings.HasPrefix(source, "!AppDir"), strings.HasPrefix(source, "/"):
+	case !namePattern.MatchString(source):
+		v.add(field, "%q isn't a valid volume name", source)
+	}
+
+	if !strings.HasPrefix(parts[1], "/") {
+		v.add(field, "target %q must be an absolute path", parts[1])
+	}
+
+	if len(parts) == 3 {
+		for _, option := range strings.Split(parts[2], ",") {
+			if !slices.Contains(volumeOptions, option) {
+				v.add(field, "unknown volume option %q", option)
+			}
+		}
+	}
+}
+
+// validateRoute checks the route's subdomain can be used in a host name, its path is absolute and its port is valid
+func (v *validator) validateRoute(field string, route persistence.PackageRoute) {
+	if route.Subdomain != "" && !subdomainPattern.MatchString(route.Subdomain) {
+		v.add(field+".subdomain", "%q must be lowercase letters, numbers and hyphens", route.Subdomain)
+	}
+	if route.Path != "" && !strings.HasPrefix(route.Path, "/") {
+		v.add(field+".path", "%q must start with /", route.Path)
+	}
+	if route.Port != "" && !validPortNumber(route.Port) {
+		v.add(field+".port", "%q isn't a valid port", route.Port)
+	}
+}
+
+// describeRoute formats a route for errors, such as /api on the admin subdomain
+func describeRoute(route persistence.PackageRoute) string {
+	if route.Subdomain == "" {
+		return route.Path
+	}
+	return fmt.Sprintf("%s on the %s subdomain", route.Path, route.Subdomain)
+}
+
+// validateHealthcheck checks the healthcheck test is a command docker accepts and each duration can be parsed
+func (v *validator) validateHealthcheck(field string, healthcheck persistence.PackageHealthcheck) {
+	if len(healthcheck.Test) == 0 || !slices.Contains(healthcheckTypes, healthcheck.Test[0]) {
+		v.add(field+".test", "must start with NONE, CMD or CMD-SHELL")
+	}
+
+	durations := map[string]string{
+		"interval":     healthcheck.Interval,
+		"timeout":      healthcheck.Timeout,
+		"start_period": healthcheck.StartPeriod,
+	}
+	for _, name := range []string{"interval", "timeout", "start_period"} {
+		if duration := durations[name]; duration != "" {
+			if parsed, err := time.ParseDuration(duration); err != nil || parsed < 0 {
+				v.add(field+"."+name, "%q isn't a valid duration", duration)
+			}
+		}
+	}
+
+	if healthcheck.Retries < 0 {
+		v.add(field+".retries", "can't be negative")
+	}
+}
+
+// validateBackup checks the backup hooks have no empty commands, aren't combined with stopping the container as they're
+// run inside it, and that the timeout can be parsed
+func (v *validator) validateBackup(field string, backup persistence.PackageBackup) {
+	commands := map[string][]string{"pre": backup.Pre, "post": backup.Post}
+	for _, name := range []string{"pre", "post"} {
+		command := commands[name]
+		if command != nil && (len(command) == 0 || command[0] == "") {
+			v.add(field+"."+name, "must be a command in exec form, such as [\"pg_dump\", \"-f\", \"/data/dump.sql\"]")
+		}
+		if len(command) > 0 && backup.Stop {
+			v.add(field+"."+name, "can't be run in a container stopped during backup")
+		}
+	}
+
+	if backup.Timeout != "" {
+		if timeout, err := time.ParseDuration(backup.Timeout); err != nil || timeout <= 0 {
+			v.add(field+".timeout", "%q isn't a valid duration", backup.Timeout)
+		}
+	}
+}
+
+// ValidateLimits checks the resource limits for a container are valid, used for limits set outside of packages
+func ValidateLimits(limits persistence.PackageLimits) error {
+	v := &validator{}
+	v.validateLimits("limits", limits)
+	if len(v.errors) > 0 {
+		return ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+// validateLimits checks the memory limit has a valid size and other limits aren't negative
+func (v *validator) validateLimits(field string, limits persistence.PackageLimits) {
+	if limits.Memory != "" {
+		if memory, err := units.RAMInBytes(limits.Memory); err != nil || memory <= 0 {
+			v.add(field+".memory", "%q isn't a valid size, such as 512m or 2g", limits.Memory)
+		}
+	}
+	if limits.Cpus < 0 {
+		v.add(field+".cpus", "can't be negative")
+	}
+	if limits.Pids < 0 {
+		v.add(field+".pids", "can't be negative")
+	}
+}
+
+// ValidateSettings checks values set by an admin are declared by the package and match the type of the setting
+func ValidateSettings(app persistence.AppPackage, values map[string]string) error {
+	v := &validator{}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		index := slices.IndexFunc(app.Settings, func(setting persistence.PackageSetting) bool {
+			return setting.Key == key
+		})
+		if index == -1 {
+			v.add("settings."+key, "unknown setting")
+			continue
+		}
+		v.validateSettingValue("settings."+key, app.Settings[index], values[key])
+	}
+
+	if len(v.errors) > 0 {
+		return ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+// validateSettingValue checks number and boolean settings can be parsed. An empty value is always allowed, leaving the
+// setting unset
+func (v *validator) validateSettingValue(field string, setting persistence.PackageSetting, value string) {
+	if value == "" {
+		return
+	}
+
+	switch setting.Type {
+	case persistence.SettingNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			v.add(field, "%q isn't a number", value)
+		}
+	case persistence.SettingBoolean:
+		if value != "true" && value != "false" {
+			v.add(field, "%q must be true or false", value)
+		}
+	}
+}
+
+func validPortNumber(port string) bool {
+	number, err := strconv.Atoi(port)
+	return err == nil && number > 0 && number <= 65535
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+
+	"github.com/An-Owlbear/homecloud/backend"
+	"github.com/An-Owlbear/homecloud/backend/internal/apps"
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+const driftUsage = `usage: homecloud drift [repair <number> remove]
+
+Lists differences between the installed apps and the containers, networks, volumes and OAuth2 clients that exist.
+Orphaned and unexpected resources can be removed by their number in the list. Reinstalling and adopting apps must be
+done through the admin API while the server is running, since it updates the server's proxies`
+
+// printProgress writes the steps of a repair to stdout
+type printProgress struct{}
+
+func (printProgress) Step(name string) {
+	fmt.Println(name)
+}
+
+func (printProgress) PullProgress(image string, message jsonmessage.JSONMessage) {}
+
+// DriftCommand reports drift between the database, docker and hydra, optionally removing an orphaned resource
+func DriftCommand(args []string) error {
+	serverConfig, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer dockerClient.Close()
+
+	db, err := persistence.SetupDB(config.DatabasePath, backend.Migrations)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	queries := persistence.New(db)
+	hydraAdmin := newHydraAdmin(serverConfig.Ory)
+
+	ctx := context.Background()
+	drift, err := apps.DetectDrift(ctx, dockerClient, queries, hydraAdmin)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) == 0:
+		if len(drift) == 0 {
+			fmt.Println("No drift found")
+			return nil
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "#\tKIND\tAPP\tMESSAGE\tACTIONS")
+		for i, d := range drift {
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%v\n", i+1, d.Kind, d.AppID, d.Message, d.Actions)
+		}
+		return writer.Flush()
+	case len(args) == 3 && args[0] == "repair" && args[2] == string(apps.RepairRemove):
+		number, err := strconv.Atoi(args[1])
+		if err != nil || number < 1 || number > len(drift) {
+			return fmt.Errorf("%w: %s", apps.DriftNotFoundError, args[1])
+		}
+		return apps.RepairDrift(
+			ctx, printProgress{}, dockerClient, queries, hydraAdmin, nil, nil,
+			serverConfig.Ory, serverConfig.Host, serverConfig.Storage, serverConfig.Docker,
+			drift[number-1], apps.RepairRemove,
+		)
+	default:
+		return errors.New(driftUsage)
+	}
+}
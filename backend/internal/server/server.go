@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
@@ -25,25 +26,45 @@ import (
 	"github.com/An-Owlbear/homecloud/backend/internal/api"
 	"github.com/An-Owlbear/homecloud/backend/internal/apps"
 	"github.com/An-Owlbear/homecloud/backend/internal/auth"
+	"github.com/An-Owlbear/homecloud/backend/internal/backup"
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
+	"github.com/An-Owlbear/homecloud/backend/internal/jobs"
+	"github.com/An-Owlbear/homecloud/backend/internal/metrics"
+	"github.com/An-Owlbear/homecloud/backend/internal/notifications"
 	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
 	"github.com/An-Owlbear/homecloud/backend/internal/storage"
 )
 
-func CreateServer() {
-	// Loads configuration
+// loadConfig loads the environment files and configuration
+func loadConfig() (*config.Config, error) {
 	if os.Getenv("ENVIRONMENT") == "DEV" {
 		if err := godotenv.Load(".dev.env"); err != nil {
-			panic(err)
+			return nil, err
 		}
 	}
 	err := godotenv.Load()
 	if err != nil && !os.IsNotExist(err) {
-		panic(err)
+		return nil, err
+	}
+
+	return config.LoadConfig()
+}
+
+// newHydraAdmin creates a client for the hydra admin API
+func newHydraAdmin(oryConfig config.Ory) *hydra.APIClient {
+	hydraAdminConfig := hydra.NewConfiguration()
+	hydraAdminConfig.Servers = []hydra.ServerConfiguration{
+		{
+			URL: oryConfig.Hydra.PrivateAddress.String(),
+		},
 	}
+	return hydra.NewAPIClient(hydraAdminConfig)
+}
 
+func CreateServer() {
 	// Loads the configuration
-	serverConfig, err := config.LoadConfig()
+	serverConfig, err := loadConfig()
 	if err != nil {
 		panic(err)
 	}
@@ -61,41 +82,29 @@ func CreateServer() {
 	}
 
 	// Sets of database connection
-	db, err := persistence.SetupDB("db/data.db", backend.Migrations)
+	db, err := persistence.SetupDB(config.DatabasePath, backend.Migrations)
 	if err != nil {
 		panic(err)
 	}
 
 	queries := persistence.New(db)
+
+	// Sets up background jobs, marking any interrupted by the server stopping as failed
+	jobManager := jobs.NewManager(queries)
+	if err := jobManager.FailInterrupted(context.Background()); err != nil {
+		panic(err)
+	}
+
 	storeClient := apps.NewStoreClient(serverConfig.Store)
+	storeClient.SetQueries(queries)
 	err = storeClient.UpdatePackageList(context.Background(), queries)
 	if err != nil {
 		panic(err)
 	}
-
-	// Sets up function to automatically refresh package list
-	storeTicker := time.NewTicker(time.Hour)
-	go func() {
-		for {
-			select {
-			case <-storeTicker.C:
-				slog.Info("Updating package list...")
-				err := storeClient.UpdatePackageList(context.Background(), queries)
-				if err != nil {
-					slog.Error(err.Error())
-				}
-			}
-		}
-	}()
+	storeRefreshed := time.Now()
 
 	// Sets up ory hydra client
-	hydraAdminConfig := hydra.NewConfiguration()
-	hydraAdminConfig.Servers = []hydra.ServerConfiguration{
-		{
-			URL: serverConfig.Ory.Hydra.PrivateAddress.String(),
-		},
-	}
-	hydraAdmin := hydra.NewAPIClient(hydraAdminConfig)
+	hydraAdmin := newHydraAdmin(serverConfig.Ory)
 
 	// Sets up ory kratos client
 	kratosConfig := kratos.NewConfiguration()
@@ -117,10 +126,38 @@ func CreateServer() {
 
 	// Sets up data storage handling
 	appDataHandler := storage.NewAppDataHandler(serverConfig.Storage, serverConfig.Store)
+	appDataHandler.SetPackageDownloader(storeClient)
+
+	// Sets up encryption of app secrets, with the key kept alongside the database
+	encryptionKey, err := encryption.LoadOrCreateKey(config.EncryptionKeyPath)
+	if err != nil {
+		panic(err)
+	}
+	settingsCipher, err := encryption.NewCipher(encryptionKey)
+	if err != nil {
+		panic(err)
+	}
+	appDataHandler.SetCipher(settingsCipher)
 
 	// Sets up hosts config
-	hostsMap := apps.HostsMap{}
-	hosts := apps.NewHosts(hostsMap, nil, serverConfig.Host)
+	hosts := apps.NewHosts(apps.HostsMap{}, nil, serverConfig.Host)
+
+	// Recreates the apps of a system backup restored by the launcher, before they're started
+	err = apps.CompleteSystemRestore(
+		context.Background(),
+		dockerClient,
+		queries,
+		hydraAdmin,
+		hosts,
+		appDataHandler,
+		serverConfig.Ory,
+		serverConfig.Host,
+		serverConfig.Storage,
+		serverConfig.Docker,
+	)
+	if err != nil {
+		panic(err)
+	}
 
 	// Sets up proxies for installed apps
 	err = apps.SetupProxies(dockerClient, queries, hosts, appDataHandler, serverConfig.Host, serverConfig.Ory)
@@ -128,6 +165,87 @@ func CreateServer() {
 		panic(err)
 	}
 
+	// Starts sending notifications to admins, including warnings about disk space and certificates
+	notifier := notifications.NewNotifier(
+		queries,
+		kratosAdmin.IdentityAPI,
+		settingsCipher,
+		serverConfig.Notifications,
+		serverConfig.Storage,
+	)
+	if err := notifier.EncryptWebhookTokens(context.Background()); err != nil {
+		panic(err)
+	}
+	go notifier.Run(context.Background(), hosts)
+
+	// Starts watching app containers, recording their state and restarting them if they crash
+	reconciler := apps.NewReconciler(dockerClient, queries, jobManager, notifier, serverConfig.Recovery)
+	go reconciler.Run(context.Background())
+
+	// Starts collecting resource usage of apps, and sets up recording of metrics for Prometheus
+	metricsCollector := metrics.NewCollector(dockerClient, queries)
+	go metricsCollector.Run(context.Background())
+	metricsExporter := metrics.NewExporter(dockerClient, queries, hosts, metricsCollector)
+	metricsExporter.ObserveStoreRefresh(nil, storeRefreshed)
+	jobManager.SetFinishHook(func(details persistence.JobDetails, duration time.Duration) {
+		metricsExporter.ObserveJob(details, duration)
+		notifier.ObserveJob(details, duration)
+	})
+
+	// Starts running backup schedules
+	backupTargets := backup.NewTargetStore(queries, settingsCipher)
+	backupScheduler := apps.NewBackupScheduler(
+		dockerClient,
+		queries,
+		appDataHandler,
+		jobManager,
+		backupTargets,
+		serverConfig.Host,
+		serverConfig.Storage,
+		serverConfig.Ory,
+		serverConfig.Docker,
+	)
+	go backupScheduler.Run(context.Background())
+
+	// Sets up function to automatically refresh package list and apply scheduled updates
+	storeTicker := time.NewTicker(time.Hour)
+	go func() {
+		for {
+			select {
+			case <-storeTicker.C:
+				slog.Info("Updating package list...")
+				err := storeClient.UpdatePackageList(context.Background(), queries)
+				metricsExporter.ObserveStoreRefresh(err, time.Now())
+				if err != nil {
+					slog.Error(err.Error())
+					continue
+				}
+
+				if err := apps.NotifyUpdates(context.Background(), queries, notifier); err != nil {
+					slog.Error(err.Error())
+				}
+
+				err = apps.RunScheduledUpdates(
+					context.Background(),
+					time.Now(),
+					jobManager,
+					dockerClient,
+					storeClient,
+					queries,
+					hosts,
+					appDataHandler,
+					serverConfig.Ory,
+					serverConfig.Host,
+					serverConfig.Storage,
+					serverConfig.Docker,
+				)
+				if err != nil {
+					slog.Error(err.Error())
+				}
+			}
+		}
+	}()
+
 	// Sets up proxy for launcher on host
 	launcherUrl, err := url.Parse(serverConfig.Launcher.Url)
 	if err != nil {
@@ -143,6 +261,7 @@ func CreateServer() {
 	api.AddRoutes(
 		backendApi,
 		dockerClient,
+		db,
 		queries,
 		storeClient,
 		hosts,
@@ -150,6 +269,12 @@ func CreateServer() {
 		kratosClient,
 		kratosAdmin.IdentityAPI,
 		appDataHandler,
+		jobManager,
+		metricsCollector,
+		reconciler,
+		notifier,
+		backupTargets,
+		backupScheduler,
 		*serverConfig,
 		launcherProxy,
 	)
@@ -157,7 +282,7 @@ func CreateServer() {
 	if serverConfig.Host.Port != 80 && serverConfig.Host.Port != 443 {
 		hostname = fmt.Sprintf("%s:%d", serverConfig.Host.Host, serverConfig.Host.Port)
 	}
-	hostsMap[hostname] = backendApi
+	hosts.SetHost(hostname, backendApi)
 
 	// Adds reverse proxies for ory services
 	hosts.AddProxy("hydra", "hydra", "4444")
@@ -165,6 +290,16 @@ func CreateServer() {
 
 	// Creates and starts the health check server
 	healthServer := HealthCheckServer(hosts)
+
+	// Serves Prometheus metrics on either the health check server or the main host
+	if serverConfig.Metrics.Enabled {
+		metricsHandler := api.PrometheusMetrics(metricsExporter, serverConfig.Metrics)
+		if serverConfig.Metrics.HealthServer {
+			healthServer.GET("/metrics", metricsHandler)
+		} else {
+			backendApi.GET("/metrics", metricsHandler)
+		}
+	}
 	go func() {
 		healthServer.Logger.Info(healthServer.Start(":1325"))
 	}()
@@ -186,12 +321,15 @@ func CreateServer() {
 		},
 	}))
 
-	// Checks which HTTP server/proxy to send traffic to
+	// Checks which HTTP server/proxy to send traffic to, recording the request for metrics
 	e.Any("/*", func(c echo.Context) (err error) {
-		if host, ok := hostsMap[c.Request().Host]; ok {
+		start := time.Now()
+		if host, ok := hosts.Host(c.Request().Host); ok {
 			host.ServeHTTP(c.Response(), c.Request())
+			metricsExporter.ObserveRequest(c.Request().Host, c.Response().Status, time.Since(start))
 		} else {
 			err = echo.ErrNotFound
+			metricsExporter.ObserveRequest(metrics.OtherHost, http.StatusNotFound, time.Since(start))
 		}
 
 		return
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"io"
@@ -13,13 +14,22 @@ import (
 	"strings"
 
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
 	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
 )
 
+// PackageDownloader retrieves package bundles, allowing packages to be downloaded from the store they're listed in and
+// verified before being extracted
+type PackageDownloader interface {
+	GetPackageBundle(packageId string, version string) ([]byte, error)
+}
+
 type AppDataHandler struct {
 	storageConfig config.Storage
 	storeConfig   config.Store
 	http          *http.Client
+	downloader    PackageDownloader
+	cipher        *encryption.Cipher
 }
 
 func NewAppDataHandler(storageConfig config.Storage, storeConfig config.Store) *AppDataHandler {
@@ -30,20 +40,114 @@ func NewAppDataHandler(storageConfig config.Storage, storeConfig config.Store) *
 	}
 }
 
-// SavePackage downloads and extracts the specified app package to the device
+// SetPackageDownloader sets the downloader used to retrieve packages. If not set packages are downloaded from the
+// configured store without verification
+func (h *AppDataHandler) SetPackageDownloader(downloader PackageDownloader) {
+	h.downloader = downloader
+}
+
+// SavePackage downloads and extracts the latest version of the specified app package to the device
 func (h *AppDataHandler) SavePackage(appId string) error {
-	packageUrl, err := url.JoinPath(strings.Trim(h.storeConfig.StoreUrl, "list.json"), "packages", appId, "package.tar.gz")
-	if err != nil {
-		return err
+	return h.SavePackageVersion(appId, "")
+}
+
+// SavePackageVersion downloads and extracts the given version of the specified app package to the device. If the store
+// doesn't publish the version separately the latest package is used instead
+func (h *AppDataHandler) SavePackageVersion(appId string, version string) error {
+	if h.downloader != nil {
+		bundle, err := h.downloader.GetPackageBundle(appId, version)
+		if err != nil {
+			return err
+		}
+		return h.extractPackage(appId, bytes.NewReader(bundle))
 	}
 
-	resp, err := h.http.Get(packageUrl)
+	storeUrl := strings.Trim(h.storeConfig.StoreUrl, "list.json")
+	packageUrl, err := url.JoinPath(storeUrl, "packages", appId, "package.tar.gz")
 	if err != nil {
 		return err
 	}
+
+	var resp *http.Response
+	if version != "" {
+		versionUrl, err := url.JoinPath(storeUrl, "packages", appId, "versions", version, "package.tar.gz")
+		if err != nil {
+			return err
+		}
+		resp, err = h.http.Get(versionUrl)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			resp = nil
+		}
+	}
+
+	if resp == nil {
+		resp, err = h.http.Get(packageUrl)
+		if err != nil {
+			return err
+		}
+	}
 	defer resp.Body.Close()
 
-	uncompressed, err := gzip.NewReader(resp.Body)
+	return h.extractPackage(appId, resp.Body)
+}
+
+// BackupPackageFiles keeps a copy of the package files stored alongside the app's data directory, such as its icon and
+// schema, returning a function that restores them. Used to undo replacing them with the files of another version, with
+// the data directory itself backed up along with the rest of the app's data
+func (h *AppDataHandler) BackupPackageFiles(appId string) (func() error, error) {
+	appPath := filepath.Join(h.storageConfig.DataPath, appId)
+	entries, err := os.ReadDir(appPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(appPath, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = contents
+	}
+
+	return func() error {
+		// Files added by the other version are removed, so only the backed up files remain
+		entries, err := os.ReadDir(appPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, entry := range entries {
+			if _, ok := files[entry.Name()]; entry.Type().IsRegular() && !ok {
+				if err := os.Remove(filepath.Join(appPath, entry.Name())); err != nil {
+					return err
+				}
+			}
+		}
+
+		for name, contents := range files {
+			if err := os.WriteFile(filepath.Join(appPath, name), contents, 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// SaveBundle extracts an uploaded package bundle to the device, used for packages that aren't installed from a store
+func (h *AppDataHandler) SaveBundle(appId string, bundle io.Reader) error {
+	return h.extractPackage(appId, bundle)
+}
+
+// extractPackage extracts a gzipped package bundle into the app's directory
+func (h *AppDataHandler) extractPackage(appId string, bundle io.Reader) error {
+	uncompressed, err := gzip.NewReader(bundle)
 	if err != nil {
 		return err
 	}
@@ -87,48 +191,70 @@ func (h *AppDataHandler) SavePackage(appId string) error {
 	return nil
 }
 
-// RenderTemplates renders any templates files in the given app data directory
+// RenderTemplates renders any templates files in the given app data directory, returning the files whose contents
+// changed relative to the data directory
 func (h *AppDataHandler) RenderTemplates(
 	ctx context.Context,
 	queries *persistence.Queries,
 	oryConfig config.Ory,
 	hostConfig config.Host,
 	appId string,
-) error {
+) ([]string, error) {
 	dataPath := filepath.Join(h.storageConfig.DataPath, appId, "data")
 	if _, err := os.Stat(dataPath); os.IsNotExist(err) {
-		return nil
+		return nil, nil
+	}
+
+	appInfo, err := queries.GetAppWithCreds(ctx, appId)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := h.AppSettings(ctx, queries, appInfo.Schema)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := h.AppSecrets(ctx, queries, appInfo.Schema)
+	if err != nil {
+		return nil, err
 	}
 
-	err := filepath.Walk(dataPath, func(path string, info os.FileInfo, err error) error {
+	var changedFiles []string
+	err = filepath.Walk(dataPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if !info.IsDir() && filepath.Ext(path) == ".tmpl" {
-			appInfo, err := queries.GetAppWithCreds(ctx, appId)
-
 			templateFile, err := os.ReadFile(path)
 			if err != nil {
 				return err
 			}
 
-			writer, err := os.Create(strings.TrimSuffix(path, ".tmpl"))
-			if err != nil {
+			var rendered bytes.Buffer
+			if err := ApplyAppTemplate(string(templateFile), &rendered, appInfo.Schema, appInfo.ClientID.String, appInfo.ClientSecret.String, oryConfig, hostConfig, h.storageConfig, settings, secrets); err != nil {
 				return err
 			}
 
-			if err := ApplyAppTemplate(string(templateFile), writer, appInfo.Schema, appInfo.ClientID.String, appInfo.ClientSecret.String, oryConfig, hostConfig, h.storageConfig); err != nil {
+			// Only writes files that have changed, so apps only need restarting when their configuration changes
+			outputPath := strings.TrimSuffix(path, ".tmpl")
+			previous, err := os.ReadFile(outputPath)
+			if err == nil && bytes.Equal(previous, rendered.Bytes()) {
+				return nil
+			}
+			if err := os.WriteFile(outputPath, rendered.Bytes(), 0644); err != nil {
 				return err
 			}
-			if err := writer.Close(); err != nil {
+
+			relativePath, err := filepath.Rel(dataPath, outputPath)
+			if err != nil {
 				return err
 			}
+			changedFiles = append(changedFiles, filepath.ToSlash(relativePath))
 		}
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return changedFiles, nil
 }
@@ -3,6 +3,7 @@ package storage
 import (
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 
 	"github.com/An-Owlbear/homecloud/backend/internal/config"
@@ -27,3 +28,42 @@ func TestSavePackage(t *testing.T) {
 		}
 	}
 }
+
+// Tests package files replaced by another version are restored, without touching the data directory
+func TestBackupPackageFiles(t *testing.T) {
+	dataPath := t.TempDir()
+	dataHandler := NewAppDataHandler(config.Storage{DataPath: dataPath}, config.Store{})
+	appPath := filepath.Join(dataPath, "test.app")
+	if err := os.MkdirAll(filepath.Join(appPath, "data"), 0755); err != nil {
+		t.Fatalf("Unexpected error creating app directory: %s", err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(appPath, "icon.png"), []byte("old icon"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing icon: %s", err.Error())
+	}
+
+	restore, err := dataHandler.BackupPackageFiles("test.app")
+	if err != nil {
+		t.Fatalf("Unexpected error backing up package files: %s", err.Error())
+	}
+
+	// Simulates saving the package files of another version
+	newFiles := map[string]string{"icon.png": "new icon", "schema.json": "{}", "data/config.tmpl": "config"}
+	for name, contents := range newFiles {
+		if err := os.WriteFile(filepath.Join(appPath, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Unexpected error writing %s: %s", name, err.Error())
+		}
+	}
+
+	if err := restore(); err != nil {
+		t.Fatalf("Unexpected error restoring package files: %s", err.Error())
+	}
+	if icon, err := os.ReadFile(filepath.Join(appPath, "icon.png")); err != nil || string(icon) != "old icon" {
+		t.Errorf("Expected previous icon, got %q, %v", icon, err)
+	}
+	if _, err := os.Stat(filepath.Join(appPath, "schema.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected file added by the other version to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(appPath, "data", "config.tmpl")); err != nil {
+		t.Errorf("Expected data directory to be left alone, got %v", err)
+	}
+}
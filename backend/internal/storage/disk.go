@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// DiskSpace is the size and free space of the filesystem containing a path, in bytes
+type DiskSpace struct {
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"`
+}
+
+// GetDiskSpace retrieves the size and space available to unprivileged users of the filesystem containing the path
+func GetDiskSpace(path string) (DiskSpace, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return DiskSpace{}, err
+	}
+
+	return DiskSpace{
+		Total: stat.Blocks * uint64(stat.Bsize),
+		Free:  stat.Bavail * uint64(stat.Bsize),
+	}, nil
+}
+
+// DirectorySize calculates the total size of the files in a directory. Files removed while walking the directory,
+// or a directory that doesn't exist, are ignored
+func DirectorySize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectorySize(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "nested", "b.txt"), make([]byte, 50), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := DirectorySize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 150 {
+		t.Errorf("expected size 150, got %d", size)
+	}
+
+	size, err = DirectorySize(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatalf("expected no error for missing directory, got %s", err.Error())
+	}
+	if size != 0 {
+		t.Errorf("expected size 0 for missing directory, got %d", size)
+	}
+}
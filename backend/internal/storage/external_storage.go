@@ -9,7 +9,6 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"slices"
 	"strings"
 
@@ -174,34 +173,3 @@ func UnmountPartition(details LsblkDetails) error {
 	}
 	return nil
 }
-
-// ListBackups lists the backups on the given device for the given app
-func ListBackups(targetDevice string, appId string) ([]string, error) {
-	details, err := GetExternalPartition(targetDevice)
-	if err != nil {
-		return nil, err
-	}
-
-	mountPath, err := MountPartition(details)
-	if err != nil {
-		return nil, err
-	}
-	defer UnmountPartition(details)
-
-	entries, err := os.ReadDir(filepath.Join(mountPath, "backup", appId))
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return []string{}, nil
-		}
-		return nil, err
-	}
-
-	backups := make([]string, 0)
-	for _, entry := range entries {
-		if entry.IsDir() {
-			backups = append(backups, entry.Name())
-		}
-	}
-
-	return backups, nil
-}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+const DefaultSecretLength = 32
+
+// Secrets are alphanumeric so they can be used in environment variables, URLs and config files without escaping
+const secretCharacters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+var MissingSecretError = errors.New("secret hasn't been generated")
+
+// generateSecret creates a random alphanumeric string of the given length
+func generateSecret(length int) (string, error) {
+	secret := make([]byte, length)
+	max := big.NewInt(int64(len(secretCharacters)))
+	for i := range secret {
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		secret[i] = secretCharacters[index.Int64()]
+	}
+	return string(secret), nil
+}
+
+// GenerateAppSecrets creates the secrets declared by the app package that haven't been created yet, returning the keys
+// of the secrets created. When upgrading an existing install a secret's upgrade value is used if it has one, since the
+// app's data was set up before the secret existed
+func (h *AppDataHandler) GenerateAppSecrets(
+	ctx context.Context,
+	queries *persistence.Queries,
+	app persistence.AppPackage,
+	upgrading bool,
+) ([]string, error) {
+	if len(app.Secrets) == 0 {
+		return nil, nil
+	}
+	if h.cipher == nil {
+		return nil, NoCipherError
+	}
+
+	storedSecrets, err := queries.GetAppSecrets(ctx, app.Id)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(storedSecrets))
+	for _, storedSecret := range storedSecrets {
+		existing[storedSecret.Key] = true
+	}
+
+	var created []string
+	for _, secret := range app.Secrets {
+		if existing[secret.Key] {
+			continue
+		}
+
+		var value string
+		if upgrading && secret.UpgradeValue != "" {
+			value = secret.UpgradeValue
+		} else {
+			length := secret.Length
+			if length == 0 {
+				length = DefaultSecretLength
+			}
+			value, err = generateSecret(length)
+			if err != nil {
+				return created, err
+			}
+		}
+
+		if err := h.setAppSecret(ctx, queries, app.Id, secret.Key, value); err != nil {
+			return created, err
+		}
+		created = append(created, secret.Key)
+	}
+
+	return created, nil
+}
+
+// AppSecrets retrieves the values of the secrets declared by the app package. Secrets that are no longer declared are
+// kept, in case a later version of the package declares them again, but aren't returned
+func (h *AppDataHandler) AppSecrets(
+	ctx context.Context,
+	queries *persistence.Queries,
+	app persistence.AppPackage,
+) (map[string]string, error) {
+	allSecrets, err := h.ExportSecrets(ctx, queries, app.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]string, len(app.Secrets))
+	for _, secret := range app.Secrets {
+		value, ok := allSecrets[secret.Key]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", MissingSecretError, secret.Key)
+		}
+		secrets[secret.Key] = value
+	}
+	return secrets, nil
+}
+
+// ExportSecrets retrieves the decrypted values of every secret stored for an app, used when backing up the app
+func (h *AppDataHandler) ExportSecrets(ctx context.Context, queries *persistence.Queries, appId string) (map[string]string, error) {
+	storedSecrets, err := queries.GetAppSecrets(ctx, appId)
+	if err != nil {
+		return nil, err
+	}
+	if len(storedSecrets) > 0 && h.cipher == nil {
+		return nil, NoCipherError
+	}
+
+	secrets := make(map[string]string, len(storedSecrets))
+	for _, storedSecret := range storedSecrets {
+		value, err := h.cipher.Decrypt(storedSecret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %s: %w", storedSecret.Key, err)
+		}
+		secrets[storedSecret.Key] = value
+	}
+	return secrets, nil
+}
+
+// ImportSecrets replaces the secrets stored for an app, used when restoring the app from a backup so the secrets match
+// the restored data
+func (h *AppDataHandler) ImportSecrets(
+	ctx context.Context,
+	queries *persistence.Queries,
+	appId string,
+	secrets map[string]string,
+) error {
+	if err := queries.DeleteAppSecrets(ctx, appId); err != nil {
+		return err
+	}
+	for key, value := range secrets {
+		if err := h.setAppSecret(ctx, queries, appId, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAppSecret encrypts and stores a single secret
+func (h *AppDataHandler) setAppSecret(ctx context.Context, queries *persistence.Queries, appId string, key string, value string) error {
+	if h.cipher == nil {
+		return NoCipherError
+	}
+	encrypted, err := h.cipher.Encrypt(value)
+	if err != nil {
+		return err
+	}
+	return queries.SetAppSecret(ctx, persistence.SetAppSecretParams{AppID: appId, Key: key, Value: encrypted})
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// Tests secrets are generated once, kept when generated again and use upgrade values for existing installs
+func TestAppSecrets(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+	ctx := context.Background()
+
+	cipher, err := encryption.NewCipher(make([]byte, encryption.KeySize))
+	if err != nil {
+		t.Fatalf("Unexpected error creating cipher: %s", err.Error())
+	}
+	dataHandler := NewAppDataHandler(config.Storage{}, config.Store{})
+	dataHandler.SetCipher(cipher)
+
+	app := persistence.AppPackage{
+		Id:      "test.app",
+		Secrets: []persistence.PackageSecret{{Key: "db_password", UpgradeValue: "postgres"}, {Key: "app_key", Length: 64}},
+	}
+	created, err := dataHandler.GenerateAppSecrets(ctx, queries, app, false)
+	if err != nil {
+		t.Fatalf("Unexpected error generating secrets: %s", err.Error())
+	}
+	if diff := cmp.Diff([]string{"db_password", "app_key"}, created); diff != "" {
+		t.Errorf("Created secrets mismatch (-want +got):\n%s", diff)
+	}
+
+	secrets, err := dataHandler.AppSecrets(ctx, queries, app)
+	if err != nil {
+		t.Fatalf("Unexpected error getting secrets: %s", err.Error())
+	}
+	if !regexp.MustCompile(`^[a-zA-Z0-9]{32}$`).MatchString(secrets["db_password"]) {
+		t.Errorf("Expected 32 character alphanumeric secret, got %q", secrets["db_password"])
+	}
+	if len(secrets["app_key"]) != 64 {
+		t.Errorf("Expected 64 character secret, got %q", secrets["app_key"])
+	}
+
+	// Existing secrets are kept, while secrets added by an upgrade use the upgrade value
+	app.Secrets = append(app.Secrets, persistence.PackageSecret{Key: "legacy_password", UpgradeValue: "postgres"})
+	created, err = dataHandler.GenerateAppSecrets(ctx, queries, app, true)
+	if err != nil {
+		t.Fatalf("Unexpected error generating secrets: %s", err.Error())
+	}
+	if diff := cmp.Diff([]string{"legacy_password"}, created); diff != "" {
+		t.Errorf("Created secrets mismatch (-want +got):\n%s", diff)
+	}
+	upgradedSecrets, err := dataHandler.AppSecrets(ctx, queries, app)
+	if err != nil {
+		t.Fatalf("Unexpected error getting secrets: %s", err.Error())
+	}
+	secrets["legacy_password"] = "postgres"
+	if diff := cmp.Diff(secrets, upgradedSecrets); diff != "" {
+		t.Errorf("Secrets mismatch (-want +got):\n%s", diff)
+	}
+
+	// Secrets are stored encrypted
+	storedSecrets, err := queries.GetAppSecrets(ctx, app.Id)
+	if err != nil {
+		t.Fatalf("Unexpected error getting stored secrets: %s", err.Error())
+	}
+	for _, stored := range storedSecrets {
+		if stored.Value == secrets[stored.Key] {
+			t.Errorf("Expected secret %s to be stored encrypted", stored.Key)
+		}
+	}
+
+	// Importing secrets from a backup replaces the existing secrets
+	if err := dataHandler.ImportSecrets(ctx, queries, app.Id, map[string]string{"db_password": "restored"}); err != nil {
+		t.Fatalf("Unexpected error importing secrets: %s", err.Error())
+	}
+	exported, err := dataHandler.ExportSecrets(ctx, queries, app.Id)
+	if err != nil {
+		t.Fatalf("Unexpected error exporting secrets: %s", err.Error())
+	}
+	if diff := cmp.Diff(map[string]string{"db_password": "restored"}, exported); diff != "" {
+		t.Errorf("Exported secrets mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := dataHandler.AppSecrets(ctx, queries, app); !errors.Is(err, MissingSecretError) {
+		t.Errorf("Expected missing secret error, got %v", err)
+	}
+}
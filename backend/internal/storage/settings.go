@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+)
+
+var NoCipherError = errors.New("no encryption key configured for secrets")
+
+// SetCipher sets the cipher used to encrypt secret settings and generated secrets, which can't be stored without one
+func (h *AppDataHandler) SetCipher(cipher *encryption.Cipher) {
+	h.cipher = cipher
+}
+
+// AppSettings retrieves the values of each setting declared by the app package, using the package default for settings
+// that haven't been set by an admin. Stored settings the package no longer declares are ignored
+func (h *AppDataHandler) AppSettings(
+	ctx context.Context,
+	queries *persistence.Queries,
+	app persistence.AppPackage,
+) (map[string]string, error) {
+	settings := make(map[string]string, len(app.Settings))
+	for _, setting := range app.Settings {
+		settings[setting.Key] = setting.Default
+	}
+
+	storedSettings, err := queries.GetAppSettings(ctx, app.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, storedSetting := range storedSettings {
+		if _, ok := settings[storedSetting.Key]; !ok {
+			continue
+		}
+
+		value := storedSetting.Value
+		if storedSetting.Encrypted {
+			if h.cipher == nil {
+				return nil, NoCipherError
+			}
+			value, err = h.cipher.Decrypt(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		settings[storedSetting.Key] = value
+	}
+
+	return settings, nil
+}
+
+// SetAppSetting stores the value of a setting for the given app, encrypting it if it's a secret. A nil value removes
+// the stored value, resetting the setting to its default
+func (h *AppDataHandler) SetAppSetting(
+	ctx context.Context,
+	queries *persistence.Queries,
+	appId string,
+	setting persistence.PackageSetting,
+	value *string,
+) error {
+	if value == nil {
+		return queries.DeleteAppSetting(ctx, persistence.DeleteAppSettingParams{AppID: appId, Key: setting.Key})
+	}
+
+	storedValue := *value
+	encrypted := setting.Type == persistence.SettingSecret
+	if encrypted {
+		if h.cipher == nil {
+			return NoCipherError
+		}
+		var err error
+		storedValue, err = h.cipher.Encrypt(storedValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return queries.SetAppSetting(ctx, persistence.SetAppSettingParams{
+		AppID:     appId,
+		Key:       setting.Key,
+		Value:     storedValue,
+		Encrypted: encrypted,
+	})
+}
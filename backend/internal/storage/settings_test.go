@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/An-Owlbear/homecloud/backend/internal/config"
+	"github.com/An-Owlbear/homecloud/backend/internal/encryption"
+	"github.com/An-Owlbear/homecloud/backend/internal/persistence"
+	"github.com/An-Owlbear/homecloud/backend/internal/testutils"
+)
+
+// Tests settings use package defaults until set, and secret settings are only stored encrypted
+func TestAppSettings(t *testing.T) {
+	queries := testutils.SetupDB(t)
+	defer testutils.CleanupDB()
+	ctx := context.Background()
+
+	cipher, err := encryption.NewCipher(make([]byte, encryption.KeySize))
+	if err != nil {
+		t.Fatalf("Unexpected error creating cipher: %s", err.Error())
+	}
+	dataHandler := NewAppDataHandler(config.Storage{}, config.Store{})
+	dataHandler.SetCipher(cipher)
+
+	timezone := persistence.PackageSetting{Key: "timezone", Type: persistence.SettingString, Default: "UTC"}
+	password := persistence.PackageSetting{Key: "smtp_password", Type: persistence.SettingSecret}
+	app := persistence.AppPackage{Id: "test.app", Settings: []persistence.PackageSetting{timezone, password}}
+
+	settings, err := dataHandler.AppSettings(ctx, queries, app)
+	if err != nil {
+		t.Fatalf("Unexpected error getting settings: %s", err.Error())
+	}
+	if diff := cmp.Diff(map[string]string{"timezone": "UTC", "smtp_password": ""}, settings); diff != "" {
+		t.Errorf("Default settings mismatch (-want +got):\n%s", diff)
+	}
+
+	newTimezone := "Europe/London"
+	newPassword := "hunter2"
+	if err := dataHandler.SetAppSetting(ctx, queries, app.Id, timezone, &newTimezone); err != nil {
+		t.Fatalf("Unexpected error setting timezone: %s", err.Error())
+	}
+	if err := dataHandler.SetAppSetting(ctx, queries, app.Id, password, &newPassword); err != nil {
+		t.Fatalf("Unexpected error setting password: %s", err.Error())
+	}
+
+	storedSettings, err := queries.GetAppSettings(ctx, app.Id)
+	if err != nil {
+		t.Fatalf("Unexpected error getting stored settings: %s", err.Error())
+	}
+	for _, stored := range storedSettings {
+		if stored.Key == password.Key && (!stored.Encrypted || stored.Value == newPassword) {
+			t.Errorf("Expected secret setting to be stored encrypted")
+		}
+	}
+
+	settings, err = dataHandler.AppSettings(ctx, queries, app)
+	if err != nil {
+		t.Fatalf("Unexpected error getting settings: %s", err.Error())
+	}
+	if diff := cmp.Diff(map[string]string{"timezone": newTimezone, "smtp_password": newPassword}, settings); diff != "" {
+		t.Errorf("Settings mismatch (-want +got):\n%s", diff)
+	}
+
+	// Resetting a setting uses the package default again
+	if err := dataHandler.SetAppSetting(ctx, queries, app.Id, timezone, nil); err != nil {
+		t.Fatalf("Unexpected error resetting timezone: %s", err.Error())
+	}
+	settings, err = dataHandler.AppSettings(ctx, queries, app)
+	if err != nil {
+		t.Fatalf("Unexpected error getting settings: %s", err.Error())
+	}
+	if settings["timezone"] != "UTC" {
+		t.Errorf("Expected reset timezone to be UTC, got %s", settings["timezone"])
+	}
+}
@@ -23,10 +23,13 @@ type PackageTemplateParams struct {
 	AppUrl            string
 	UrlScheme         string
 	Environment       string
+	Settings          map[string]string
+	Secrets           map[string]string
 }
 
 // ApplyAppTemplate applies templated values to the given input. In the case of templating an app package the app
-// package itself must also be passed to ensure values like name and url are properly set
+// package itself must also be passed to ensure values like name and url are properly set. Settings and secrets contain
+// the values of the app's settings and generated secrets, available as {{ .Settings.key }} and {{ .Secrets.key }}
 func ApplyAppTemplate(
 	input string,
 	output io.Writer,
@@ -36,6 +39,8 @@ func ApplyAppTemplate(
 	oryConfig config.Ory,
 	hostConfig config.Host,
 	storageConfig config.Storage,
+	settings map[string]string,
+	secrets map[string]string,
 ) error {
 	appTemplate, err := template.New("appTemplate").Parse(input)
 	if err != nil {
@@ -62,6 +67,8 @@ func ApplyAppTemplate(
 		AppUrl:            hostConfig.PublicSubdomain(app.Id),
 		UrlScheme:         hostUrl.Scheme,
 		Environment:       string(config.GetEnvironment()),
+		Settings:          settings,
+		Secrets:           secrets,
 	}
 
 	return appTemplate.Execute(output, parameters)
@@ -75,6 +82,8 @@ func TemplateAppPackage(
 	oryConfig config.Ory,
 	hostConfig config.Host,
 	storageConfig config.Storage,
+	settings map[string]string,
+	secrets map[string]string,
 ) (persistence.AppPackage, error) {
 	// Deserializes app package to template the templated values in it
 	packageBytes, err := json.Marshal(input)
@@ -82,6 +91,16 @@ func TemplateAppPackage(
 		return persistence.AppPackage{}, err
 	}
 
+	// Settings are set by admins and could contain any characters, so are escaped to keep the package valid JSON
+	escapedSettings, err := escapeJSONValues(settings)
+	if err != nil {
+		return persistence.AppPackage{}, err
+	}
+	escapedSecrets, err := escapeJSONValues(secrets)
+	if err != nil {
+		return persistence.AppPackage{}, err
+	}
+
 	var templateOutput bytes.Buffer
 	err = ApplyAppTemplate(
 		string(packageBytes),
@@ -92,6 +111,8 @@ func TemplateAppPackage(
 		oryConfig,
 		hostConfig,
 		storageConfig,
+		escapedSettings,
+		escapedSecrets,
 	)
 	if err != nil {
 		return persistence.AppPackage{}, err
@@ -106,3 +127,16 @@ func TemplateAppPackage(
 
 	return output, nil
 }
+
+// escapeJSONValues escapes each value so it can be placed inside a JSON string
+func escapeJSONValues(values map[string]string) (map[string]string, error) {
+	escapedValues := make(map[string]string, len(values))
+	for key, value := range values {
+		escaped, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		escapedValues[key] = string(escaped[1 : len(escaped)-1])
+	}
+	return escapedValues, nil
+}
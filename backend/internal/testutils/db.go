@@ -17,6 +17,9 @@ var dbPath = filepath.Join(util.RootDir(), "tmp/test.db")
 
 func SetupDB(t *testing.T) *persistence.Queries {
 	var err error
+	if err = os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatalf("Unexpected error creating DB directory: %s", err.Error())
+	}
 	db, err = sql.Open("sqlite3", dbPath)
 	if err != nil {
 		t.Fatalf("Unexpected error setting up DB: %s", err.Error())
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var CycleError = errors.New("dependency cycle")
+
+// TopologicalSort orders the given nodes so each one comes after every node it depends on, with nodes that don't
+// depend on each other keeping their original order. Dependencies on nodes that aren't in the list are ignored
+func TopologicalSort(nodes []string, dependencies map[string][]string) ([]string, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	known := make(map[string]bool)
+	for _, node := range nodes {
+		known[node] = true
+	}
+
+	state := make(map[string]int)
+	order := make([]string, 0, len(nodes))
+	var visit func(node string, path []string) error
+	visit = func(node string, path []string) error {
+		switch state[node] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: %s", CycleError, strings.Join(append(path, node), " -> "))
+		}
+
+		state[node] = visiting
+		for _, dependency := range dependencies[node] {
+			if !known[dependency] {
+				continue
+			}
+			if err := visit(dependency, append(slices.Clip(path), node)); err != nil {
+				return err
+			}
+		}
+		state[node] = visited
+		order = append(order, node)
+		return nil
+	}
+
+	for _, node := range nodes {
+		if err := visit(node, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
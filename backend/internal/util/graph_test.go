@@ -0,0 +1,41 @@
+package util
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Tests nodes are placed after their dependencies, otherwise keeping their order
+func TestTopologicalSort(t *testing.T) {
+	order, err := TopologicalSort(
+		[]string{"server", "machine-learning", "redis", "database"},
+		map[string][]string{
+			"server":   {"database", "redis"},
+			"database": {"external"},
+		},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	expected := []string{"database", "redis", "server", "machine-learning"}
+	if diff := cmp.Diff(expected, order); diff != "" {
+		t.Errorf("Order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Tests dependency cycles are reported
+func TestTopologicalSortCycle(t *testing.T) {
+	_, err := TopologicalSort(
+		[]string{"a", "b", "c"},
+		map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+	)
+	if !errors.Is(err, CycleError) {
+		t.Fatalf("Expected cycle error, got %v", err)
+	}
+	if err.Error() != "dependency cycle: a -> b -> c -> a" {
+		t.Errorf("Unexpected error message: %s", err.Error())
+	}
+}
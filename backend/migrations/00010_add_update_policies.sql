@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE apps ADD COLUMN update_policy TEXT NOT NULL DEFAULT 'manual';
+
+CREATE TABLE update_settings(
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    window_start INTEGER NOT NULL,
+    window_end INTEGER NOT NULL
+);
+
+INSERT INTO update_settings (id, window_start, window_end)
+VALUES (1, 3, 5);
+
+CREATE TABLE update_history(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_id TEXT NOT NULL,
+    from_version TEXT NOT NULL,
+    to_version TEXT NOT NULL,
+    automatic BOOLEAN NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_update_history_app_id ON update_history(app_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE update_history;
+DROP TABLE update_settings;
+ALTER TABLE apps DROP COLUMN update_policy;
+-- +goose StatementEnd
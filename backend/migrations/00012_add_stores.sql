@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE stores(
+    name TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
+    public_key TEXT NOT NULL DEFAULT ''
+);
+
+ALTER TABLE package_list_items ADD COLUMN store TEXT NOT NULL DEFAULT 'default';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE package_list_items DROP COLUMN store;
+DROP TABLE stores;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE resource_limits(
+    app_id TEXT NOT NULL,
+    container TEXT NOT NULL,
+    memory TEXT NOT NULL DEFAULT '',
+    cpus REAL NOT NULL DEFAULT 0,
+    pids INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (app_id, container)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE resource_limits;
+-- +goose StatementEnd
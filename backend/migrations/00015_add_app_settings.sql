@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE app_settings(
+    app_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    encrypted BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (app_id, key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE app_settings;
+-- +goose StatementEnd
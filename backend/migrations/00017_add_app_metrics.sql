@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE app_metrics(
+    app_id TEXT NOT NULL,
+    resolution INTEGER NOT NULL,
+    timestamp INTEGER NOT NULL,
+    cpu_percent REAL NOT NULL,
+    memory_bytes INTEGER NOT NULL,
+    network_rx REAL NOT NULL,
+    network_tx REAL NOT NULL,
+    block_read REAL NOT NULL,
+    block_write REAL NOT NULL,
+    PRIMARY KEY (app_id, resolution, timestamp)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE app_metrics;
+-- +goose StatementEnd
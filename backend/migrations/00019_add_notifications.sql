@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_options ADD COLUMN webhook_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_options ADD COLUMN webhook_format TEXT NOT NULL DEFAULT 'generic';
+ALTER TABLE user_options ADD COLUMN webhook_token TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE notification_subscriptions(
+    user_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    channel TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, event, channel)
+);
+
+CREATE TABLE notifications(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    app_id TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL,
+    message TEXT NOT NULL,
+    read BOOLEAN NOT NULL DEFAULT false,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE notifications;
+DROP TABLE notification_subscriptions;
+ALTER TABLE user_options DROP COLUMN webhook_token;
+ALTER TABLE user_options DROP COLUMN webhook_format;
+ALTER TABLE user_options DROP COLUMN webhook_url;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE backup_schedules(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_id TEXT NOT NULL DEFAULT '',
+    cron TEXT NOT NULL,
+    target TEXT NOT NULL,
+    keep_daily INTEGER NOT NULL DEFAULT 7,
+    keep_weekly INTEGER NOT NULL DEFAULT 4,
+    keep_monthly INTEGER NOT NULL DEFAULT 6,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_run_at INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE backup_history(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    schedule_id INTEGER NOT NULL DEFAULT 0,
+    app_id TEXT NOT NULL,
+    target TEXT NOT NULL,
+    snapshot TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    size INTEGER NOT NULL DEFAULT 0,
+    pruned BOOLEAN NOT NULL DEFAULT false,
+    started_at INTEGER NOT NULL,
+    finished_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_backup_history_app_id ON backup_history(app_id);
+CREATE INDEX idx_backup_history_schedule_id ON backup_history(schedule_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE backup_history;
+DROP TABLE backup_schedules;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE backup_targets(
+    name TEXT PRIMARY KEY,
+    type TEXT NOT NULL,
+    config TEXT NOT NULL,
+    secrets TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL
+);
+
+-- Schedules previously referred to removable drives by device name, so each is saved as a target of the same name
+INSERT INTO backup_targets (name, type, config, created_at)
+SELECT DISTINCT target, 'drive', json_object('drive', json_object('device', target)), unixepoch()
+FROM backup_schedules;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE backup_targets;
+-- +goose StatementEnd
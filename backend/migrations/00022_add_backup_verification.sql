@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE backup_schedules ADD COLUMN test_restore BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE backup_history ADD COLUMN verified_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_history ADD COLUMN verify_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE backup_history ADD COLUMN restore_tested_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_history ADD COLUMN restore_test_error TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE backup_history DROP COLUMN restore_test_error;
+ALTER TABLE backup_history DROP COLUMN restore_tested_at;
+ALTER TABLE backup_history DROP COLUMN verify_error;
+ALTER TABLE backup_history DROP COLUMN verified_at;
+
+ALTER TABLE backup_schedules DROP COLUMN test_restore;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_options ADD COLUMN webhook_token_encrypted BOOLEAN NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_options DROP COLUMN webhook_token_encrypted;
+-- +goose StatementEnd
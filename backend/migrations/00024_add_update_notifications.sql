@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE update_notifications(
+    app_id TEXT PRIMARY KEY NOT NULL,
+    version TEXT NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE update_notifications;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- name: GetAppMetrics :many
+SELECT * FROM app_metrics
+WHERE app_id = sqlc.arg(app_id) AND resolution = sqlc.arg(resolution) AND timestamp >= sqlc.arg(since)
+ORDER BY timestamp;
+
+-- name: SetAppMetric :exec
+INSERT INTO app_metrics (app_id, resolution, timestamp, cpu_percent, memory_bytes, network_rx, network_tx, block_read, block_write)
+VALUES (sqlc.arg(app_id), sqlc.arg(resolution), sqlc.arg(timestamp), sqlc.arg(cpu_percent), sqlc.arg(memory_bytes), sqlc.arg(network_rx), sqlc.arg(network_tx), sqlc.arg(block_read), sqlc.arg(block_write))
+ON CONFLICT (app_id, resolution, timestamp) DO UPDATE SET
+    cpu_percent = excluded.cpu_percent,
+    memory_bytes = excluded.memory_bytes,
+    network_rx = excluded.network_rx,
+    network_tx = excluded.network_tx,
+    block_read = excluded.block_read,
+    block_write = excluded.block_write;
+
+-- name: RollupAppMetrics :exec
+INSERT INTO app_metrics (app_id, resolution, timestamp, cpu_percent, memory_bytes, network_rx, network_tx, block_read, block_write)
+SELECT app_id, CAST(sqlc.arg(to_resolution) AS INTEGER), (timestamp / sqlc.arg(to_resolution)) * sqlc.arg(to_resolution) AS bucket,
+    AVG(cpu_percent), CAST(AVG(memory_bytes) AS INTEGER), AVG(network_rx), AVG(network_tx), AVG(block_read), AVG(block_write)
+FROM app_metrics
+WHERE resolution = sqlc.arg(from_resolution) AND timestamp >= sqlc.arg(since)
+GROUP BY app_id, bucket
+ON CONFLICT (app_id, resolution, timestamp) DO UPDATE SET
+    cpu_percent = excluded.cpu_percent,
+    memory_bytes = excluded.memory_bytes,
+    network_rx = excluded.network_rx,
+    network_tx = excluded.network_tx,
+    block_read = excluded.block_read,
+    block_write = excluded.block_write;
+
+-- name: DeleteOldAppMetrics :exec
+DELETE FROM app_metrics
+WHERE resolution = sqlc.arg(resolution) AND timestamp < sqlc.arg(before);
+
+-- name: DeleteAppMetrics :exec
+DELETE FROM app_metrics
+WHERE app_id = sqlc.arg(app_id);
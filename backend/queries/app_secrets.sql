@@ -0,0 +1,17 @@
+-- name: GetAppSecrets :many
+SELECT * FROM app_secrets
+WHERE app_id = sqlc.arg(app_id)
+ORDER BY key;
+
+-- name: SetAppSecret :exec
+INSERT INTO app_secrets (app_id, key, value)
+VALUES (sqlc.arg(app_id), sqlc.arg(key), sqlc.arg(value))
+ON CONFLICT (app_id, key) DO UPDATE SET value = excluded.value;
+
+-- name: DeleteAppSecret :exec
+DELETE FROM app_secrets
+WHERE app_id = sqlc.arg(app_id) AND key = sqlc.arg(key);
+
+-- name: DeleteAppSecrets :exec
+DELETE FROM app_secrets
+WHERE app_id = sqlc.arg(app_id);
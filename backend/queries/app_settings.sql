@@ -0,0 +1,17 @@
+-- name: GetAppSettings :many
+SELECT * FROM app_settings
+WHERE app_id = sqlc.arg(app_id)
+ORDER BY key;
+
+-- name: SetAppSetting :exec
+INSERT INTO app_settings (app_id, key, value, encrypted)
+VALUES (sqlc.arg(app_id), sqlc.arg(key), sqlc.arg(value), sqlc.arg(encrypted))
+ON CONFLICT (app_id, key) DO UPDATE SET value = excluded.value, encrypted = excluded.encrypted;
+
+-- name: DeleteAppSetting :exec
+DELETE FROM app_settings
+WHERE app_id = sqlc.arg(app_id) AND key = sqlc.arg(key);
+
+-- name: DeleteAppSettings :exec
+DELETE FROM app_settings
+WHERE app_id = sqlc.arg(app_id);
@@ -0,0 +1,20 @@
+-- name: GetAppState :one
+SELECT * FROM app_states
+WHERE app_id = sqlc.arg(app_id);
+
+-- name: GetAppStates :many
+SELECT * FROM app_states
+ORDER BY app_id;
+
+-- name: SetAppState :exec
+INSERT INTO app_states (app_id, state, message, restarts, updated_at)
+VALUES (sqlc.arg(app_id), sqlc.arg(state), sqlc.arg(message), sqlc.arg(restarts), sqlc.arg(updated_at))
+ON CONFLICT (app_id) DO UPDATE SET
+    state = excluded.state,
+    message = excluded.message,
+    restarts = excluded.restarts,
+    updated_at = excluded.updated_at;
+
+-- name: DeleteAppState :exec
+DELETE FROM app_states
+WHERE app_id = sqlc.arg(app_id);
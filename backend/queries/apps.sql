@@ -1,10 +1,17 @@
 -- name: CreateApp :exec
-INSERT INTO apps (id, schema, date_added, client_id, client_secret, status)
-VALUES (sqlc.arg(id), jsonb(sqlc.arg(schema)), unixepoch(), sqlc.arg(client_id), sqlc.arg(client_secret), 'running');
+INSERT INTO apps (id, schema, date_added, client_id, client_secret, status, sideloaded)
+VALUES (sqlc.arg(id), jsonb(sqlc.arg(schema)), unixepoch(), sqlc.arg(client_id), sqlc.arg(client_secret), 'running', sqlc.arg(sideloaded));
 
 -- name: RemoveApp :execresult
 DELETE FROM apps where id = ?;
 
+-- name: RestoreApp :exec
+INSERT INTO apps (id, schema, date_added, client_id, client_secret, status, update_policy, pinned, sideloaded)
+VALUES (
+    sqlc.arg(id), jsonb(sqlc.arg(schema)), sqlc.arg(date_added), sqlc.arg(client_id), sqlc.arg(client_secret),
+    sqlc.arg(status), sqlc.arg(update_policy), sqlc.arg(pinned), sqlc.arg(sideloaded)
+);
+
 -- name: UpdateApp :exec
 UPDATE apps SET schema = jsonb(sqlc.arg(schema))
 WHERE id = sqlc.arg(id);
@@ -14,19 +21,31 @@ UPDATE apps SET status = sqlc.arg(status)
 WHERE id = sqlc.arg(id);
 
 -- name: getAppUnparsed :one
-SELECT id, json(schema) as schema, date_added, status FROM apps
+SELECT id, json(schema) as schema, date_added, status, update_policy, pinned, sideloaded FROM apps
 WHERE id = sqlc.arg(id);
 
 -- name: getAppsUnparsed :many
-SELECT id, json(schema) as schema, date_added, status FROM apps;
+SELECT id, json(schema) as schema, date_added, status, update_policy, pinned, sideloaded FROM apps;
 
 -- name: getAppWithCredsUnparsed :one
-SELECT id, json(schema) as schema, date_added, client_id, client_secret, status from apps
+SELECT id, json(schema) as schema, date_added, client_id, client_secret, status, update_policy, pinned, sideloaded from apps
 WHERE id = sqlc.arg(id);
 
 -- name: getAppsWithCredsUnparsed :many
-SELECT id, json(schema) as schema, date_added, client_Id, client_secret, status from apps;
+SELECT id, json(schema) as schema, date_added, client_Id, client_secret, status, update_policy, pinned, sideloaded from apps;
 
 -- name: GetAppOAuth :one
 SELECT id, client_id, client_secret FROM apps
 WHERE id = sqlc.arg(id);
+
+-- name: SetAppOAuth :exec
+UPDATE apps SET client_id = sqlc.arg(client_id), client_secret = sqlc.arg(client_secret)
+WHERE id = sqlc.arg(id);
+
+-- name: SetUpdatePolicy :exec
+UPDATE apps SET update_policy = sqlc.arg(update_policy)
+WHERE id = sqlc.arg(id);
+
+-- name: SetPinned :exec
+UPDATE apps SET pinned = sqlc.arg(pinned)
+WHERE id = sqlc.arg(id);
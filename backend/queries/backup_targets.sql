@@ -0,0 +1,24 @@
+-- name: CreateBackupTarget :exec
+INSERT INTO backup_targets (name, type, config, secrets, created_at)
+VALUES (sqlc.arg(name), sqlc.arg(type), sqlc.arg(config), sqlc.arg(secrets), sqlc.arg(created_at));
+
+-- name: GetBackupTarget :one
+SELECT * FROM backup_targets
+WHERE name = sqlc.arg(name);
+
+-- name: GetBackupTargets :many
+SELECT * FROM backup_targets
+ORDER BY name;
+
+-- name: UpdateBackupTarget :execrows
+UPDATE backup_targets
+SET type = sqlc.arg(type), config = sqlc.arg(config), secrets = sqlc.arg(secrets)
+WHERE name = sqlc.arg(name);
+
+-- name: DeleteBackupTarget :execrows
+DELETE FROM backup_targets
+WHERE name = sqlc.arg(name);
+
+-- name: CountBackupTargetSchedules :one
+SELECT COUNT(*) FROM backup_schedules
+WHERE target = sqlc.arg(target);
@@ -0,0 +1,70 @@
+-- name: CreateBackupSchedule :one
+INSERT INTO backup_schedules (app_id, cron, target, keep_daily, keep_weekly, keep_monthly, enabled, test_restore, created_at)
+VALUES (sqlc.arg(app_id), sqlc.arg(cron), sqlc.arg(target), sqlc.arg(keep_daily), sqlc.arg(keep_weekly), sqlc.arg(keep_monthly), sqlc.arg(enabled), sqlc.arg(test_restore), sqlc.arg(created_at))
+RETURNING *;
+
+-- name: GetBackupSchedule :one
+SELECT * FROM backup_schedules
+WHERE id = sqlc.arg(id);
+
+-- name: GetBackupSchedules :many
+SELECT * FROM backup_schedules
+ORDER BY id;
+
+-- name: UpdateBackupSchedule :execrows
+UPDATE backup_schedules
+SET app_id = sqlc.arg(app_id), cron = sqlc.arg(cron), target = sqlc.arg(target), keep_daily = sqlc.arg(keep_daily),
+    keep_weekly = sqlc.arg(keep_weekly), keep_monthly = sqlc.arg(keep_monthly), enabled = sqlc.arg(enabled),
+    test_restore = sqlc.arg(test_restore)
+WHERE id = sqlc.arg(id);
+
+-- name: SetBackupScheduleLastRun :exec
+UPDATE backup_schedules SET last_run_at = sqlc.arg(last_run_at)
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteBackupSchedule :execrows
+DELETE FROM backup_schedules
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteAppBackupSchedules :exec
+DELETE FROM backup_schedules
+WHERE app_id = sqlc.arg(app_id);
+
+-- name: CreateBackupHistory :one
+INSERT INTO backup_history (schedule_id, app_id, target, snapshot, status, started_at)
+VALUES (sqlc.arg(schedule_id), sqlc.arg(app_id), sqlc.arg(target), sqlc.arg(snapshot), sqlc.arg(status), sqlc.arg(started_at))
+RETURNING id;
+
+-- name: FailInterruptedBackups :exec
+UPDATE backup_history SET status = 'failed', error = 'interrupted by server restart', finished_at = unixepoch()
+WHERE status = 'running';
+
+-- name: FinishBackupHistory :exec
+UPDATE backup_history
+SET status = sqlc.arg(status), error = sqlc.arg(error), size = sqlc.arg(size), finished_at = sqlc.arg(finished_at)
+WHERE id = sqlc.arg(id);
+
+-- name: GetBackupHistory :many
+SELECT * FROM backup_history
+WHERE (sqlc.arg(app_id) = '' OR app_id = sqlc.arg(app_id))
+    AND (sqlc.arg(schedule_id) = 0 OR schedule_id = sqlc.arg(schedule_id))
+ORDER BY id DESC
+LIMIT sqlc.arg(limit);
+
+-- name: GetRetainedBackups :many
+SELECT * FROM backup_history
+WHERE schedule_id = sqlc.arg(schedule_id) AND app_id = sqlc.arg(app_id) AND target = sqlc.arg(target)
+    AND status = 'completed' AND NOT pruned
+ORDER BY started_at DESC;
+
+-- name: SetBackupPruned :exec
+UPDATE backup_history SET pruned = true
+WHERE id = sqlc.arg(id);
+
+-- name: SetBackupVerified :exec
+UPDATE backup_history SET verified_at = sqlc.arg(verified_at), verify_error = sqlc.arg(verify_error)
+WHERE app_id = sqlc.arg(app_id) AND target = sqlc.arg(target) AND snapshot = sqlc.arg(snapshot);
+
+-- name: SetBackupRestoreTested :exec
+UPDATE backup_history SET restore_tested_at = sqlc.arg(restore_tested_at), restore_test_error = sqlc.arg(restore_test_error)
+WHERE app_id = sqlc.arg(app_id) AND target = sqlc.arg(target) AND snapshot = sqlc.arg(snapshot);
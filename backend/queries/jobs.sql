@@ -0,0 +1,22 @@
+-- name: CreateJob :exec
+INSERT INTO jobs (id, type, app_id, status, created_at, updated_at)
+VALUES (sqlc.arg(id), sqlc.arg(type), sqlc.arg(app_id), sqlc.arg(status), unixepoch(), unixepoch());
+
+-- name: UpdateJob :exec
+UPDATE jobs
+SET status = sqlc.arg(status), steps = sqlc.arg(steps), progress = sqlc.arg(progress), error = sqlc.arg(error), updated_at = unixepoch()
+WHERE id = sqlc.arg(id);
+
+-- name: FailInterruptedJobs :exec
+UPDATE jobs SET status = 'failed', error = 'interrupted by server restart', updated_at = unixepoch()
+WHERE status IN ('pending', 'running');
+
+-- name: getJob :one
+SELECT * FROM jobs
+WHERE id = sqlc.arg(id);
+
+-- name: getJobs :many
+SELECT * FROM jobs
+WHERE (sqlc.arg(app_id) = '' OR app_id = sqlc.arg(app_id))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(limit);
@@ -0,0 +1,48 @@
+-- name: CreateNotification :exec
+INSERT INTO notifications (user_id, event, app_id, title, message, created_at)
+VALUES (sqlc.arg(user_id), sqlc.arg(event), sqlc.arg(app_id), sqlc.arg(title), sqlc.arg(message), sqlc.arg(created_at));
+
+-- name: ListNotifications :many
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg(user_id) AND (NOT sqlc.arg(unread_only) OR NOT read)
+ORDER BY id DESC
+LIMIT sqlc.arg(limit);
+
+-- name: CountUnreadNotifications :one
+SELECT count(*) FROM notifications
+WHERE user_id = sqlc.arg(user_id) AND NOT read;
+
+-- name: MarkNotificationRead :execrows
+UPDATE notifications SET read = true
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id);
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications SET read = true
+WHERE user_id = sqlc.arg(user_id);
+
+-- name: DeleteNotification :execrows
+DELETE FROM notifications
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id);
+
+-- name: DeleteOldNotifications :exec
+DELETE FROM notifications
+WHERE created_at < sqlc.arg(before);
+
+-- name: DeleteUserNotifications :exec
+DELETE FROM notifications
+WHERE user_id = sqlc.arg(user_id);
+
+-- name: GetNotificationSubscriptions :many
+SELECT * FROM notification_subscriptions
+WHERE user_id = sqlc.arg(user_id)
+ORDER BY event, channel;
+
+-- name: SetNotificationSubscription :exec
+INSERT INTO notification_subscriptions (user_id, event, channel, enabled)
+VALUES (sqlc.arg(user_id), sqlc.arg(event), sqlc.arg(channel), sqlc.arg(enabled))
+ON CONFLICT (user_id, event, channel) DO UPDATE SET
+    enabled = excluded.enabled;
+
+-- name: DeleteNotificationSubscriptions :exec
+DELETE FROM notification_subscriptions
+WHERE user_id = sqlc.arg(user_id);
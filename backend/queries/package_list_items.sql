@@ -12,8 +12,8 @@ INSERT OR IGNORE INTO package_categories (category)
 VALUES (sqlc.arg(category));
 
 -- name: writePackageListItem :exec
-INSERT OR REPLACE INTO package_list_items (id, name, version, author, description, image_url)
-VALUES (sqlc.arg(id), sqlc.arg(name), sqlc.arg(version), sqlc.arg(author), sqlc.arg(description), sqlc.arg(image_url));
+INSERT OR REPLACE INTO package_list_items (id, name, version, author, description, image_url, store)
+VALUES (sqlc.arg(id), sqlc.arg(name), sqlc.arg(version), sqlc.arg(author), sqlc.arg(description), sqlc.arg(image_url), sqlc.arg(store));
 
 -- name: addPackageCategoryDefinition :exec
 INSERT OR IGNORE INTO package_category_definitions (category, package_id)
@@ -23,6 +23,14 @@ VALUES (sqlc.arg(category), sqlc.arg(package_id));
 SELECT category FROM package_category_definitions
 WHERE package_id = sqlc.arg(package_id);
 
+-- name: deleteStorePackages :exec
+DELETE FROM package_list_items
+WHERE store = sqlc.arg(store);
+
+-- name: deleteStoreCategoryDefinitions :exec
+DELETE FROM package_category_definitions
+WHERE package_id IN (SELECT id FROM package_list_items WHERE store = sqlc.arg(store));
+
 -- name: deletePackageCategoryDefinitions :exec
 DELETE FROM package_category_definitions
 WHERE package_id = sqlc.arg(package_id);
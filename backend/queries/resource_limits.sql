@@ -0,0 +1,13 @@
+-- name: GetResourceLimits :many
+SELECT * FROM resource_limits
+WHERE app_id = sqlc.arg(app_id)
+ORDER BY container;
+
+-- name: SetResourceLimit :exec
+INSERT INTO resource_limits (app_id, container, memory, cpus, pids)
+VALUES (sqlc.arg(app_id), sqlc.arg(container), sqlc.arg(memory), sqlc.arg(cpus), sqlc.arg(pids))
+ON CONFLICT (app_id, container) DO UPDATE SET memory = excluded.memory, cpus = excluded.cpus, pids = excluded.pids;
+
+-- name: DeleteResourceLimits :exec
+DELETE FROM resource_limits
+WHERE app_id = sqlc.arg(app_id);
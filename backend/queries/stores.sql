@@ -0,0 +1,11 @@
+-- name: GetStores :many
+SELECT * FROM stores
+ORDER BY priority DESC, name;
+
+-- name: CreateStore :exec
+INSERT INTO stores (name, url, priority, public_key)
+VALUES (sqlc.arg(name), sqlc.arg(url), sqlc.arg(priority), sqlc.arg(public_key));
+
+-- name: DeleteStore :execresult
+DELETE FROM stores
+WHERE name = sqlc.arg(name);
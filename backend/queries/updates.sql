@@ -0,0 +1,37 @@
+-- name: GetUpdateSettings :one
+SELECT * FROM update_settings
+WHERE id = 1;
+
+-- name: SetUpdateSettings :exec
+UPDATE update_settings SET window_start = sqlc.arg(window_start), window_end = sqlc.arg(window_end)
+WHERE id = 1;
+
+-- name: AddUpdateHistory :exec
+INSERT INTO update_history (app_id, from_version, to_version, automatic, status, error, created_at)
+VALUES (sqlc.arg(app_id), sqlc.arg(from_version), sqlc.arg(to_version), sqlc.arg(automatic), sqlc.arg(status), sqlc.arg(error), unixepoch());
+
+-- name: GetUpdateHistory :many
+SELECT * FROM update_history
+WHERE app_id = sqlc.arg(app_id)
+ORDER BY id DESC
+LIMIT sqlc.arg(limit);
+
+-- name: HasFailedUpdate :one
+SELECT CAST(EXISTS(
+    SELECT 1 FROM update_history
+    WHERE app_id = sqlc.arg(app_id) AND to_version = sqlc.arg(to_version) AND status != 'completed'
+) AS BOOLEAN) AS failed;
+
+-- name: GetNotifiedUpdate :one
+SELECT version FROM update_notifications
+WHERE app_id = sqlc.arg(app_id);
+
+-- name: SetNotifiedUpdate :exec
+INSERT INTO update_notifications (app_id, version)
+VALUES (sqlc.arg(app_id), sqlc.arg(version))
+ON CONFLICT (app_id) DO UPDATE SET
+    version = excluded.version;
+
+-- name: DeleteNotifiedUpdate :exec
+DELETE FROM update_notifications
+WHERE app_id = sqlc.arg(app_id);
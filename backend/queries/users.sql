@@ -2,10 +2,19 @@
 INSERT INTO user_options (user_id, completed_welcome)
 VALUES (sqlc.arg(user_id), false);
 
+-- name: GetUnencryptedWebhookTokens :many
+SELECT * FROM user_options WHERE webhook_token != '' AND NOT webhook_token_encrypted;
+
 -- name: GetUserOptions :one
 SELECT * FROM user_options WHERE user_id = sqlc.arg(user_id);
 
 -- name: UpdateUserOptions :exec
 UPDATE user_options
 SET completed_welcome = coalesce(sqlc.narg(completed_welcome), completed_welcome)
-WHERE user_id = sqlc.arg(user_id);
\ No newline at end of file
+WHERE user_id = sqlc.arg(user_id);
+
+-- name: SetUserWebhook :exec
+UPDATE user_options
+SET webhook_url = sqlc.arg(webhook_url), webhook_format = sqlc.arg(webhook_format), webhook_token = sqlc.arg(webhook_token),
+    webhook_token_encrypted = sqlc.arg(webhook_token_encrypted)
+WHERE user_id = sqlc.arg(user_id);
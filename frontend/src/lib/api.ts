@@ -1,12 +1,16 @@
 import type {
-	ExternalStorage,
+	ExternalStorage, BackupTarget, BackupSchedule, BackupScheduleRequest, BackupHistory,
 	HomecloudApp,
 	InviteCode,
-	PackageListItem, RecoveryCode,
+	Job,
+	PackageListItem, PackageStore, RecoveryCode, ContainerLimits, ResourceLimits, AppSetting,
+	LogLine, LogFilters, AppMetrics, MetricsRange, SystemMetrics, Drift, RepairAction,
+	NotificationList, NotificationSettings, UpdateNotificationSettings,
 	SearchParams, StoreHome,
-	UpdateCheckResponse, UpdateUserOptions,
+	UpdateAppsResponse, UpdateCheckResponse, UpdatePolicy, UpdateUserOptions,
 	User, UserOptions
 } from '$lib/models';
+import { JobStatus } from '$lib/models';
 import { goto } from '$app/navigation';
 
 export const getApps = async (): Promise<HomecloudApp[]> => {
@@ -39,12 +43,27 @@ export const getPackage = async (id: string): Promise<PackageListItem> => {
 	return await response.json() as PackageListItem;
 }
 
-export const installPackage = async (id: string): Promise<void> => {
+export const installPackage = async (id: string, onProgress?: (job: Job) => void): Promise<void> => {
 	const response = await fetch(`/api/v1/packages/${id}/install`, { method: 'POST' });
 	if (!response.ok) {
 		await CheckAuthRedirect(response);
 		throw new Error(response.statusText);
 	}
+
+	await waitForJob(await response.json() as Job, onProgress);
+}
+
+// Installs an app from a package bundle, for apps that aren't available from any store
+export const sideloadApp = async (bundle: File, onProgress?: (job: Job) => void): Promise<void> => {
+	const body = new FormData();
+	body.append('bundle', bundle);
+	const response = await fetch('/api/v1/apps/sideload', { method: 'POST', body: body });
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+
+	await waitForJob(await response.json() as Job, onProgress);
 }
 
 export const uninstallApp = async (id: string): Promise<void> => {
@@ -115,26 +134,203 @@ export const listBackups = async (externalStorage: string, appId: string): Promi
 	return await response.json() as string[];
 }
 
-export const backupApp = async (externalStorage: string, appId: string): Promise<void> => {
+export const backupApp = async (externalStorage: string, appId: string, passphrase: string): Promise<void> => {
 	const response = await fetch(`/api/v1/apps/${appId}/backup`, {
 		method: 'POST',
-		body: JSON.stringify({ target_device: externalStorage }),
+		body: JSON.stringify({ target_device: externalStorage, passphrase: passphrase }),
 		headers: { 'Content-Type': 'application/json' },
 	});
 	if (!response.ok) {
 		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+
+	await waitForJob(await response.json() as Job);
+}
+
+export const backupSystem = async (externalStorage: string, passphrase: string): Promise<void> => {
+	const response = await fetch('/api/v1/backup/system', {
+		method: 'POST',
+		body: JSON.stringify({ target_device: externalStorage, passphrase: passphrase }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
 	}
+
+	await waitForJob(await response.json() as Job);
 }
 
-export const restoreBackup = async (externalStorage: string, appId: string, backup: string): Promise<void> => {
+export const restoreBackup = async (externalStorage: string, appId: string, backup: string, passphrase: string): Promise<void> => {
 	const response = await fetch(`/api/v1/apps/${appId}/restore`, {
 		method: 'POST',
-		body: JSON.stringify({ target_device: externalStorage, backup: backup }),
+		body: JSON.stringify({ target_device: externalStorage, backup: backup, passphrase: passphrase }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+
+	await waitForJob(await response.json() as Job);
+}
+
+export const verifyBackup = async (externalStorage: string, appId: string, backup: string, passphrase: string): Promise<void> => {
+	const response = await fetch(`/api/v1/apps/${appId}/backups/${backup}/verify`, {
+		method: 'POST',
+		body: JSON.stringify({ target_device: externalStorage, passphrase: passphrase }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+
+	await waitForJob(await response.json() as Job);
+}
+
+export const testRestoreBackup = async (externalStorage: string, appId: string, backup: string, passphrase: string): Promise<void> => {
+	const response = await fetch(`/api/v1/apps/${appId}/backups/${backup}/test-restore`, {
+		method: 'POST',
+		body: JSON.stringify({ target_device: externalStorage, passphrase: passphrase }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+
+	await waitForJob(await response.json() as Job);
+}
+
+export const listBackupTargets = async (): Promise<BackupTarget[]> => {
+	const response = await fetch('/api/v1/backup/targets');
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as BackupTarget[];
+}
+
+export const createBackupTarget = async (target: BackupTarget): Promise<BackupTarget> => {
+	const response = await fetch('/api/v1/backup/targets', {
+		method: 'POST',
+		body: JSON.stringify(target),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as BackupTarget;
+}
+
+export const updateBackupTarget = async (target: BackupTarget): Promise<BackupTarget> => {
+	const response = await fetch(`/api/v1/backup/targets/${target.name}`, {
+		method: 'PUT',
+		body: JSON.stringify(target),
 		headers: { 'Content-Type': 'application/json' },
 	});
 	if (!response.ok) {
 		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
 	}
+	return await response.json() as BackupTarget;
+}
+
+export const deleteBackupTarget = async (name: string): Promise<void> => {
+	const response = await fetch(`/api/v1/backup/targets/${name}`, { method: 'DELETE' });
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const testBackupTarget = async (name: string): Promise<void> => {
+	const response = await fetch(`/api/v1/backup/targets/${name}/test`, { method: 'POST' });
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const checkBackupTarget = async (name: string, readData: boolean): Promise<void> => {
+	const response = await fetch(`/api/v1/backup/targets/${name}/check`, {
+		method: 'POST',
+		body: JSON.stringify({ read_data: readData }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+
+	await waitForJob(await response.json() as Job);
+}
+
+export const listBackupSchedules = async (): Promise<BackupSchedule[]> => {
+	const response = await fetch('/api/v1/backup/schedules');
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as BackupSchedule[];
+}
+
+export const createBackupSchedule = async (schedule: BackupScheduleRequest): Promise<BackupSchedule> => {
+	const response = await fetch('/api/v1/backup/schedules', {
+		method: 'POST',
+		body: JSON.stringify(schedule),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as BackupSchedule;
+}
+
+export const updateBackupSchedule = async (id: number, schedule: BackupScheduleRequest): Promise<BackupSchedule> => {
+	const response = await fetch(`/api/v1/backup/schedules/${id}`, {
+		method: 'PUT',
+		body: JSON.stringify(schedule),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as BackupSchedule;
+}
+
+export const deleteBackupSchedule = async (id: number): Promise<void> => {
+	const response = await fetch(`/api/v1/backup/schedules/${id}`, { method: 'DELETE' });
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const runBackupSchedule = async (id: number): Promise<void> => {
+	const response = await fetch(`/api/v1/backup/schedules/${id}/run`, { method: 'POST' });
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const getBackupHistory = async (filters: { app_id?: string, schedule_id?: number, limit?: number } = {}): Promise<BackupHistory[]> => {
+	const params = new URLSearchParams();
+	Object.entries(filters).forEach(([key, value]) => {
+		if (value !== undefined) params.set(key, String(value));
+	});
+	const response = await fetch('/api/v1/backup/history?' + params);
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as BackupHistory[];
 }
 
 export const getUserOptions = async (): Promise<UserOptions> => {
@@ -188,7 +384,281 @@ export const updateAppsRequest = async () => {
 	const response = await fetch('/api/v1/apps/update', { method: 'POST' });
 	if (!response.ok) {
 		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+
+	// Updates which started are waited for even if others couldn't be started
+	const result = await response.json() as UpdateAppsResponse;
+	await Promise.all(result.jobs.map(job => waitForJob(job)));
+	if (result.errors.length !== 0) {
+		throw new Error(result.errors.map(error => `${error.app_id}: ${error.error}`).join('\n'));
+	}
+}
+
+export const setUpdatePolicy = async (appId: string, policy: UpdatePolicy): Promise<void> => {
+	const response = await fetch(`/api/v1/apps/${appId}/update_policy`, {
+		method: 'PUT',
+		body: JSON.stringify({ update_policy: policy }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const getPackageVersions = async (id: string): Promise<string[]> => {
+	const response = await fetch(`/api/v1/packages/${id}/versions`);
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as string[];
+}
+
+export const changeAppVersion = async (appId: string, version: string, pin: boolean, onProgress?: (job: Job) => void): Promise<void> => {
+	const response = await fetch(`/api/v1/apps/${appId}/version`, {
+		method: 'POST',
+		body: JSON.stringify({ version: version, pin: pin }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+
+	await waitForJob(await response.json() as Job, onProgress);
+}
+
+export const setAppPinned = async (appId: string, pinned: boolean): Promise<void> => {
+	const response = await fetch(`/api/v1/apps/${appId}/pin`, {
+		method: 'PUT',
+		body: JSON.stringify({ pinned: pinned }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const getAppLimits = async (appId: string): Promise<ContainerLimits[]> => {
+	const response = await fetch(`/api/v1/apps/${appId}/limits`);
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as ContainerLimits[];
+}
+
+export const setAppLimits = async (appId: string, limits: ({ container: string } & ResourceLimits)[]): Promise<void> => {
+	const response = await fetch(`/api/v1/apps/${appId}/limits`, {
+		method: 'PUT',
+		body: JSON.stringify(limits),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+const logParams = (filters: LogFilters): URLSearchParams => {
+	const params = new URLSearchParams();
+	filters.containers?.forEach(container => params.append('container', container));
+	if (filters.since) params.set('since', filters.since);
+	if (filters.until) params.set('until', filters.until);
+	if (filters.tail) params.set('tail', filters.tail);
+	return params;
+}
+
+export const getAppLogs = async (appId: string, filters: LogFilters = {}): Promise<LogLine[]> => {
+	const response = await fetch(`/api/v1/apps/${appId}/logs?${logParams(filters)}`);
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as LogLine[];
+}
+
+// Follows the logs of an app, calling onLine for each line as it's written. Returns a function to stop following
+export const followAppLogs = (appId: string, onLine: (line: LogLine) => void, filters: LogFilters = {}): () => void => {
+	const events = new EventSource(`/api/v1/apps/${appId}/logs/events?${logParams(filters)}`);
+	events.onmessage = (event) => onLine(JSON.parse(event.data) as LogLine);
+	return () => events.close();
+}
+
+export const appLogsDownloadUrl = (appId: string, filters: LogFilters = {}): string => {
+	return `/api/v1/apps/${appId}/logs/download?${logParams(filters)}`;
+}
+
+export const getAppMetrics = async (appId: string, range: MetricsRange = 'day'): Promise<AppMetrics> => {
+	const response = await fetch(`/api/v1/apps/${appId}/metrics?range=${range}`);
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as AppMetrics;
+}
+
+export const getSystemMetrics = async (): Promise<SystemMetrics> => {
+	const response = await fetch('/api/v1/system/metrics');
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as SystemMetrics;
+}
+
+export const getNotifications = async (unread: boolean = false, limit: number = 50): Promise<NotificationList> => {
+	const response = await fetch(`/api/v1/notifications?unread=${unread}&limit=${limit}`);
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
 	}
+	return await response.json() as NotificationList;
+}
+
+export const readNotification = async (id: number): Promise<void> => {
+	const response = await fetch(`/api/v1/notifications/${id}/read`, { method: 'POST' });
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const readAllNotifications = async (): Promise<void> => {
+	const response = await fetch('/api/v1/notifications/read', { method: 'POST' });
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const deleteNotification = async (id: number): Promise<void> => {
+	const response = await fetch(`/api/v1/notifications/${id}`, { method: 'DELETE' });
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const getNotificationSettings = async (): Promise<NotificationSettings> => {
+	const response = await fetch('/api/v1/account/notifications');
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as NotificationSettings;
+}
+
+export const updateNotificationSettings = async (settings: UpdateNotificationSettings): Promise<void> => {
+	const response = await fetch('/api/v1/account/notifications', {
+		method: 'PUT',
+		body: JSON.stringify(settings),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const getDrift = async (): Promise<Drift[]> => {
+	const response = await fetch('/api/v1/system/drift');
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as Drift[];
+}
+
+export const repairDrift = async (drift: Drift, action: RepairAction, onProgress?: (job: Job) => void): Promise<void> => {
+	const response = await fetch('/api/v1/system/drift/repair', {
+		method: 'POST',
+		body: JSON.stringify({ kind: drift.kind, app_id: drift.app_id, resource: drift.resource, action }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+
+	await waitForJob(await response.json() as Job, onProgress);
+}
+
+export const getAppSettings = async (appId: string): Promise<AppSetting[]> => {
+	const response = await fetch(`/api/v1/apps/${appId}/settings`);
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as AppSetting[];
+}
+
+// Values set to null reset the setting to its default
+export const setAppSettings = async (appId: string, settings: Record<string, string | null>, onProgress?: (job: Job) => void): Promise<void> => {
+	const response = await fetch(`/api/v1/apps/${appId}/settings`, {
+		method: 'PUT',
+		body: JSON.stringify(settings),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	await waitForJob(await response.json() as Job, onProgress);
+}
+
+export const getStores = async (): Promise<PackageStore[]> => {
+	const response = await fetch('/api/v1/stores');
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+	return await response.json() as PackageStore[];
+}
+
+export const addStore = async (store: PackageStore): Promise<void> => {
+	const response = await fetch('/api/v1/stores', {
+		method: 'POST',
+		body: JSON.stringify(store),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+export const deleteStore = async (name: string): Promise<void> => {
+	const response = await fetch(`/api/v1/stores/${name}`, { method: 'DELETE' });
+	if (!response.ok) {
+		await CheckAuthRedirect(response);
+		throw new Error(response.statusText);
+	}
+}
+
+// Waits for a background job to finish, calling onProgress with each update to it
+export const waitForJob = (job: Job, onProgress?: (job: Job) => void): Promise<Job> => {
+	return new Promise((resolve, reject) => {
+		const events = new EventSource(`/api/v1/jobs/${job.id}/events`);
+		events.onmessage = (event) => {
+			const update = JSON.parse(event.data) as Job;
+			onProgress?.(update);
+			if (update.status === JobStatus.Completed) {
+				events.close();
+				resolve(update);
+			} else if (update.status === JobStatus.Failed || update.status === JobStatus.RolledBack) {
+				events.close();
+				reject(new Error(update.error));
+			}
+		};
+		events.onerror = () => {
+			events.close();
+			reject(new Error('Lost connection to job'));
+		};
+	});
 }
 
 export const CheckAuthRedirect = async (response: Response) => {
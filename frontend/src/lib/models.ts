@@ -6,6 +6,18 @@ export type HomecloudApp = {
 	description: string
 	image_url: string
 	status: AppStatus
+	state: AppState
+	state_message: string
+	update_policy: UpdatePolicy
+	pinned: boolean
+	sideloaded: boolean
+}
+
+export enum UpdatePolicy {
+	Manual = "manual",
+	Notify = "notify",
+	AutoPatch = "auto-patch",
+	AutoMinor = "auto-minor"
 }
 
 export enum AppStatus {
@@ -17,6 +29,16 @@ export enum AppStatus {
 	Dead = "dead"
 }
 
+// The observed state of an app's containers, while status is whether the app should be running
+export enum AppState {
+	Running = "running",
+	Starting = "starting",
+	Restarting = "restarting",
+	Degraded = "degraded",
+	Crashed = "crashed",
+	Stopped = "stopped"
+}
+
 export type PackageListItem = {
 	id: string
 	name: string
@@ -25,9 +47,103 @@ export type PackageListItem = {
 	description: string
 	categories:  string[]
 	image_url: string
+	store: string
 	installed: boolean
 }
 
+export type ResourceLimits = {
+	memory: string
+	cpus: number
+	pids: number
+}
+
+export type ContainerLimits = {
+	container: string
+	package: ResourceLimits | null
+	override: ResourceLimits | null
+}
+
+export type LogLine = {
+	container: string
+	stream: 'stdout' | 'stderr'
+	time: string
+	text: string
+}
+
+export type LogFilters = {
+	containers?: string[]
+	since?: string
+	until?: string
+	tail?: string
+}
+
+export type ResourceUsage = {
+	cpu_percent: number
+	memory_bytes: number
+	network_rx: number
+	network_tx: number
+	block_read: number
+	block_write: number
+}
+
+export type MetricsSample = ResourceUsage & {
+	app_id: string
+	time: string
+}
+
+export type MetricsRange = 'hour' | 'day' | 'week' | 'month' | 'year'
+
+export type AppMetrics = {
+	current: MetricsSample | null
+	history: MetricsSample[]
+}
+
+export type AppUsageSummary = {
+	app_id: string
+	usage: ResourceUsage
+	volumes_size: number
+	data_size: number
+}
+
+export type SystemMetrics = {
+	apps: AppUsageSummary[]
+	total: ResourceUsage
+	volumes: { name: string, app_id: string, size: number }[]
+	images_size: number
+	disk: { total: number, free: number }
+}
+
+export type DriftKind = 'missing_containers' | 'unexpected_container' | 'missing_network' | 'missing_oauth_client'
+	| 'orphaned_containers' | 'orphaned_network' | 'orphaned_volume' | 'orphaned_oauth_client'
+
+export type RepairAction = 'reinstall' | 'adopt' | 'remove'
+
+export type Drift = {
+	kind: DriftKind
+	app_id: string
+	resource: string
+	message: string
+	actions: RepairAction[]
+}
+
+export type SettingType = 'string' | 'number' | 'boolean' | 'secret'
+
+export type AppSetting = {
+	key: string
+	type: SettingType
+	default: string
+	description: string
+	value: string
+	set: boolean
+}
+
+export type PackageStore = {
+	name: string
+	url: string
+	priority: number
+	public_key: string
+}
+
 export type SearchParams = {
 	q?: string
 	category?: string
@@ -61,6 +177,70 @@ export type ExternalStorage = {
 	available: number,
 }
 
+export type BackupTargetType = 'local' | 'drive' | 'sftp' | 's3'
+
+export type BackupTarget = {
+	name: string,
+	type: BackupTargetType,
+	passphrase?: string,
+	local?: { path: string },
+	drive?: { device: string },
+	sftp?: {
+		host: string,
+		port?: number,
+		username: string,
+		password?: string,
+		private_key?: string,
+		host_key: string,
+		path: string,
+	},
+	s3?: {
+		endpoint: string,
+		region?: string,
+		bucket: string,
+		prefix?: string,
+		access_key: string,
+		secret_key?: string,
+		path_style?: boolean,
+	},
+}
+
+export type BackupSchedule = {
+	id: number,
+	app_id: string,
+	cron: string,
+	target: string,
+	keep_daily: number,
+	keep_weekly: number,
+	keep_monthly: number,
+	enabled: boolean,
+	test_restore: boolean,
+	last_run_at: number,
+	created_at: number,
+}
+
+export type BackupScheduleRequest = Omit<BackupSchedule, 'id' | 'last_run_at' | 'created_at'>
+
+export type BackupStatus = 'running' | 'completed' | 'failed'
+
+export type BackupHistory = {
+	id: number,
+	schedule_id: number,
+	app_id: string,
+	target: string,
+	snapshot: string,
+	status: BackupStatus,
+	error: string,
+	size: number,
+	pruned: boolean,
+	started_at: number,
+	finished_at: number,
+	verified_at: number,
+	verify_error: string,
+	restore_tested_at: number,
+	restore_test_error: string,
+}
+
 export enum UserRoles {
 	User = 'user',
 	Admin = 'admin',
@@ -69,13 +249,61 @@ export enum UserRoles {
 export type UserOptions = {
 	user_id: string,
 	user_roles: UserRoles[],
-	completed_welcome: boolean
+	completed_welcome: boolean,
+	webhook_url: string,
+	webhook_format: WebhookFormat,
+	webhook_token: string,
 }
 
 export type UpdateUserOptions = {
 	completed_welcome?: boolean;
 }
 
+export type NotificationEvent = 'app_crashed' | 'update_available' | 'update_failed' | 'backup_failed'
+	| 'disk_nearly_full' | 'certificate_expiring' | 'user_registered'
+
+export type WebhookFormat = 'generic' | 'ntfy' | 'gotify'
+
+export type Notification = {
+	id: number,
+	user_id: string,
+	event: NotificationEvent,
+	app_id: string,
+	title: string,
+	message: string,
+	read: boolean,
+	created_at: number,
+}
+
+export type NotificationList = {
+	notifications: Notification[],
+	unread: number,
+}
+
+export type NotificationSubscription = {
+	event: NotificationEvent,
+	channel: string,
+	enabled: boolean,
+}
+
+export type NotificationWebhook = {
+	url: string,
+	format: WebhookFormat,
+	token: string,
+}
+
+export type NotificationSettings = {
+	events: NotificationEvent[],
+	channels: { name: string, available: boolean }[],
+	subscriptions: NotificationSubscription[],
+	webhook: NotificationWebhook,
+}
+
+export type UpdateNotificationSettings = {
+	subscriptions?: NotificationSubscription[],
+	webhook?: NotificationWebhook,
+}
+
 export type StoreHome = {
 	popular_categories: string[],
 	new_apps: PackageListItem[],
@@ -85,4 +313,46 @@ export type RecoveryCode = {
 	expires_at: string,
 	recovery_code: string,
 	recovery_link: string
-}
\ No newline at end of file
+}
+export enum JobStatus {
+	Pending = "pending",
+	Running = "running",
+	Completed = "completed",
+	Failed = "failed",
+	RolledBack = "rolled_back",
+}
+
+export type JobStep = {
+	name: string,
+	status: JobStatus,
+	error?: string,
+}
+
+export type LayerProgress = {
+	image: string,
+	status: string,
+	current: number,
+	total: number,
+}
+
+export type Job = {
+	id: string,
+	type: string,
+	app_id: string,
+	status: JobStatus,
+	steps: JobStep[],
+	progress: Record<string, LayerProgress>,
+	error: string,
+	created_at: number,
+	updated_at: number,
+}
+
+export type UpdateAppError = {
+	app_id: string,
+	error: string,
+}
+
+export type UpdateAppsResponse = {
+	jobs: Job[],
+	errors: UpdateAppError[],
+}
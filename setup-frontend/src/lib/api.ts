@@ -30,4 +30,61 @@ export const getCurrentSubdomain = async (): Promise<string> => {
 	}
 	const body = await response.json() as { subdomain: string };
 	return body.subdomain;
-}
\ No newline at end of file
+}
+
+export interface DriveInfo {
+	name: string;
+	label: string;
+	size: number;
+	available: number;
+}
+
+export const listRestoreDevices = async (): Promise<DriveInfo[]> => {
+	const response = await fetch('/api/v1/restore/devices');
+	if (!response.ok) {
+		throw new Error(response.statusText);
+	}
+	return await response.json() as DriveInfo[];
+}
+
+export const listSystemBackups = async (device: string): Promise<string[]> => {
+	const response = await fetch('/api/v1/restore/backups?' + new URLSearchParams({ device: device }));
+	if (!response.ok) {
+		throw new Error(response.statusText);
+	}
+	return await response.json() as string[];
+}
+
+export interface RestoreStep {
+	name: string;
+	status: 'running' | 'completed' | 'failed';
+	error?: string;
+}
+
+export interface RestoreStatus {
+	status: '' | 'running' | 'completed' | 'failed';
+	steps: RestoreStep[];
+	apps: string[];
+	error?: string;
+}
+
+export const restoreSystem = async (device: string, passphrase: string, backup: string): Promise<RestoreStatus> => {
+	const response = await fetch('/api/v1/restore', {
+		method: 'POST',
+		body: JSON.stringify({ device: device, passphrase: passphrase, backup: backup }),
+		headers: { 'Content-Type': 'application/json' },
+	});
+	if (!response.ok) {
+		const body = await response.json() as { message: string };
+		throw new Error(body.message);
+	}
+	return await response.json() as RestoreStatus;
+}
+
+export const getRestoreStatus = async (): Promise<RestoreStatus> => {
+	const response = await fetch('/api/v1/restore');
+	if (!response.ok) {
+		throw new Error(response.statusText);
+	}
+	return await response.json() as RestoreStatus;
+}